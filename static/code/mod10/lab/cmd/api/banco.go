@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"go.uber.org/zap"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// banco reúne os repositórios abertos por abrirRepositorio.
+type banco struct {
+	produtos   repo.RepositorioProdutos
+	categorias repo.RepositorioCategorias
+	estoque    repo.RepositorioEstoque
+	pedidos    repo.RepositorioPedidos
+	variantes  repo.RepositorioVariantes
+	precos     repo.RepositorioPrecos
+	imagens    repo.RepositorioImagens
+	transacoes repo.UnidadeDeTrabalho
+	// db é a conexão usada pelo relay da outbox; nil fora dos bancos SQL.
+	db *gorm.DB
+}
+
+// abrirRepositorio conecta ao banco escolhido pela variável BANCO, aplica as
+// migrações e devolve os repositórios de produtos, categorias, estoque,
+// pedidos, variantes, preços e imagens, a unidade de trabalho que combina os dois
+// primeiros e, nos bancos SQL, a conexão usada pelo relay da outbox.
+//
+//   - BANCO=postgres (padrão): usa POSTGRES_HOST (padrão "postgres").
+//   - BANCO=pgx: o mesmo PostgreSQL, via database/sql sem GORM.
+//   - BANCO=sqlite: usa o arquivo SQLITE_ARQUIVO (padrão "produtos.db"),
+//     dispensando o contêiner do PostgreSQL.
+//   - BANCO=memoria: mantém os produtos em memória, gravando log e snapshots
+//     em MEMORIA_DIRETORIO; sem o diretório, tudo se perde ao reiniciar.
+//
+// NOME_UNICO escolhe se os nomes de produtos são únicos no tenant inteiro
+// ("tenant", padrão) ou só dentro de cada categoria ("categoria").
+func abrirRepositorio(logger *zap.Logger) (banco, error) {
+	opcoes := repo.OpcoesRepositorio{EscopoNome: repo.EscopoNome(variavel("NOME_UNICO", string(repo.NomeUnicoNoTenant)))}
+	if err := repo.ValidarEscopoNome(opcoes.EscopoNome); err != nil {
+		return banco{}, fmt.Errorf("NOME_UNICO: %w", err)
+	}
+
+	switch nome := variavel("BANCO", "postgres"); nome {
+	case "postgres":
+		return abrirPostgres(variavel("POSTGRES_HOST", "postgres"), opcoes, logger)
+	case "pgx":
+		return abrirPgx(variavel("POSTGRES_HOST", "postgres"), opcoes, logger)
+	case "sqlite":
+		return abrirSQLite(variavel("SQLITE_ARQUIVO", "produtos.db"), opcoes, logger)
+	case "memoria":
+		return abrirMemoria(os.Getenv("MEMORIA_DIRETORIO"), opcoes)
+	default:
+		return banco{}, fmt.Errorf("banco %q desconhecido: use postgres, pgx, sqlite ou memoria", nome)
+	}
+}
+
+func abrirPostgres(host string, opcoes repo.OpcoesRepositorio, logger *zap.Logger) (banco, error) {
+	if err := migrarPostgres(host, logger); err != nil {
+		return banco{}, err
+	}
+
+	// Conectar ao banco
+	db, err := gorm.Open(postgres.Open(dsnPostgres(host)), &gorm.Config{})
+	if err != nil {
+		return banco{}, fmt.Errorf("conectar ao banco: %w", err)
+	}
+	if err := repo.PreencherNomesNormalizados(context.Background(), db); err != nil {
+		return banco{}, err
+	}
+	repositorio := repo.NovoPostgresRepositorio(db, opcoes, logger)
+	return banco{
+		produtos:   repositorio,
+		categorias: repositorio,
+		estoque:    repositorio,
+		pedidos:    repositorio,
+		variantes:  repositorio,
+		precos:     repositorio,
+		imagens:    repositorio,
+		transacoes: repo.NovaUnidadeDeTrabalhoPostgres(db, opcoes, logger),
+		db:         db,
+	}, nil
+}
+
+func abrirPgx(host string, opcoes repo.OpcoesRepositorio, logger *zap.Logger) (banco, error) {
+	if err := migrarPostgres(host, logger); err != nil {
+		return banco{}, err
+	}
+
+	// Conectar ao banco e preparar as instruções
+	db, err := sql.Open("pgx", dsnPostgres(host))
+	if err != nil {
+		return banco{}, fmt.Errorf("conectar ao banco: %w", err)
+	}
+	repositorio, err := repo.NovoPgxRepositorio(context.Background(), db, opcoes, logger)
+	if err != nil {
+		return banco{}, err
+	}
+
+	// O relay da outbox e o preenchimento dos nomes normalizados usam o GORM
+	// sobre a mesma conexão
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	if err != nil {
+		return banco{}, fmt.Errorf("conectar ao banco: %w", err)
+	}
+	if err := repo.PreencherNomesNormalizados(context.Background(), gormDB); err != nil {
+		return banco{}, err
+	}
+	return banco{
+		produtos:   repositorio,
+		categorias: repositorio,
+		estoque:    repositorio,
+		pedidos:    repositorio,
+		variantes:  repositorio,
+		precos:     repositorio,
+		imagens:    repositorio,
+		transacoes: repo.NovaUnidadeDeTrabalhoPgx(repositorio, logger),
+		db:         gormDB,
+	}, nil
+}
+
+func migrarPostgres(host string, logger *zap.Logger) error {
+	m, err := migrate.New(
+		"file://migrations",
+		fmt.Sprintf("postgres://postgres:secret@%s:5432/mydb?sslmode=disable", host),
+	)
+	if err != nil {
+		return fmt.Errorf("inicializar migrações: %w", err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("aplicar migrações: %w", err)
+	}
+	logger.Info("Migrações aplicadas")
+	return nil
+}
+
+func dsnPostgres(host string) string {
+	return fmt.Sprintf("host=%s user=postgres password=secret dbname=mydb port=5432 sslmode=disable", host)
+}
+
+func abrirSQLite(arquivo string, opcoes repo.OpcoesRepositorio, logger *zap.Logger) (banco, error) {
+	db, err := gorm.Open(sqlite.Open(arquivo+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"), &gorm.Config{})
+	if err != nil {
+		return banco{}, fmt.Errorf("abrir sqlite %s: %w", arquivo, err)
+	}
+
+	// O SQLite aceita um escritor por vez; uma única conexão evita SQLITE_BUSY
+	sqlDB, err := db.DB()
+	if err != nil {
+		return banco{}, fmt.Errorf("abrir sqlite %s: %w", arquivo, err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := repo.MigrarSQLite(context.Background(), db, os.DirFS("migrations/sqlite")); err != nil {
+		return banco{}, err
+	}
+	if err := repo.PreencherNomesNormalizados(context.Background(), db); err != nil {
+		return banco{}, err
+	}
+	logger.Info("Migrações aplicadas", zap.String("sqlite", arquivo))
+
+	repositorio := repo.NovoSQLiteRepositorio(db, opcoes, logger)
+	return banco{
+		produtos:   repositorio,
+		categorias: repositorio,
+		estoque:    repositorio,
+		pedidos:    repositorio,
+		variantes:  repositorio,
+		precos:     repositorio,
+		imagens:    repositorio,
+		transacoes: repo.NovaUnidadeDeTrabalhoSQLite(db, opcoes, logger),
+		db:         db,
+	}, nil
+}
+
+func abrirMemoria(diretorio string, opcoes repo.OpcoesRepositorio) (banco, error) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	var repositorio *repo.RepositorioEmMemoria
+	if diretorio == "" {
+		repositorio = repo.NovoRepositorioEmMemoria(opcoes, logger)
+	} else {
+		var err error
+		repositorio, err = repo.AbrirRepositorioEmMemoria(repo.OpcoesPersistencia{Diretorio: diretorio, OpcoesRepositorio: opcoes}, logger)
+		if err != nil {
+			return banco{}, err
+		}
+	}
+	return banco{
+		produtos:   repositorio,
+		categorias: repositorio,
+		estoque:    repositorio,
+		pedidos:    repositorio,
+		variantes:  repositorio,
+		precos:     repositorio,
+		imagens:    repositorio,
+		transacoes: repo.NovaUnidadeDeTrabalhoEmMemoria(repositorio, logger),
+	}, nil
+}
+
+// variavel lê uma variável de ambiente, usando padrao quando ausente.
+func variavel(nome, padrao string) string {
+	if valor := os.Getenv(nome); valor != "" {
+		return valor
+	}
+	return padrao
+}
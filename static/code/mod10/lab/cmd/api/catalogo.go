@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/models"
+)
+
+// Formatos de arquivo aceitos na exportação e na importação do catálogo.
+const (
+	formatoCSV   = "csv"
+	formatoJSONL = "jsonl"
+)
+
+const (
+	// tamanhoImportacaoMaximo limita o corpo de POST /produtos/importar.
+	tamanhoImportacaoMaximo = 32 << 20
+
+	// linhasImportacaoMaximo limita as linhas de uma importação, que é
+	// aplicada numa única transação.
+	linhasImportacaoMaximo = 50_000
+
+	// tamanhoLinhaMaximo limita cada linha de um arquivo JSON Lines.
+	tamanhoLinhaMaximo = 1 << 20
+)
+
+// Ações registradas no relatório de importação.
+const (
+	acaoCriado     = "criado"
+	acaoAtualizado = "atualizado"
+	acaoInalterado = "inalterado"
+)
+
+var (
+	errFormatoInvalido       = errors.New("formato inválido: use csv ou jsonl")
+	errCabecalhoInvalido     = errors.New("cabeçalho CSV inválido: são obrigatórias as colunas nome e preco")
+	errImportacaoRejeitada   = errors.New("importação rejeitada: há linhas com erro")
+	errImportacaoMuitoGrande = fmt.Errorf("importação com mais de %d linhas", linhasImportacaoMaximo)
+
+	// errSimulacao desfaz a transação de uma importação simulada.
+	errSimulacao = errors.New("importação simulada")
+)
+
+// tiposCatalogo são os Content-Types de cada formato, usados na exportação e
+// para deduzir o formato de uma importação sem o parâmetro formato.
+var tiposCatalogo = map[string]string{
+	formatoCSV:   "text/csv; charset=utf-8",
+	formatoJSONL: "application/x-ndjson",
+}
+
+// colunasCSV é o cabeçalho exportado. Na importação as colunas podem vir em
+// qualquer ordem, id é opcional e colunas desconhecidas são ignoradas.
+var colunasCSV = []string{"id", "nome", "preco"}
+
+// inicioFormula são os caracteres com que uma planilha reconhece uma fórmula
+// no início de uma célula. Na exportação CSV, uma célula que começa com um
+// deles recebe um apóstrofo na frente, que a planilha trata como texto; a
+// importação o remove.
+const inicioFormula = "=+-@"
+
+// celulaCSV protege o valor contra a injeção de fórmulas ao abrir o CSV numa
+// planilha. Um valor que já começa com apóstrofo também ganha outro, para
+// que valorCSV devolva exatamente o valor exportado.
+func celulaCSV(valor string) string {
+	if valor != "" && strings.ContainsRune(inicioFormula+"'", rune(valor[0])) {
+		return "'" + valor
+	}
+	return valor
+}
+
+// valorCSV desfaz a proteção de celulaCSV, removendo o apóstrofo antes de um
+// início de fórmula ou de outro apóstrofo. A remoção perde informação só
+// para arquivos que não vieram da exportação: uma célula escrita à mão como
+// '=x é importada como =x, e uma que começa com dois apóstrofos perde um.
+func valorCSV(celula string) string {
+	if len(celula) > 1 && celula[0] == '\'' && strings.ContainsRune(inicioFormula+"'", rune(celula[1])) {
+		return celula[1:]
+	}
+	return celula
+}
+
+// precoPlanilha é um preço com a vírgula decimal das planilhas em pt-BR,
+// com ou sem ponto de milhar.
+var precoPlanilha = regexp.MustCompile(`^[-+]?(\d+|\d{1,3}(\.\d{3})+),\d{1,2}$`)
+
+// precoCSV lê o preço de uma célula CSV: no formato da exportação (1234.56)
+// ou com a vírgula decimal das planilhas em pt-BR (1234,56 ou 1.234,56).
+func precoCSV(celula string) (models.Dinheiro, error) {
+	texto := celula
+	if precoPlanilha.MatchString(texto) {
+		texto = strings.ReplaceAll(texto, ".", "")
+		texto = strings.Replace(texto, ",", ".", 1)
+	}
+	preco, err := models.ParseDinheiro(texto)
+	if err != nil {
+		return models.Dinheiro{}, fmt.Errorf("preço %w; use 1234.56 ou 1.234,56", err)
+	}
+	return preco, nil
+}
+
+// registroCatalogo é um produto no arquivo do catálogo: uma linha do CSV ou
+// um objeto do JSON Lines. Sem ID, a importação procura o produto pelo nome.
+type registroCatalogo struct {
+	ID    string          `json:"id,omitempty"`
+	Nome  string          `json:"nome"`
+	Preco models.Dinheiro `json:"preco"`
+}
+
+// linhaCatalogo é um registro lido do arquivo, com o número da linha em que
+// começa. erro indica uma linha ilegível, que não interrompe a leitura.
+type linhaCatalogo struct {
+	numero   int
+	registro registroCatalogo
+	erro     error
+}
+
+// leitorCatalogo devolve a próxima linha do arquivo e io.EOF ao final.
+// Outros erros, como falhas de leitura do corpo, interrompem a importação.
+type leitorCatalogo func() (linhaCatalogo, error)
+
+// resultadoImportacao é o desfecho de uma linha. Numa simulação ou numa
+// importação rejeitada, a ação e o produto são o que a linha produziria.
+type resultadoImportacao struct {
+	Linha   int             `json:"linha"`
+	Acao    string          `json:"acao,omitempty"`
+	Produto *models.Produto `json:"produto,omitempty"`
+	Erro    string          `json:"erro,omitempty"`
+}
+
+// relatorioImportacao resume uma importação, linha a linha.
+type relatorioImportacao struct {
+	Simulacao   bool                  `json:"simulacao"`
+	Criados     int                   `json:"criados"`
+	Atualizados int                   `json:"atualizados"`
+	Inalterados int                   `json:"inalterados"`
+	Erros       int                   `json:"erros"`
+	Linhas      []resultadoImportacao `json:"linhas"`
+}
+
+// formatoCatalogo valida o formato pedido; vazio, deduz o formato do
+// Content-Type.
+func formatoCatalogo(formato, tipoConteudo string) (string, error) {
+	if formato == "" {
+		tipo, _, _ := mime.ParseMediaType(tipoConteudo)
+		switch tipo {
+		case "text/csv":
+			return formatoCSV, nil
+		case "application/x-ndjson", "application/jsonl":
+			return formatoJSONL, nil
+		}
+		return "", errFormatoInvalido
+	}
+	if _, ok := tiposCatalogo[formato]; !ok {
+		return "", errFormatoInvalido
+	}
+	return formato, nil
+}
+
+// exportarCatalogo grava os produtos ativos do tenant no formato, página a
+// página, descarregando cada página em w antes de buscar a seguinte; assim
+// o catálogo nunca fica inteiro em memória. Nada chega a w antes da primeira
+// página, o que permite responder com um erro se ela falhar.
+func exportarCatalogo(ctx context.Context, w io.Writer, formato string, produtos repo.RepositorioProdutos) error {
+	var escrever func(models.Produto) error
+	var descarregar func() error
+	switch formato {
+	case formatoCSV:
+		saida := csv.NewWriter(w)
+		// O cabeçalho fica no buffer até a primeira página
+		if err := saida.Write(colunasCSV); err != nil {
+			return fmt.Errorf("exportar catálogo: %w", err)
+		}
+		escrever = func(p models.Produto) error {
+			return saida.Write([]string{p.ID.String(), celulaCSV(p.Nome), p.Preco.String()})
+		}
+		descarregar = func() error {
+			saida.Flush()
+			return saida.Error()
+		}
+	case formatoJSONL:
+		buffer := bufio.NewWriter(w)
+		codificador := json.NewEncoder(buffer)
+		escrever = func(p models.Produto) error {
+			return codificador.Encode(registroCatalogo{ID: p.ID.String(), Nome: p.Nome, Preco: p.Preco})
+		}
+		descarregar = buffer.Flush
+	default:
+		return errFormatoInvalido
+	}
+
+	filtro := repo.FiltroListagem{Limite: repo.LimiteMaximo}
+	for {
+		pagina, err := produtos.Listar(ctx, filtro)
+		if err != nil {
+			return fmt.Errorf("exportar catálogo: %w", err)
+		}
+		for _, p := range pagina.Produtos {
+			if err := escrever(p); err != nil {
+				return fmt.Errorf("exportar catálogo: %w", err)
+			}
+		}
+		if err := descarregar(); err != nil {
+			return fmt.Errorf("exportar catálogo: %w", err)
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if pagina.ProximoCursor == "" {
+			return nil
+		}
+		filtro.Cursor = pagina.ProximoCursor
+	}
+}
+
+// lerCatalogo prepara a leitura do arquivo no formato. Um BOM UTF-8 no
+// início, comum em CSVs salvos por planilhas, é descartado.
+func lerCatalogo(r io.Reader, formato string) (leitorCatalogo, error) {
+	entrada := bufio.NewReader(r)
+	if inicio, _ := entrada.Peek(3); bytes.Equal(inicio, []byte("\xef\xbb\xbf")) {
+		entrada.Discard(3)
+	}
+
+	switch formato {
+	case formatoCSV:
+		return lerCSV(entrada)
+	case formatoJSONL:
+		return lerJSONL(entrada), nil
+	default:
+		return nil, errFormatoInvalido
+	}
+}
+
+func lerCSV(r io.Reader) (leitorCatalogo, error) {
+	entrada := csv.NewReader(r)
+	entrada.TrimLeadingSpace = true
+	cabecalho, err := entrada.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errCabecalhoInvalido
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ler cabeçalho CSV: %w", err)
+	}
+
+	colunas := map[string]int{"id": -1, "nome": -1, "preco": -1}
+	for i, nome := range cabecalho {
+		nome = strings.ToLower(strings.TrimSpace(nome))
+		if _, ok := colunas[nome]; ok {
+			colunas[nome] = i
+		}
+	}
+	if colunas["nome"] < 0 || colunas["preco"] < 0 {
+		return nil, errCabecalhoInvalido
+	}
+
+	return func() (linhaCatalogo, error) {
+		campos, err := entrada.Read()
+		var erroCSV *csv.ParseError
+		if errors.As(err, &erroCSV) {
+			return linhaCatalogo{numero: erroCSV.StartLine, erro: erroCSV.Err}, nil
+		}
+		if err != nil {
+			return linhaCatalogo{}, err
+		}
+
+		linha := linhaCatalogo{}
+		linha.numero, _ = entrada.FieldPos(0)
+		if i := colunas["id"]; i >= 0 {
+			linha.registro.ID = strings.TrimSpace(campos[i])
+		}
+		linha.registro.Nome = valorCSV(strings.TrimSpace(campos[colunas["nome"]]))
+		// Um preço vazio fica zerado e cai na validação do produto
+		if preco := strings.TrimSpace(campos[colunas["preco"]]); preco != "" {
+			linha.registro.Preco, linha.erro = precoCSV(preco)
+		}
+		return linha, nil
+	}, nil
+}
+
+func lerJSONL(r io.Reader) leitorCatalogo {
+	entrada := bufio.NewScanner(r)
+	entrada.Buffer(make([]byte, 0, 64<<10), tamanhoLinhaMaximo)
+	numero := 0
+
+	return func() (linhaCatalogo, error) {
+		for entrada.Scan() {
+			numero++
+			texto := bytes.TrimSpace(entrada.Bytes())
+			if len(texto) == 0 {
+				continue
+			}
+			linha := linhaCatalogo{numero: numero}
+			linha.erro = json.Unmarshal(texto, &linha.registro)
+			return linha, nil
+		}
+		if err := entrada.Err(); err != nil {
+			return linhaCatalogo{}, fmt.Errorf("linha %d: %w", numero+1, err)
+		}
+		return linhaCatalogo{}, io.EOF
+	}
+}
+
+// importarCatalogo aplica as linhas numa única transação, que só é
+// confirmada se nenhuma linha falhar e a importação não for uma simulação;
+// assim a simulação relata exatamente o que a importação faria. Com erros,
+// devolve o relatório junto de errImportacaoRejeitada.
+func importarCatalogo(ctx context.Context, transacoes repo.UnidadeDeTrabalho, ler leitorCatalogo, simular bool) (relatorioImportacao, error) {
+	relatorio := relatorioImportacao{Simulacao: simular, Linhas: []resultadoImportacao{}}
+	err := transacoes.Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+		for {
+			linha, err := ler()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("ler arquivo: %w", err)
+			}
+			if len(relatorio.Linhas) == linhasImportacaoMaximo {
+				return errImportacaoMuitoGrande
+			}
+
+			resultado := importarLinha(ctx, repos.Produtos, linha)
+			switch resultado.Acao {
+			case acaoCriado:
+				relatorio.Criados++
+			case acaoAtualizado:
+				relatorio.Atualizados++
+			case acaoInalterado:
+				relatorio.Inalterados++
+			default:
+				relatorio.Erros++
+			}
+			relatorio.Linhas = append(relatorio.Linhas, resultado)
+		}
+
+		switch {
+		case relatorio.Erros > 0:
+			return errImportacaoRejeitada
+		case simular:
+			return errSimulacao
+		}
+		return nil
+	})
+	if errors.Is(err, errSimulacao) {
+		err = nil
+	}
+	return relatorio, err
+}
+
+// importarLinha valida o registro com as mesmas regras de POST /produtos e o
+// grava: com ID, atualiza esse produto ou, se ele não existir, o cria com
+// esse ID, como ao importar o catálogo exportado de outra base; sem ID, cria
+// o produto ou, se o nome já for usado, atualiza o produto que o usa. Produtos sem mudanças não são
+// regravados, para não gerar versões nem histórico à toa.
+func importarLinha(ctx context.Context, produtos repo.RepositorioProdutos, linha linhaCatalogo) resultadoImportacao {
+	resultado := resultadoImportacao{Linha: linha.numero}
+	falhar := func(err error) resultadoImportacao {
+		resultado.Erro = err.Error()
+		return resultado
+	}
+	if linha.erro != nil {
+		return falhar(linha.erro)
+	}
+
+	nome, preco := linha.registro.Nome, linha.registro.Preco
+	if err := binding.Validator.ValidateStruct(models.Produto{Nome: nome, Preco: preco}); err != nil {
+		return falhar(err)
+	}
+
+	var id uuid.UUID
+	if linha.registro.ID != "" {
+		var err error
+		if id, err = uuid.Parse(linha.registro.ID); err != nil {
+			return falhar(fmt.Errorf("id %q inválido", linha.registro.ID))
+		}
+	} else {
+		produto, err := produtos.Criar(ctx, nome, preco)
+		var duplicado *repo.ProdutoDuplicadoError
+		switch {
+		case err == nil:
+			resultado.Acao, resultado.Produto = acaoCriado, &produto
+			return resultado
+		case errors.As(err, &duplicado):
+			id = duplicado.ExistenteID
+		default:
+			return falhar(err)
+		}
+	}
+
+	atual, err := produtos.Buscar(ctx, id)
+	if errors.Is(err, repo.ErrProdutoNaoEncontrado) && linha.registro.ID != "" {
+		produto, err := produtos.CriarComID(ctx, id, nome, preco)
+		if err != nil {
+			return falhar(err)
+		}
+		resultado.Acao, resultado.Produto = acaoCriado, &produto
+		return resultado
+	}
+	if err != nil {
+		return falhar(err)
+	}
+	if atual.Nome == nome && atual.Preco == preco {
+		resultado.Acao, resultado.Produto = acaoInalterado, &atual
+		return resultado
+	}
+	produto, err := produtos.Atualizar(ctx, id, nome, preco, repo.QualquerVersao)
+	if err != nil {
+		return falhar(err)
+	}
+	resultado.Acao, resultado.Produto = acaoAtualizado, &produto
+	return resultado
+}
+
+// statusImportacao traduz os erros de importarCatalogo.
+func statusImportacao(err error) int {
+	var excedido *http.MaxBytesError
+	var erroCSV *csv.ParseError
+	switch {
+	case errors.As(err, &excedido), errors.Is(err, errImportacaoMuitoGrande):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errImportacaoRejeitada):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &erroCSV), errors.Is(err, bufio.ErrTooLong), errors.Is(err, errCabecalhoInvalido):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
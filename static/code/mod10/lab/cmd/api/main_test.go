@@ -1,45 +1,556 @@
 package main
 
 import (
-	"github.com/seuusuario/lab6/internal/repo"
-	"github.com/stretchr/testify/assert"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
 	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/midia"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestMainIntegration(t *testing.T) {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	repo := repo.NovoRepositorioEmMemoria(logger)
+	repositorio := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
 
 	t.Run("Fluxo completo do CRUD", func(t *testing.T) {
 
 		// Criar
-		produto, err := repo.Criar("Laptop", 999.99)
+		produto, err := repositorio.Criar(ctx, "Laptop", models.Centavos(99999))
 		assert.NoError(t, err)
 
 		// Listar
-		produtos, err := repo.Listar()
+		pagina, err := repositorio.Listar(ctx, repo.FiltroListagem{})
 		assert.NoError(t, err)
-		assert.Len(t, produtos, 1)
+		assert.Len(t, pagina.Produtos, 1)
 
 		// Buscar
-		encontrado, err := repo.Buscar(produto.ID)
+		encontrado, err := repositorio.Buscar(ctx, produto.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, produto, encontrado)
 
 		// Atualizar
-		atualizado, err := repo.Atualizar(produto.ID, "Laptop Pro", 1299.99)
-		assert.NoError(t,, err)
+		atualizado, err := repositorio.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), repo.QualquerVersao)
+		assert.NoError(t, err)
 		assert.Equal(t, "Laptop Pro", atualizado.Nome)
 
 		// Deletar
-		err = repo.Deletar(produto.ID)
+		err = repositorio.Deletar(ctx, produto.ID, repo.QualquerVersao)
 		assert.NoError(t, err)
 
 		// Verificar exclusão
-		produtos, err = repo.Listar()
+		pagina, err = repositorio.Listar(ctx, repo.FiltroListagem{})
+		assert.NoError(t, err)
+		assert.Len(t, pagina.Produtos, 0)
+	})
+}
+
+func TestResolverTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens, err := lerTokensTenant("segredo-a=loja-a, segredo-b=loja-b")
+	assert.NoError(t, err)
+
+	repositorio := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	rotear := func(tokens map[string]string, dev bool) *gin.Engine {
+		r := gin.New()
+		r.Use(resolverTenant(tokens, nil, dev))
+		r.GET("/produtos/:id", func(c *gin.Context) {
+			produto, err := repositorio.Buscar(c.Request.Context(), uuid.MustParse(c.Param("id")))
+			if err != nil {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			c.JSON(http.StatusOK, produto)
+		})
+		return r
+	}
+	roteadores := map[string]*gin.Engine{
+		"produção":        rotear(tokens, false),
+		"desenvolvimento": rotear(tokens, true),
+		"sem tokens":      rotear(nil, false),
+	}
+	produto, err := repositorio.Criar(repo.ComTenant(context.Background(), "loja-a"), "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	padrao, err := repositorio.Criar(repo.ComTenant(context.Background(), repo.TenantPadrao), "Mouse", models.Centavos(4990))
+	assert.NoError(t, err)
+
+	// O status esperado em cada roteador: produção, desenvolvimento e sem
+	// tokens
+	casos := []struct {
+		nome      string
+		id        uuid.UUID
+		cabecalho map[string]string
+		status    [3]int
+	}{
+		{"token do dono", produto.ID, map[string]string{"Authorization": "Bearer segredo-a"}, [3]int{http.StatusOK, http.StatusOK, http.StatusUnauthorized}},
+		{"cabeçalho do dono", produto.ID, map[string]string{"X-Tenant": "loja-a"}, [3]int{http.StatusUnauthorized, http.StatusOK, http.StatusUnauthorized}},
+		{"token e cabeçalho iguais", produto.ID, map[string]string{"Authorization": "Bearer segredo-a", "X-Tenant": "loja-a"}, [3]int{http.StatusOK, http.StatusOK, http.StatusUnauthorized}},
+		{"token de outro tenant", produto.ID, map[string]string{"Authorization": "Bearer segredo-b"}, [3]int{http.StatusNotFound, http.StatusNotFound, http.StatusUnauthorized}},
+		{"cabeçalho de outro tenant", produto.ID, map[string]string{"X-Tenant": "loja-b"}, [3]int{http.StatusUnauthorized, http.StatusNotFound, http.StatusUnauthorized}},
+		{"sem tenant", produto.ID, nil, [3]int{http.StatusUnauthorized, http.StatusNotFound, http.StatusNotFound}},
+		{"sem tenant no tenant padrão", padrao.ID, nil, [3]int{http.StatusUnauthorized, http.StatusOK, http.StatusOK}},
+		{"token desconhecido", produto.ID, map[string]string{"Authorization": "Bearer outro"}, [3]int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized}},
+		{"cabeçalho contradiz o token", produto.ID, map[string]string{"Authorization": "Bearer segredo-b", "X-Tenant": "loja-a"}, [3]int{http.StatusForbidden, http.StatusForbidden, http.StatusUnauthorized}},
+		{"tenant inválido", produto.ID, map[string]string{"X-Tenant": "Loja A"}, [3]int{http.StatusUnauthorized, http.StatusBadRequest, http.StatusUnauthorized}},
+	}
+	for _, caso := range casos {
+		for i, modo := range []string{"produção", "desenvolvimento", "sem tokens"} {
+			t.Run(caso.nome+" em "+modo, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/produtos/"+caso.id.String(), nil)
+				for nome, valor := range caso.cabecalho {
+					req.Header.Set(nome, valor)
+				}
+				w := httptest.NewRecorder()
+				roteadores[modo].ServeHTTP(w, req)
+				assert.Equal(t, caso.status[i], w.Code)
+			})
+		}
+	}
+
+	_, err = lerTokensTenant("segredo-a")
+	assert.Error(t, err)
+	_, err = lerTokensTenant("segredo-a=Loja A")
+	assert.ErrorIs(t, err, repo.ErrTenantInvalido)
+}
+
+func TestListarRemovidosExigeAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens, err := lerTokensTenant("segredo-a=loja-a")
+	assert.NoError(t, err)
+	admins, err := lerTokensTenant("raiz-a=loja-a")
+	assert.NoError(t, err)
+
+	repositorio := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	lojaA := repo.ComTenant(context.Background(), "loja-a")
+	ativo, err := repositorio.Criar(lojaA, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	removido, err := repositorio.Criar(lojaA, "Mouse", models.Centavos(4990))
+	assert.NoError(t, err)
+	assert.NoError(t, repositorio.Deletar(lojaA, removido.ID, removido.Versao))
+
+	r := gin.New()
+	r.Use(resolverTenant(tokens, admins, false))
+	r.GET("/produtos", listarProdutos(repositorio, repositorio))
+	listar := func(url, token string) (int, repo.Pagina) {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var pagina repo.Pagina
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pagina))
+		}
+		return w.Code, pagina
+	}
+
+	status, _ := listar("/produtos?incluir_removidos=true", "segredo-a")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, pagina := listar("/produtos", "segredo-a")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, pagina.Produtos, 1)
+	assert.Equal(t, ativo.ID, pagina.Produtos[0].ID)
+
+	// O token de administrador também resolve o tenant
+	status, pagina = listar("/produtos?incluir_removidos=true", "raiz-a")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, pagina.Produtos, 2)
+	status, pagina = listar("/produtos", "raiz-a")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, pagina.Produtos, 1)
+}
+
+func TestResponderDuplicado(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+	repositorio := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	existente, err := repositorio.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	_, err = repositorio.Criar(ctx, "laptop", models.Centavos(89999))
+
+	for _, erro := range []error{err, fmt.Errorf("corrida: %w", repo.ErrProdutoDuplicado)} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		responderDuplicado(c, erro)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		var corpo map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &corpo))
+		assert.Equal(t, erro.Error(), corpo["error"])
+		if erro == err {
+			assert.Equal(t, existente.ID.String(), corpo["produto_id"])
+		} else {
+			assert.NotContains(t, corpo, "produto_id")
+		}
+	}
+}
+
+func TestImagensDoProduto(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+	repositorio := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	diretorio := t.TempDir()
+	arquivos, err := midia.NovoArmazenamentoLocal(diretorio)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(resolverTenant(nil, nil, true))
+	r.GET("/produtos/:id/imagens/:imagem", servirImagem(repositorio, arquivos, false))
+	r.GET("/produtos/:id/imagens/:imagem/miniatura", servirImagem(repositorio, arquivos, true))
+	r.DELETE("/produtos/:id", removerProduto(repositorio, repositorio, arquivos, zap.NewNop()))
+	baixar := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	produto, err := repositorio.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+
+	t.Run("Envio grava os arquivos e preenche o produto", func(t *testing.T) {
+		dados := fotoPNG(t, 800, 600)
+		imagem, err := enviarImagem(ctx, repositorio, arquivos, produto.ID, arquivoEnviado(t, "image/png", dados))
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", imagem.TipoConteudo)
+		assert.Equal(t, int64(len(dados)), imagem.Tamanho)
+		assert.Equal(t, 800, imagem.Largura)
+
+		original := baixar(imagem.URL)
+		assert.Equal(t, http.StatusOK, original.Code)
+		assert.Equal(t, "image/png", original.Header().Get("Content-Type"))
+		assert.Equal(t, dados, original.Body.Bytes())
+
+		miniatura := baixar(imagem.MiniaturaURL)
+		assert.Equal(t, http.StatusOK, miniatura.Code)
+		assert.Equal(t, midia.TipoMiniatura, miniatura.Header().Get("Content-Type"))
+		config, _, err := image.DecodeConfig(miniatura.Body)
+		if assert.NoError(t, err) {
+			assert.Equal(t, midia.LadoMiniatura, config.Width)
+		}
+
+		lista := []models.Produto{produto}
+		assert.NoError(t, preencherImagens(ctx, repositorio, lista))
+		assert.Equal(t, []models.Imagem{imagem}, lista[0].Imagens)
+
+		// Outro tenant não enxerga a imagem
+		req := httptest.NewRequest(http.MethodGet, imagem.URL, nil)
+		req.Header.Set("X-Tenant", "outra-loja")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Envio recusado não deixa arquivos", func(t *testing.T) {
+		antes, err := repositorio.Imagens(ctx, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+
+		_, err = enviarImagem(ctx, repositorio, arquivos, produto.ID, arquivoEnviado(t, "image/png", []byte("não é imagem")))
+		assert.ErrorIs(t, err, midia.ErrTipoNaoSuportado)
+		assert.Equal(t, http.StatusUnsupportedMediaType, statusImagem(err))
+
+		_, err = enviarImagem(ctx, repositorio, arquivos, uuid.New(), arquivoEnviado(t, "image/png", fotoPNG(t, 10, 10)))
+		assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+		assert.Equal(t, http.StatusNotFound, statusImagem(err))
+
+		depois, err := repositorio.Imagens(ctx, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, antes, depois)
+		assert.Len(t, arquivosEm(t, diretorio), 2*len(depois[produto.ID]))
+	})
+
+	t.Run("Remoção apaga os arquivos", func(t *testing.T) {
+		porProduto, err := repositorio.Imagens(ctx, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+		for _, imagem := range porProduto[produto.ID] {
+			removida, err := repositorio.RemoverImagem(ctx, produto.ID, imagem.ID)
+			assert.NoError(t, err)
+			assert.NoError(t, apagarImagem(ctx, arquivos, removida))
+			assert.Equal(t, http.StatusNotFound, baixar(comURLs(imagem).URL).Code)
+		}
+		assert.Empty(t, arquivosEm(t, diretorio))
+	})
+
+	t.Run("Remoção do produto apaga os arquivos", func(t *testing.T) {
+		sofa, err := repositorio.Criar(ctx, "Sofá", models.Centavos(250000))
+		assert.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			_, err := enviarImagem(ctx, repositorio, arquivos, sofa.ID, arquivoEnviado(t, "image/png", fotoPNG(t, 40, 30)))
+			assert.NoError(t, err)
+		}
+		assert.Len(t, arquivosEm(t, diretorio), 4)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/produtos/"+sofa.ID.String(), nil))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, arquivosEm(t, diretorio))
+
+		// A restauração traz o produto de volta sem as imagens
+		_, err = repositorio.Restaurar(ctx, sofa.ID)
+		assert.NoError(t, err)
+		imagens, err := repositorio.Imagens(ctx, []uuid.UUID{sofa.ID})
+		assert.NoError(t, err)
+		assert.Empty(t, imagens)
+	})
+}
+
+func TestCatalogo(t *testing.T) {
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	repositorio := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+	transacoes := repo.NovaUnidadeDeTrabalhoEmMemoria(repositorio, logger)
+
+	// Mais de uma página da listagem
+	total := repo.LimiteMaximo + 5
+	for i := 0; i < total; i++ {
+		_, err := repositorio.Criar(ctx, fmt.Sprintf("Produto %03d", i), models.Centavos(int64(100+i)))
 		assert.NoError(t, err)
-		assert.Len(t, produtos, 0)
+	}
+	importar := func(t *testing.T, formato, conteudo string, simular bool) (relatorioImportacao, error) {
+		t.Helper()
+		ler, err := lerCatalogo(strings.NewReader(conteudo), formato)
+		assert.NoError(t, err)
+		return importarCatalogo(ctx, transacoes, ler, simular)
+	}
+
+	t.Run("Exportação percorre todas as páginas e reimporta sem mudanças", func(t *testing.T) {
+		for formato, linhas := range map[string]int{formatoCSV: total + 1, formatoJSONL: total} {
+			var arquivo bytes.Buffer
+			assert.NoError(t, exportarCatalogo(ctx, &arquivo, formato, repositorio))
+			assert.Equal(t, linhas, strings.Count(arquivo.String(), "\n"), formato)
+
+			relatorio, err := importar(t, formato, arquivo.String(), false)
+			assert.NoError(t, err)
+			assert.Equal(t, total, relatorio.Inalterados, formato)
+			assert.Zero(t, relatorio.Criados+relatorio.Atualizados+relatorio.Erros, formato)
+		}
+	})
+
+	t.Run("Importação cria e atualiza por ID ou pelo nome", func(t *testing.T) {
+		pagina, err := repositorio.Listar(ctx, repo.FiltroListagem{Ordenacao: repo.OrdenarPorNome, Limite: 2})
+		assert.NoError(t, err)
+		primeiro, segundo := pagina.Produtos[0], pagina.Produtos[1]
+
+		arquivo := "\xef\xbb\xbfnome,preco,id,observacao\n" +
+			"Teclado,149.90,,novo\n" +
+			"produto 000, 2.50,,mesmo nome\n" +
+			"Renomeado,3.00," + segundo.ID.String() + ",\n"
+		relatorio, err := importar(t, formatoCSV, arquivo, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, relatorio.Criados)
+		assert.Equal(t, 2, relatorio.Atualizados)
+		assert.Equal(t, []int{2, 3, 4}, []int{relatorio.Linhas[0].Linha, relatorio.Linhas[1].Linha, relatorio.Linhas[2].Linha})
+
+		criado, err := repositorio.Buscar(ctx, relatorio.Linhas[0].Produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Teclado", criado.Nome)
+		assert.Equal(t, models.Centavos(14990), criado.Preco)
+
+		porNome, err := repositorio.Buscar(ctx, primeiro.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "produto 000", porNome.Nome)
+		assert.Equal(t, models.Centavos(250), porNome.Preco)
+
+		porID, err := repositorio.Buscar(ctx, segundo.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Renomeado", porID.Nome)
+		assert.Equal(t, segundo.Versao+1, porID.Versao)
+	})
+
+	t.Run("Importação cria com o ID do arquivo o produto que não existe", func(t *testing.T) {
+		id := uuid.New()
+		relatorio, err := importar(t, formatoJSONL, `{"id":"`+id.String()+`","nome":"Webcam","preco":"199.90"}`, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, relatorio.Criados)
+
+		criado, err := repositorio.Buscar(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Webcam", criado.Nome)
+		assert.Equal(t, models.Centavos(19990), criado.Preco)
+
+		// O ID de um produto removido não é reaproveitado
+		assert.NoError(t, repositorio.Deletar(ctx, id, repo.QualquerVersao))
+		relatorio, err = importar(t, formatoJSONL, `{"id":"`+id.String()+`","nome":"Webcam HD","preco":"249.90"}`, false)
+		assert.ErrorIs(t, err, errImportacaoRejeitada)
+		if assert.Len(t, relatorio.Linhas, 1) {
+			assert.Contains(t, relatorio.Linhas[0].Erro, repo.ErrIDEmUso.Error())
+		}
+	})
+
+	t.Run("Simulação relata sem gravar", func(t *testing.T) {
+		relatorio, err := importar(t, formatoJSONL, `{"nome":"Mouse sem fio","preco":"89.90"}`+"\n", true)
+		assert.NoError(t, err)
+		assert.True(t, relatorio.Simulacao)
+		if assert.Len(t, relatorio.Linhas, 1) {
+			assert.Equal(t, acaoCriado, relatorio.Linhas[0].Acao)
+			_, err = repositorio.Buscar(ctx, relatorio.Linhas[0].Produto.ID)
+			assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+		}
+	})
+
+	t.Run("Linhas inválidas rejeitam a importação inteira", func(t *testing.T) {
+		arquivo := strings.Join([]string{
+			`{"nome":"Monitor","preco":"999.90"}`,
+			`{"nome":"TV","preco":"999.90"}`,
+			``,
+			`{"nome":"Cabo","preco":0}`,
+			`{"nome":"Cabo"`,
+			`{"id":"` + uuid.NewString() + `","nome":"Fantasma","preco":"1.00"}`,
+			`{"id":"123","nome":"Fantasma","preco":"1.00"}`,
+		}, "\n")
+		relatorio, err := importar(t, formatoJSONL, arquivo, false)
+		assert.ErrorIs(t, err, errImportacaoRejeitada)
+		assert.Equal(t, http.StatusUnprocessableEntity, statusImportacao(err))
+		assert.Equal(t, 4, relatorio.Erros)
+
+		var comErro []int
+		for _, resultado := range relatorio.Linhas {
+			if resultado.Erro != "" {
+				comErro = append(comErro, resultado.Linha)
+			}
+		}
+		assert.Equal(t, []int{2, 4, 5, 7}, comErro)
+		assert.Equal(t, acaoCriado, relatorio.Linhas[0].Acao)
+		_, err = repositorio.Buscar(ctx, relatorio.Linhas[0].Produto.ID)
+		assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Exportação CSV neutraliza fórmulas de planilha", func(t *testing.T) {
+		repositorio := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+		transacoes := repo.NovaUnidadeDeTrabalhoEmMemoria(repositorio, logger)
+		nomes := []string{`=HYPERLINK("http://exemplo.com")`, "+5511999999999", "-10% off", "@SOMA(1+1)", "Cabo = USB", "'=aspas", "'Clássico'"}
+		for _, nome := range nomes {
+			_, err := repositorio.Criar(ctx, nome, models.Centavos(100))
+			assert.NoError(t, err)
+		}
+
+		var arquivo bytes.Buffer
+		assert.NoError(t, exportarCatalogo(ctx, &arquivo, formatoCSV, repositorio))
+		registros, err := csv.NewReader(strings.NewReader(arquivo.String())).ReadAll()
+		assert.NoError(t, err)
+		exportados := map[string]bool{}
+		for _, registro := range registros[1:] {
+			exportados[registro[1]] = true
+		}
+		assert.Equal(t, map[string]bool{
+			`'=HYPERLINK("http://exemplo.com")`: true,
+			"'+5511999999999":                   true,
+			"'-10% off":                         true,
+			"'@SOMA(1+1)":                       true,
+			"Cabo = USB":                        true,
+			"''=aspas":                          true,
+			"''Clássico'":                       true,
+		}, exportados)
+
+		// A reimportação remove só o apóstrofo da exportação e não muda nada
+		ler, err := lerCatalogo(strings.NewReader(arquivo.String()), formatoCSV)
+		assert.NoError(t, err)
+		relatorio, err := importarCatalogo(ctx, transacoes, ler, false)
+		assert.NoError(t, err)
+		assert.Equal(t, len(nomes), relatorio.Inalterados)
+	})
+
+	t.Run("Importação CSV aceita a vírgula decimal das planilhas", func(t *testing.T) {
+		arquivo := "nome,preco\n" +
+			"Caderno,\"10,50\"\n" +
+			"Estojo,\"1.234,5\"\n" +
+			"Lápis,0.99\n" +
+			"Régua,\"1,234.00\"\n"
+		relatorio, err := importar(t, formatoCSV, arquivo, true)
+		assert.ErrorIs(t, err, errImportacaoRejeitada)
+		if !assert.Len(t, relatorio.Linhas, 4) {
+			return
+		}
+		assert.Equal(t, models.Centavos(1050), relatorio.Linhas[0].Produto.Preco)
+		assert.Equal(t, models.Centavos(123450), relatorio.Linhas[1].Produto.Preco)
+		assert.Equal(t, models.Centavos(99), relatorio.Linhas[2].Produto.Preco)
+		assert.Contains(t, relatorio.Linhas[3].Erro, "use 1234.56 ou 1.234,56")
+
+		// Uma célula escrita à mão com o apóstrofo de texto da planilha o perde
+		assert.Equal(t, "=x", valorCSV("'=x"))
+		assert.Equal(t, "'x", valorCSV("''x"))
+		assert.Equal(t, "'x", valorCSV("'x"))
+	})
+
+	t.Run("Arquivos ilegíveis são recusados", func(t *testing.T) {
+		_, err := lerCatalogo(strings.NewReader("id,name,price\n"), formatoCSV)
+		assert.ErrorIs(t, err, errCabecalhoInvalido)
+		assert.Equal(t, http.StatusBadRequest, statusImportacao(err))
+
+		_, err = importar(t, formatoJSONL, strings.Repeat("x", tamanhoLinhaMaximo+1), false)
+		assert.Equal(t, http.StatusBadRequest, statusImportacao(err))
+
+		formato, err := formatoCatalogo("", "text/csv; charset=utf-8")
+		assert.NoError(t, err)
+		assert.Equal(t, formatoCSV, formato)
+		_, err = formatoCatalogo("xlsx", "")
+		assert.ErrorIs(t, err, errFormatoInvalido)
+	})
+}
+
+// arquivoEnviado monta o cabeçalho multipart de um arquivo enviado no campo
+// "imagem", como o que c.FormFile devolve.
+func arquivoEnviado(t *testing.T, tipo string, dados []byte) *multipart.FileHeader {
+	t.Helper()
+	var corpo bytes.Buffer
+	escritor := multipart.NewWriter(&corpo)
+	parte, err := escritor.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="imagem"; filename="foto"`},
+		"Content-Type":        {tipo},
+	})
+	assert.NoError(t, err)
+	parte.Write(dados)
+	assert.NoError(t, escritor.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", &corpo)
+	req.Header.Set("Content-Type", escritor.FormDataContentType())
+	_, cabecalho, err := req.FormFile("imagem")
+	assert.NoError(t, err)
+	return cabecalho
+}
+
+// fotoPNG codifica uma imagem PNG de uma cor só.
+func fotoPNG(t *testing.T, largura, altura int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, largura, altura))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var dados bytes.Buffer
+	assert.NoError(t, png.Encode(&dados, img))
+	return dados.Bytes()
+}
+
+// arquivosEm lista os arquivos abaixo do diretório.
+func arquivosEm(t *testing.T, diretorio string) []string {
+	t.Helper()
+	var arquivos []string
+	err := filepath.WalkDir(diretorio, func(caminho string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			arquivos = append(arquivos, caminho)
+		}
+		return err
 	})
-}
\ No newline at end of file
+	assert.NoError(t, err)
+	return arquivos
+}
@@ -0,0 +1,140 @@
+// Package midia guarda os arquivos enviados à API, como as imagens dos
+// produtos, e prepara as imagens antes de guardá-las.
+package midia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var (
+	ErrBlobNaoEncontrado = errors.New("blob não encontrado")
+	ErrChaveInvalida     = errors.New("chave de blob inválida")
+)
+
+// Armazenamento guarda blobs sob chaves hierárquicas separadas por "/", como
+// "produtos/<id>/imagens/<id>". Os metadados dos blobs, como o tipo do
+// conteúdo, ficam com quem os grava. As implementações devem ser seguras
+// para uso concorrente.
+type Armazenamento interface {
+	// Salvar grava o conteúdo sob a chave, substituindo o blob anterior. Um
+	// leitor nunca enxerga um blob gravado pela metade.
+	Salvar(ctx context.Context, chave string, conteudo io.Reader) error
+	// Abrir devolve o conteúdo do blob, que o chamador deve fechar.
+	Abrir(ctx context.Context, chave string) (io.ReadCloser, error)
+	// Remover apaga o blob; remover um blob inexistente não é erro.
+	Remover(ctx context.Context, chave string) error
+}
+
+// ArmazenamentoLocal guarda cada blob num arquivo abaixo de um diretório,
+// no caminho dado pela chave.
+type ArmazenamentoLocal struct {
+	diretorio string
+}
+
+// NovoArmazenamentoLocal cria o armazenamento em diretorio, criando-o se não
+// existir.
+func NovoArmazenamentoLocal(diretorio string) (*ArmazenamentoLocal, error) {
+	if err := os.MkdirAll(diretorio, 0o755); err != nil {
+		return nil, fmt.Errorf("abrir armazenamento em %s: %w", diretorio, err)
+	}
+	return &ArmazenamentoLocal{diretorio: diretorio}, nil
+}
+
+// Salvar grava num arquivo temporário ao lado do definitivo e o renomeia por
+// cima, para que uma queda no meio preserve o blob anterior.
+func (a *ArmazenamentoLocal) Salvar(ctx context.Context, chave string, conteudo io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("salvar blob: %w", err)
+	}
+	caminho, err := a.caminho(chave)
+	if err != nil {
+		return fmt.Errorf("salvar blob: %w", err)
+	}
+
+	// Um Remover concorrente pode apagar o diretório recém-criado, já vazio;
+	// basta criá-lo de novo
+	var temporario *os.File
+	for tentativa := 0; temporario == nil; tentativa++ {
+		if err := os.MkdirAll(filepath.Dir(caminho), 0o755); err != nil {
+			return fmt.Errorf("salvar blob %s: %w", chave, err)
+		}
+		temporario, err = os.CreateTemp(filepath.Dir(caminho), ".blob-*")
+		if err != nil && (tentativa > 0 || !errors.Is(err, fs.ErrNotExist)) {
+			return fmt.Errorf("salvar blob %s: %w", chave, err)
+		}
+	}
+	defer os.Remove(temporario.Name())
+
+	_, err = io.Copy(temporario, conteudo)
+	if err == nil {
+		err = temporario.Sync()
+	}
+	if errFechar := temporario.Close(); err == nil {
+		err = errFechar
+	}
+	if err == nil {
+		err = os.Rename(temporario.Name(), caminho)
+	}
+	if err != nil {
+		return fmt.Errorf("salvar blob %s: %w", chave, err)
+	}
+	return nil
+}
+
+func (a *ArmazenamentoLocal) Abrir(ctx context.Context, chave string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("abrir blob: %w", err)
+	}
+	caminho, err := a.caminho(chave)
+	if err != nil {
+		return nil, fmt.Errorf("abrir blob: %w", err)
+	}
+
+	arquivo, err := os.Open(caminho)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("abrir blob %s: %w", chave, ErrBlobNaoEncontrado)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("abrir blob %s: %w", chave, err)
+	}
+	return arquivo, nil
+}
+
+// Remover apaga o arquivo e os diretórios que ficarem vazios acima dele,
+// até o diretório do armazenamento.
+func (a *ArmazenamentoLocal) Remover(ctx context.Context, chave string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("remover blob: %w", err)
+	}
+	caminho, err := a.caminho(chave)
+	if err != nil {
+		return fmt.Errorf("remover blob: %w", err)
+	}
+
+	if err := os.Remove(caminho); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remover blob %s: %w", chave, err)
+	}
+	// os.Remove recusa diretórios com conteúdo, o que encerra a subida
+	for dir := path.Dir(chave); dir != "."; dir = path.Dir(dir) {
+		if os.Remove(filepath.Join(a.diretorio, filepath.FromSlash(dir))) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// caminho traduz a chave para um arquivo abaixo do diretório, recusando
+// chaves que escapariam dele, como "../x" ou "/x".
+func (a *ArmazenamentoLocal) caminho(chave string) (string, error) {
+	if chave == "." || !fs.ValidPath(chave) {
+		return "", fmt.Errorf("%q: %w", chave, ErrChaveInvalida)
+	}
+	return filepath.Join(a.diretorio, filepath.FromSlash(chave)), nil
+}
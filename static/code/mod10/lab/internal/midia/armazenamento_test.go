@@ -0,0 +1,75 @@
+package midia_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seu-usuario/lab6/internal/midia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArmazenamentoLocal(t *testing.T) {
+	diretorio := t.TempDir()
+	a, err := midia.NovoArmazenamentoLocal(diretorio)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	ctx := context.Background()
+
+	t.Run("Salvar, abrir e substituir", func(t *testing.T) {
+		assert.NoError(t, a.Salvar(ctx, "produtos/1/imagens/a", strings.NewReader("primeira")))
+		assert.Equal(t, "primeira", ler(t, a, "produtos/1/imagens/a"))
+
+		assert.NoError(t, a.Salvar(ctx, "produtos/1/imagens/a", strings.NewReader("segunda")))
+		assert.Equal(t, "segunda", ler(t, a, "produtos/1/imagens/a"))
+
+		// Nenhum temporário fica para trás
+		entradas, err := os.ReadDir(filepath.Join(diretorio, "produtos", "1", "imagens"))
+		assert.NoError(t, err)
+		assert.Len(t, entradas, 1)
+	})
+
+	t.Run("Remover apaga os diretórios que ficam vazios", func(t *testing.T) {
+		assert.NoError(t, a.Salvar(ctx, "produtos/2/imagens/a", strings.NewReader("a")))
+		assert.NoError(t, a.Salvar(ctx, "produtos/2/imagens/b", strings.NewReader("b")))
+
+		assert.NoError(t, a.Remover(ctx, "produtos/2/imagens/a"))
+		_, err := a.Abrir(ctx, "produtos/2/imagens/a")
+		assert.ErrorIs(t, err, midia.ErrBlobNaoEncontrado)
+		assert.Equal(t, "b", ler(t, a, "produtos/2/imagens/b"))
+
+		assert.NoError(t, a.Remover(ctx, "produtos/2/imagens/b"))
+		assert.NoDirExists(t, filepath.Join(diretorio, "produtos", "2"))
+		assert.DirExists(t, diretorio)
+
+		// Remover de novo não é erro
+		assert.NoError(t, a.Remover(ctx, "produtos/2/imagens/b"))
+	})
+
+	t.Run("Chaves fora do diretório são recusadas", func(t *testing.T) {
+		for _, chave := range []string{"", ".", "../fora", "/absoluta", "produtos/../../fora", "produtos//a"} {
+			assert.ErrorIs(t, a.Salvar(ctx, chave, strings.NewReader("x")), midia.ErrChaveInvalida, chave)
+			_, err := a.Abrir(ctx, chave)
+			assert.ErrorIs(t, err, midia.ErrChaveInvalida, chave)
+			assert.ErrorIs(t, a.Remover(ctx, chave), midia.ErrChaveInvalida, chave)
+		}
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(diretorio), "fora"))
+	})
+}
+
+func ler(t *testing.T, a midia.Armazenamento, chave string) string {
+	t.Helper()
+
+	conteudo, err := a.Abrir(context.Background(), chave)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer conteudo.Close()
+	dados, err := io.ReadAll(conteudo)
+	assert.NoError(t, err)
+	return string(dados)
+}
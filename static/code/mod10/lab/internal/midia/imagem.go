@@ -0,0 +1,140 @@
+package midia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const (
+	// TamanhoMaximoPadrao limita o tamanho de uma imagem enviada.
+	TamanhoMaximoPadrao = 5 << 20
+
+	// LadoMiniatura é o maior lado da miniatura, em pixels. Imagens menores
+	// não são ampliadas.
+	LadoMiniatura = 256
+
+	// TipoMiniatura é o formato das miniaturas, qualquer que seja o original.
+	TipoMiniatura = "image/jpeg"
+
+	// pixelsMaximo recusa imagens que ocupariam memória demais ao serem
+	// decodificadas, mesmo com um arquivo pequeno.
+	pixelsMaximo = 40_000_000
+)
+
+var (
+	ErrTipoNaoSuportado = errors.New("tipo de imagem não suportado: use JPEG, PNG ou GIF")
+	ErrImagemInvalida   = errors.New("imagem inválida")
+)
+
+// decodificadores são os formatos aceitos, pelo tipo que
+// http.DetectContentType reconhece no conteúdo.
+var decodificadores = map[string]struct {
+	config func(io.Reader) (image.Config, error)
+	decode func(io.Reader) (image.Image, error)
+}{
+	"image/jpeg": {jpeg.DecodeConfig, jpeg.Decode},
+	"image/png":  {png.DecodeConfig, png.Decode},
+	"image/gif":  {gif.DecodeConfig, gif.Decode},
+}
+
+// ImagemProcessada é o resultado de ProcessarImagem: o tipo e as dimensões
+// do original e a miniatura em TipoMiniatura.
+type ImagemProcessada struct {
+	TipoConteudo string
+	Largura      int
+	Altura       int
+	Miniatura    []byte
+}
+
+// ProcessarImagem confere a imagem e gera sua miniatura. O tipo vem do
+// próprio conteúdo; tipoDeclarado, o Content-Type informado pelo cliente,
+// precisa coincidir com ele, a não ser que seja vazio ou o genérico
+// application/octet-stream. Um GIF animado é representado pelo primeiro
+// quadro.
+func ProcessarImagem(dados []byte, tipoDeclarado string) (ImagemProcessada, error) {
+	tipo := http.DetectContentType(dados)
+	formato, aceito := decodificadores[tipo]
+	if !aceito {
+		return ImagemProcessada{}, fmt.Errorf("conteúdo %s: %w", tipo, ErrTipoNaoSuportado)
+	}
+	if tipoDeclarado != "" {
+		declarado, _, err := mime.ParseMediaType(tipoDeclarado)
+		if err != nil || (declarado != tipo && declarado != "application/octet-stream") {
+			return ImagemProcessada{}, fmt.Errorf("declarado %q, conteúdo %s: %w", tipoDeclarado, tipo, ErrTipoNaoSuportado)
+		}
+	}
+
+	config, err := formato.config(bytes.NewReader(dados))
+	if err != nil {
+		return ImagemProcessada{}, fmt.Errorf("%w: %v", ErrImagemInvalida, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > pixelsMaximo {
+		return ImagemProcessada{}, fmt.Errorf("%dx%d pixels: %w", config.Width, config.Height, ErrImagemInvalida)
+	}
+	original, err := formato.decode(bytes.NewReader(dados))
+	if err != nil {
+		return ImagemProcessada{}, fmt.Errorf("%w: %v", ErrImagemInvalida, err)
+	}
+
+	var miniatura bytes.Buffer
+	if err := jpeg.Encode(&miniatura, reduzir(original, LadoMiniatura), &jpeg.Options{Quality: 85}); err != nil {
+		return ImagemProcessada{}, fmt.Errorf("gerar miniatura: %w", err)
+	}
+	return ImagemProcessada{
+		TipoConteudo: tipo,
+		Largura:      config.Width,
+		Altura:       config.Height,
+		Miniatura:    miniatura.Bytes(),
+	}, nil
+}
+
+// reduzir encaixa a imagem num quadrado de lado pixels, mantendo a
+// proporção. Cada pixel da miniatura é a média da área que ele cobre no
+// original, e as transparências são compostas sobre branco, já que o JPEG
+// não as representa.
+func reduzir(original image.Image, lado int) *image.RGBA {
+	b := original.Bounds()
+	largura, altura := b.Dx(), b.Dy()
+	switch {
+	case largura <= lado && altura <= lado:
+	case largura >= altura:
+		largura, altura = lado, max(1, altura*lado/largura)
+	default:
+		largura, altura = max(1, largura*lado/altura), lado
+	}
+
+	miniatura := image.NewRGBA(image.Rect(0, 0, largura, altura))
+	for y := 0; y < altura; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/altura, b.Min.Y+(y+1)*b.Dy()/altura
+		for x := 0; x < largura; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/largura, b.Min.X+(x+1)*b.Dx()/largura
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := original.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			// As componentes já vêm multiplicadas pelo alfa; o branco
+			// preenche o que falta para a opacidade total
+			fundo := 0xffff - a/n
+			miniatura.SetRGBA(x, y, color.RGBA{
+				R: uint8((r/n + fundo) >> 8),
+				G: uint8((g/n + fundo) >> 8),
+				B: uint8((bl/n + fundo) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return miniatura
+}
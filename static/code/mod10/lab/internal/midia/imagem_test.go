@@ -0,0 +1,98 @@
+package midia_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/seu-usuario/lab6/internal/midia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessarImagem(t *testing.T) {
+	t.Run("Miniatura mantém a proporção", func(t *testing.T) {
+		dados := codificar(t, png.Encode, 1024, 512, color.RGBA{R: 200, A: 0xff})
+
+		processada, err := midia.ProcessarImagem(dados, "image/png")
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", processada.TipoConteudo)
+		assert.Equal(t, 1024, processada.Largura)
+		assert.Equal(t, 512, processada.Altura)
+
+		miniatura, formato, err := image.Decode(bytes.NewReader(processada.Miniatura))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "jpeg", formato)
+			assert.Equal(t, image.Rect(0, 0, midia.LadoMiniatura, midia.LadoMiniatura/2), miniatura.Bounds())
+			r, g, _, _ := miniatura.At(10, 10).RGBA()
+			assert.InDelta(t, 200, r>>8, 4)
+			assert.InDelta(t, 0, g>>8, 4)
+		}
+	})
+
+	t.Run("Imagens pequenas não são ampliadas", func(t *testing.T) {
+		dados := codificar(t, func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) }, 40, 90, color.RGBA{B: 0xff, A: 0xff})
+
+		processada, err := midia.ProcessarImagem(dados, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "image/gif", processada.TipoConteudo)
+		miniatura, err := jpeg.DecodeConfig(bytes.NewReader(processada.Miniatura))
+		if assert.NoError(t, err) {
+			assert.Equal(t, 40, miniatura.Width)
+			assert.Equal(t, 90, miniatura.Height)
+		}
+	})
+
+	t.Run("Transparência vira fundo branco", func(t *testing.T) {
+		dados := codificar(t, png.Encode, 16, 16, color.RGBA{})
+
+		processada, err := midia.ProcessarImagem(dados, "image/png")
+		assert.NoError(t, err)
+		miniatura, err := jpeg.Decode(bytes.NewReader(processada.Miniatura))
+		if assert.NoError(t, err) {
+			r, g, b, _ := miniatura.At(8, 8).RGBA()
+			assert.Equal(t, []uint32{0xff, 0xff, 0xff}, []uint32{r >> 8, g >> 8, b >> 8})
+		}
+	})
+
+	t.Run("Tipos não suportados ou divergentes", func(t *testing.T) {
+		_, err := midia.ProcessarImagem([]byte("não sou uma imagem"), "image/png")
+		assert.ErrorIs(t, err, midia.ErrTipoNaoSuportado)
+		_, err = midia.ProcessarImagem([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "image/svg+xml")
+		assert.ErrorIs(t, err, midia.ErrTipoNaoSuportado)
+
+		dados := codificar(t, png.Encode, 8, 8, color.RGBA{A: 0xff})
+		_, err = midia.ProcessarImagem(dados, "image/jpeg")
+		assert.ErrorIs(t, err, midia.ErrTipoNaoSuportado)
+		_, err = midia.ProcessarImagem(dados, "image/png; charset=binary")
+		assert.NoError(t, err)
+		_, err = midia.ProcessarImagem(dados, "application/octet-stream")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Imagem corrompida", func(t *testing.T) {
+		dados := codificar(t, png.Encode, 64, 64, color.RGBA{A: 0xff})
+
+		_, err := midia.ProcessarImagem(dados[:len(dados)/2], "image/png")
+		assert.ErrorIs(t, err, midia.ErrImagemInvalida)
+	})
+}
+
+// codificar gera uma imagem de cor única no formato de encode.
+func codificar(t *testing.T, encode func(w io.Writer, img image.Image) error, largura, altura int, cor color.RGBA) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, largura, altura))
+	for y := 0; y < altura; y++ {
+		for x := 0; x < largura; x++ {
+			img.SetRGBA(x, y, cor)
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, encode(&buf, img))
+	return buf.Bytes()
+}
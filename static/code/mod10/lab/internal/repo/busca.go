@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/seu-usuario/lab6/models"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrBuscaVazia = errors.New("termo de busca vazio")
+
+// stopwords replica as palavras mais comuns descartadas pelo dicionário
+// portuguese do PostgreSQL.
+var stopwords = map[string]bool{
+	"a": true, "o": true, "as": true, "os": true, "e": true, "de": true,
+	"da": true, "do": true, "das": true, "dos": true, "em": true, "no": true,
+	"na": true, "nos": true, "nas": true, "um": true, "uma": true, "com": true,
+	"para": true, "por": true, "sem": true,
+}
+
+// tokenizar quebra o texto em termos normalizados: minúsculos, sem acentos,
+// sem stopwords e reduzidos por radicalizar. É a contrapartida em memória da
+// configuração de busca portugues_sem_acento usada no PostgreSQL.
+func tokenizar(texto string) []string {
+	semAcento, _, _ := transform.String(
+		transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC),
+		strings.ToLower(texto),
+	)
+
+	palavras := strings.FieldsFunc(semAcento, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	termos := make([]string, 0, len(palavras))
+	for _, p := range palavras {
+		if stopwords[p] {
+			continue
+		}
+		termos = append(termos, radicalizar(p))
+	}
+	return termos
+}
+
+// radicalizar aplica uma redução simplificada de plural do português. Não
+// reproduz todo o stemmer Snowball do PostgreSQL, mas faz "cafés" e "café"
+// (ou "pães" e "pão") caírem no mesmo termo.
+func radicalizar(palavra string) string {
+	if len(palavra) <= 3 {
+		return palavra
+	}
+
+	for _, regra := range [...]struct{ sufixo, troca string }{
+		{"oes", "ao"}, {"aes", "ao"}, {"aos", "ao"},
+		{"ais", "al"}, {"eis", "el"}, {"ois", "ol"},
+		{"ns", "m"}, {"res", "r"}, {"zes", "z"}, {"s", ""},
+	} {
+		if strings.HasSuffix(palavra, regra.sufixo) {
+			return strings.TrimSuffix(palavra, regra.sufixo) + regra.troca
+		}
+	}
+	return palavra
+}
+
+// relevancia conta quantas vezes os termos da busca aparecem no texto.
+// Retorna zero se algum termo estiver ausente, pois a busca exige todos.
+func relevancia(termos []string, texto string) int {
+	frequencia := make(map[string]int)
+	for _, t := range tokenizar(texto) {
+		frequencia[t]++
+	}
+
+	total := 0
+	for _, t := range termos {
+		if frequencia[t] == 0 {
+			return 0
+		}
+		total += frequencia[t]
+	}
+	return total
+}
+
+// classificar seleciona os produtos ativos que contêm todos os termos e os
+// ordena pela relevância, desempatando pelo nome, até o limite.
+func classificar(termos []string, produtos []models.Produto, limite int) []models.Produto {
+	type candidato struct {
+		produto models.Produto
+		pontos  int
+	}
+	var candidatos []candidato
+	for _, p := range produtos {
+		if p.RemovidoEm.Valid || len(termos) == 0 {
+			continue
+		}
+		if pontos := relevancia(termos, p.Nome); pontos > 0 {
+			candidatos = append(candidatos, candidato{produto: p, pontos: pontos})
+		}
+	}
+
+	slices.SortFunc(candidatos, func(a, b candidato) int {
+		if a.pontos != b.pontos {
+			return b.pontos - a.pontos
+		}
+		return OrdenarPorNome.comparar(a.produto, b.produto)
+	})
+
+	resultado := make([]models.Produto, 0, min(len(candidatos), limite))
+	for _, c := range candidatos {
+		if len(resultado) == limite {
+			break
+		}
+		resultado = append(resultado, c.produto)
+	}
+	return resultado
+}
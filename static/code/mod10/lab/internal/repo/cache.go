@@ -0,0 +1,353 @@
+package repo
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	CapacidadeCachePadrao = 1000
+	TTLCachePadrao        = time.Minute
+	TTLNegativoPadrao     = 5 * time.Second
+)
+
+// OpcoesCache configura RepositorioComCache. Valores zerados usam os padrões.
+type OpcoesCache struct {
+	// Capacidade é o número máximo de IDs guardados, contando cada tenant à
+	// parte; ao excedê-la, o menos usado recentemente é descartado.
+	Capacidade int
+	// TTL é por quanto tempo um produto encontrado é servido do cache.
+	TTL time.Duration
+	// TTLNegativo é por quanto tempo um ID inexistente continua respondendo
+	// ErrProdutoNaoEncontrado sem consultar o repositório.
+	TTLNegativo time.Duration
+}
+
+// EstatisticasCache são os contadores acumulados de RepositorioComCache.
+type EstatisticasCache struct {
+	Acertos  int64 // Buscar respondido pelo cache, inclusive negativos
+	Falhas   int64 // Buscar que precisou consultar o repositório
+	Despejos int64 // entradas descartadas pelo limite de capacidade
+}
+
+// RepositorioComCache decora um RepositorioProdutos com um cache de leitura
+// para Buscar. Escritas feitas por ele, pelas unidades de trabalho envolvidas
+// por UnidadeDeTrabalho e pelos preços aplicados por RepositorioPrecos
+// invalidam as entradas afetadas; escritas feitas por fora (outra instância)
+// só aparecem depois do TTL, a menos que se chame Invalidar. As demais
+// operações são delegadas sem cache.
+type RepositorioComCache struct {
+	RepositorioProdutos
+
+	opcoes OpcoesCache
+	grupo  singleflight.Group
+
+	mu       sync.Mutex
+	lru      *list.List // de *entradaCache, mais recente na frente
+	entradas map[chaveCache]*list.Element
+	geracao  uint64 // incrementada a cada invalidação
+
+	acertos, falhas, despejos atomic.Int64
+}
+
+// chaveCache separa as entradas por tenant, já que o mesmo ID é
+// inexistente para os tenants que não são donos do produto.
+type chaveCache struct {
+	tenant string
+	id     uuid.UUID
+}
+
+func (c chaveCache) String() string {
+	return c.tenant + "/" + c.id.String()
+}
+
+type entradaCache struct {
+	chave    chaveCache
+	produto  models.Produto
+	existe   bool
+	expiraEm time.Time
+}
+
+// NovoRepositorioComCache envolve repo com o cache configurado por opcoes.
+func NovoRepositorioComCache(repo RepositorioProdutos, opcoes OpcoesCache) *RepositorioComCache {
+	if opcoes.Capacidade <= 0 {
+		opcoes.Capacidade = CapacidadeCachePadrao
+	}
+	if opcoes.TTL <= 0 {
+		opcoes.TTL = TTLCachePadrao
+	}
+	if opcoes.TTLNegativo <= 0 {
+		opcoes.TTLNegativo = TTLNegativoPadrao
+	}
+	return &RepositorioComCache{
+		RepositorioProdutos: repo,
+		opcoes:              opcoes,
+		lru:                 list.New(),
+		entradas:            make(map[chaveCache]*list.Element),
+	}
+}
+
+// Estatisticas retorna os contadores de acertos, falhas e despejos.
+func (r *RepositorioComCache) Estatisticas() EstatisticasCache {
+	return EstatisticasCache{
+		Acertos:  r.acertos.Load(),
+		Falhas:   r.falhas.Load(),
+		Despejos: r.despejos.Load(),
+	}
+}
+
+// Buscar responde pelo cache quando possível. Falhas simultâneas para o
+// mesmo ID fazem uma única consulta ao repositório, que não é cancelada se
+// apenas um dos chamadores desistir.
+func (r *RepositorioComCache) Buscar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Produto{}, fmt.Errorf("buscar produto: %w", err)
+	}
+
+	chave := chaveCache{tenant: tenantDe(ctx), id: id}
+	if e, ok := r.consultar(chave); ok {
+		r.acertos.Add(1)
+		if !e.existe {
+			return models.Produto{}, fmt.Errorf("buscar produto id %s: %w", id, ErrProdutoNaoEncontrado)
+		}
+		return e.produto, nil
+	}
+	r.falhas.Add(1)
+
+	resultado := r.grupo.DoChan(chave.String(), func() (any, error) {
+		r.mu.Lock()
+		geracao := r.geracao
+		r.mu.Unlock()
+
+		produto, err := r.RepositorioProdutos.Buscar(context.WithoutCancel(ctx), id)
+		switch {
+		case err == nil:
+			r.guardar(geracao, entradaCache{chave: chave, produto: produto, existe: true, expiraEm: time.Now().Add(r.opcoes.TTL)})
+		case errors.Is(err, ErrProdutoNaoEncontrado):
+			r.guardar(geracao, entradaCache{chave: chave, expiraEm: time.Now().Add(r.opcoes.TTLNegativo)})
+		}
+		return produto, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return models.Produto{}, fmt.Errorf("buscar produto: %w", ctx.Err())
+	case res := <-resultado:
+		if res.Err != nil {
+			return models.Produto{}, res.Err
+		}
+		return res.Val.(models.Produto), nil
+	}
+}
+
+// CriarComID delega a criação e invalida o produto no cache, que pode ter
+// guardado o ID como inexistente.
+func (r *RepositorioComCache) CriarComID(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	defer r.Invalidar(ctx, id)
+	return r.RepositorioProdutos.CriarComID(ctx, id, nome, preco)
+}
+
+// Atualizar delega a atualização e invalida o produto no cache.
+func (r *RepositorioComCache) Atualizar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro, versao int) (models.Produto, error) {
+	defer r.Invalidar(ctx, id)
+	return r.RepositorioProdutos.Atualizar(ctx, id, nome, preco, versao)
+}
+
+// Deletar delega a remoção e invalida o produto no cache.
+func (r *RepositorioComCache) Deletar(ctx context.Context, id uuid.UUID, versao int) error {
+	defer r.Invalidar(ctx, id)
+	return r.RepositorioProdutos.Deletar(ctx, id, versao)
+}
+
+// Restaurar delega a restauração e invalida o produto no cache, que pode
+// ter guardado o ID como inexistente.
+func (r *RepositorioComCache) Restaurar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	defer r.Invalidar(ctx, id)
+	return r.RepositorioProdutos.Restaurar(ctx, id)
+}
+
+// AplicarLote delega o lote e invalida os produtos atualizados ou removidos.
+func (r *RepositorioComCache) AplicarLote(ctx context.Context, operacoes []OperacaoLote) ([]ResultadoLote, error) {
+	defer func() {
+		for _, op := range operacoes {
+			if op.Tipo != OperacaoCriar {
+				r.Invalidar(ctx, op.ID)
+			}
+		}
+	}()
+	return r.RepositorioProdutos.AplicarLote(ctx, operacoes)
+}
+
+// consultar devolve a entrada válida da chave, marcando-a como a mais
+// recente.
+func (r *RepositorioComCache) consultar(chave chaveCache) (*entradaCache, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elemento, ok := r.entradas[chave]
+	if !ok {
+		return nil, false
+	}
+	e := elemento.Value.(*entradaCache)
+	if time.Now().After(e.expiraEm) {
+		r.lru.Remove(elemento)
+		delete(r.entradas, chave)
+		return nil, false
+	}
+	r.lru.MoveToFront(elemento)
+	return e, true
+}
+
+// guardar insere a entrada, a menos que alguma invalidação tenha ocorrido
+// desde geracao: nesse caso o valor lido pode já estar desatualizado.
+func (r *RepositorioComCache) guardar(geracao uint64, e entradaCache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if geracao != r.geracao {
+		return
+	}
+	if elemento, ok := r.entradas[e.chave]; ok {
+		elemento.Value = &e
+		r.lru.MoveToFront(elemento)
+		return
+	}
+	r.entradas[e.chave] = r.lru.PushFront(&e)
+
+	for r.lru.Len() > r.opcoes.Capacidade {
+		antiga := r.lru.Back()
+		r.lru.Remove(antiga)
+		delete(r.entradas, antiga.Value.(*entradaCache).chave)
+		r.despejos.Add(1)
+	}
+}
+
+// Invalidar descarta o ID do tenant do contexto e impede que consultas já em
+// andamento guardem o valor anterior à escrita. Quem escreve por fora do
+// cache deve chamá-lo depois de confirmar, com o contexto da escrita.
+func (r *RepositorioComCache) Invalidar(ctx context.Context, id uuid.UUID) {
+	r.invalidar(chaveCache{tenant: tenantDe(ctx), id: id})
+}
+
+func (r *RepositorioComCache) invalidar(chaves ...chaveCache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.geracao++
+	for _, chave := range chaves {
+		if elemento, ok := r.entradas[chave]; ok {
+			r.lru.Remove(elemento)
+			delete(r.entradas, chave)
+		}
+		r.grupo.Forget(chave.String())
+	}
+}
+
+// UnidadeDeTrabalho envolve u para que os produtos escritos pelos
+// repositórios da transação sejam invalidados depois que ela for confirmada.
+func (r *RepositorioComCache) UnidadeDeTrabalho(u UnidadeDeTrabalho) UnidadeDeTrabalho {
+	return &unidadeComCache{transacoes: u, cache: r}
+}
+
+type unidadeComCache struct {
+	transacoes UnidadeDeTrabalho
+	cache      *RepositorioComCache
+}
+
+// Executar implementa UnidadeDeTrabalho, entregando a fn um
+// RepositorioProdutos que anota os IDs escritos.
+func (u *unidadeComCache) Executar(ctx context.Context, fn func(ctx context.Context, repos Repositorios) error) error {
+	var escritos []chaveCache
+	err := u.transacoes.Executar(ctx, func(ctx context.Context, repos Repositorios) error {
+		repos.Produtos = &produtosAnotados{RepositorioProdutos: repos.Produtos, escritos: &escritos}
+		return fn(ctx, repos)
+	})
+	if err == nil {
+		u.cache.invalidar(escritos...)
+	}
+	return err
+}
+
+// produtosAnotados anota em escritos o tenant e o ID de cada produto que
+// uma escrita pode ter alterado, inclusive as que falharam.
+type produtosAnotados struct {
+	RepositorioProdutos
+	escritos *[]chaveCache
+}
+
+func (p *produtosAnotados) anotar(ctx context.Context, id uuid.UUID) {
+	*p.escritos = append(*p.escritos, chaveCache{tenant: tenantDe(ctx), id: id})
+}
+
+func (p *produtosAnotados) Criar(ctx context.Context, nome string, preco models.Dinheiro) (models.Produto, error) {
+	produto, err := p.RepositorioProdutos.Criar(ctx, nome, preco)
+	if err == nil {
+		p.anotar(ctx, produto.ID)
+	}
+	return produto, err
+}
+
+func (p *produtosAnotados) CriarComID(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	p.anotar(ctx, id)
+	return p.RepositorioProdutos.CriarComID(ctx, id, nome, preco)
+}
+
+func (p *produtosAnotados) Atualizar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro, versao int) (models.Produto, error) {
+	p.anotar(ctx, id)
+	return p.RepositorioProdutos.Atualizar(ctx, id, nome, preco, versao)
+}
+
+func (p *produtosAnotados) Deletar(ctx context.Context, id uuid.UUID, versao int) error {
+	p.anotar(ctx, id)
+	return p.RepositorioProdutos.Deletar(ctx, id, versao)
+}
+
+func (p *produtosAnotados) Restaurar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	p.anotar(ctx, id)
+	return p.RepositorioProdutos.Restaurar(ctx, id)
+}
+
+func (p *produtosAnotados) AplicarLote(ctx context.Context, operacoes []OperacaoLote) ([]ResultadoLote, error) {
+	resultados, err := p.RepositorioProdutos.AplicarLote(ctx, operacoes)
+	for _, op := range operacoes {
+		if op.Tipo != OperacaoCriar {
+			p.anotar(ctx, op.ID)
+		}
+	}
+	for _, resultado := range resultados {
+		if resultado.Produto != nil {
+			p.anotar(ctx, resultado.Produto.ID)
+		}
+	}
+	return resultados, err
+}
+
+// RepositorioPrecos envolve precos para que os produtos que recebem um
+// preço agendado sejam invalidados, no tenant de cada um.
+func (r *RepositorioComCache) RepositorioPrecos(precos RepositorioPrecos) RepositorioPrecos {
+	return &precosComCache{RepositorioPrecos: precos, cache: r}
+}
+
+type precosComCache struct {
+	RepositorioPrecos
+	cache *RepositorioComCache
+}
+
+func (p *precosComCache) AplicarPrecosAgendados(ctx context.Context, agora time.Time) ([]models.PrecoProduto, error) {
+	aplicados, err := p.RepositorioPrecos.AplicarPrecosAgendados(ctx, agora)
+	chaves := make([]chaveCache, 0, len(aplicados))
+	for _, preco := range aplicados {
+		chaves = append(chaves, chaveCache{tenant: preco.TenantID, id: preco.ProdutoID})
+	}
+	p.cache.invalidar(chaves...)
+	return aplicados, err
+}
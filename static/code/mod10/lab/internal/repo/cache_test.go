@@ -0,0 +1,308 @@
+package repo_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/internal/repo/repotest"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositorioComCache(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	repotest.Run(t, func(t *testing.T) repo.RepositorioProdutos {
+		return repo.NovoRepositorioComCache(repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger), repo.OpcoesCache{})
+	})
+}
+
+func TestRepositorioComCacheTenants(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	repotest.RunTenants(t, func(t *testing.T) repo.RepositorioProdutos {
+		return repo.NovoRepositorioComCache(repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger), repo.OpcoesCache{})
+	})
+}
+
+// contador conta as chamadas a Buscar e, se portao não for nil, as segura
+// até que ele seja fechado.
+type contador struct {
+	repo.RepositorioProdutos
+	buscas atomic.Int64
+	portao chan struct{}
+}
+
+func (c *contador) Buscar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	c.buscas.Add(1)
+	if c.portao != nil {
+		<-c.portao
+	}
+	return c.RepositorioProdutos.Buscar(ctx, id)
+}
+
+func novoCache(opcoes repo.OpcoesCache) (*repo.RepositorioComCache, *contador) {
+	c := &contador{RepositorioProdutos: repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, slog.New(slog.NewJSONHandler(io.Discard, nil)))}
+	return repo.NovoRepositorioComCache(c, opcoes), c
+}
+
+func TestRepositorioComCacheAcertos(t *testing.T) {
+	cache, c := novoCache(repo.OpcoesCache{})
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	produto, err := cache.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		encontrado, err := cache.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, produto, encontrado)
+	}
+	assert.Equal(t, int64(1), c.buscas.Load())
+	assert.Equal(t, repo.EstatisticasCache{Acertos: 2, Falhas: 1}, cache.Estatisticas())
+}
+
+func TestRepositorioComCacheTTL(t *testing.T) {
+	cache, c := novoCache(repo.OpcoesCache{TTL: 20 * time.Millisecond})
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	produto, err := cache.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+
+	_, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(2), c.buscas.Load())
+}
+
+func TestRepositorioComCacheNegativo(t *testing.T) {
+	cache, c := novoCache(repo.OpcoesCache{TTLNegativo: 20 * time.Millisecond})
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+	id := uuid.New()
+
+	for i := 0; i < 3; i++ {
+		_, err := cache.Buscar(ctx, id)
+		assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+	}
+	assert.Equal(t, int64(1), c.buscas.Load())
+
+	time.Sleep(30 * time.Millisecond)
+	_, err := cache.Buscar(ctx, id)
+	assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+	assert.Equal(t, int64(2), c.buscas.Load())
+}
+
+func TestRepositorioComCacheSeparaTenants(t *testing.T) {
+	cache, c := novoCache(repo.OpcoesCache{})
+	lojaA := repo.ComTenant(context.Background(), "loja-a")
+	lojaB := repo.ComTenant(context.Background(), "loja-b")
+
+	produto, err := cache.Criar(lojaA, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	_, err = cache.Buscar(lojaA, produto.ID)
+	assert.NoError(t, err)
+
+	// O produto guardado para loja-a não responde pela loja-b
+	_, err = cache.Buscar(lojaB, produto.ID)
+	assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+	encontrado, err := cache.Buscar(lojaA, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, produto, encontrado)
+	assert.Equal(t, int64(2), c.buscas.Load())
+}
+
+func TestRepositorioComCacheInvalidacao(t *testing.T) {
+	cache, _ := novoCache(repo.OpcoesCache{})
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	produto, err := cache.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	_, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+
+	// Atualizar invalida a entrada
+	atualizado, err := cache.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), produto.Versao)
+	assert.NoError(t, err)
+	encontrado, err := cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, atualizado, encontrado)
+
+	// Deletar também; depois disso o ID fica em cache como inexistente
+	assert.NoError(t, cache.Deletar(ctx, produto.ID, atualizado.Versao))
+	_, err = cache.Buscar(ctx, produto.ID)
+	assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+
+	// Restaurar descarta a entrada negativa
+	restaurado, err := cache.Restaurar(ctx, produto.ID)
+	assert.NoError(t, err)
+	encontrado, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, restaurado, encontrado)
+
+	// E o lote invalida os produtos que altera
+	_, err = cache.AplicarLote(ctx, []repo.OperacaoLote{
+		{Tipo: repo.OperacaoAtualizar, ID: produto.ID, Nome: "Laptop Air", Preco: models.Centavos(89999), Versao: repo.QualquerVersao},
+	})
+	assert.NoError(t, err)
+	encontrado, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Laptop Air", encontrado.Nome)
+}
+
+func TestRepositorioComCacheUnidadeDeTrabalho(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	memoria := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+	cache := repo.NovoRepositorioComCache(memoria, repo.OpcoesCache{TTL: time.Hour, TTLNegativo: time.Hour})
+	transacoes := cache.UnidadeDeTrabalho(repo.NovaUnidadeDeTrabalhoEmMemoria(memoria, logger))
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	produto, err := cache.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	_, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	novoID := uuid.New()
+	_, err = cache.Buscar(ctx, novoID)
+	assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+
+	// Uma transação desfeita não altera o que o cache responde
+	err = transacoes.Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+		if _, err := repos.Produtos.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), repo.QualquerVersao); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	encontrado, err := cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, produto, encontrado)
+
+	// Ao confirmar, o produto atualizado e o criado deixam o cache
+	err = transacoes.Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+		if _, err := repos.Produtos.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), repo.QualquerVersao); err != nil {
+			return err
+		}
+		_, err := repos.Produtos.CriarComID(ctx, novoID, "Mouse", models.Centavos(2999))
+		return err
+	})
+	assert.NoError(t, err)
+	encontrado, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Laptop Pro", encontrado.Nome)
+	criado, err := cache.Buscar(ctx, novoID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Mouse", criado.Nome)
+}
+
+func TestRepositorioComCachePrecosAgendados(t *testing.T) {
+	memoria := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cache := repo.NovoRepositorioComCache(memoria, repo.OpcoesCache{TTL: time.Hour})
+	precos := cache.RepositorioPrecos(memoria)
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	produto, err := cache.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	_, err = cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+
+	vigenteDe := time.Now().Add(time.Minute)
+	_, err = precos.AgendarPreco(ctx, produto.ID, models.Centavos(89999), vigenteDe)
+	assert.NoError(t, err)
+	aplicados, err := precos.AplicarPrecosAgendados(ctx, vigenteDe)
+	assert.NoError(t, err)
+	assert.Len(t, aplicados, 1)
+
+	// O preço aplicado invalida o produto no tenant dele
+	encontrado, err := cache.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Centavos(89999), encontrado.Preco)
+}
+
+func TestRepositorioComCacheLRU(t *testing.T) {
+	cache, c := novoCache(repo.OpcoesCache{Capacidade: 2})
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	var produtos []models.Produto
+	for _, nome := range []string{"A", "B", "C"} {
+		p, err := cache.Criar(ctx, nome, models.Centavos(100))
+		assert.NoError(t, err)
+		produtos = append(produtos, p)
+	}
+
+	// A e B entram; usar A torna B o menos recente, que C então despeja
+	for _, i := range []int{0, 1, 0, 2} {
+		_, err := cache.Buscar(ctx, produtos[i].ID)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(1), cache.Estatisticas().Despejos)
+
+	buscas := c.buscas.Load()
+	_, err := cache.Buscar(ctx, produtos[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, buscas, c.buscas.Load(), "A deveria continuar em cache")
+	_, err = cache.Buscar(ctx, produtos[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, buscas+1, c.buscas.Load(), "B deveria ter sido despejado")
+}
+
+func TestRepositorioComCacheSingleflight(t *testing.T) {
+	cache, c := novoCache(repo.OpcoesCache{})
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	produto, err := cache.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+
+	c.portao = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			encontrado, err := cache.Buscar(ctx, produto.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, produto, encontrado)
+		}()
+	}
+
+	// Esperar todas as buscas falharem no cache antes de liberar o banco
+	assert.Eventually(t, func() bool { return cache.Estatisticas().Falhas == 10 }, time.Second, time.Millisecond)
+	close(c.portao)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), c.buscas.Load())
+}
+
+func TestRepositorioComCacheCancelamento(t *testing.T) {
+	cache, c := novoCache(repo.OpcoesCache{})
+	padrao := repo.ComTenant(context.Background(), repo.TenantPadrao)
+	produto, err := cache.Criar(padrao, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+
+	// Quem desiste não cancela a consulta compartilhada
+	c.portao = make(chan struct{})
+	ctx, cancel := context.WithCancel(padrao)
+	erros := make(chan error)
+	go func() {
+		_, err := cache.Buscar(ctx, produto.ID)
+		erros <- err
+	}()
+	assert.Eventually(t, func() bool { return c.buscas.Load() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-erros, context.Canceled)
+
+	close(c.portao)
+	assert.Eventually(t, func() bool {
+		_, err := cache.Buscar(padrao, produto.ID)
+		return err == nil && cache.Estatisticas().Acertos > 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(1), c.buscas.Load())
+}
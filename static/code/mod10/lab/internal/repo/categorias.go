@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+var ErrCategoriaNaoEncontrada = errors.New("categoria não encontrada")
+
+// RepositorioCategorias mantém a árvore de categorias e a associação, muitos
+// para muitos, entre categorias e produtos. Os repositórios de produtos
+// também o implementam, de modo que uma UnidadeDeTrabalho grava produtos e
+// categorias na mesma transação.
+type RepositorioCategorias interface {
+	// CriarCategoria cria uma categoria filha de paiID, ou raiz se paiID
+	// for nil.
+	CriarCategoria(ctx context.Context, nome string, paiID *uuid.UUID) (models.Categoria, error)
+	// ListarCategorias retorna todas as categorias ordenadas por nome.
+	ListarCategorias(ctx context.Context) ([]models.Categoria, error)
+	// ProdutosDaCategoria retorna os produtos ativos da categoria ordenados
+	// por nome, incluindo os das subcategorias se incluirDescendentes.
+	ProdutosDaCategoria(ctx context.Context, id uuid.UUID, incluirDescendentes bool) ([]models.Produto, error)
+	// AtribuirCategorias substitui as categorias do produto pelas informadas.
+	// Com NomeUnicoNaCategoria, recusa com *ProdutoDuplicadoError uma
+	// categoria onde outro produto ativo já usa o nome.
+	AtribuirCategorias(ctx context.Context, produtoID uuid.UUID, categorias []uuid.UUID) error
+	// CategoriasDoProduto retorna os IDs das categorias do produto em ordem.
+	CategoriasDoProduto(ctx context.Context, produtoID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// NoCategoria é uma categoria com suas subcategorias, para exibir a árvore.
+type NoCategoria struct {
+	models.Categoria
+	Filhas []NoCategoria `json:"filhas"`
+}
+
+// ArvoreDeCategorias monta a árvore a partir da lista de categorias,
+// preservando a ordem recebida entre irmãs. Categorias cujo pai não está na
+// lista viram raízes.
+func ArvoreDeCategorias(categorias []models.Categoria) []NoCategoria {
+	presentes := make(map[uuid.UUID]bool, len(categorias))
+	filhas := make(map[uuid.UUID][]models.Categoria)
+	var raizes []models.Categoria
+	for _, c := range categorias {
+		presentes[c.ID] = true
+	}
+	for _, c := range categorias {
+		if c.PaiID == nil || !presentes[*c.PaiID] {
+			raizes = append(raizes, c)
+			continue
+		}
+		filhas[*c.PaiID] = append(filhas[*c.PaiID], c)
+	}
+
+	var montar func([]models.Categoria) []NoCategoria
+	montar = func(categorias []models.Categoria) []NoCategoria {
+		nos := make([]NoCategoria, 0, len(categorias))
+		for _, c := range categorias {
+			nos = append(nos, NoCategoria{Categoria: c, Filhas: montar(filhas[c.ID])})
+		}
+		return nos
+	}
+	return montar(raizes)
+}
+
+// compararCategorias ordena por nome e, em empates, por ID.
+func compararCategorias(a, b models.Categoria) int {
+	if c := strings.Compare(a.Nome, b.Nome); c != 0 {
+		return c
+	}
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+// normalizarCategorias ordena os IDs e descarta repetições.
+func normalizarCategorias(ids []uuid.UUID) []uuid.UUID {
+	ids = slices.Clone(ids)
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	return slices.Compact(ids)
+}
+
+// consultaProdutosDaCategoria monta a consulta SQL de ProdutosDaCategoria,
+// que recebe o ID da categoria e o tenant dos produtos, nessa ordem. A CTE
+// recursiva só desce para as subcategorias se incluirDescendentes.
+// colunaNome e os marcadores (os placeholders dos parâmetros) variam com o
+// banco.
+func consultaProdutosDaCategoria(incluirDescendentes bool, colunaNome, marcadorCategoria, marcadorTenant string) string {
+	arvore := "SELECT id FROM categorias WHERE id = " + marcadorCategoria
+	if incluirDescendentes {
+		arvore += " UNION SELECT c.id FROM categorias c JOIN arvore a ON c.pai_id = a.id"
+	}
+	return fmt.Sprintf(`WITH RECURSIVE arvore (id) AS (%s)
+SELECT %s FROM produtos
+WHERE tenant_id = %s AND deleted_at IS NULL AND EXISTS (
+	SELECT 1 FROM produto_categorias pc
+	WHERE pc.produto_id = produtos.id AND pc.categoria_id IN (SELECT id FROM arvore)
+)
+ORDER BY %s, id`, arvore, colunasProduto, marcadorTenant, colunaNome)
+}
@@ -0,0 +1,32 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArvoreDeCategorias(t *testing.T) {
+	alimentos := models.Categoria{ID: uuid.New(), Nome: "Alimentos"}
+	frutas := models.Categoria{ID: uuid.New(), Nome: "Frutas", PaiID: &alimentos.ID}
+	secas := models.Categoria{ID: uuid.New(), Nome: "Frutas secas", PaiID: &frutas.ID}
+	graos := models.Categoria{ID: uuid.New(), Nome: "Grãos", PaiID: &alimentos.ID}
+	ausente := uuid.New()
+	orfa := models.Categoria{ID: uuid.New(), Nome: "Órfã", PaiID: &ausente}
+
+	arvore := repo.ArvoreDeCategorias([]models.Categoria{alimentos, frutas, secas, graos, orfa})
+	assert.Equal(t, []repo.NoCategoria{
+		{Categoria: alimentos, Filhas: []repo.NoCategoria{
+			{Categoria: frutas, Filhas: []repo.NoCategoria{
+				{Categoria: secas, Filhas: []repo.NoCategoria{}},
+			}},
+			{Categoria: graos, Filhas: []repo.NoCategoria{}},
+		}},
+		{Categoria: orfa, Filhas: []repo.NoCategoria{}},
+	}, arvore)
+
+	assert.Empty(t, repo.ArvoreDeCategorias(nil))
+}
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+var (
+	ErrQuantidadeInvalida   = errors.New("quantidade inválida")
+	ErrEstoqueInsuficiente  = errors.New("estoque insuficiente")
+	ErrReservaNaoEncontrada = errors.New("reserva não encontrada")
+	ErrReservaExpirada      = errors.New("reserva expirada")
+	ErrReservaEncerrada     = errors.New("reserva já encerrada")
+)
+
+// StatusReserva é a situação de uma reserva. Só reservas pendentes ocupam
+// estoque; as demais estão encerradas e não mudam mais.
+type StatusReserva string
+
+const (
+	ReservaPendente   StatusReserva = "pendente"
+	ReservaConfirmada StatusReserva = "confirmada"
+	ReservaLiberada   StatusReserva = "liberada"
+	ReservaExpirada   StatusReserva = "expirada"
+)
+
+// ValidadeReservaPadrao é usada por Reservar quando a validade não é positiva.
+const ValidadeReservaPadrao = 15 * time.Minute
+
+// RepositorioEstoque controla o estoque dos produtos e as reservas sobre ele.
+// Cada operação é atômica e serializada por produto, de modo que reservas
+// concorrentes nunca somam mais que a quantidade em mãos. Os repositórios de
+// produtos também o implementam.
+type RepositorioEstoque interface {
+	// DefinirEstoque fixa a quantidade em mãos do produto, que não pode
+	// ficar abaixo do que está reservado.
+	DefinirEstoque(ctx context.Context, produtoID uuid.UUID, quantidade int) (models.Estoque, error)
+	// ConsultarEstoque retorna o estoque do produto; um produto sem estoque
+	// definido tem quantidade zero.
+	ConsultarEstoque(ctx context.Context, produtoID uuid.UUID) (models.Estoque, error)
+	// Reservar separa a quantidade do estoque disponível por validade, ou
+	// por ValidadeReservaPadrao se validade não for positiva.
+	Reservar(ctx context.Context, produtoID uuid.UUID, quantidade int, validade time.Duration) (models.Reserva, error)
+	// ConfirmarReserva baixa a quantidade reservada do estoque. Confirmar
+	// de novo não tem efeito.
+	ConfirmarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error)
+	// LiberarReserva devolve a quantidade reservada ao disponível. Liberar
+	// uma reserva já liberada ou expirada não tem efeito.
+	LiberarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error)
+	// ExpirarReservas libera as reservas pendentes vencidas em agora e
+	// retorna quantas foram expiradas.
+	ExpirarReservas(ctx context.Context, agora time.Time) (int64, error)
+}
+
+// novaReserva monta uma reserva pendente do tenant criada agora.
+func novaReserva(tenant string, produtoID uuid.UUID, quantidade int, validade time.Duration) models.Reserva {
+	if validade <= 0 {
+		validade = ValidadeReservaPadrao
+	}
+	agora := time.Now().UTC()
+	return models.Reserva{
+		ID:         uuid.New(),
+		ProdutoID:  produtoID,
+		TenantID:   tenant,
+		Quantidade: quantidade,
+		Status:     string(ReservaPendente),
+		CriadaEm:   agora,
+		ExpiraEm:   agora.Add(validade),
+	}
+}
+
+// vencida informa se a reserva pendente já passou da validade em agora.
+func vencida(reserva models.Reserva, agora time.Time) bool {
+	return reserva.Status == string(ReservaPendente) && !reserva.ExpiraEm.After(agora)
+}
+
+// encerrarReserva decide a transição de uma reserva para o status alvo
+// (confirmada ou liberada). Retorna false quando não há nada a fazer porque
+// a reserva já está no estado pedido, ou um erro quando a transição não é
+// permitida.
+func encerrarReserva(reserva models.Reserva, alvo StatusReserva, agora time.Time) (bool, error) {
+	switch StatusReserva(reserva.Status) {
+	case ReservaPendente:
+		if alvo == ReservaConfirmada && vencida(reserva, agora) {
+			return false, ErrReservaExpirada
+		}
+		return true, nil
+	case alvo:
+		return false, nil
+	case ReservaExpirada:
+		if alvo == ReservaLiberada {
+			return false, nil
+		}
+		return false, ErrReservaExpirada
+	default:
+		return false, ErrReservaEncerrada
+	}
+}
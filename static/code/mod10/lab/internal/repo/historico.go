@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+// OperacaoRestaurar só aparece no histórico; não é aceita em lotes.
+const OperacaoRestaurar TipoOperacao = "restaurar"
+
+// AutorPadrao identifica alterações feitas sem um autor no contexto.
+const AutorPadrao = "sistema"
+
+type chaveAutor struct{}
+
+// ComAutor associa ao contexto o responsável pelas alterações que serão
+// registradas no histórico.
+func ComAutor(ctx context.Context, autor string) context.Context {
+	return context.WithValue(ctx, chaveAutor{}, autor)
+}
+
+func autorDe(ctx context.Context) string {
+	if autor, ok := ctx.Value(chaveAutor{}).(string); ok && autor != "" {
+		return autor
+	}
+	return AutorPadrao
+}
+
+// novoHistorico monta o registro de uma alteração. antes deve ser nil na
+// criação; os estados são copiados para que alterações posteriores não os
+// afetem.
+func novoHistorico(ctx context.Context, operacao TipoOperacao, antes, depois *models.Produto) models.HistoricoProduto {
+	h := models.HistoricoProduto{
+		ID:           uuid.New(),
+		Operacao:     string(operacao),
+		Autor:        autorDe(ctx),
+		RegistradoEm: time.Now(),
+	}
+	if antes != nil {
+		copia := *antes
+		h.Antes = &copia
+		h.ProdutoID, h.TenantID = antes.ID, antes.TenantID
+	}
+	if depois != nil {
+		copia := *depois
+		h.Depois = &copia
+		h.ProdutoID, h.TenantID = depois.ID, depois.TenantID
+	}
+	return h
+}
@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+// ErrImagemNaoEncontrada indica uma imagem inexistente no produto.
+var ErrImagemNaoEncontrada = errors.New("imagem não encontrada")
+
+// RepositorioImagens guarda os metadados das imagens dos produtos. Os
+// arquivos ficam com o chamador, num armazenamento de blobs; por isso as
+// remoções devolvem as imagens excluídas, cujos arquivos ele deve apagar.
+// Os repositórios de produtos também o implementam.
+type RepositorioImagens interface {
+	// AdicionarImagem registra a imagem, com o ID já escolhido pelo
+	// chamador, no produto ativo, preenchendo TenantID e CriadaEm.
+	AdicionarImagem(ctx context.Context, imagem models.Imagem) (models.Imagem, error)
+	// Imagens retorna as imagens de cada produto ativo entre produtoIDs, em
+	// ordem de CriadaEm. Produtos sem imagens, removidos ou de outro tenant
+	// ficam fora do mapa.
+	Imagens(ctx context.Context, produtoIDs []uuid.UUID) (map[uuid.UUID][]models.Imagem, error)
+	// RemoverImagem exclui a imagem do produto ativo e a retorna.
+	RemoverImagem(ctx context.Context, produtoID, imagemID uuid.UUID) (models.Imagem, error)
+	// ExpurgarImagens exclui, de todos os tenants, as imagens dos produtos
+	// removidos antes do instante e as retorna. A rotina de retenção o chama
+	// antes de Purgar, que levaria os metadados sem apagar os arquivos.
+	ExpurgarImagens(ctx context.Context, removidosAntesDe time.Time) ([]models.Imagem, error)
+	// ExpurgarImagensDoProduto exclui as imagens do produto removido e as
+	// retorna, para que a remoção do produto apague também os arquivos.
+	// Restaurar o produto depois não as traz de volta.
+	ExpurgarImagensDoProduto(ctx context.Context, produtoID uuid.UUID) ([]models.Imagem, error)
+}
+
+// ordenarImagens ordena as imagens por CriadaEm, desempatando pelo ID.
+func ordenarImagens(imagens []models.Imagem) {
+	slices.SortFunc(imagens, func(a, b models.Imagem) int {
+		if c := a.CriadaEm.Compare(b.CriadaEm); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+}
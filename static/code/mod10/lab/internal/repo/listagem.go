@@ -0,0 +1,190 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+const (
+	LimitePadrao = 20
+	LimiteMaximo = 100
+)
+
+var (
+	ErrCursorInvalido    = errors.New("cursor inválido")
+	ErrOrdenacaoInvalida = errors.New("ordenação inválida")
+)
+
+// Ordenacao define o critério de ordenação da listagem. O prefixo "-" indica
+// ordem decrescente. O ID é sempre usado como critério de desempate.
+type Ordenacao string
+
+const (
+	OrdenarPorNome      Ordenacao = "nome"
+	OrdenarPorNomeDesc  Ordenacao = "-nome"
+	OrdenarPorPreco     Ordenacao = "preco"
+	OrdenarPorPrecoDesc Ordenacao = "-preco"
+)
+
+// FiltroListagem reúne os filtros, a ordenação e a paginação de Listar.
+// Produtos removidos logicamente só aparecem com IncluirRemovidos.
+type FiltroListagem struct {
+	Nome             string           `form:"nome"`
+	PrecoMin         *models.Dinheiro `form:"preco_min"`
+	PrecoMax         *models.Dinheiro `form:"preco_max"`
+	IncluirRemovidos bool             `form:"incluir_removidos"`
+	Ordenacao        Ordenacao        `form:"ordenar"`
+	Limite           int              `form:"limit"`
+	Cursor           string           `form:"cursor"`
+}
+
+// Pagina é uma página de resultados de Listar. ProximoCursor fica vazio na
+// última página.
+type Pagina struct {
+	Produtos      []models.Produto `json:"produtos"`
+	ProximoCursor string           `json:"next_cursor,omitempty"`
+}
+
+// cursor guarda a chave de ordenação do último produto entregue.
+type cursor struct {
+	Ordenacao Ordenacao `json:"o"`
+	Nome      string    `json:"n,omitempty"`
+	Centavos  int64     `json:"p,omitempty"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// normalizar aplica os valores padrão e valida o filtro, decodificando o
+// cursor quando presente.
+func (f FiltroListagem) normalizar() (FiltroListagem, *cursor, error) {
+	switch f.Ordenacao {
+	case "":
+		f.Ordenacao = OrdenarPorNome
+	case OrdenarPorNome, OrdenarPorNomeDesc, OrdenarPorPreco, OrdenarPorPrecoDesc:
+	default:
+		return f, nil, fmt.Errorf("ordenação %q: %w", f.Ordenacao, ErrOrdenacaoInvalida)
+	}
+
+	f.Limite = normalizarLimite(f.Limite)
+
+	if f.Cursor == "" {
+		return f, nil, nil
+	}
+
+	c, err := decodificarCursor(f.Cursor)
+	if err != nil {
+		return f, nil, err
+	}
+	if c.Ordenacao != f.Ordenacao {
+		return f, nil, fmt.Errorf("cursor gerado para ordenação %q: %w", c.Ordenacao, ErrCursorInvalido)
+	}
+
+	return f, c, nil
+}
+
+// normalizarLimite troca limites ausentes pelo padrão e limita ao máximo.
+func normalizarLimite(limite int) int {
+	if limite <= 0 {
+		return LimitePadrao
+	}
+	return min(limite, LimiteMaximo)
+}
+
+// aceita informa se o produto satisfaz os filtros de remoção, nome e preço.
+func (f FiltroListagem) aceita(p models.Produto) bool {
+	if !f.IncluirRemovidos && p.RemovidoEm.Valid {
+		return false
+	}
+	if f.Nome != "" && !strings.Contains(strings.ToLower(p.Nome), strings.ToLower(f.Nome)) {
+		return false
+	}
+	if f.PrecoMin != nil && p.Preco.Centavos < f.PrecoMin.Centavos {
+		return false
+	}
+	if f.PrecoMax != nil && p.Preco.Centavos > f.PrecoMax.Centavos {
+		return false
+	}
+	return true
+}
+
+func (o Ordenacao) decrescente() bool {
+	return strings.HasPrefix(string(o), "-")
+}
+
+// comparar ordena dois produtos segundo o critério, comparando nomes byte a
+// byte (equivalente ao COLLATE "C" do PostgreSQL) e desempatando pelo ID.
+func (o Ordenacao) comparar(a, b models.Produto) int {
+	var r int
+	switch o {
+	case OrdenarPorPreco, OrdenarPorPrecoDesc:
+		switch {
+		case a.Preco.Centavos < b.Preco.Centavos:
+			r = -1
+		case a.Preco.Centavos > b.Preco.Centavos:
+			r = 1
+		}
+	default:
+		r = strings.Compare(a.Nome, b.Nome)
+	}
+	if r == 0 {
+		r = bytes.Compare(a.ID[:], b.ID[:])
+	}
+	if o.decrescente() {
+		r = -r
+	}
+	return r
+}
+
+// posterior informa se o produto vem depois do cursor na ordenação.
+func (c *cursor) posterior(p models.Produto) bool {
+	return c.Ordenacao.comparar(p, models.Produto{ID: c.ID, Nome: c.Nome, Preco: models.Centavos(c.Centavos)}) > 0
+}
+
+func novoCursor(o Ordenacao, p models.Produto) string {
+	c := cursor{Ordenacao: o, ID: p.ID}
+	switch o {
+	case OrdenarPorPreco, OrdenarPorPrecoDesc:
+		c.Centavos = p.Preco.Centavos
+	default:
+		c.Nome = p.Nome
+	}
+
+	dados, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(dados)
+}
+
+func decodificarCursor(s string) (*cursor, error) {
+	dados, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decodificar cursor: %w", ErrCursorInvalido)
+	}
+
+	var c cursor
+	if err := json.Unmarshal(dados, &c); err != nil {
+		return nil, fmt.Errorf("decodificar cursor: %w", ErrCursorInvalido)
+	}
+	return &c, nil
+}
+
+// paginar recebe até Limite+1 produtos já ordenados e monta a página,
+// gerando o próximo cursor quando há mais resultados.
+func paginar(f FiltroListagem, produtos []models.Produto) Pagina {
+	if produtos == nil {
+		produtos = []models.Produto{}
+	}
+	if len(produtos) <= f.Limite {
+		return Pagina{Produtos: produtos}
+	}
+
+	produtos = produtos[:f.Limite]
+	return Pagina{
+		Produtos:      produtos,
+		ProximoCursor: novoCursor(f.Ordenacao, produtos[len(produtos)-1]),
+	}
+}
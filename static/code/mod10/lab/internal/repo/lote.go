@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+// LoteMaximo limita a quantidade de operações aceitas em um único lote.
+const LoteMaximo = 1000
+
+var (
+	ErrLoteRejeitado    = errors.New("lote rejeitado: nenhuma operação foi aplicada")
+	ErrLoteMuitoGrande  = errors.New("lote excede o limite de operações")
+	ErrOperacaoInvalida = errors.New("operação inválida")
+)
+
+// TipoOperacao identifica o que uma OperacaoLote faz.
+type TipoOperacao string
+
+const (
+	OperacaoCriar     TipoOperacao = "criar"
+	OperacaoAtualizar TipoOperacao = "atualizar"
+	OperacaoDeletar   TipoOperacao = "deletar"
+)
+
+// OperacaoLote descreve uma operação de AplicarLote. ID e Versao são usados
+// apenas por atualizar e deletar.
+type OperacaoLote struct {
+	Tipo   TipoOperacao    `json:"operacao" binding:"required,oneof=criar atualizar deletar"`
+	ID     uuid.UUID       `json:"id"`
+	Nome   string          `json:"nome"`
+	Preco  models.Dinheiro `json:"preco"`
+	Versao int             `json:"versao"`
+}
+
+// ResultadoLote relata o desfecho de uma operação, na mesma posição em que
+// ela foi enviada.
+type ResultadoLote struct {
+	Indice  int             `json:"indice"`
+	Produto *models.Produto `json:"produto,omitempty"`
+	Erro    string          `json:"erro,omitempty"`
+}
+
+// aplicarOperacao executa uma operação do lote sobre o repositório. Criar e
+// atualizar recusam com ErrOperacaoInvalida nome e preço que POST /produtos
+// também recusaria.
+func aplicarOperacao(ctx context.Context, repo RepositorioProdutos, op OperacaoLote) (*models.Produto, error) {
+	if op.Tipo == OperacaoCriar || op.Tipo == OperacaoAtualizar {
+		if err := validarProduto(op.Nome, op.Preco); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrOperacaoInvalida, err)
+		}
+	}
+
+	switch op.Tipo {
+	case OperacaoCriar:
+		produto, err := repo.Criar(ctx, op.Nome, op.Preco)
+		if err != nil {
+			return nil, err
+		}
+		return &produto, nil
+	case OperacaoAtualizar:
+		produto, err := repo.Atualizar(ctx, op.ID, op.Nome, op.Preco, op.Versao)
+		if err != nil {
+			return nil, err
+		}
+		return &produto, nil
+	case OperacaoDeletar:
+		return nil, repo.Deletar(ctx, op.ID, op.Versao)
+	default:
+		return nil, fmt.Errorf("operação %q: %w", op.Tipo, ErrOperacaoInvalida)
+	}
+}
+
+// executarLote aplica todas as operações, mesmo após uma falha, para que o
+// relatório traga o erro de cada item. Retorna também a quantidade de falhas.
+func executarLote(operacoes []OperacaoLote, aplicar func(OperacaoLote) (*models.Produto, error)) ([]ResultadoLote, int) {
+	resultados := make([]ResultadoLote, len(operacoes))
+	falhas := 0
+	for i, op := range operacoes {
+		resultados[i].Indice = i
+
+		produto, err := aplicar(op)
+		if err != nil {
+			resultados[i].Erro = err.Error()
+			falhas++
+			continue
+		}
+		resultados[i].Produto = produto
+	}
+	return resultados, falhas
+}
@@ -1,57 +1,176 @@
 package repo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/seu-usuario/lab6/models"
+	"gorm.io/gorm"
 )
 
 var (
-	ErrPrecoInvalido        = errors.New("preço não pode ser negativo")
+	ErrPrecoInvalido        = models.ErrPrecoInvalido
 	ErrProdutoNaoEncontrado = errors.New("produto não encontrado")
+	ErrConflitoDeVersao     = errors.New("produto modificado por outra operação")
+	ErrProdutoDuplicado     = errors.New("nome já usado por outro produto")
+	ErrIDEmUso              = errors.New("id já usado por outro produto")
 )
 
+// ProdutoDuplicadoError detalha ErrProdutoDuplicado com o produto ativo que
+// já usa o nome. Numa corrida entre duas escritas com o mesmo nome, a
+// perdedora pode receber ErrProdutoDuplicado sem esse detalhe.
+type ProdutoDuplicadoError struct {
+	Nome        string
+	ExistenteID uuid.UUID
+}
+
+func (e *ProdutoDuplicadoError) Error() string {
+	return fmt.Sprintf("%v: %q é o nome do produto id %s", ErrProdutoDuplicado, e.Nome, e.ExistenteID)
+}
+
+func (e *ProdutoDuplicadoError) Unwrap() error {
+	return ErrProdutoDuplicado
+}
+
+// QualquerVersao desativa a verificação de versão em Atualizar e Deletar.
+const QualquerVersao = 0
+
+// RepositorioProdutos restringe cada operação ao tenant do contexto (veja
+// ComTenant): produtos de outros tenants respondem ErrProdutoNaoEncontrado. A
+// exceção é Purgar, a rotina de retenção, que expurga os removidos de todos
+// os tenants.
+//
+// Os produtos ativos de um tenant têm nomes únicos, sem distinção entre
+// maiúsculas e minúsculas, no escopo do repositório (veja OpcoesRepositorio): o
+// tenant inteiro ou cada categoria. Criar, Atualizar, Restaurar e o lote
+// recusam um nome em uso com *ProdutoDuplicadoError; removidos não ocupam o
+// nome.
 type RepositorioProdutos interface {
-	Criar(nome string, preco float64) (models.Produto, error)
-	Buscar(id uuid.UUID) (models.Produto, error)
-	Listar() ([]models.Produto, error)
-	Atualizar(id uuid.UUID, nome string, preco float64) (models.Produto, error)
-	Deletar(id uuid.UUID) error
+	Criar(ctx context.Context, nome string, preco models.Dinheiro) (models.Produto, error)
+	// CriarComID cria o produto com o ID informado, para que a importação
+	// do catálogo recrie produtos exportados de outra base. Um ID já usado,
+	// mesmo por um removido ou por outro tenant, é recusado com ErrIDEmUso.
+	CriarComID(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error)
+	Buscar(ctx context.Context, id uuid.UUID) (models.Produto, error)
+	Listar(ctx context.Context, filtro FiltroListagem) (Pagina, error)
+	Pesquisar(ctx context.Context, termo string, limite int) ([]models.Produto, error)
+	Atualizar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro, versao int) (models.Produto, error)
+	Deletar(ctx context.Context, id uuid.UUID, versao int) error
+	Restaurar(ctx context.Context, id uuid.UUID) (models.Produto, error)
+	Purgar(ctx context.Context, removidosAntesDe time.Time) (int64, error)
+	AplicarLote(ctx context.Context, operacoes []OperacaoLote) ([]ResultadoLote, error)
+	Historico(ctx context.Context, id uuid.UUID) ([]models.HistoricoProduto, error)
 }
 
+// RepositorioEmMemoria é seguro para uso concorrente: escritas usam o lock
+// exclusivo e leituras compartilham o lock de leitura, de modo que Listar
+// sempre enxerga um retrato consistente do mapa. Criado por
+// AbrirRepositorioEmMemoria, também grava as alterações em disco.
 type RepositorioEmMemoria struct {
-	produtos map[uuid.UUID]models.Produto
-	logger   *slog.Logger
+	mu        sync.RWMutex
+	produtos  map[uuid.UUID]models.Produto
+	historico map[uuid.UUID][]models.HistoricoProduto
+	// categorias e vinculos (produto → IDs das categorias em ordem) servem
+	// RepositorioCategorias
+	categorias map[uuid.UUID]models.Categoria
+	vinculos   map[uuid.UUID][]uuid.UUID
+	// estoques e reservas servem RepositorioEstoque; o lock exclusivo
+	// serializa as reservas
+	estoques map[uuid.UUID]models.Estoque
+	reservas map[uuid.UUID]models.Reserva
+	// pedidos serve RepositorioPedidos
+	pedidos map[uuid.UUID]models.Pedido
+	// grades (produto pai → eixos) e variantes (produto filho → ligação ao
+	// pai) servem RepositorioVariantes
+	grades    map[uuid.UUID]models.Grade
+	variantes map[uuid.UUID]models.Variante
+	// precos (produto → linha do tempo em ordem de VigenteDe) serve
+	// RepositorioPrecos
+	precos map[uuid.UUID][]models.PrecoProduto
+	// imagens (produto → imagens em ordem de CriadaEm) serve
+	// RepositorioImagens
+	imagens    map[uuid.UUID][]models.Imagem
+	escopoNome EscopoNome
+	logger     *slog.Logger
+
+	wal      *logEscrita // nil quando não há persistência
+	pendente *alteracao  // não nil em rascunhos: acumula o que publicar gravará
 }
 
-func NovoRepositorioEmMemoria(logger *slog.Logger) *RepositorioEmMemoria {
+func NovoRepositorioEmMemoria(opcoes OpcoesRepositorio, logger *slog.Logger) *RepositorioEmMemoria {
 	return &RepositorioEmMemoria{
-		produtos: make(map[uuid.UUID]models.Produto),
-		logger:   logger,
+		produtos:   make(map[uuid.UUID]models.Produto),
+		historico:  make(map[uuid.UUID][]models.HistoricoProduto),
+		categorias: make(map[uuid.UUID]models.Categoria),
+		vinculos:   make(map[uuid.UUID][]uuid.UUID),
+		estoques:   make(map[uuid.UUID]models.Estoque),
+		reservas:   make(map[uuid.UUID]models.Reserva),
+		pedidos:    make(map[uuid.UUID]models.Pedido),
+		grades:     make(map[uuid.UUID]models.Grade),
+		variantes:  make(map[uuid.UUID]models.Variante),
+		precos:     make(map[uuid.UUID][]models.PrecoProduto),
+		imagens:    make(map[uuid.UUID][]models.Imagem),
+		escopoNome: opcoes.escopoNome(),
+		logger:     logger,
 	}
 }
 
-func (r *RepositorioEmMemoria) Criar(nome string, preco float64) (models.Produto, error) {
-	if preco < 0 {
-		r.logger.Error("Falha ao criar produto", "error", ErrPrecoInvalido, "nome", nome)
+func (r *RepositorioEmMemoria) Criar(ctx context.Context, nome string, preco models.Dinheiro) (models.Produto, error) {
+	return r.criar(ctx, uuid.New(), nome, preco)
+}
+
+func (r *RepositorioEmMemoria) CriarComID(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	return r.criar(ctx, id, nome, preco)
+}
+
+func (r *RepositorioEmMemoria) criar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Produto{}, fmt.Errorf("criar produto: %w", err)
+	}
+
+	if err := preco.Validar(); err != nil {
+		r.logger.Error("Falha ao criar produto", "error", err, "nome", nome)
 
-		return models.Produto{}, ErrPrecoInvalido
+		return models.Produto{}, err
 	}
 
-	id := uuid.New()
-	produto := models.Produto{ID: id, Nome: nome, Preco: preco}
+	produto := models.Produto{ID: id, TenantID: tenantDe(ctx), Nome: nome, Preco: preco, Versao: 1}
 
-	r.produtos[id] = produto
-	r.logger.Info("Produto criado", "id", id, "nome", nome, "preco", preco)
+	r.mu.Lock()
+	err := ErrIDEmUso
+	if _, existe := r.produtos[id]; !existe {
+		err = r.alterar(ctx, OperacaoCriar, nil, &produto)
+	}
+	r.mu.Unlock()
+	if err != nil {
+		r.logger.Error("Falha ao criar produto", "error", err, "nome", nome)
+
+		return models.Produto{}, fmt.Errorf("criar produto: %w", err)
+	}
+
+	r.logger.Info("Produto criado", "id", id, "nome", nome, "preco", preco.String())
 	return produto, nil
 }
 
-func (r *RepositorioEmMemoria) Buscar(id uuid.UUID) (models.Produto, error) {
+func (r *RepositorioEmMemoria) Buscar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Produto{}, fmt.Errorf("buscar produto: %w", err)
+	}
+
+	tenant := tenantDe(ctx)
+	r.mu.RLock()
 	produto, existe := r.produtos[id]
-	if !existe {
+	r.mu.RUnlock()
+
+	if !existe || produto.TenantID != tenant || produto.RemovidoEm.Valid {
 		r.logger.Error("Falha ao buscar produto", "error", ErrProdutoNaoEncontrado, "id", id)
 
 		return models.Produto{}, fmt.Errorf("buscar produto id %s: %w", id, ErrProdutoNaoEncontrado)
@@ -61,47 +180,1264 @@ func (r *RepositorioEmMemoria) Buscar(id uuid.UUID) (models.Produto, error) {
 	return produto, nil
 }
 
-func (r *RepositorioEmMemoria) Listar() ([]models.Produto, error) {
+func (r *RepositorioEmMemoria) Listar(ctx context.Context, filtro FiltroListagem) (Pagina, error) {
+	if err := ctx.Err(); err != nil {
+		return Pagina{}, fmt.Errorf("listar produtos: %w", err)
+	}
+
+	filtro, c, err := filtro.normalizar()
+	if err != nil {
+		r.logger.Error("Falha ao listar produtos", "error", err)
+
+		return Pagina{}, fmt.Errorf("listar produtos: %w", err)
+	}
+
+	tenant := tenantDe(ctx)
 	var produtos []models.Produto
+	r.mu.RLock()
 	for _, p := range r.produtos {
-		produtos = append(produtos, p)
+		if p.TenantID == tenant && filtro.aceita(p) && (c == nil || c.posterior(p)) {
+			produtos = append(produtos, p)
+		}
 	}
+	r.mu.RUnlock()
 
-	r.logger.Info("Listando produtos", "total", len(produtos))
+	slices.SortFunc(produtos, filtro.Ordenacao.comparar)
+	if len(produtos) > filtro.Limite+1 {
+		produtos = produtos[:filtro.Limite+1]
+	}
+
+	pagina := paginar(filtro, produtos)
+	r.logger.Info("Listando produtos", "total", len(pagina.Produtos))
+	return pagina, nil
+}
+
+// Pesquisar faz a busca textual sobre os nomes, exigindo todos os termos e
+// ordenando pela frequência com que aparecem.
+func (r *RepositorioEmMemoria) Pesquisar(ctx context.Context, termo string, limite int) ([]models.Produto, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("pesquisar produtos: %w", err)
+	}
+
+	if strings.TrimSpace(termo) == "" {
+		r.logger.Error("Falha ao pesquisar produtos", "error", ErrBuscaVazia)
+
+		return nil, fmt.Errorf("pesquisar produtos: %w", ErrBuscaVazia)
+	}
+
+	tenant := tenantDe(ctx)
+	r.mu.RLock()
+	produtos := make([]models.Produto, 0, len(r.produtos))
+	for _, p := range r.produtos {
+		if p.TenantID == tenant {
+			produtos = append(produtos, p)
+		}
+	}
+	r.mu.RUnlock()
+
+	produtos = classificar(tokenizar(termo), produtos, normalizarLimite(limite))
+
+	r.logger.Info("Produtos pesquisados", "termo", termo, "total", len(produtos))
 	return produtos, nil
 }
 
-func (r *RepositorioEmMemoria) Atualizar(id uuid.UUID, nome string, preco float64) (models.Produto, error) {
-	if preco < 0 {
-		r.logger.Error("Falha ao atualizar produto", "error", ErrPrecoInvalido, "id", id)
+func (r *RepositorioEmMemoria) Atualizar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro, versao int) (models.Produto, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Produto{}, fmt.Errorf("atualizar produto: %w", err)
+	}
+
+	if err := preco.Validar(); err != nil {
+		r.logger.Error("Falha ao atualizar produto", "error", err, "id", id)
 
-		return models.Produto{}, ErrPrecoInvalido
+		return models.Produto{}, err
 	}
 
-	produto, existe := r.produtos[id]
-	if !existe {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	produto, existe := r.produtoDoTenant(ctx, id)
+	if !existe || produto.RemovidoEm.Valid {
 		r.logger.Error("Falha ao atualizar produto", "error", ErrProdutoNaoEncontrado, "id", id)
 
 		return models.Produto{}, fmt.Errorf("atualizar produto id %s: %w", id, ErrProdutoNaoEncontrado)
 	}
+	if versao != QualquerVersao && produto.Versao != versao {
+		r.logger.Error("Falha ao atualizar produto", "error", ErrConflitoDeVersao, "id", id, "versao", versao)
 
+		return models.Produto{}, fmt.Errorf("atualizar produto id %s versão %d: %w", id, versao, ErrConflitoDeVersao)
+	}
+
+	antes := produto
 	produto.Nome = nome
 	produto.Preco = preco
+	produto.Versao++
+
+	if err := r.alterar(ctx, OperacaoAtualizar, &antes, &produto); err != nil {
+		r.logger.Error("Falha ao atualizar produto", "error", err, "id", id)
 
-	r.produtos[id] = produto
-	r.logger.Info("Produto atualizado", "id", id, "nome", nome, "preco", preco)
+		return models.Produto{}, fmt.Errorf("atualizar produto id %s: %w", id, err)
+	}
+	r.logger.Info("Produto atualizado", "id", id, "nome", nome, "preco", preco.String())
 	return produto, nil
 }
 
-func (r *RepositorioEmMemoria) Deletar(id uuid.UUID) error {
-	if _, existe := r.produtos[id]; !existe {
+func (r *RepositorioEmMemoria) Deletar(ctx context.Context, id uuid.UUID, versao int) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("deletar produto: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	produto, existe := r.produtoDoTenant(ctx, id)
+	if !existe || produto.RemovidoEm.Valid {
 		r.logger.Error("Falha ao deletar produto", "error", ErrProdutoNaoEncontrado, "id", id)
 
 		return fmt.Errorf("deletar produto id %s: %w", id, ErrProdutoNaoEncontrado)
 	}
+	if versao != QualquerVersao && produto.Versao != versao {
+		r.logger.Error("Falha ao deletar produto", "error", ErrConflitoDeVersao, "id", id, "versao", versao)
+
+		return fmt.Errorf("deletar produto id %s versão %d: %w", id, versao, ErrConflitoDeVersao)
+	}
 
-	delete(r.produtos, id)
+	antes := produto
+	produto.RemovidoEm = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	if err := r.alterar(ctx, OperacaoDeletar, &antes, &produto); err != nil {
+		r.logger.Error("Falha ao deletar produto", "error", err, "id", id)
+
+		return fmt.Errorf("deletar produto id %s: %w", id, err)
+	}
 	r.logger.Info("Produto deletado", "id", id)
 
 	return nil
 }
+
+func (r *RepositorioEmMemoria) Restaurar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Produto{}, fmt.Errorf("restaurar produto: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	produto, existe := r.produtoDoTenant(ctx, id)
+	if !existe {
+		r.logger.Error("Falha ao restaurar produto", "error", ErrProdutoNaoEncontrado, "id", id)
+
+		return models.Produto{}, fmt.Errorf("restaurar produto id %s: %w", id, ErrProdutoNaoEncontrado)
+	}
+
+	if produto.RemovidoEm.Valid {
+		antes := produto
+		produto.RemovidoEm = gorm.DeletedAt{}
+		if err := r.alterar(ctx, OperacaoRestaurar, &antes, &produto); err != nil {
+			r.logger.Error("Falha ao restaurar produto", "error", err, "id", id)
+
+			return models.Produto{}, fmt.Errorf("restaurar produto id %s: %w", id, err)
+		}
+	}
+	r.logger.Info("Produto restaurado", "id", id)
+
+	return produto, nil
+}
+
+func (r *RepositorioEmMemoria) Purgar(ctx context.Context, removidosAntesDe time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("purgar produtos: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purgados []uuid.UUID
+	for id, p := range r.produtos {
+		if p.RemovidoEm.Valid && p.RemovidoEm.Time.Before(removidosAntesDe) {
+			purgados = append(purgados, id)
+		}
+	}
+	if len(purgados) > 0 {
+		if err := r.salvar(alteracao{Purgados: purgados}); err != nil {
+			r.logger.Error("Falha ao purgar produtos", "error", err)
+
+			return 0, fmt.Errorf("purgar produtos: %w", err)
+		}
+	}
+	total := int64(len(purgados))
+
+	r.logger.Info("Produtos purgados", "total", total, "removidos_antes_de", removidosAntesDe)
+	return total, nil
+}
+
+// AplicarLote executa as operações sobre uma cópia do mapa e só a publica se
+// todas tiverem sucesso; qualquer falha descarta a cópia inteira.
+func (r *RepositorioEmMemoria) AplicarLote(ctx context.Context, operacoes []OperacaoLote) ([]ResultadoLote, error) {
+	if len(operacoes) > LoteMaximo {
+		return nil, fmt.Errorf("aplicar lote com %d operações: %w", len(operacoes), ErrLoteMuitoGrande)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rascunho := r.rascunho()
+	resultados, falhas := executarLote(operacoes, func(op OperacaoLote) (*models.Produto, error) {
+		return aplicarOperacao(ctx, rascunho, op)
+	})
+	if falhas > 0 {
+		r.logger.Error("Falha ao aplicar lote", "error", ErrLoteRejeitado, "operacoes", len(operacoes), "falhas", falhas)
+
+		return resultados, fmt.Errorf("aplicar lote: %d de %d operações falharam: %w", falhas, len(operacoes), ErrLoteRejeitado)
+	}
+
+	if err := r.publicar(rascunho); err != nil {
+		r.logger.Error("Falha ao aplicar lote", "error", err, "operacoes", len(operacoes))
+
+		return nil, fmt.Errorf("aplicar lote: %w", err)
+	}
+	r.logger.Info("Lote aplicado", "operacoes", len(operacoes))
+	return resultados, nil
+}
+
+// rascunho devolve uma cópia independente do repositório, usada para aplicar
+// escritas que podem ser descartadas. Exige o lock exclusivo de r.
+func (r *RepositorioEmMemoria) rascunho() *RepositorioEmMemoria {
+	return &RepositorioEmMemoria{
+		produtos:   maps.Clone(r.produtos),
+		historico:  maps.Clone(r.historico),
+		categorias: maps.Clone(r.categorias),
+		vinculos:   maps.Clone(r.vinculos),
+		estoques:   maps.Clone(r.estoques),
+		reservas:   maps.Clone(r.reservas),
+		pedidos:    maps.Clone(r.pedidos),
+		grades:     maps.Clone(r.grades),
+		variantes:  maps.Clone(r.variantes),
+		precos:     maps.Clone(r.precos),
+		imagens:    maps.Clone(r.imagens),
+		escopoNome: r.escopoNome,
+		logger:     r.logger,
+		pendente:   &alteracao{},
+	}
+}
+
+// publicar troca o estado de r pelo do rascunho, gravando antes as
+// alterações do rascunho como um único registro. Exige o lock exclusivo de r.
+func (r *RepositorioEmMemoria) publicar(rascunho *RepositorioEmMemoria) error {
+	if err := r.persistir(*rascunho.pendente); err != nil {
+		return err
+	}
+	r.produtos = rascunho.produtos
+	r.historico = rascunho.historico
+	r.categorias = rascunho.categorias
+	r.vinculos = rascunho.vinculos
+	r.estoques = rascunho.estoques
+	r.reservas = rascunho.reservas
+	r.pedidos = rascunho.pedidos
+	r.grades = rascunho.grades
+	r.variantes = rascunho.variantes
+	r.precos = rascunho.precos
+	r.imagens = rascunho.imagens
+	r.compactarSeNecessario()
+	return nil
+}
+
+// Historico retorna as alterações do produto em ordem cronológica. O
+// histórico sobrevive à remoção e ao expurgo do produto.
+func (r *RepositorioEmMemoria) Historico(ctx context.Context, id uuid.UUID) ([]models.HistoricoProduto, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("consultar histórico: %w", err)
+	}
+
+	r.mu.RLock()
+	historico := slices.Clone(r.historico[id])
+	r.mu.RUnlock()
+
+	if len(historico) == 0 || historico[0].TenantID != tenantDe(ctx) {
+		r.logger.Error("Falha ao consultar histórico", "error", ErrProdutoNaoEncontrado, "id", id)
+
+		return nil, fmt.Errorf("consultar histórico id %s: %w", id, ErrProdutoNaoEncontrado)
+	}
+
+	r.logger.Info("Histórico consultado", "id", id, "total", len(historico))
+	return historico, nil
+}
+
+// CriarCategoria cria uma categoria, conferindo antes que o pai existe.
+func (r *RepositorioEmMemoria) CriarCategoria(ctx context.Context, nome string, paiID *uuid.UUID) (models.Categoria, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Categoria{}, fmt.Errorf("criar categoria: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	categoria := models.Categoria{ID: uuid.New(), TenantID: tenantDe(ctx), Nome: nome}
+	if paiID != nil {
+		if _, existe := r.categoriaDoTenant(ctx, *paiID); !existe {
+			r.logger.Error("Falha ao criar categoria", "error", ErrCategoriaNaoEncontrada, "pai_id", *paiID)
+
+			return models.Categoria{}, fmt.Errorf("criar categoria pai %s: %w", *paiID, ErrCategoriaNaoEncontrada)
+		}
+		pai := *paiID
+		categoria.PaiID = &pai
+	}
+
+	if err := r.salvar(alteracao{Categorias: []models.Categoria{categoria}}); err != nil {
+		r.logger.Error("Falha ao criar categoria", "error", err, "nome", nome)
+
+		return models.Categoria{}, fmt.Errorf("criar categoria: %w", err)
+	}
+
+	r.logger.Info("Categoria criada", "id", categoria.ID, "nome", nome)
+	return categoria, nil
+}
+
+func (r *RepositorioEmMemoria) ListarCategorias(ctx context.Context) ([]models.Categoria, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listar categorias: %w", err)
+	}
+
+	tenant := tenantDe(ctx)
+	r.mu.RLock()
+	categorias := make([]models.Categoria, 0, len(r.categorias))
+	for _, c := range r.categorias {
+		if c.TenantID == tenant {
+			categorias = append(categorias, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(categorias, compararCategorias)
+	r.logger.Info("Listando categorias", "total", len(categorias))
+	return categorias, nil
+}
+
+// ProdutosDaCategoria percorre a árvore a partir da categoria quando
+// incluirDescendentes e filtra os produtos ativos ligados a ela.
+func (r *RepositorioEmMemoria) ProdutosDaCategoria(ctx context.Context, id uuid.UUID, incluirDescendentes bool) ([]models.Produto, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listar produtos da categoria: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, existe := r.categoriaDoTenant(ctx, id); !existe {
+		r.logger.Error("Falha ao listar produtos da categoria", "error", ErrCategoriaNaoEncontrada, "id", id)
+
+		return nil, fmt.Errorf("listar produtos da categoria id %s: %w", id, ErrCategoriaNaoEncontrada)
+	}
+
+	alvo := map[uuid.UUID]bool{id: true}
+	if incluirDescendentes {
+		filhas := make(map[uuid.UUID][]uuid.UUID)
+		for _, c := range r.categorias {
+			if c.PaiID != nil {
+				filhas[*c.PaiID] = append(filhas[*c.PaiID], c.ID)
+			}
+		}
+		for fila := []uuid.UUID{id}; len(fila) > 0; fila = fila[1:] {
+			for _, filha := range filhas[fila[0]] {
+				alvo[filha] = true
+				fila = append(fila, filha)
+			}
+		}
+	}
+
+	var produtos []models.Produto
+	for produtoID, categorias := range r.vinculos {
+		p, existe := r.produtoDoTenant(ctx, produtoID)
+		if existe && !p.RemovidoEm.Valid && slices.ContainsFunc(categorias, func(c uuid.UUID) bool { return alvo[c] }) {
+			produtos = append(produtos, p)
+		}
+	}
+	slices.SortFunc(produtos, OrdenarPorNome.comparar)
+
+	r.logger.Info("Listando produtos da categoria", "id", id, "total", len(produtos))
+	return produtos, nil
+}
+
+func (r *RepositorioEmMemoria) AtribuirCategorias(ctx context.Context, produtoID uuid.UUID, categorias []uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("atribuir categorias: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, existe := r.produtoDoTenant(ctx, produtoID)
+	if !existe || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao atribuir categorias", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return fmt.Errorf("atribuir categorias ao produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	categorias = normalizarCategorias(categorias)
+	for _, id := range categorias {
+		if _, existe := r.categoriaDoTenant(ctx, id); !existe {
+			r.logger.Error("Falha ao atribuir categorias", "error", ErrCategoriaNaoEncontrada, "id", produtoID, "categoria_id", id)
+
+			return fmt.Errorf("atribuir categorias ao produto id %s: categoria %s: %w", produtoID, id, ErrCategoriaNaoEncontrada)
+		}
+	}
+	// No escopo por categoria, o produto não pode entrar numa categoria onde
+	// outro já usa o nome
+	if r.escopoNome == NomeUnicoNaCategoria {
+		if err := r.nomeLivre(ctx, p, categorias); err != nil {
+			r.logger.Error("Falha ao atribuir categorias", "error", err, "id", produtoID)
+
+			return fmt.Errorf("atribuir categorias ao produto id %s: %w", produtoID, err)
+		}
+	}
+
+	if err := r.salvar(alteracao{Vinculos: map[uuid.UUID][]uuid.UUID{produtoID: categorias}}); err != nil {
+		r.logger.Error("Falha ao atribuir categorias", "error", err, "id", produtoID)
+
+		return fmt.Errorf("atribuir categorias ao produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Info("Categorias atribuídas", "id", produtoID, "total", len(categorias))
+	return nil
+}
+
+func (r *RepositorioEmMemoria) CategoriasDoProduto(ctx context.Context, produtoID uuid.UUID) ([]uuid.UUID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("consultar categorias: %w", err)
+	}
+
+	tenant := tenantDe(ctx)
+	r.mu.RLock()
+	p, existe := r.produtos[produtoID]
+	categorias := slices.Clone(r.vinculos[produtoID])
+	r.mu.RUnlock()
+
+	if !existe || p.TenantID != tenant || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao consultar categorias", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return nil, fmt.Errorf("consultar categorias do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	return categorias, nil
+}
+
+func (r *RepositorioEmMemoria) DefinirEstoque(ctx context.Context, produtoID uuid.UUID, quantidade int) (models.Estoque, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Estoque{}, fmt.Errorf("definir estoque: %w", err)
+	}
+
+	if quantidade < 0 {
+		r.logger.Error("Falha ao definir estoque do produto", "error", ErrQuantidadeInvalida, "id", produtoID, "quantidade", quantidade)
+
+		return models.Estoque{}, fmt.Errorf("definir estoque do produto id %s: %w", produtoID, ErrQuantidadeInvalida)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, existe := r.produtoDoTenant(ctx, produtoID); !existe || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao definir estoque do produto", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return models.Estoque{}, fmt.Errorf("definir estoque do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	estoque, vencidas := r.vencerReservas(produtoID, time.Now())
+	if quantidade < estoque.Reservado {
+		r.logger.Error("Falha ao definir estoque do produto", "error", ErrEstoqueInsuficiente, "id", produtoID, "quantidade", quantidade, "reservado", estoque.Reservado)
+
+		return models.Estoque{}, fmt.Errorf("definir estoque do produto id %s: reservado %d: %w", produtoID, estoque.Reservado, ErrEstoqueInsuficiente)
+	}
+
+	estoque.Quantidade = quantidade
+	if err := r.salvar(alteracao{Estoques: []models.Estoque{estoque}, Reservas: vencidas}); err != nil {
+		r.logger.Error("Falha ao definir estoque do produto", "error", err, "id", produtoID)
+
+		return models.Estoque{}, fmt.Errorf("definir estoque do produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Info("Estoque definido", "id", produtoID, "quantidade", quantidade)
+	return estoque, nil
+}
+
+func (r *RepositorioEmMemoria) ConsultarEstoque(ctx context.Context, produtoID uuid.UUID) (models.Estoque, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Estoque{}, fmt.Errorf("consultar estoque: %w", err)
+	}
+
+	tenant := tenantDe(ctx)
+	r.mu.RLock()
+	p, existe := r.produtos[produtoID]
+	estoque := r.estoqueDe(produtoID)
+	r.mu.RUnlock()
+
+	if !existe || p.TenantID != tenant || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao consultar estoque do produto", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return models.Estoque{}, fmt.Errorf("consultar estoque do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	return estoque, nil
+}
+
+// Reservar confere o disponível e grava a reserva sob o lock exclusivo, o
+// que impede duas reservas de disputarem a mesma unidade.
+func (r *RepositorioEmMemoria) Reservar(ctx context.Context, produtoID uuid.UUID, quantidade int, validade time.Duration) (models.Reserva, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reserva{}, fmt.Errorf("reservar estoque: %w", err)
+	}
+
+	if quantidade <= 0 {
+		r.logger.Error("Falha ao reservar estoque do produto", "error", ErrQuantidadeInvalida, "id", produtoID, "quantidade", quantidade)
+
+		return models.Reserva{}, fmt.Errorf("reservar estoque do produto id %s: %w", produtoID, ErrQuantidadeInvalida)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, existe := r.produtoDoTenant(ctx, produtoID); !existe || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao reservar estoque do produto", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return models.Reserva{}, fmt.Errorf("reservar estoque do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	estoque, vencidas := r.vencerReservas(produtoID, time.Now())
+	if estoque.Disponivel() < quantidade {
+		r.logger.Error("Falha ao reservar estoque do produto", "error", ErrEstoqueInsuficiente, "id", produtoID, "quantidade", quantidade, "disponivel", estoque.Disponivel())
+
+		return models.Reserva{}, fmt.Errorf("reservar estoque do produto id %s: disponível %d: %w", produtoID, estoque.Disponivel(), ErrEstoqueInsuficiente)
+	}
+
+	reserva := novaReserva(tenantDe(ctx), produtoID, quantidade, validade)
+	estoque.Reservado += quantidade
+	if err := r.salvar(alteracao{Estoques: []models.Estoque{estoque}, Reservas: append(vencidas, reserva)}); err != nil {
+		r.logger.Error("Falha ao reservar estoque do produto", "error", err, "id", produtoID)
+
+		return models.Reserva{}, fmt.Errorf("reservar estoque do produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Info("Estoque reservado", "id", reserva.ID, "produto_id", produtoID, "quantidade", quantidade)
+	return reserva, nil
+}
+
+func (r *RepositorioEmMemoria) ConfirmarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error) {
+	return r.encerrar(ctx, id, ReservaConfirmada, "confirmar")
+}
+
+func (r *RepositorioEmMemoria) LiberarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error) {
+	return r.encerrar(ctx, id, ReservaLiberada, "liberar")
+}
+
+// encerrar leva a reserva ao status alvo, baixando o estoque na confirmação
+// ou devolvendo-o ao disponível na liberação.
+func (r *RepositorioEmMemoria) encerrar(ctx context.Context, id uuid.UUID, alvo StatusReserva, operacao string) (models.Reserva, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reserva{}, fmt.Errorf("%s reserva: %w", operacao, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reserva, existe := r.reservas[id]
+	if !existe || reserva.TenantID != tenantDe(ctx) {
+		r.logger.Error("Falha ao "+operacao+" reserva", "error", ErrReservaNaoEncontrada, "id", id)
+
+		return models.Reserva{}, fmt.Errorf("%s reserva id %s: %w", operacao, id, ErrReservaNaoEncontrada)
+	}
+	estoque, vencidas := r.vencerReservas(reserva.ProdutoID, time.Now())
+	if i := slices.IndexFunc(vencidas, func(v models.Reserva) bool { return v.ID == id }); i >= 0 {
+		reserva = vencidas[i]
+	}
+	mudar, err := encerrarReserva(reserva, alvo, time.Now())
+	if err != nil {
+		r.logger.Error("Falha ao "+operacao+" reserva", "error", err, "id", id, "status", reserva.Status)
+
+		return models.Reserva{}, fmt.Errorf("%s reserva id %s: %w", operacao, id, err)
+	}
+
+	if !mudar && len(vencidas) == 0 {
+		return reserva, nil
+	}
+	if mudar {
+		estoque.Reservado -= reserva.Quantidade
+		if alvo == ReservaConfirmada {
+			estoque.Quantidade -= reserva.Quantidade
+		}
+		reserva.Status = string(alvo)
+		vencidas = append(vencidas, reserva)
+	}
+	if err := r.salvar(alteracao{Estoques: []models.Estoque{estoque}, Reservas: vencidas}); err != nil {
+		r.logger.Error("Falha ao "+operacao+" reserva", "error", err, "id", id)
+
+		return models.Reserva{}, fmt.Errorf("%s reserva id %s: %w", operacao, id, err)
+	}
+
+	r.logger.Info("Reserva encerrada", "id", id, "status", reserva.Status)
+	return reserva, nil
+}
+
+func (r *RepositorioEmMemoria) ExpirarReservas(ctx context.Context, agora time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("expirar reservas: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	produtos := make(map[uuid.UUID]bool)
+	for _, reserva := range r.reservas {
+		if vencida(reserva, agora) {
+			produtos[reserva.ProdutoID] = true
+		}
+	}
+	var a alteracao
+	for produtoID := range produtos {
+		estoque, vencidas := r.vencerReservas(produtoID, agora)
+		a.Estoques = append(a.Estoques, estoque)
+		a.Reservas = append(a.Reservas, vencidas...)
+	}
+	if err := r.salvar(a); err != nil {
+		r.logger.Error("Falha ao expirar reservas", "error", err)
+
+		return 0, fmt.Errorf("expirar reservas: %w", err)
+	}
+	total := int64(len(a.Reservas))
+
+	r.logger.Info("Reservas expiradas", "total", total)
+	return total, nil
+}
+
+// estoqueDe retorna o estoque do produto, zerado se nunca foi definido.
+// Exige o lock de r.
+func (r *RepositorioEmMemoria) estoqueDe(produtoID uuid.UUID) models.Estoque {
+	if estoque, existe := r.estoques[produtoID]; existe {
+		return estoque
+	}
+	return models.Estoque{ProdutoID: produtoID}
+}
+
+// vencerReservas marca como expiradas as reservas pendentes do produto
+// vencidas em agora e devolve o estoque sem elas, sem gravar nada: o
+// chamador inclui ambos na sua alteração. Exige o lock exclusivo de r.
+func (r *RepositorioEmMemoria) vencerReservas(produtoID uuid.UUID, agora time.Time) (models.Estoque, []models.Reserva) {
+	estoque := r.estoqueDe(produtoID)
+	var vencidas []models.Reserva
+	for _, reserva := range r.reservas {
+		if reserva.ProdutoID == produtoID && vencida(reserva, agora) {
+			reserva.Status = string(ReservaExpirada)
+			estoque.Reservado -= reserva.Quantidade
+			vencidas = append(vencidas, reserva)
+		}
+	}
+	return estoque, vencidas
+}
+
+func (r *RepositorioEmMemoria) CriarPedido(ctx context.Context, itens []ItemSolicitado) (models.Pedido, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Pedido{}, fmt.Errorf("criar pedido: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pedido, err := novoPedido(tenantDe(ctx), itens, func(id uuid.UUID) (models.Produto, error) {
+		if p, existe := r.produtoDoTenant(ctx, id); existe && !p.RemovidoEm.Valid {
+			return p, nil
+		}
+		return models.Produto{}, ErrProdutoNaoEncontrado
+	})
+	if err != nil {
+		r.logger.Error("Falha ao criar pedido", "error", err)
+
+		return models.Pedido{}, fmt.Errorf("criar pedido: %w", err)
+	}
+
+	if err := r.salvar(alteracao{Pedidos: []models.Pedido{pedido}}); err != nil {
+		r.logger.Error("Falha ao criar pedido", "error", err)
+
+		return models.Pedido{}, fmt.Errorf("criar pedido: %w", err)
+	}
+
+	r.logger.Info("Pedido criado", "id", pedido.ID, "itens", len(pedido.Itens), "total", pedido.Total.String())
+	return copiarPedido(pedido), nil
+}
+
+func (r *RepositorioEmMemoria) BuscarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Pedido{}, fmt.Errorf("buscar pedido: %w", err)
+	}
+
+	r.mu.RLock()
+	pedido, existe := r.pedidos[id]
+	r.mu.RUnlock()
+
+	if !existe || pedido.TenantID != tenantDe(ctx) {
+		r.logger.Error("Falha ao buscar pedido", "error", ErrPedidoNaoEncontrado, "id", id)
+
+		return models.Pedido{}, fmt.Errorf("buscar pedido id %s: %w", id, ErrPedidoNaoEncontrado)
+	}
+
+	r.logger.Info("Pedido encontrado", "id", id)
+	return copiarPedido(pedido), nil
+}
+
+func (r *RepositorioEmMemoria) ListarPedidos(ctx context.Context, status StatusPedido, limite int) ([]models.Pedido, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listar pedidos: %w", err)
+	}
+
+	if err := validarStatusPedido(status); err != nil {
+		r.logger.Error("Falha ao listar pedidos", "error", err)
+
+		return nil, fmt.Errorf("listar pedidos: %w", err)
+	}
+
+	var pedidos []models.Pedido
+	tenant := tenantDe(ctx)
+	r.mu.RLock()
+	for _, p := range r.pedidos {
+		if p.TenantID == tenant && (status == "" || p.Status == string(status)) {
+			pedidos = append(pedidos, copiarPedido(p))
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(pedidos, compararPedidos)
+	if limite = normalizarLimite(limite); len(pedidos) > limite {
+		pedidos = pedidos[:limite]
+	}
+
+	r.logger.Info("Listando pedidos", "total", len(pedidos))
+	return pedidos, nil
+}
+
+func (r *RepositorioEmMemoria) PagarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoPago, "pagar")
+}
+
+func (r *RepositorioEmMemoria) EnviarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoEnviado, "enviar")
+}
+
+func (r *RepositorioEmMemoria) CancelarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoCancelado, "cancelar")
+}
+
+// mudarStatusPedido leva o pedido ao status alvo, se a transição for
+// permitida.
+func (r *RepositorioEmMemoria) mudarStatusPedido(ctx context.Context, id uuid.UUID, alvo StatusPedido, operacao string) (models.Pedido, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Pedido{}, fmt.Errorf("%s pedido: %w", operacao, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pedido, existe := r.pedidos[id]
+	if !existe || pedido.TenantID != tenantDe(ctx) {
+		r.logger.Error("Falha ao "+operacao+" pedido", "error", ErrPedidoNaoEncontrado, "id", id)
+
+		return models.Pedido{}, fmt.Errorf("%s pedido id %s: %w", operacao, id, ErrPedidoNaoEncontrado)
+	}
+	mudar, err := transicaoPedido(StatusPedido(pedido.Status), alvo)
+	if err != nil {
+		r.logger.Error("Falha ao "+operacao+" pedido", "error", err, "id", id)
+
+		return models.Pedido{}, fmt.Errorf("%s pedido id %s: %w", operacao, id, err)
+	}
+	if !mudar {
+		return copiarPedido(pedido), nil
+	}
+
+	pedido.Status = string(alvo)
+	pedido.AtualizadoEm = time.Now().UTC()
+	if err := r.salvar(alteracao{Pedidos: []models.Pedido{pedido}}); err != nil {
+		r.logger.Error("Falha ao "+operacao+" pedido", "error", err, "id", id)
+
+		return models.Pedido{}, fmt.Errorf("%s pedido id %s: %w", operacao, id, err)
+	}
+
+	r.logger.Info("Status do pedido alterado", "id", id, "status", pedido.Status)
+	return copiarPedido(pedido), nil
+}
+
+// copiarPedido devolve o pedido com uma cópia dos itens, para que quem o
+// recebe não altere o mapa.
+func copiarPedido(pedido models.Pedido) models.Pedido {
+	pedido.Itens = slices.Clone(pedido.Itens)
+	return pedido
+}
+
+// DefinirEixos grava os eixos do produto, recusando a troca se algum filho,
+// mesmo removido, já os usa.
+func (r *RepositorioEmMemoria) DefinirEixos(ctx context.Context, produtoID uuid.UUID, eixos []models.EixoVariante) (models.Grade, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Grade{}, fmt.Errorf("definir eixos: %w", err)
+	}
+
+	if err := validarEixos(eixos); err != nil {
+		r.logger.Error("Falha ao definir eixos do produto", "error", err, "id", produtoID)
+
+		return models.Grade{}, fmt.Errorf("definir eixos do produto id %s: %w", produtoID, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, existe := r.produtoDoTenant(ctx, produtoID); !existe || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao definir eixos do produto", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return models.Grade{}, fmt.Errorf("definir eixos do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	if _, ehVariante := r.variantes[produtoID]; ehVariante {
+		r.logger.Error("Falha ao definir eixos do produto", "error", ErrEixosInvalidos, "id", produtoID)
+
+		return models.Grade{}, fmt.Errorf("definir eixos do produto id %s: produto é uma variante: %w", produtoID, ErrEixosInvalidos)
+	}
+	for _, v := range r.variantes {
+		if v.PaiID == produtoID {
+			r.logger.Error("Falha ao definir eixos do produto", "error", ErrGradeComVariantes, "id", produtoID)
+
+			return models.Grade{}, fmt.Errorf("definir eixos do produto id %s: %w", produtoID, ErrGradeComVariantes)
+		}
+	}
+
+	grade := models.Grade{ProdutoID: produtoID, Eixos: slices.Clone(eixos)}
+	if err := r.salvar(alteracao{Grades: []models.Grade{grade}}); err != nil {
+		r.logger.Error("Falha ao definir eixos do produto", "error", err, "id", produtoID)
+
+		return models.Grade{}, fmt.Errorf("definir eixos do produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Info("Eixos definidos", "id", produtoID, "eixos", len(eixos))
+	grade.Variantes = []models.Variante{}
+	return grade, nil
+}
+
+// CriarVariante grava o produto filho, seu histórico e a ligação ao pai numa
+// única alteração.
+func (r *RepositorioEmMemoria) CriarVariante(ctx context.Context, paiID uuid.UUID, nova NovaVariante) (models.Variante, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Variante{}, fmt.Errorf("criar variante: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pai, existe := r.produtoDoTenant(ctx, paiID)
+	if !existe || pai.RemovidoEm.Valid {
+		r.logger.Error("Falha ao criar variante", "error", ErrProdutoNaoEncontrado, "pai_id", paiID)
+
+		return models.Variante{}, fmt.Errorf("criar variante do produto id %s: %w", paiID, ErrProdutoNaoEncontrado)
+	}
+	grade, existe := r.grades[paiID]
+	if !existe {
+		r.logger.Error("Falha ao criar variante", "error", ErrProdutoSemEixos, "pai_id", paiID)
+
+		return models.Variante{}, fmt.Errorf("criar variante do produto id %s: %w", paiID, ErrProdutoSemEixos)
+	}
+	if err := validarVariante(grade.Eixos, nova); err != nil {
+		r.logger.Error("Falha ao criar variante", "error", err, "pai_id", paiID)
+
+		return models.Variante{}, fmt.Errorf("criar variante do produto id %s: %w", paiID, err)
+	}
+	tenant := tenantDe(ctx)
+	for _, v := range r.variantes {
+		var err error
+		switch {
+		case v.TenantID == tenant && v.SKU == nova.SKU:
+			err = ErrSKUDuplicado
+		case v.PaiID == paiID && maps.Equal(v.Opcoes, nova.Opcoes):
+			err = ErrCombinacaoDuplicada
+		default:
+			continue
+		}
+		r.logger.Error("Falha ao criar variante", "error", err, "pai_id", paiID, "sku", nova.SKU)
+
+		return models.Variante{}, fmt.Errorf("criar variante do produto id %s: %w", paiID, err)
+	}
+
+	produto := models.Produto{ID: uuid.New(), TenantID: tenant, Nome: nomeVariante(pai, grade.Eixos, nova.Opcoes), Preco: nova.Preco, Versao: 1}
+	if err := r.nomeLivre(ctx, produto, nil); err != nil {
+		r.logger.Error("Falha ao criar variante", "error", err, "pai_id", paiID)
+
+		return models.Variante{}, fmt.Errorf("criar variante do produto id %s: %w", paiID, err)
+	}
+	variante := models.Variante{ProdutoID: produto.ID, PaiID: paiID, TenantID: tenant, SKU: nova.SKU, Opcoes: maps.Clone(nova.Opcoes)}
+	h := novoHistorico(ctx, OperacaoCriar, nil, &produto)
+	err := r.salvar(alteracao{
+		Produtos:  []models.Produto{produto},
+		Historico: []models.HistoricoProduto{h},
+		Variantes: []models.Variante{variante},
+		Precos:    []models.PrecoProduto{novaVigencia(h)},
+	})
+	if err != nil {
+		r.logger.Error("Falha ao criar variante", "error", err, "pai_id", paiID)
+
+		return models.Variante{}, fmt.Errorf("criar variante do produto id %s: %w", paiID, err)
+	}
+
+	r.logger.Info("Variante criada", "id", produto.ID, "pai_id", paiID, "sku", nova.SKU)
+	variante.Produto = &produto
+	return variante, nil
+}
+
+func (r *RepositorioEmMemoria) Grade(ctx context.Context, produtoID uuid.UUID) (models.Grade, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Grade{}, fmt.Errorf("consultar grade: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p, existe := r.produtoDoTenant(ctx, produtoID); !existe || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao consultar grade do produto", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return models.Grade{}, fmt.Errorf("consultar grade do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	grade := models.Grade{ProdutoID: produtoID, Eixos: []models.EixoVariante{}, Variantes: []models.Variante{}}
+	if g, existe := r.grades[produtoID]; existe {
+		grade.Eixos = slices.Clone(g.Eixos)
+	}
+	for _, v := range r.variantes {
+		if p, existe := r.produtoDoTenant(ctx, v.ProdutoID); v.PaiID == produtoID && existe && !p.RemovidoEm.Valid {
+			v.Produto = &p
+			grade.Variantes = append(grade.Variantes, v)
+		}
+	}
+	ordenarVariantes(grade.Eixos, grade.Variantes)
+
+	r.logger.Info("Grade consultada", "id", produtoID, "variantes", len(grade.Variantes))
+	return grade, nil
+}
+
+func (r *RepositorioEmMemoria) BuscarSKU(ctx context.Context, sku string) (models.Variante, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Variante{}, fmt.Errorf("buscar variante: %w", err)
+	}
+
+	tenant := tenantDe(ctx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, v := range r.variantes {
+		if v.TenantID != tenant || v.SKU != sku {
+			continue
+		}
+		if p, existe := r.produtoDoTenant(ctx, v.ProdutoID); existe && !p.RemovidoEm.Valid {
+			v.Produto = &p
+			r.logger.Info("Variante encontrada", "sku", sku)
+			return v, nil
+		}
+	}
+
+	r.logger.Error("Falha ao buscar variante", "error", ErrVarianteNaoEncontrada, "sku", sku)
+
+	return models.Variante{}, fmt.Errorf("buscar variante sku %s: %w", sku, ErrVarianteNaoEncontrada)
+}
+
+// AgendarPreco grava o agendamento no produto ativo, reaproveitando o ID de
+// um agendamento pendente para o mesmo instante.
+func (r *RepositorioEmMemoria) AgendarPreco(ctx context.Context, produtoID uuid.UUID, preco models.Dinheiro, vigenteDe time.Time) (models.PrecoProduto, error) {
+	if err := ctx.Err(); err != nil {
+		return models.PrecoProduto{}, fmt.Errorf("agendar preço: %w", err)
+	}
+
+	if err := validarAgendamento(preco, vigenteDe, time.Now()); err != nil {
+		r.logger.Error("Falha ao agendar preço", "error", err, "id", produtoID)
+
+		return models.PrecoProduto{}, fmt.Errorf("agendar preço do produto id %s: %w", produtoID, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	produto, existe := r.produtoDoTenant(ctx, produtoID)
+	if !existe || produto.RemovidoEm.Valid {
+		r.logger.Error("Falha ao agendar preço", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return models.PrecoProduto{}, fmt.Errorf("agendar preço do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+
+	agendado := models.PrecoProduto{ID: uuid.New(), ProdutoID: produtoID, TenantID: produto.TenantID, Preco: preco, VigenteDe: vigenteDe.UTC(), Agendado: true}
+	for _, p := range r.precos[produtoID] {
+		if p.Agendado && p.VigenteDe.Equal(agendado.VigenteDe) {
+			agendado.ID = p.ID
+		}
+	}
+	if err := r.salvar(alteracao{Precos: []models.PrecoProduto{agendado}}); err != nil {
+		r.logger.Error("Falha ao agendar preço", "error", err, "id", produtoID)
+
+		return models.PrecoProduto{}, fmt.Errorf("agendar preço do produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Info("Preço agendado", "id", produtoID, "preco", preco.String(), "vigente_de", vigenteDe)
+	return agendado, nil
+}
+
+func (r *RepositorioEmMemoria) Precos(ctx context.Context, produtoID uuid.UUID) ([]models.PrecoProduto, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("consultar preços: %w", err)
+	}
+
+	r.mu.RLock()
+	precos := slices.Clone(r.precos[produtoID])
+	r.mu.RUnlock()
+
+	if len(precos) == 0 || precos[0].TenantID != tenantDe(ctx) {
+		r.logger.Error("Falha ao consultar preços", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return nil, fmt.Errorf("consultar preços id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+
+	r.logger.Info("Preços consultados", "id", produtoID, "total", len(precos))
+	return precos, nil
+}
+
+// AplicarPrecosAgendados grava cada preço aplicado num registro próprio, com
+// o produto, a entrada de histórico e os períodos afetados.
+func (r *RepositorioEmMemoria) AplicarPrecosAgendados(ctx context.Context, agora time.Time) ([]models.PrecoProduto, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("aplicar preços agendados: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var devidos []models.PrecoProduto
+	for _, precos := range r.precos {
+		for _, p := range precos {
+			if p.Agendado && !p.VigenteDe.After(agora) {
+				devidos = append(devidos, p)
+			}
+		}
+	}
+	ordenarPrecos(devidos)
+
+	aplicados := []models.PrecoProduto{}
+	for _, p := range devidos {
+		produto, existe := r.produtos[p.ProdutoID]
+		if !existe || produto.RemovidoEm.Valid {
+			continue
+		}
+		antes := produto
+		produto.Preco = p.Preco
+		produto.Versao++
+		h := novoHistorico(ctx, OperacaoAtualizar, &antes, &produto)
+		p.Agendado, p.VigenteDe = false, h.RegistradoEm
+
+		err := r.salvar(alteracao{
+			Produtos:  []models.Produto{produto},
+			Historico: []models.HistoricoProduto{h},
+			Precos:    r.abrirVigencia(p),
+		})
+		if err != nil {
+			r.logger.Error("Falha ao aplicar preços agendados", "error", err, "produto_id", p.ProdutoID)
+
+			return aplicados, fmt.Errorf("aplicar preços agendados: %w", err)
+		}
+		aplicados = append(aplicados, p)
+	}
+
+	r.logger.Info("Preços agendados aplicados", "total", len(aplicados))
+	return aplicados, nil
+}
+
+// abrirVigencia devolve o período v junto do período em vigor do produto,
+// fechado no início de v, sem gravar nada: o chamador inclui ambos na sua
+// alteração. Exige o lock de r.
+func (r *RepositorioEmMemoria) abrirVigencia(v models.PrecoProduto) []models.PrecoProduto {
+	var precos []models.PrecoProduto
+	for _, p := range r.precos[v.ProdutoID] {
+		if !p.Agendado && p.VigenteAte == nil {
+			ate := v.VigenteDe
+			p.VigenteAte = &ate
+			precos = append(precos, p)
+		}
+	}
+	return append(precos, v)
+}
+
+// AdicionarImagem acrescenta a imagem ao fim da lista do produto ativo.
+func (r *RepositorioEmMemoria) AdicionarImagem(ctx context.Context, imagem models.Imagem) (models.Imagem, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Imagem{}, fmt.Errorf("adicionar imagem: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	produto, existe := r.produtoDoTenant(ctx, imagem.ProdutoID)
+	if !existe || produto.RemovidoEm.Valid {
+		r.logger.Error("Falha ao adicionar imagem", "error", ErrProdutoNaoEncontrado, "id", imagem.ProdutoID)
+
+		return models.Imagem{}, fmt.Errorf("adicionar imagem ao produto id %s: %w", imagem.ProdutoID, ErrProdutoNaoEncontrado)
+	}
+
+	imagem.TenantID, imagem.CriadaEm = produto.TenantID, time.Now().UTC()
+	imagens := append(slices.Clone(r.imagens[imagem.ProdutoID]), imagem)
+	if err := r.salvar(alteracao{Imagens: map[uuid.UUID][]models.Imagem{imagem.ProdutoID: imagens}}); err != nil {
+		r.logger.Error("Falha ao adicionar imagem", "error", err, "id", imagem.ProdutoID)
+
+		return models.Imagem{}, fmt.Errorf("adicionar imagem ao produto id %s: %w", imagem.ProdutoID, err)
+	}
+
+	r.logger.Info("Imagem adicionada", "id", imagem.ProdutoID, "imagem_id", imagem.ID)
+	return imagem, nil
+}
+
+func (r *RepositorioEmMemoria) Imagens(ctx context.Context, produtoIDs []uuid.UUID) (map[uuid.UUID][]models.Imagem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("consultar imagens: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	imagens := make(map[uuid.UUID][]models.Imagem)
+	for _, id := range produtoIDs {
+		if p, existe := r.produtoDoTenant(ctx, id); existe && !p.RemovidoEm.Valid && len(r.imagens[id]) > 0 {
+			imagens[id] = slices.Clone(r.imagens[id])
+		}
+	}
+
+	r.logger.Info("Imagens consultadas", "produtos", len(produtoIDs), "com_imagens", len(imagens))
+	return imagens, nil
+}
+
+func (r *RepositorioEmMemoria) RemoverImagem(ctx context.Context, produtoID, imagemID uuid.UUID) (models.Imagem, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Imagem{}, fmt.Errorf("remover imagem: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, existe := r.produtoDoTenant(ctx, produtoID); !existe || p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao remover imagem", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return models.Imagem{}, fmt.Errorf("remover imagem do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	imagens := r.imagens[produtoID]
+	i := slices.IndexFunc(imagens, func(imagem models.Imagem) bool { return imagem.ID == imagemID })
+	if i < 0 {
+		r.logger.Error("Falha ao remover imagem", "error", ErrImagemNaoEncontrada, "id", produtoID, "imagem_id", imagemID)
+
+		return models.Imagem{}, fmt.Errorf("remover imagem id %s do produto id %s: %w", imagemID, produtoID, ErrImagemNaoEncontrada)
+	}
+
+	restantes := slices.Delete(slices.Clone(imagens), i, i+1)
+	if err := r.salvar(alteracao{Imagens: map[uuid.UUID][]models.Imagem{produtoID: restantes}}); err != nil {
+		r.logger.Error("Falha ao remover imagem", "error", err, "id", produtoID)
+
+		return models.Imagem{}, fmt.Errorf("remover imagem do produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Info("Imagem removida", "id", produtoID, "imagem_id", imagemID)
+	return imagens[i], nil
+}
+
+func (r *RepositorioEmMemoria) ExpurgarImagens(ctx context.Context, removidosAntesDe time.Time) ([]models.Imagem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("expurgar imagens: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a := alteracao{Imagens: make(map[uuid.UUID][]models.Imagem)}
+	expurgadas := []models.Imagem{}
+	for id, imagens := range r.imagens {
+		if p := r.produtos[id]; p.RemovidoEm.Valid && p.RemovidoEm.Time.Before(removidosAntesDe) {
+			a.Imagens[id] = nil
+			expurgadas = append(expurgadas, imagens...)
+		}
+	}
+	if err := r.salvar(a); err != nil {
+		r.logger.Error("Falha ao expurgar imagens", "error", err)
+
+		return nil, fmt.Errorf("expurgar imagens: %w", err)
+	}
+
+	r.logger.Info("Imagens expurgadas", "total", len(expurgadas), "removidos_antes_de", removidosAntesDe)
+	return expurgadas, nil
+}
+
+func (r *RepositorioEmMemoria) ExpurgarImagensDoProduto(ctx context.Context, produtoID uuid.UUID) ([]models.Imagem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("expurgar imagens: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, existe := r.produtoDoTenant(ctx, produtoID); !existe || !p.RemovidoEm.Valid {
+		r.logger.Error("Falha ao expurgar imagens do produto", "error", ErrProdutoNaoEncontrado, "id", produtoID)
+
+		return nil, fmt.Errorf("expurgar imagens do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+	expurgadas := append([]models.Imagem{}, r.imagens[produtoID]...)
+	if err := r.salvar(alteracao{Imagens: map[uuid.UUID][]models.Imagem{produtoID: nil}}); err != nil {
+		r.logger.Error("Falha ao expurgar imagens do produto", "error", err, "id", produtoID)
+
+		return nil, fmt.Errorf("expurgar imagens do produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Info("Imagens do produto expurgadas", "id", produtoID, "total", len(expurgadas))
+	return expurgadas, nil
+}
+
+// nomeLivre confere que nenhum outro produto ativo do tenant de p usa o
+// nome dele, no escopo do repositório: no escopo por categoria, só os produtos
+// de alguma das categorias informadas contam. Exige o lock de r.
+func (r *RepositorioEmMemoria) nomeLivre(ctx context.Context, p models.Produto, categorias []uuid.UUID) error {
+	porCategoria := r.escopoNome == NomeUnicoNaCategoria
+	if porCategoria && len(categorias) == 0 {
+		return nil
+	}
+	nome := normalizarNome(p.Nome)
+	for _, outro := range r.produtos {
+		if outro.ID == p.ID || outro.TenantID != p.TenantID || outro.RemovidoEm.Valid || normalizarNome(outro.Nome) != nome {
+			continue
+		}
+		if porCategoria && !compartilhamCategoria(r.vinculos[outro.ID], categorias) {
+			continue
+		}
+		return &ProdutoDuplicadoError{Nome: p.Nome, ExistenteID: outro.ID}
+	}
+	return nil
+}
+
+// produtoDoTenant busca o produto, removido ou não, entre os do tenant do
+// contexto. Exige o lock de r.
+func (r *RepositorioEmMemoria) produtoDoTenant(ctx context.Context, id uuid.UUID) (models.Produto, bool) {
+	produto, existe := r.produtos[id]
+	if !existe || produto.TenantID != tenantDe(ctx) {
+		return models.Produto{}, false
+	}
+	return produto, true
+}
+
+// categoriaDoTenant busca a categoria entre as do tenant do contexto. Exige
+// o lock de r.
+func (r *RepositorioEmMemoria) categoriaDoTenant(ctx context.Context, id uuid.UUID) (models.Categoria, bool) {
+	categoria, existe := r.categorias[id]
+	if !existe || categoria.TenantID != tenantDe(ctx) {
+		return models.Categoria{}, false
+	}
+	return categoria, true
+}
+
+// alterar grava o novo estado do produto junto da entrada de histórico que o
+// descreve e, se o preço mudou, do período de preço que ela abre. Um produto
+// que passa a ocupar um nome, por ser novo, renomeado ou restaurado, precisa
+// encontrá-lo livre. Exige o lock exclusivo de r.
+func (r *RepositorioEmMemoria) alterar(ctx context.Context, operacao TipoOperacao, antes, depois *models.Produto) error {
+	if !depois.RemovidoEm.Valid && (antes == nil || antes.RemovidoEm.Valid || antes.Nome != depois.Nome) {
+		if err := r.nomeLivre(ctx, *depois, r.vinculos[depois.ID]); err != nil {
+			return err
+		}
+	}
+	h := novoHistorico(ctx, operacao, antes, depois)
+	a := alteracao{
+		Produtos:  []models.Produto{*depois},
+		Historico: []models.HistoricoProduto{h},
+	}
+	if mudouPreco(antes, depois) {
+		a.Precos = r.abrirVigencia(novaVigencia(h))
+	}
+	return r.salvar(a)
+}
@@ -1,84 +1,89 @@
+package repo_test
+
 import (
-	"github.com/google/uuid"
-	"github.com/seuusuario/labлог6/models"
-	"github.com/stretchr/testify/assert"
+	"io"
 	"log/slog"
-	"os"
 	"testing"
+
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/internal/repo/repotest"
 )
 
 func TestRepositorioEmMemoria(t *testing.T) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	repo := NovoRepositorioEmMemoria(logger)
-
-	t.Run("Criar produto com sucesso", func(t *testing.T) {
-		produto, err := repo.Criar("Laptop", 999.99)
-		assert.NoError(t, err)
-		assert.NotEqual(t, uuid.Nil, produto.ID)
-		assert.Equal(t, "Laptop", produto.Nome)
-		assert.Equal(t, 999.99, produto.Preco)
-	})
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-	t.Run("Criar produto com preço inválido", func(t *testing.T) {
-		_, err := repo.Criar("Laptop", 1)
-		assert.ErrorIs(t, err, ErrPrecoInvalido)
+	repotest.Run(t, func(t *testing.T) repo.RepositorioProdutos {
+		return repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
 	})
+}
 
-	t.Run("Buscar produto existente", func(t *testing.T) {
-		produto, err := repo.Criar("Mouse", 29.99)
-		assert.NoError(t, err)
+func TestTenantsEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-		encontrado, err := repo.Buscar(produto.ID)
-		assert.NoError(t, err)
-		assert.Equal(t, produto, encontrado)
+	repotest.RunTenants(t, func(t *testing.T) repo.RepositorioProdutos {
+		return repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
 	})
+}
+
+func TestUnidadeDeTrabalhoEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-	t.Run("Buscar produto inexistente", func(t *testing.T) {
-		_, err := repo.Buscar(uuid.New())
-		assert.ErrorIs(t, err, ErrProdutoNaoEncontrado)
+	repotest.RunUnidadeDeTrabalho(t, func(t *testing.T) (repo.UnidadeDeTrabalho, repo.RepositorioProdutos) {
+		produtos := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+		return repo.NovaUnidadeDeTrabalhoEmMemoria(produtos, logger), produtos
 	})
+}
 
-	t.Run("Listar produtos", func(t *testing.T) {
-		repo = NovoRepositorioEmMemoria(logger)
-		repo.Criar("Laptop", 999.99)
-		repo.Crir("Mouse", 29.99)
+func TestCategoriasEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-		produtos, err := repo.Listar()
-		assert.NoError(t, err)
-		assert.Len(t, produtos, 2)
+	repotest.RunCategorias(t, func(t *testing.T, opcoes repo.OpcoesRepositorio) (repo.RepositorioProdutos, repo.RepositorioCategorias) {
+		r := repo.NovoRepositorioEmMemoria(opcoes, logger)
+		return r, r
 	})
+}
 
-	t.Run("Atualizar produto existente", func(t *testing.T) {
-		produto, err := repo.Criar("Laptop", 999.99)
-		assert.NoError(t, err)
+func TestEstoqueEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-		atualizado, err := repo.Atualizar(produto.ID, "Laptop Pro", 1299.99)
-		assert.NoError(t, err)
-		assert.Equal(t, "Laptop Pro", atualizado.Nome)
-		assert.Equal(t, 1299.99, atualizado.Preco)
+	repotest.RunEstoque(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioEstoque) {
+		r := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
+}
 
-	t.Run("Atualizar produto com preço inválido", func(t *testing.T) {
-		produto, err := repo.Criar("Laptop", 999.99)
-		assert.NoError(t, err)
+func TestPedidosEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-		_, err = repo.Atualizar(produto.ID, "Laptop Pro", 1)
-		assert.ErrorIs(t, err, ErrPrecoInvalido)
+	repotest.RunPedidos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPedidos) {
+		r := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
+}
 
-	t.Run("Deletar produto existente", func(t *testing.T) {
-		produto, err := repo.Criar("Laptop", 999.99)
-		assert.NoError(t, err)
+func TestVariantesEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-		err = repo.Deletar(produto.ID)
-		assert.NoError(t, err)
+	repotest.RunVariantes(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioVariantes) {
+		r := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+		return r, r
+	})
+}
+
+func TestPrecosEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-		_, err = repo.Buscar(produto.ID)
-		assert.ErrorIs(t, err, ErrProdutoNaoEncontrado)
+	repotest.RunPrecos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPrecos) {
+		r := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
+}
+
+func TestImagensEmMemoria(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 
-	t.Run("Deletar produto inexistente", func(t *testing.T) {
-		err := repo.Deletar(uuid.New())
-		assert.ErrorIs(t, err, ErrProdutoNaoEncontrado)
+	repotest.RunImagens(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioImagens) {
+		r := repo.NovoRepositorioEmMemoria(repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// EscopoNome define entre quais produtos ativos de um tenant o nome precisa
+// ser único, sem distinção entre maiúsculas e minúsculas.
+type EscopoNome string
+
+const (
+	// NomeUnicoNoTenant, o padrão, recusa o nome de qualquer outro produto
+	// ativo do tenant.
+	NomeUnicoNoTenant EscopoNome = "tenant"
+	// NomeUnicoNaCategoria só recusa o nome de outro produto ativo que
+	// compartilhe alguma categoria; produtos sem categoria não concorrem.
+	NomeUnicoNaCategoria EscopoNome = "categoria"
+)
+
+var ErrEscopoNomeInvalido = errors.New("escopo de nome único inválido")
+
+// ValidarEscopoNome aceita NomeUnicoNoTenant e NomeUnicoNaCategoria.
+func ValidarEscopoNome(escopo EscopoNome) error {
+	switch escopo {
+	case NomeUnicoNoTenant, NomeUnicoNaCategoria:
+		return nil
+	}
+	return fmt.Errorf("%q: %w", escopo, ErrEscopoNomeInvalido)
+}
+
+// OpcoesRepositorio configura os repositórios de produtos.
+type OpcoesRepositorio struct {
+	// EscopoNome é a regra de unicidade dos nomes que as escritas de
+	// produtos e a atribuição de categorias respeitam. Vazio usa
+	// NomeUnicoNoTenant.
+	EscopoNome EscopoNome
+}
+
+func (o OpcoesRepositorio) escopoNome() EscopoNome {
+	if o.EscopoNome == "" {
+		return NomeUnicoNoTenant
+	}
+	return o.EscopoNome
+}
+
+// normalizarNome é a forma do nome comparada pela unicidade. Os repositórios
+// SQL a gravam na coluna nome_normalizado, inclusive ao preenchê-la nos
+// produtos antigos, em vez de depender do lower() de cada banco.
+func normalizarNome(nome string) string {
+	return strings.ToLower(nome)
+}
+
+// truncarNome corta o nome em no máximo limite caracteres.
+func truncarNome(nome string, limite int) string {
+	if runas := []rune(nome); len(runas) > limite {
+		return string(runas[:limite])
+	}
+	return nome
+}
+
+// compartilhamCategoria informa se as duas listas têm alguma categoria em
+// comum.
+func compartilhamCategoria(a, b []uuid.UUID) bool {
+	for _, id := range a {
+		if slices.Contains(b, id) {
+			return true
+		}
+	}
+	return false
+}
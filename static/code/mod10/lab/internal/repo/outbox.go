@@ -0,0 +1,228 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TipoEvento identifica o evento de domínio gravado na outbox.
+type TipoEvento string
+
+const (
+	EventoProdutoCriado     TipoEvento = "ProdutoCriado"
+	EventoProdutoAtualizado TipoEvento = "ProdutoAtualizado"
+	EventoProdutoRemovido   TipoEvento = "ProdutoRemovido"
+	EventoProdutoRestaurado TipoEvento = "ProdutoRestaurado"
+)
+
+// eventosPorOperacao associa cada operação do histórico ao evento publicado.
+var eventosPorOperacao = map[TipoOperacao]TipoEvento{
+	OperacaoCriar:     EventoProdutoCriado,
+	OperacaoAtualizar: EventoProdutoAtualizado,
+	OperacaoDeletar:   EventoProdutoRemovido,
+	OperacaoRestaurar: EventoProdutoRestaurado,
+}
+
+// novoEvento monta o evento correspondente a uma entrada do histórico. O ID
+// do evento é o da entrada, o que liga as duas tabelas.
+func novoEvento(h models.HistoricoProduto) models.EventoProduto {
+	return models.EventoProduto{
+		ID:         h.ID,
+		Tipo:       string(eventosPorOperacao[TipoOperacao(h.Operacao)]),
+		ProdutoID:  h.ProdutoID,
+		Produto:    h.Depois,
+		OcorridoEm: h.RegistradoEm,
+	}
+}
+
+// Publicador entrega eventos a outros serviços. Publicar pode ser chamado
+// mais de uma vez para o mesmo evento, inclusive depois de ter sucesso, então
+// o destino deve descartar repetições pelo ID do evento.
+type Publicador interface {
+	Publicar(ctx context.Context, evento models.EventoProduto) error
+}
+
+const (
+	IntervaloRelayPadrao    = time.Second
+	LoteRelayPadrao         = 100
+	EsperaMaximaRelayPadrao = time.Minute
+)
+
+// OpcoesRelay configura RelayOutbox. Valores zerados usam os padrões.
+type OpcoesRelay struct {
+	// Intervalo é a espera entre varreduras da outbox sem falhas.
+	Intervalo time.Duration
+	// Lote é o máximo de eventos publicados por varredura.
+	Lote int
+	// EsperaMaxima limita o recuo exponencial após falhas de publicação.
+	EsperaMaxima time.Duration
+}
+
+// RelayOutbox publica os eventos pendentes da outbox por meio de um
+// Publicador, na ordem em que foram gravados. A entrega é pelo menos uma vez:
+// um evento só é marcado como publicado depois que Publicar retorna sem erro,
+// e uma queda entre as duas coisas o publica de novo.
+type RelayOutbox struct {
+	db         *gorm.DB
+	publicador Publicador
+	opcoes     OpcoesRelay
+	logger     *zap.Logger
+}
+
+// NovoRelayOutbox cria um relay sobre a outbox de db.
+func NovoRelayOutbox(db *gorm.DB, publicador Publicador, opcoes OpcoesRelay, logger *zap.Logger) *RelayOutbox {
+	if opcoes.Intervalo <= 0 {
+		opcoes.Intervalo = IntervaloRelayPadrao
+	}
+	if opcoes.Lote <= 0 {
+		opcoes.Lote = LoteRelayPadrao
+	}
+	if opcoes.EsperaMaxima <= 0 {
+		opcoes.EsperaMaxima = EsperaMaximaRelayPadrao
+	}
+	return &RelayOutbox{db: db, publicador: publicador, opcoes: opcoes, logger: logger}
+}
+
+// Executar publica os eventos até ctx ser cancelado. Depois de uma falha, a
+// espera até a próxima tentativa dobra, até OpcoesRelay.EsperaMaxima; uma
+// varredura que enche o lote é seguida de outra imediatamente.
+func (r *RelayOutbox) Executar(ctx context.Context) {
+	espera := r.opcoes.Intervalo
+	for {
+		publicados, err := r.Publicar(ctx)
+		switch {
+		case err != nil:
+			espera = min(espera*2, r.opcoes.EsperaMaxima)
+		case publicados == r.opcoes.Lote:
+			espera = 0
+		default:
+			espera = r.opcoes.Intervalo
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(espera):
+		}
+	}
+}
+
+// Publicar faz uma varredura: trava os eventos pendentes mais antigos e os
+// publica em ordem, marcando cada um como publicado. A varredura para no
+// primeiro erro, que fica registrado no evento, para que os seguintes não o
+// ultrapassem. Retorna quantos eventos foram publicados.
+func (r *RelayOutbox) Publicar(ctx context.Context) (int, error) {
+	var publicados int
+	var errPublicar error
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var eventos []models.EventoProduto
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("publicado_em IS NULL").
+			Order("seq").
+			Limit(r.opcoes.Lote).
+			Find(&eventos).Error
+		if err != nil {
+			return err
+		}
+
+		for _, evento := range eventos {
+			if errPublicar = r.publicador.Publicar(ctx, evento); errPublicar != nil {
+				return tx.Model(&evento).Updates(map[string]any{
+					"tentativas":  gorm.Expr("tentativas + 1"),
+					"ultimo_erro": errPublicar.Error(),
+				}).Error
+			}
+			if err := tx.Model(&evento).Update("publicado_em", time.Now()).Error; err != nil {
+				return err
+			}
+			publicados++
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("Falha ao ler a outbox", zap.Error(err))
+		return 0, fmt.Errorf("publicar eventos: %w", err)
+	}
+	if errPublicar != nil {
+		r.logger.Error("Falha ao publicar evento", zap.Error(errPublicar), zap.Int("publicados", publicados))
+		return publicados, fmt.Errorf("publicar eventos: %w", errPublicar)
+	}
+
+	if publicados > 0 {
+		r.logger.Info("Eventos publicados", zap.Int("total", publicados))
+	}
+	return publicados, nil
+}
+
+// PublicadorEmMemoria guarda os eventos recebidos, descartando repetições
+// pelo ID como um consumidor faria. Serve para testes.
+type PublicadorEmMemoria struct {
+	mu       sync.Mutex
+	eventos  []models.EventoProduto
+	vistos   map[uuid.UUID]bool
+	entregas int
+	falhas   []error
+}
+
+func NovoPublicadorEmMemoria() *PublicadorEmMemoria {
+	return &PublicadorEmMemoria{vistos: make(map[uuid.UUID]bool)}
+}
+
+// Publicar implementa Publicador.
+func (p *PublicadorEmMemoria) Publicar(ctx context.Context, evento models.EventoProduto) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.falhas) > 0 {
+		err := p.falhas[0]
+		p.falhas = p.falhas[1:]
+		return err
+	}
+
+	p.entregas++
+	if !p.vistos[evento.ID] {
+		p.vistos[evento.ID] = true
+		p.eventos = append(p.eventos, evento)
+	}
+	return nil
+}
+
+// Falhar faz as próximas chamadas a Publicar retornarem os erros informados,
+// um por chamada.
+func (p *PublicadorEmMemoria) Falhar(erros ...error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.falhas = append(p.falhas, erros...)
+}
+
+// Eventos retorna os eventos distintos na ordem da primeira entrega.
+func (p *PublicadorEmMemoria) Eventos() []models.EventoProduto {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.eventos)
+}
+
+// Entregas retorna quantas chamadas a Publicar tiveram sucesso, contando as
+// repetições.
+func (p *PublicadorEmMemoria) Entregas() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.entregas
+}
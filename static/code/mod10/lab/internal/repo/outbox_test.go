@@ -0,0 +1,118 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func TestPublicadorEmMemoria(t *testing.T) {
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+	p := repo.NovoPublicadorEmMemoria()
+	evento := models.EventoProduto{ID: uuid.New(), Tipo: string(repo.EventoProdutoCriado)}
+
+	errBroker := errors.New("broker indisponível")
+	p.Falhar(errBroker)
+	assert.ErrorIs(t, p.Publicar(ctx, evento), errBroker)
+	assert.Empty(t, p.Eventos())
+
+	// Uma repetição conta como entrega, mas não como novo evento
+	assert.NoError(t, p.Publicar(ctx, evento))
+	assert.NoError(t, p.Publicar(ctx, evento))
+	assert.Equal(t, []models.EventoProduto{evento}, p.Eventos())
+	assert.Equal(t, 2, p.Entregas())
+}
+
+func TestPostgresOutbox(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	esvaziar(t)
+	testarOutbox(t, db, repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, zap.NewNop()))
+}
+
+func TestPgxOutbox(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	esvaziar(t)
+	testarOutbox(t, db, abrirPgx(t, repo.OpcoesRepositorio{}))
+}
+
+func TestSQLiteOutbox(t *testing.T) {
+	db := abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db"))
+	testarOutbox(t, db, repo.NovoSQLiteRepositorio(db, repo.OpcoesRepositorio{}, zap.NewNop()))
+}
+
+// testarOutbox confere que as escritas de produtos gravam eventos na outbox
+// de db e que o relay os publica em ordem, com novas tentativas após falhas.
+func testarOutbox(t *testing.T, db *gorm.DB, produtos repo.RepositorioProdutos) {
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+	publicador := repo.NovoPublicadorEmMemoria()
+	relay := repo.NovoRelayOutbox(db, publicador, repo.OpcoesRelay{Lote: 2}, zap.NewNop())
+
+	produto, err := produtos.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	atualizado, err := produtos.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), produto.Versao)
+	assert.NoError(t, err)
+	assert.NoError(t, produtos.Deletar(ctx, produto.ID, atualizado.Versao))
+	_, err = produtos.Restaurar(ctx, produto.ID)
+	assert.NoError(t, err)
+
+	// Um lote rejeitado não deixa eventos
+	_, err = produtos.AplicarLote(ctx, []repo.OperacaoLote{
+		{Tipo: repo.OperacaoCriar, Nome: "Mouse", Preco: models.Centavos(4990)},
+		{Tipo: repo.OperacaoDeletar, ID: uuid.New()},
+	})
+	assert.ErrorIs(t, err, repo.ErrLoteRejeitado)
+
+	// Lote 2: a primeira varredura publica só os dois mais antigos
+	publicados, err := relay.Publicar(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, publicados)
+	publicados, err = relay.Publicar(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, publicados)
+	publicados, err = relay.Publicar(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, publicados)
+
+	var tipos []string
+	for _, e := range publicador.Eventos() {
+		assert.Equal(t, produto.ID, e.ProdutoID)
+		tipos = append(tipos, e.Tipo)
+	}
+	assert.Equal(t, []string{"ProdutoCriado", "ProdutoAtualizado", "ProdutoRemovido", "ProdutoRestaurado"}, tipos)
+	assert.Equal(t, "Laptop Pro", publicador.Eventos()[1].Produto.Nome)
+
+	// Uma falha interrompe a varredura e fica registrada no evento
+	outro, err := produtos.Criar(ctx, "Teclado", models.Centavos(14990))
+	assert.NoError(t, err)
+	publicador.Falhar(errors.New("broker indisponível"))
+	publicados, err = relay.Publicar(ctx)
+	assert.Error(t, err)
+	assert.Zero(t, publicados)
+
+	var pendente models.EventoProduto
+	assert.NoError(t, db.Where("produto_id = ?", outro.ID).First(&pendente).Error)
+	assert.Equal(t, 1, pendente.Tentativas)
+	assert.Equal(t, "broker indisponível", pendente.UltimoErro)
+	assert.Nil(t, pendente.PublicadoEm)
+
+	publicados, err = relay.Publicar(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, publicados)
+	assert.Len(t, publicador.Eventos(), 5)
+
+	// Reentregar um evento, como após uma queda do relay, não o duplica
+	assert.NoError(t, db.Model(&pendente).Update("publicado_em", nil).Error)
+	publicados, err = relay.Publicar(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, publicados)
+	assert.Len(t, publicador.Eventos(), 5)
+	assert.Equal(t, 6, publicador.Entregas())
+}
@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+var (
+	ErrPedidoNaoEncontrado  = errors.New("pedido não encontrado")
+	ErrPedidoVazio          = errors.New("pedido sem itens")
+	ErrStatusPedidoInvalido = errors.New("status de pedido inválido")
+	ErrTransicaoInvalida    = errors.New("transição de status não permitida")
+)
+
+// StatusPedido é a situação de um pedido. Um pedido criado pode ser pago e,
+// depois, enviado; enquanto não for enviado, pode ser cancelado.
+type StatusPedido string
+
+const (
+	PedidoCriado    StatusPedido = "criado"
+	PedidoPago      StatusPedido = "pago"
+	PedidoEnviado   StatusPedido = "enviado"
+	PedidoCancelado StatusPedido = "cancelado"
+)
+
+// transicoesPedido lista, para cada status, os status seguintes permitidos.
+var transicoesPedido = map[StatusPedido][]StatusPedido{
+	PedidoCriado: {PedidoPago, PedidoCancelado},
+	PedidoPago:   {PedidoEnviado, PedidoCancelado},
+}
+
+// ItemSolicitado é um item pedido pelo cliente: o produto e a quantidade.
+// Nome e preço vêm do produto no momento da criação do pedido.
+type ItemSolicitado struct {
+	ProdutoID  uuid.UUID `json:"produto_id" binding:"required"`
+	Quantidade int       `json:"quantidade" binding:"required,gt=0"`
+}
+
+// RepositorioPedidos mantém os pedidos e seus itens. Os repositórios de
+// produtos também o implementam, de modo que o pedido lê os produtos no
+// mesmo armazenamento em que é gravado.
+type RepositorioPedidos interface {
+	// CriarPedido cria um pedido com os itens informados, copiando nome e
+	// preço de cada produto ativo e calculando os subtotais e o total.
+	CriarPedido(ctx context.Context, itens []ItemSolicitado) (models.Pedido, error)
+	// BuscarPedido retorna o pedido com seus itens na ordem em que foram
+	// pedidos.
+	BuscarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error)
+	// ListarPedidos retorna os pedidos mais recentes primeiro, apenas os do
+	// status informado se ele não for vazio.
+	ListarPedidos(ctx context.Context, status StatusPedido, limite int) ([]models.Pedido, error)
+	// PagarPedido leva um pedido criado a pago.
+	PagarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error)
+	// EnviarPedido leva um pedido pago a enviado.
+	EnviarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error)
+	// CancelarPedido cancela um pedido ainda não enviado. Cancelar de novo
+	// não tem efeito.
+	CancelarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error)
+}
+
+// novoPedido monta um pedido do tenant criado agora a partir dos itens,
+// lendo cada produto com buscar, que deve retornar ErrProdutoNaoEncontrado
+// para produtos inexistentes, removidos ou de outro tenant.
+func novoPedido(tenant string, itens []ItemSolicitado, buscar func(id uuid.UUID) (models.Produto, error)) (models.Pedido, error) {
+	if len(itens) == 0 {
+		return models.Pedido{}, ErrPedidoVazio
+	}
+
+	agora := time.Now().UTC()
+	pedido := models.Pedido{
+		ID:           uuid.New(),
+		TenantID:     tenant,
+		Status:       string(PedidoCriado),
+		Itens:        make([]models.ItemPedido, 0, len(itens)),
+		Total:        models.Centavos(0),
+		CriadoEm:     agora,
+		AtualizadoEm: agora,
+	}
+	for i, item := range itens {
+		if item.Quantidade <= 0 {
+			return models.Pedido{}, fmt.Errorf("item %d: %w", i, ErrQuantidadeInvalida)
+		}
+		produto, err := buscar(item.ProdutoID)
+		if err != nil {
+			return models.Pedido{}, fmt.Errorf("item %d produto %s: %w", i, item.ProdutoID, err)
+		}
+
+		subtotal, err := produto.Preco.Multiplicar(item.Quantidade)
+		if err != nil {
+			return models.Pedido{}, fmt.Errorf("item %d: %w", i, err)
+		}
+		if pedido.Total, err = pedido.Total.Somar(subtotal); err != nil {
+			return models.Pedido{}, fmt.Errorf("item %d: %w", i, err)
+		}
+		pedido.Itens = append(pedido.Itens, models.ItemPedido{
+			PedidoID:      pedido.ID,
+			Posicao:       i,
+			ProdutoID:     produto.ID,
+			Nome:          produto.Nome,
+			PrecoUnitario: produto.Preco,
+			Quantidade:    item.Quantidade,
+			Subtotal:      subtotal,
+		})
+	}
+	return pedido, nil
+}
+
+// transicaoPedido decide se o pedido pode ir de atual para alvo. Retorna
+// false, sem erro, ao cancelar um pedido já cancelado.
+func transicaoPedido(atual, alvo StatusPedido) (bool, error) {
+	if atual == PedidoCancelado && alvo == PedidoCancelado {
+		return false, nil
+	}
+	if !slices.Contains(transicoesPedido[atual], alvo) {
+		return false, fmt.Errorf("de %s para %s: %w", atual, alvo, ErrTransicaoInvalida)
+	}
+	return true, nil
+}
+
+// validarStatusPedido aceita o status vazio, que em ListarPedidos significa
+// todos, e os status conhecidos.
+func validarStatusPedido(status StatusPedido) error {
+	switch status {
+	case "", PedidoCriado, PedidoPago, PedidoEnviado, PedidoCancelado:
+		return nil
+	default:
+		return fmt.Errorf("%q: %w", status, ErrStatusPedidoInvalido)
+	}
+}
+
+// compararPedidos ordena do pedido mais recente para o mais antigo e, em
+// empates, por ID decrescente, como o ORDER BY dos bancos SQL.
+func compararPedidos(a, b models.Pedido) int {
+	if c := b.CriadoEm.Compare(a.CriadoEm); c != 0 {
+		return c
+	}
+	return bytes.Compare(b.ID[:], a.ID[:])
+}
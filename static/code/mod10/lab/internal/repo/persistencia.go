@@ -0,0 +1,614 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+const (
+	arquivoLog      = "produtos.wal"
+	arquivoSnapshot = "produtos.snapshot"
+
+	// CompactarACadaPadrao é quantos registros o log acumula antes de ser
+	// compactado num snapshot.
+	CompactarACadaPadrao = 1000
+
+	// registroMaximo limita o tamanho lido de um registro, para que um
+	// cabeçalho corrompido não provoque uma alocação gigante.
+	registroMaximo = 64 << 20
+)
+
+// ErrLogCorrompido indica um registro inválido antes do fim do log, que não
+// pode ser explicado por uma escrita interrompida.
+var ErrLogCorrompido = errors.New("log de escrita corrompido")
+
+// OpcoesPersistencia configura AbrirRepositorioEmMemoria.
+type OpcoesPersistencia struct {
+	// Diretorio guarda o log e o snapshot; é criado se não existir.
+	Diretorio string
+	// CompactarACada é quantos registros o log acumula antes de virar um
+	// snapshot. Zero usa CompactarACadaPadrao.
+	CompactarACada int
+	OpcoesRepositorio
+}
+
+// alteracao é a unidade gravada no log: os produtos, categorias, estoques,
+// reservas, pedidos, grades, variantes e períodos de preço no estado novo, as
+// entradas de histórico, as categorias e as imagens de cada produto alterado
+// e os IDs expurgados por uma escrita; uma lista vazia de categorias ou de
+// imagens as remove do produto. Lotes e transações gravam uma única
+// alteracao, então são recuperados por inteiro ou não são recuperados.
+type alteracao struct {
+	Produtos   []models.Produto              `json:"produtos,omitempty"`
+	Historico  []models.HistoricoProduto     `json:"historico,omitempty"`
+	Categorias []models.Categoria            `json:"categorias,omitempty"`
+	Vinculos   map[uuid.UUID][]uuid.UUID     `json:"vinculos,omitempty"`
+	Estoques   []models.Estoque              `json:"estoques,omitempty"`
+	Reservas   []models.Reserva              `json:"reservas,omitempty"`
+	Pedidos    []models.Pedido               `json:"pedidos,omitempty"`
+	Grades     []models.Grade                `json:"grades,omitempty"`
+	Variantes  []models.Variante             `json:"variantes,omitempty"`
+	Precos     []models.PrecoProduto         `json:"precos,omitempty"`
+	Imagens    map[uuid.UUID][]models.Imagem `json:"imagens,omitempty"`
+	Purgados   []uuid.UUID                   `json:"purgados,omitempty"`
+}
+
+func (a alteracao) vazia() bool {
+	return len(a.Produtos) == 0 && len(a.Historico) == 0 && len(a.Categorias) == 0 &&
+		len(a.Vinculos) == 0 && len(a.Estoques) == 0 && len(a.Reservas) == 0 && len(a.Pedidos) == 0 && len(a.Grades) == 0 && len(a.Variantes) == 0 &&
+		len(a.Precos) == 0 && len(a.Imagens) == 0 && len(a.Purgados) == 0
+}
+
+// registroLog é uma alteracao numerada. Seq cresce a cada registro e permite
+// ignorar, na recuperação, registros que o snapshot já contém.
+type registroLog struct {
+	Seq uint64 `json:"seq"`
+	alteracao
+}
+
+// snapshot é o estado completo do repositório após o registro Seq.
+type snapshot struct {
+	Seq        uint64                        `json:"seq"`
+	Produtos   []models.Produto              `json:"produtos"`
+	Historico  []models.HistoricoProduto     `json:"historico"`
+	Categorias []models.Categoria            `json:"categorias"`
+	Vinculos   map[uuid.UUID][]uuid.UUID     `json:"vinculos"`
+	Estoques   []models.Estoque              `json:"estoques"`
+	Reservas   []models.Reserva              `json:"reservas"`
+	Pedidos    []models.Pedido               `json:"pedidos"`
+	Grades     []models.Grade                `json:"grades"`
+	Variantes  []models.Variante             `json:"variantes"`
+	Precos     []models.PrecoProduto         `json:"precos"`
+	Imagens    map[uuid.UUID][]models.Imagem `json:"imagens"`
+}
+
+// logEscrita é o log de escrita antecipada: cada registro é gravado e
+// sincronizado com o disco antes de a alteração ficar visível. Cada registro
+// tem um cabeçalho com o tamanho e o CRC-32 do conteúdo JSON, o que permite
+// reconhecer um último registro gravado pela metade.
+type logEscrita struct {
+	diretorio      string
+	arquivo        *os.File
+	tamanho        int64  // bytes válidos no arquivo
+	seq            uint64 // último registro gravado
+	registros      int    // registros desde o último snapshot
+	compactarACada int
+	falha          error // erro que impede novas gravações
+}
+
+// AbrirRepositorioEmMemoria cria um RepositorioEmMemoria persistido em
+// opcoes.Diretorio, recuperando o estado do snapshot e do log existentes.
+// Um último registro incompleto, deixado por uma queda durante a escrita, é
+// descartado; registros inválidos antes dele resultam em ErrLogCorrompido.
+func AbrirRepositorioEmMemoria(opcoes OpcoesPersistencia, logger *slog.Logger) (*RepositorioEmMemoria, error) {
+	if opcoes.CompactarACada <= 0 {
+		opcoes.CompactarACada = CompactarACadaPadrao
+	}
+	if err := os.MkdirAll(opcoes.Diretorio, 0o755); err != nil {
+		return nil, fmt.Errorf("abrir repositório em %s: %w", opcoes.Diretorio, err)
+	}
+
+	r := NovoRepositorioEmMemoria(opcoes.OpcoesRepositorio, logger)
+	wal := &logEscrita{diretorio: opcoes.Diretorio, compactarACada: opcoes.CompactarACada}
+
+	seq, err := r.carregarSnapshot(filepath.Join(opcoes.Diretorio, arquivoSnapshot))
+	if err != nil {
+		return nil, fmt.Errorf("abrir repositório em %s: %w", opcoes.Diretorio, err)
+	}
+	wal.seq = seq
+
+	if err := r.reproduzirLog(wal); err != nil {
+		return nil, fmt.Errorf("abrir repositório em %s: %w", opcoes.Diretorio, err)
+	}
+	r.wal = wal
+
+	if err := r.migrarPrecos(); err != nil {
+		return nil, fmt.Errorf("abrir repositório em %s: %w", opcoes.Diretorio, err)
+	}
+
+	logger.Info("Repositório recuperado", "diretorio", opcoes.Diretorio, "produtos", len(r.produtos), "seq", wal.seq)
+	return r, nil
+}
+
+// Compactar grava o estado atual num snapshot e esvazia o log. É chamado
+// automaticamente a cada OpcoesPersistencia.CompactarACada registros.
+func (r *RepositorioEmMemoria) Compactar() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.wal == nil {
+		return nil
+	}
+	return r.compactar()
+}
+
+// Fechar libera o arquivo do log. O repositório não aceita escritas depois.
+func (r *RepositorioEmMemoria) Fechar() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.wal == nil {
+		return nil
+	}
+	r.wal.falha = os.ErrClosed
+	return r.wal.arquivo.Close()
+}
+
+// salvar grava a alteração e a aplica ao estado. Exige o lock exclusivo de r.
+func (r *RepositorioEmMemoria) salvar(a alteracao) error {
+	if err := r.persistir(a); err != nil {
+		return err
+	}
+	r.aplicar(a)
+	r.compactarSeNecessario()
+	return nil
+}
+
+// persistir acumula a alteração, num rascunho, ou a grava no log.
+func (r *RepositorioEmMemoria) persistir(a alteracao) error {
+	switch {
+	case a.vazia():
+		return nil
+	case r.pendente != nil:
+		r.pendente.Produtos = append(r.pendente.Produtos, a.Produtos...)
+		r.pendente.Historico = append(r.pendente.Historico, a.Historico...)
+		r.pendente.Categorias = append(r.pendente.Categorias, a.Categorias...)
+		if len(a.Vinculos) > 0 && r.pendente.Vinculos == nil {
+			r.pendente.Vinculos = make(map[uuid.UUID][]uuid.UUID)
+		}
+		maps.Copy(r.pendente.Vinculos, a.Vinculos)
+		r.pendente.Estoques = append(r.pendente.Estoques, a.Estoques...)
+		r.pendente.Reservas = append(r.pendente.Reservas, a.Reservas...)
+		r.pendente.Pedidos = append(r.pendente.Pedidos, a.Pedidos...)
+		r.pendente.Grades = append(r.pendente.Grades, a.Grades...)
+		r.pendente.Variantes = append(r.pendente.Variantes, a.Variantes...)
+		r.pendente.Precos = append(r.pendente.Precos, a.Precos...)
+		if len(a.Imagens) > 0 && r.pendente.Imagens == nil {
+			r.pendente.Imagens = make(map[uuid.UUID][]models.Imagem)
+		}
+		maps.Copy(r.pendente.Imagens, a.Imagens)
+		r.pendente.Purgados = append(r.pendente.Purgados, a.Purgados...)
+		return nil
+	case r.wal != nil:
+		return r.wal.anexar(a)
+	default:
+		return nil
+	}
+}
+
+// aplicar incorpora a alteração ao estado em memória, na mesma ordem usada
+// ao gravá-la.
+func (r *RepositorioEmMemoria) aplicar(a alteracao) {
+	// Registros gravados antes do isolamento por tenant não trazem TenantID;
+	// eles pertencem ao TenantPadrao, como nas migrações dos bancos SQL. O
+	// mesmo vale para categorias, reservas e pedidos, isolados depois.
+	for _, p := range a.Produtos {
+		if p.TenantID == "" {
+			p.TenantID = TenantPadrao
+		}
+		r.produtos[p.ID] = p
+	}
+	for _, h := range a.Historico {
+		if h.TenantID == "" {
+			h.TenantID = TenantPadrao
+		}
+		r.historico[h.ProdutoID] = append(r.historico[h.ProdutoID], h)
+	}
+	for _, c := range a.Categorias {
+		if c.TenantID == "" {
+			c.TenantID = TenantPadrao
+		}
+		r.categorias[c.ID] = c
+	}
+	for id, categorias := range a.Vinculos {
+		if len(categorias) == 0 {
+			delete(r.vinculos, id)
+			continue
+		}
+		r.vinculos[id] = categorias
+	}
+	for _, e := range a.Estoques {
+		r.estoques[e.ProdutoID] = e
+	}
+	for _, reserva := range a.Reservas {
+		if reserva.TenantID == "" {
+			reserva.TenantID = TenantPadrao
+		}
+		r.reservas[reserva.ID] = reserva
+	}
+	for _, p := range a.Pedidos {
+		if p.TenantID == "" {
+			p.TenantID = TenantPadrao
+		}
+		// PedidoID e Posicao não vão para o JSON dos itens; a posição no
+		// slice os reconstitui ao reler o registro.
+		p.Itens = slices.Clone(p.Itens)
+		for i := range p.Itens {
+			p.Itens[i].PedidoID, p.Itens[i].Posicao = p.ID, i
+		}
+		r.pedidos[p.ID] = p
+	}
+	for _, g := range a.Grades {
+		r.grades[g.ProdutoID] = g
+	}
+	for _, v := range a.Variantes {
+		r.variantes[v.ProdutoID] = v
+	}
+	for _, p := range a.Precos {
+		// A linha do tempo pode ser compartilhada com um rascunho; cada
+		// mudança produz uma nova
+		precos := slices.Clone(r.precos[p.ProdutoID])
+		if i := slices.IndexFunc(precos, func(q models.PrecoProduto) bool { return q.ID == p.ID }); i >= 0 {
+			precos[i] = p
+		} else {
+			precos = append(precos, p)
+		}
+		ordenarPrecos(precos)
+		r.precos[p.ProdutoID] = precos
+	}
+	for id, imagens := range a.Imagens {
+		if len(imagens) == 0 {
+			delete(r.imagens, id)
+			continue
+		}
+		r.imagens[id] = imagens
+	}
+	for _, id := range a.Purgados {
+		delete(r.produtos, id)
+		delete(r.vinculos, id)
+		delete(r.estoques, id)
+		delete(r.grades, id)
+		delete(r.precos, id)
+		delete(r.imagens, id)
+	}
+	if len(a.Purgados) > 0 {
+		maps.DeleteFunc(r.reservas, func(_ uuid.UUID, reserva models.Reserva) bool {
+			return slices.Contains(a.Purgados, reserva.ProdutoID)
+		})
+		// Como no ON DELETE CASCADE dos bancos, expurgar o filho ou o pai
+		// desfaz a ligação da variante
+		maps.DeleteFunc(r.variantes, func(_ uuid.UUID, v models.Variante) bool {
+			return slices.Contains(a.Purgados, v.ProdutoID) || slices.Contains(a.Purgados, v.PaiID)
+		})
+	}
+}
+
+// compactarSeNecessario compacta o log quando ele atinge o limite. Uma falha
+// não desfaz a escrita, que já está no log; a compactação é tentada de novo
+// no próximo registro.
+func (r *RepositorioEmMemoria) compactarSeNecessario() {
+	if r.wal == nil || r.wal.registros < r.wal.compactarACada {
+		return
+	}
+	if err := r.compactar(); err != nil {
+		r.logger.Error("Falha ao compactar log", "error", err)
+	}
+}
+
+// compactar grava o snapshot ao lado do definitivo e o renomeia por cima,
+// para que uma queda no meio preserve o anterior. Só então esvazia o log;
+// registros que sobrarem por uma queda entre os dois passos são ignorados
+// na recuperação pelo número de sequência.
+func (r *RepositorioEmMemoria) compactar() error {
+	s := snapshot{
+		Seq:        r.wal.seq,
+		Produtos:   make([]models.Produto, 0, len(r.produtos)),
+		Historico:  []models.HistoricoProduto{},
+		Categorias: make([]models.Categoria, 0, len(r.categorias)),
+		Vinculos:   r.vinculos,
+		Estoques:   make([]models.Estoque, 0, len(r.estoques)),
+		Reservas:   make([]models.Reserva, 0, len(r.reservas)),
+		Pedidos:    make([]models.Pedido, 0, len(r.pedidos)),
+		Grades:     make([]models.Grade, 0, len(r.grades)),
+		Variantes:  make([]models.Variante, 0, len(r.variantes)),
+		Precos:     []models.PrecoProduto{},
+		Imagens:    r.imagens,
+	}
+	for _, p := range r.produtos {
+		s.Produtos = append(s.Produtos, p)
+	}
+	for _, c := range r.categorias {
+		s.Categorias = append(s.Categorias, c)
+	}
+	for _, e := range r.estoques {
+		s.Estoques = append(s.Estoques, e)
+	}
+	for _, reserva := range r.reservas {
+		s.Reservas = append(s.Reservas, reserva)
+	}
+	for _, p := range r.pedidos {
+		s.Pedidos = append(s.Pedidos, p)
+	}
+	for _, g := range r.grades {
+		s.Grades = append(s.Grades, g)
+	}
+	for _, v := range r.variantes {
+		s.Variantes = append(s.Variantes, v)
+	}
+	for _, historico := range r.historico {
+		s.Historico = append(s.Historico, historico...)
+	}
+	for _, precos := range r.precos {
+		s.Precos = append(s.Precos, precos...)
+	}
+
+	caminho := filepath.Join(r.wal.diretorio, arquivoSnapshot)
+	if err := gravarArquivo(caminho, s); err != nil {
+		return fmt.Errorf("compactar log: %w", err)
+	}
+	if err := r.wal.esvaziar(); err != nil {
+		return fmt.Errorf("compactar log: %w", err)
+	}
+
+	r.logger.Info("Log compactado", "seq", s.Seq, "produtos", len(s.Produtos))
+	return nil
+}
+
+// carregarSnapshot aplica o snapshot, se existir, e retorna seu Seq.
+func (r *RepositorioEmMemoria) carregarSnapshot(caminho string) (uint64, error) {
+	dados, err := os.ReadFile(caminho)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ler snapshot: %w", err)
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(dados, &s); err != nil {
+		return 0, fmt.Errorf("ler snapshot: %w", err)
+	}
+	r.aplicar(alteracao{Produtos: s.Produtos, Historico: s.Historico, Categorias: s.Categorias, Vinculos: s.Vinculos, Estoques: s.Estoques, Reservas: s.Reservas, Pedidos: s.Pedidos, Grades: s.Grades, Variantes: s.Variantes, Precos: s.Precos, Imagens: s.Imagens})
+	return s.Seq, nil
+}
+
+// migrarPrecos monta, como a migração dos bancos SQL, a linha do tempo dos
+// produtos gravados antes dela: cada entrada do histórico que mudou o preço
+// abre um período, com o ID da entrada, fechado pela seguinte, e produtos
+// sem mudança registrada começam um período agora, com o ID do próprio
+// produto. A linha do tempo montada é gravada no log.
+func (r *RepositorioEmMemoria) migrarPrecos() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var a alteracao
+	for id, produto := range r.produtos {
+		if len(r.precos[id]) > 0 {
+			continue
+		}
+		var precos []models.PrecoProduto
+		for _, h := range r.historico[id] {
+			if !mudouPreco(h.Antes, h.Depois) {
+				continue
+			}
+			v := novaVigencia(h)
+			if n := len(precos); n > 0 {
+				ate := v.VigenteDe
+				precos[n-1].VigenteAte = &ate
+			}
+			precos = append(precos, v)
+		}
+		if len(precos) == 0 {
+			precos = append(precos, models.PrecoProduto{ID: id, ProdutoID: id, TenantID: produto.TenantID, Preco: produto.Preco, VigenteDe: time.Now()})
+		}
+		a.Precos = append(a.Precos, precos...)
+	}
+	if err := r.salvar(a); err != nil {
+		return fmt.Errorf("migrar preços: %w", err)
+	}
+	if len(a.Precos) > 0 {
+		r.logger.Info("Linha do tempo de preços migrada", "precos", len(a.Precos))
+	}
+	return nil
+}
+
+// reproduzirLog aplica os registros posteriores ao snapshot e deixa o log
+// aberto para novas gravações. Um registro incompleto no fim é cortado.
+func (r *RepositorioEmMemoria) reproduzirLog(wal *logEscrita) error {
+	arquivo, err := os.OpenFile(filepath.Join(wal.diretorio, arquivoLog), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("abrir log: %w", err)
+	}
+
+	leitor := bufio.NewReader(arquivo)
+	for {
+		registro, n, err := lerRegistro(leitor)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			r.logger.Warn("Registro incompleto descartado do log", "offset", wal.tamanho, "seq", wal.seq+1)
+
+			if err := arquivo.Truncate(wal.tamanho); err != nil {
+				arquivo.Close()
+				return fmt.Errorf("descartar registro incompleto: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			arquivo.Close()
+			return fmt.Errorf("ler log no offset %d: %w", wal.tamanho, err)
+		}
+
+		wal.tamanho += n
+		if registro.Seq <= wal.seq {
+			continue
+		}
+		r.aplicar(registro.alteracao)
+		wal.seq = registro.Seq
+		wal.registros++
+	}
+
+	wal.arquivo = arquivo
+	return nil
+}
+
+// lerRegistro lê o próximo registro e quantos bytes ele ocupa. Retorna
+// io.EOF no fim exato do log e io.ErrUnexpectedEOF quando o último registro
+// está incompleto ou não confere com o CRC, o que só acontece com uma
+// escrita interrompida.
+func lerRegistro(leitor *bufio.Reader) (registroLog, int64, error) {
+	var cabecalho [8]byte
+	if _, err := io.ReadFull(leitor, cabecalho[:]); err != nil {
+		return registroLog{}, 0, err
+	}
+	tamanho := binary.LittleEndian.Uint32(cabecalho[0:4])
+	crc := binary.LittleEndian.Uint32(cabecalho[4:8])
+	if tamanho == 0 || tamanho > registroMaximo {
+		return registroLog{}, 0, finalOuCorrompido(leitor)
+	}
+
+	conteudo := make([]byte, tamanho)
+	if _, err := io.ReadFull(leitor, conteudo); err != nil {
+		if errors.Is(err, io.EOF) {
+			return registroLog{}, 0, io.ErrUnexpectedEOF
+		}
+		return registroLog{}, 0, err
+	}
+	if crc32.ChecksumIEEE(conteudo) != crc {
+		return registroLog{}, 0, finalOuCorrompido(leitor)
+	}
+
+	var registro registroLog
+	if err := json.Unmarshal(conteudo, &registro); err != nil {
+		return registroLog{}, 0, fmt.Errorf("%w: %v", ErrLogCorrompido, err)
+	}
+	return registro, int64(len(cabecalho)) + int64(tamanho), nil
+}
+
+// finalOuCorrompido classifica um registro inválido: se depois dele só há
+// zeros, que alguns sistemas de arquivos deixam ao estender o arquivo antes
+// de gravar os dados, é um registro incompleto; seguido de outros dados, é
+// corrupção.
+func finalOuCorrompido(leitor *bufio.Reader) error {
+	resto, err := io.ReadAll(leitor)
+	if err != nil {
+		return err
+	}
+	for _, b := range resto {
+		if b != 0 {
+			return ErrLogCorrompido
+		}
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// anexar grava o registro e o sincroniza com o disco. Se a gravação falhar
+// no meio, o arquivo volta ao tamanho anterior para que o log não fique com
+// um registro incompleto seguido de outros.
+func (w *logEscrita) anexar(a alteracao) error {
+	if w.falha != nil {
+		return fmt.Errorf("gravar log: %w", w.falha)
+	}
+
+	conteudo, err := json.Marshal(registroLog{Seq: w.seq + 1, alteracao: a})
+	if err != nil {
+		return fmt.Errorf("gravar log: %w", err)
+	}
+	registro := make([]byte, 8, 8+len(conteudo))
+	binary.LittleEndian.PutUint32(registro[0:4], uint32(len(conteudo)))
+	binary.LittleEndian.PutUint32(registro[4:8], crc32.ChecksumIEEE(conteudo))
+	registro = append(registro, conteudo...)
+
+	if _, err := w.arquivo.Write(registro); err != nil {
+		return w.desfazer(fmt.Errorf("gravar log: %w", err))
+	}
+	if err := w.arquivo.Sync(); err != nil {
+		return w.desfazer(fmt.Errorf("sincronizar log: %w", err))
+	}
+
+	w.tamanho += int64(len(registro))
+	w.seq++
+	w.registros++
+	return nil
+}
+
+// desfazer corta o que uma gravação com falha deixou no arquivo. Se nem isso
+// for possível, o log passa a recusar gravações.
+func (w *logEscrita) desfazer(err error) error {
+	if errTruncar := w.arquivo.Truncate(w.tamanho); errTruncar != nil {
+		w.falha = errTruncar
+	}
+	return err
+}
+
+// esvaziar descarta os registros já contidos no snapshot.
+func (w *logEscrita) esvaziar() error {
+	if err := w.arquivo.Truncate(0); err != nil {
+		return err
+	}
+	if err := w.arquivo.Sync(); err != nil {
+		return err
+	}
+	w.tamanho = 0
+	w.registros = 0
+	return nil
+}
+
+// gravarArquivo grava v como JSON em caminho de forma atômica: escreve um
+// arquivo temporário, sincroniza e o renomeia por cima do definitivo.
+func gravarArquivo(caminho string, v any) error {
+	temporario := caminho + ".tmp"
+	arquivo, err := os.Create(temporario)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(arquivo).Encode(v)
+	if err == nil {
+		err = arquivo.Sync()
+	}
+	if errFechar := arquivo.Close(); err == nil {
+		err = errFechar
+	}
+	if err != nil {
+		os.Remove(temporario)
+		return err
+	}
+	if err := os.Rename(temporario, caminho); err != nil {
+		return err
+	}
+
+	// Sincronizar o diretório torna a renomeação durável
+	diretorio, err := os.Open(filepath.Dir(caminho))
+	if err != nil {
+		return err
+	}
+	defer diretorio.Close()
+	return diretorio.Sync()
+}
@@ -0,0 +1,420 @@
+package repo_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/internal/repo/repotest"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func abrirPersistido(t *testing.T, diretorio string, compactarACada int) *repo.RepositorioEmMemoria {
+	t.Helper()
+
+	r, err := repo.AbrirRepositorioEmMemoria(repo.OpcoesPersistencia{Diretorio: diretorio, CompactarACada: compactarACada}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { r.Fechar() })
+	return r
+}
+
+func TestRepositorioEmMemoriaPersistido(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repo.RepositorioProdutos {
+		return abrirPersistido(t, t.TempDir(), 100)
+	})
+}
+
+func TestTenantsEmMemoriaPersistidos(t *testing.T) {
+	repotest.RunTenants(t, func(t *testing.T) repo.RepositorioProdutos {
+		return abrirPersistido(t, t.TempDir(), 100)
+	})
+}
+
+func TestUnidadeDeTrabalhoEmMemoriaPersistida(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	repotest.RunUnidadeDeTrabalho(t, func(t *testing.T) (repo.UnidadeDeTrabalho, repo.RepositorioProdutos) {
+		produtos := abrirPersistido(t, t.TempDir(), 100)
+		return repo.NovaUnidadeDeTrabalhoEmMemoria(produtos, logger), produtos
+	})
+}
+
+func TestCategoriasEmMemoriaPersistidas(t *testing.T) {
+	repotest.RunCategorias(t, func(t *testing.T, opcoes repo.OpcoesRepositorio) (repo.RepositorioProdutos, repo.RepositorioCategorias) {
+		r, err := repo.AbrirRepositorioEmMemoria(repo.OpcoesPersistencia{Diretorio: t.TempDir(), OpcoesRepositorio: opcoes}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		t.Cleanup(func() { r.Fechar() })
+		return r, r
+	})
+}
+
+func TestEstoqueEmMemoriaPersistido(t *testing.T) {
+	repotest.RunEstoque(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioEstoque) {
+		r := abrirPersistido(t, t.TempDir(), 100)
+		return r, r
+	})
+}
+
+func TestPedidosEmMemoriaPersistidos(t *testing.T) {
+	repotest.RunPedidos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPedidos) {
+		r := abrirPersistido(t, t.TempDir(), 100)
+		return r, r
+	})
+}
+
+func TestVariantesEmMemoriaPersistidas(t *testing.T) {
+	repotest.RunVariantes(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioVariantes) {
+		r := abrirPersistido(t, t.TempDir(), 100)
+		return r, r
+	})
+}
+
+func TestPrecosEmMemoriaPersistidos(t *testing.T) {
+	repotest.RunPrecos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPrecos) {
+		r := abrirPersistido(t, t.TempDir(), 100)
+		return r, r
+	})
+}
+
+func TestImagensEmMemoriaPersistidas(t *testing.T) {
+	repotest.RunImagens(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioImagens) {
+		r := abrirPersistido(t, t.TempDir(), 100)
+		return r, r
+	})
+}
+
+// estado resume o que deve sobreviver a uma reabertura: os produtos ativos
+// com suas categorias, estoques, grades, preços e imagens, as categorias, os
+// pedidos e o histórico de cada produto criado.
+type estado struct {
+	produtos   []models.Produto
+	historico  map[uuid.UUID][]uuid.UUID
+	categorias []models.Categoria
+	vinculos   map[uuid.UUID][]uuid.UUID
+	estoques   map[uuid.UUID]models.Estoque
+	pedidos    []models.Pedido
+	grades     map[uuid.UUID]models.Grade
+	precos     map[uuid.UUID][]models.PrecoProduto
+	imagens    map[uuid.UUID][]models.Imagem
+}
+
+func lerEstado(t *testing.T, r *repo.RepositorioEmMemoria, ids []uuid.UUID) estado {
+	t.Helper()
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	pagina, err := r.Listar(ctx, repo.FiltroListagem{Limite: repo.LimiteMaximo})
+	assert.NoError(t, err)
+
+	e := estado{produtos: pagina.Produtos, historico: make(map[uuid.UUID][]uuid.UUID), vinculos: make(map[uuid.UUID][]uuid.UUID), estoques: make(map[uuid.UUID]models.Estoque), grades: make(map[uuid.UUID]models.Grade), precos: make(map[uuid.UUID][]models.PrecoProduto)}
+	for _, id := range ids {
+		historico, err := r.Historico(ctx, id)
+		assert.NoError(t, err)
+		for _, h := range historico {
+			e.historico[id] = append(e.historico[id], h.ID)
+		}
+	}
+	e.categorias, err = r.ListarCategorias(ctx)
+	assert.NoError(t, err)
+	e.pedidos, err = r.ListarPedidos(ctx, "", repo.LimiteMaximo)
+	assert.NoError(t, err)
+	for _, p := range pagina.Produtos {
+		e.vinculos[p.ID], err = r.CategoriasDoProduto(ctx, p.ID)
+		assert.NoError(t, err)
+		e.estoques[p.ID], err = r.ConsultarEstoque(ctx, p.ID)
+		assert.NoError(t, err)
+		e.grades[p.ID], err = r.Grade(ctx, p.ID)
+		assert.NoError(t, err)
+		precos, err := r.Precos(ctx, p.ID)
+		assert.NoError(t, err)
+		e.precos[p.ID] = precosEmUTC(precos)
+	}
+	e.imagens, err = r.Imagens(ctx, ids)
+	assert.NoError(t, err)
+	return e
+}
+
+// precosEmUTC normaliza os instantes, que voltam do JSON em UTC e sem a
+// leitura monotônica.
+func precosEmUTC(precos []models.PrecoProduto) []models.PrecoProduto {
+	for i, p := range precos {
+		precos[i].VigenteDe = p.VigenteDe.UTC()
+		if p.VigenteAte != nil {
+			ate := p.VigenteAte.UTC()
+			precos[i].VigenteAte = &ate
+		}
+	}
+	return precos
+}
+
+func TestRepositorioEmMemoriaRecuperacao(t *testing.T) {
+	for _, compactarACada := range []int{1000, 2} {
+		diretorio := t.TempDir()
+		ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+		r := abrirPersistido(t, diretorio, compactarACada)
+		var ids []uuid.UUID
+		for _, nome := range []string{"Laptop", "Mouse", "Teclado", "Monitor"} {
+			p, err := r.Criar(ctx, nome, models.Centavos(1000))
+			assert.NoError(t, err)
+			ids = append(ids, p.ID)
+		}
+
+		informatica, err := r.CriarCategoria(ctx, "Informática", nil)
+		assert.NoError(t, err)
+		notebooks, err := r.CriarCategoria(ctx, "Notebooks", &informatica.ID)
+		assert.NoError(t, err)
+		assert.NoError(t, r.AtribuirCategorias(ctx, ids[0], []uuid.UUID{informatica.ID, notebooks.ID}))
+		assert.NoError(t, r.AtribuirCategorias(ctx, ids[1], []uuid.UUID{informatica.ID}))
+		assert.NoError(t, r.AtribuirCategorias(ctx, ids[3], []uuid.UUID{informatica.ID}))
+		assert.NoError(t, r.AtribuirCategorias(ctx, ids[3], nil))
+
+		_, err = r.DefinirEixos(ctx, ids[3], []models.EixoVariante{{Nome: "Tamanho", Valores: []string{"27", "32"}}})
+		assert.NoError(t, err)
+		variante, err := r.CriarVariante(ctx, ids[3], repo.NovaVariante{SKU: "MON-27", Opcoes: map[string]string{"Tamanho": "27"}, Preco: models.Centavos(99900)})
+		assert.NoError(t, err)
+		ids = append(ids, variante.ProdutoID)
+
+		for _, id := range ids[:2] {
+			_, err = r.DefinirEstoque(ctx, id, 10)
+			assert.NoError(t, err)
+			_, err = r.Reservar(ctx, id, 2, time.Hour)
+			assert.NoError(t, err)
+		}
+		confirmada, err := r.Reservar(ctx, ids[0], 3, time.Hour)
+		assert.NoError(t, err)
+		_, err = r.ConfirmarReserva(ctx, confirmada.ID)
+		assert.NoError(t, err)
+
+		for _, id := range ids[:2] {
+			pedido, err := r.CriarPedido(ctx, []repo.ItemSolicitado{{ProdutoID: id, Quantidade: 2}})
+			assert.NoError(t, err)
+			_, err = r.PagarPedido(ctx, pedido.ID)
+			assert.NoError(t, err)
+		}
+		cancelado, err := r.CriarPedido(ctx, []repo.ItemSolicitado{{ProdutoID: ids[2], Quantidade: 1}})
+		assert.NoError(t, err)
+		_, err = r.CancelarPedido(ctx, cancelado.ID)
+		assert.NoError(t, err)
+
+		_, err = r.Atualizar(ctx, ids[0], "Laptop Pro", models.Centavos(129999), 1)
+		assert.NoError(t, err)
+		_, err = r.AgendarPreco(ctx, ids[0], models.Centavos(119999), time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		for _, id := range []uuid.UUID{ids[0], ids[0], ids[1]} {
+			_, err = r.AdicionarImagem(ctx, models.Imagem{ID: uuid.New(), ProdutoID: id, TipoConteudo: "image/png", Tamanho: 2048, Largura: 640, Altura: 480})
+			assert.NoError(t, err)
+		}
+		imagens, err := r.Imagens(ctx, ids[:1])
+		assert.NoError(t, err)
+		_, err = r.RemoverImagem(ctx, ids[0], imagens[ids[0]][0].ID)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Deletar(ctx, ids[1], 1))
+		assert.NoError(t, r.Deletar(ctx, ids[2], 1))
+		_, err = r.Restaurar(ctx, ids[2])
+		assert.NoError(t, err)
+		purgados, err := r.Purgar(ctx, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), purgados)
+
+		resultados, err := r.AplicarLote(ctx, []repo.OperacaoLote{
+			{Tipo: repo.OperacaoCriar, Nome: "Webcam", Preco: models.Centavos(4990)},
+			{Tipo: repo.OperacaoAtualizar, ID: ids[3], Nome: "Monitor 4K", Preco: models.Centavos(159900), Versao: 1},
+		})
+		assert.NoError(t, err)
+		ids = append(ids, resultados[0].Produto.ID)
+
+		err = repo.NovaUnidadeDeTrabalhoEmMemoria(r, slog.New(slog.NewJSONHandler(io.Discard, nil))).Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+			p, err := repos.Produtos.Criar(ctx, "Headset", models.Centavos(19990))
+			ids = append(ids, p.ID)
+			return err
+		})
+		assert.NoError(t, err)
+
+		esperado := lerEstado(t, r, ids)
+		assert.NoError(t, r.Fechar())
+
+		reaberto := abrirPersistido(t, diretorio, compactarACada)
+		assert.Equal(t, esperado, lerEstado(t, reaberto, ids), "compactar a cada %d", compactarACada)
+	}
+}
+
+func TestRepositorioEmMemoriaLoteRejeitadoNaoPersiste(t *testing.T) {
+	diretorio := t.TempDir()
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	r := abrirPersistido(t, diretorio, 1000)
+	_, err := r.AplicarLote(ctx, []repo.OperacaoLote{
+		{Tipo: repo.OperacaoCriar, Nome: "Webcam", Preco: models.Centavos(4990)},
+		{Tipo: repo.OperacaoDeletar, ID: uuid.New()},
+	})
+	assert.ErrorIs(t, err, repo.ErrLoteRejeitado)
+	assert.NoError(t, r.Fechar())
+
+	pagina, err := abrirPersistido(t, diretorio, 1000).Listar(ctx, repo.FiltroListagem{})
+	assert.NoError(t, err)
+	assert.Empty(t, pagina.Produtos)
+}
+
+func TestRepositorioEmMemoriaRegistroIncompleto(t *testing.T) {
+	casos := map[string]func(t *testing.T, arquivo string){
+		"cortado": func(t *testing.T, arquivo string) {
+			info, err := os.Stat(arquivo)
+			assert.NoError(t, err)
+			assert.NoError(t, os.Truncate(arquivo, info.Size()-5))
+		},
+		"cabeçalho cortado": func(t *testing.T, arquivo string) {
+			info, err := os.Stat(arquivo)
+			assert.NoError(t, err)
+			assert.NoError(t, os.Truncate(arquivo, info.Size()+3))
+		},
+		"zeros no fim": func(t *testing.T, arquivo string) {
+			info, err := os.Stat(arquivo)
+			assert.NoError(t, err)
+			assert.NoError(t, os.Truncate(arquivo, info.Size()+512))
+		},
+	}
+
+	for nome, danificar := range casos {
+		t.Run(nome, func(t *testing.T) {
+			diretorio := t.TempDir()
+			ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+			r := abrirPersistido(t, diretorio, 1000)
+			primeiro, err := r.Criar(ctx, "Laptop", models.Centavos(99999))
+			assert.NoError(t, err)
+			_, err = r.Criar(ctx, "Mouse", models.Centavos(4990))
+			assert.NoError(t, err)
+			assert.NoError(t, r.Fechar())
+
+			// "cortado" perde o segundo registro; os outros só ganham lixo no fim
+			danificar(t, filepath.Join(diretorio, "produtos.wal"))
+			esperados := 2
+			if nome == "cortado" {
+				esperados = 1
+			}
+
+			r = abrirPersistido(t, diretorio, 1000)
+			pagina, err := r.Listar(ctx, repo.FiltroListagem{})
+			assert.NoError(t, err)
+			assert.Len(t, pagina.Produtos, esperados)
+			_, err = r.Buscar(ctx, primeiro.ID)
+			assert.NoError(t, err)
+
+			// O log continua utilizável depois de descartar o registro
+			_, err = r.Criar(ctx, "Teclado", models.Centavos(14990))
+			assert.NoError(t, err)
+			assert.NoError(t, r.Fechar())
+
+			pagina, err = abrirPersistido(t, diretorio, 1000).Listar(ctx, repo.FiltroListagem{})
+			assert.NoError(t, err)
+			assert.Len(t, pagina.Produtos, esperados+1)
+		})
+	}
+}
+
+func TestRepositorioEmMemoriaLogCorrompido(t *testing.T) {
+	diretorio := t.TempDir()
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	r := abrirPersistido(t, diretorio, 1000)
+	for _, nome := range []string{"Laptop", "Mouse"} {
+		_, err := r.Criar(ctx, nome, models.Centavos(1000))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, r.Fechar())
+
+	// Um byte trocado no primeiro registro não é uma escrita interrompida
+	arquivo := filepath.Join(diretorio, "produtos.wal")
+	dados, err := os.ReadFile(arquivo)
+	assert.NoError(t, err)
+	dados[20] ^= 0xff
+	assert.NoError(t, os.WriteFile(arquivo, dados, 0o644))
+
+	_, err = repo.AbrirRepositorioEmMemoria(repo.OpcoesPersistencia{Diretorio: diretorio}, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	assert.ErrorIs(t, err, repo.ErrLogCorrompido)
+}
+
+func TestRepositorioEmMemoriaQuedaDuranteCompactacao(t *testing.T) {
+	diretorio := t.TempDir()
+	arquivo := filepath.Join(diretorio, "produtos.wal")
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	r := abrirPersistido(t, diretorio, 1000)
+	produto, err := r.Criar(ctx, "Laptop", models.Centavos(99999))
+	assert.NoError(t, err)
+	_, err = r.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), repo.QualquerVersao)
+	assert.NoError(t, err)
+	log, err := os.ReadFile(arquivo)
+	assert.NoError(t, err)
+
+	// Simula a queda depois de gravar o snapshot e antes de esvaziar o log
+	assert.NoError(t, r.Compactar())
+	assert.NoError(t, r.Fechar())
+	assert.NoError(t, os.WriteFile(arquivo, log, 0o644))
+
+	historico, err := abrirPersistido(t, diretorio, 1000).Historico(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Len(t, historico, 2, "registros já contidos no snapshot não devem ser reaplicados")
+}
+
+func TestRepositorioEmMemoriaMigraPrecos(t *testing.T) {
+	diretorio := t.TempDir()
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	// Um snapshot gravado antes da linha do tempo de preços: o Laptop mudou de
+	// preço uma vez e o Mouse, só de nome
+	laptop, mouse := uuid.New(), uuid.New()
+	criacao, reajuste := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	h1, h2, h3 := uuid.New(), uuid.New(), uuid.New()
+	snapshot := fmt.Sprintf(`{"seq": 0,
+		"produtos": [
+			{"id": %[1]q, "nome": "Laptop", "preco": "1200.00", "versao": 2},
+			{"id": %[2]q, "nome": "Mouse sem fio", "preco": "49.90", "versao": 2}
+		],
+		"historico": [
+			{"id": %[3]q, "produto_id": %[1]q, "operacao": "criar", "depois": {"id": %[1]q, "nome": "Laptop", "preco": "1000.00", "versao": 1}, "autor": "sistema", "registrado_em": %[6]q},
+			{"id": %[4]q, "produto_id": %[1]q, "operacao": "atualizar", "antes": {"id": %[1]q, "nome": "Laptop", "preco": "1000.00", "versao": 1}, "depois": {"id": %[1]q, "nome": "Laptop", "preco": "1200.00", "versao": 2}, "autor": "sistema", "registrado_em": %[7]q},
+			{"id": %[5]q, "produto_id": %[2]q, "operacao": "atualizar", "antes": {"id": %[2]q, "nome": "Mouse", "preco": "49.90", "versao": 1}, "depois": {"id": %[2]q, "nome": "Mouse sem fio", "preco": "49.90", "versao": 2}, "autor": "sistema", "registrado_em": %[7]q}
+		]}`, laptop, mouse, h1, h2, h3, criacao.Format(time.RFC3339), reajuste.Format(time.RFC3339))
+	assert.NoError(t, os.WriteFile(filepath.Join(diretorio, "produtos.snapshot"), []byte(snapshot), 0o644))
+
+	r := abrirPersistido(t, diretorio, 1000)
+	precos, err := r.Precos(ctx, laptop)
+	assert.NoError(t, err)
+	if assert.Len(t, precos, 2) {
+		assert.Equal(t, h1, precos[0].ID)
+		assert.Equal(t, models.Centavos(100000), precos[0].Preco)
+		assert.True(t, criacao.Equal(precos[0].VigenteDe))
+		if assert.NotNil(t, precos[0].VigenteAte) {
+			assert.True(t, reajuste.Equal(*precos[0].VigenteAte))
+		}
+		assert.Equal(t, h2, precos[1].ID)
+		assert.Equal(t, models.Centavos(120000), precos[1].Preco)
+		assert.Nil(t, precos[1].VigenteAte)
+		assert.Equal(t, repo.TenantPadrao, precos[1].TenantID)
+	}
+	semMudanca, err := r.Precos(ctx, mouse)
+	assert.NoError(t, err)
+	if assert.Len(t, semMudanca, 1) {
+		assert.Equal(t, mouse, semMudanca[0].ID)
+		assert.Equal(t, models.Centavos(4990), semMudanca[0].Preco)
+	}
+	assert.NoError(t, r.Fechar())
+
+	// A linha do tempo migrada vai para o log e não é refeita ao reabrir
+	reaberto, err := abrirPersistido(t, diretorio, 1000).Precos(ctx, mouse)
+	assert.NoError(t, err)
+	assert.Equal(t, precosEmUTC(semMudanca), precosEmUTC(reaberto))
+}
@@ -0,0 +1,1816 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	colunasProduto = "id, tenant_id, nome, preco, versao, deleted_at"
+	colunasReserva = "id, produto_id, tenant_id, quantidade, status, criada_em, expira_em"
+	// colunasPedido traz cada pedido repetido em todas as linhas dos itens,
+	// de modo que uma única consulta devolve pedidos completos
+	colunasPedido = "p.id, p.tenant_id, p.status, p.total, p.criado_em, p.atualizado_em, i.posicao, i.produto_id, i.nome, i.preco_unitario, i.quantidade, i.subtotal"
+	// colunasVariante traz a variante com o produto filho, na ordem de
+	// colunasProduto
+	colunasVariante = "v.produto_id, v.pai_id, v.tenant_id, v.sku, v.opcoes, p.id, p.tenant_id, p.nome, p.preco, p.versao, p.deleted_at"
+	colunasPreco    = "id, produto_id, tenant_id, preco, vigente_de, vigente_ate, agendado"
+	colunasImagem   = "id, produto_id, tenant_id, tipo_conteudo, tamanho, largura, altura, criada_em"
+)
+
+// PgxRepositorio implementa o repositório com database/sql sobre o driver
+// pgx ("github.com/jackc/pgx/v5/stdlib"), sem GORM. As consultas fixas são
+// preparadas uma única vez em NovoPgxRepositorio; Listar e Pesquisar montam o
+// SQL conforme o filtro e contam com o cache de instruções do pgx.
+type PgxRepositorio struct {
+	db         *sql.DB
+	tx         *sql.Tx // não nulo quando o repositório pertence a uma transação
+	stmts      *instrucoesPgx
+	logger     *zap.Logger
+	escopoNome EscopoNome
+}
+
+// instrucoesPgx reúne as instruções preparadas do repositório.
+type instrucoesPgx struct {
+	inserir          *sql.Stmt
+	idEmUso          *sql.Stmt
+	buscar           *sql.Stmt
+	travar           *sql.Stmt
+	travarRemovido   *sql.Stmt
+	nomeEmUso        *sql.Stmt
+	nomeNaCategoria  *sql.Stmt
+	travarCategorias *sql.Stmt
+	atualizar        *sql.Stmt
+	remover          *sql.Stmt
+	restaurar        *sql.Stmt
+	purgar           *sql.Stmt
+	inserirHistorico *sql.Stmt
+	historico        *sql.Stmt
+	inserirEvento    *sql.Stmt
+	inserirCategoria *sql.Stmt
+	existeCategoria  *sql.Stmt
+	categorias       *sql.Stmt
+	removerVinculos  *sql.Stmt
+	inserirVinculo   *sql.Stmt
+	vinculos         *sql.Stmt
+	inserirEstoque   *sql.Stmt
+	estoque          *sql.Stmt
+	travarEstoque    *sql.Stmt
+	atualizarEstoque *sql.Stmt
+	vencerReservas   *sql.Stmt
+	reservasVencidas *sql.Stmt
+	inserirReserva   *sql.Stmt
+	reserva          *sql.Stmt
+	travarReserva    *sql.Stmt
+	atualizarReserva *sql.Stmt
+	inserirPedido    *sql.Stmt
+	inserirItem      *sql.Stmt
+	pedido           *sql.Stmt
+	pedidos          *sql.Stmt
+	travarPedido     *sql.Stmt
+	atualizarPedido  *sql.Stmt
+	grade            *sql.Stmt
+	salvarGrade      *sql.Stmt
+	papelVariante    *sql.Stmt
+	existeVariante   *sql.Stmt
+	inserirVariante  *sql.Stmt
+	variantes        *sql.Stmt
+	varianteSKU      *sql.Stmt
+	precos           *sql.Stmt
+	precosAgendados  *sql.Stmt
+	agendamento      *sql.Stmt
+	pendente         *sql.Stmt
+	salvarPreco      *sql.Stmt
+	fecharPreco      *sql.Stmt
+	inserirImagem    *sql.Stmt
+	imagens          *sql.Stmt
+	removerImagem    *sql.Stmt
+	expurgarImagens  *sql.Stmt
+	expurgarProduto  *sql.Stmt
+}
+
+// NovoPgxRepositorio prepara as instruções do repositório em db, que deve ter
+// sido aberto com sql.Open("pgx", dsn).
+func NovoPgxRepositorio(ctx context.Context, db *sql.DB, opcoes OpcoesRepositorio, logger *zap.Logger) (*PgxRepositorio, error) {
+	s := &instrucoesPgx{}
+	for _, p := range []struct {
+		stmt **sql.Stmt
+		sql  string
+	}{
+		{&s.inserir, "INSERT INTO produtos (id, tenant_id, nome, nome_normalizado, escopo_nome, preco, versao) VALUES ($1, $2, $3, $4, $5, $6, 1)"},
+		{&s.idEmUso, "SELECT EXISTS (SELECT 1 FROM produtos WHERE id = $1)"},
+		{&s.buscar, "SELECT " + colunasProduto + " FROM produtos WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL"},
+		{&s.travar, "SELECT " + colunasProduto + " FROM produtos WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL FOR UPDATE"},
+		{&s.travarRemovido, "SELECT " + colunasProduto + " FROM produtos WHERE id = $1 AND tenant_id = $2 FOR UPDATE"},
+		{&s.nomeEmUso, "SELECT id FROM produtos WHERE tenant_id = $1 AND nome_normalizado = $2 AND id <> $3 AND deleted_at IS NULL LIMIT 1"},
+		{&s.nomeNaCategoria, "SELECT id FROM produtos WHERE tenant_id = $1 AND nome_normalizado = $2 AND id <> $3 AND deleted_at IS NULL AND id IN (SELECT produto_id FROM produto_categorias WHERE categoria_id = ANY($4::text[]::uuid[])) LIMIT 1"},
+		{&s.travarCategorias, "SELECT id FROM categorias WHERE id = ANY($1::text[]::uuid[]) ORDER BY id FOR UPDATE"},
+		// As colunas da unicidade do nome só mudam quando o nome muda
+		{&s.atualizar, "UPDATE produtos SET nome = $2, nome_normalizado = CASE WHEN nome = $2 THEN nome_normalizado ELSE $3 END, escopo_nome = CASE WHEN nome = $2 THEN escopo_nome ELSE $4 END, preco = $5, versao = $6 WHERE id = $1"},
+		{&s.remover, "UPDATE produtos SET deleted_at = $2 WHERE id = $1"},
+		{&s.restaurar, "UPDATE produtos SET deleted_at = NULL, nome_normalizado = $2, escopo_nome = $3 WHERE id = $1"},
+		{&s.purgar, "DELETE FROM produtos WHERE deleted_at < $1"},
+		{&s.inserirHistorico, "INSERT INTO produtos_historico (id, produto_id, tenant_id, operacao, antes, depois, autor, registrado_em) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"},
+		{&s.historico, "SELECT id, produto_id, tenant_id, operacao, antes, depois, autor, registrado_em FROM produtos_historico WHERE produto_id = $1 AND tenant_id = $2 ORDER BY registrado_em, id"},
+		{&s.inserirEvento, "INSERT INTO outbox (id, tipo, produto_id, produto, ocorrido_em) VALUES ($1, $2, $3, $4, $5)"},
+		{&s.inserirCategoria, "INSERT INTO categorias (id, tenant_id, nome, pai_id) VALUES ($1, $2, $3, $4)"},
+		{&s.existeCategoria, "SELECT EXISTS (SELECT 1 FROM categorias WHERE id = $1 AND tenant_id = $2)"},
+		{&s.categorias, "SELECT id, tenant_id, nome, pai_id FROM categorias WHERE tenant_id = $1"},
+		{&s.removerVinculos, "DELETE FROM produto_categorias WHERE produto_id = $1"},
+		{&s.inserirVinculo, "INSERT INTO produto_categorias (produto_id, categoria_id) VALUES ($1, $2)"},
+		{&s.vinculos, "SELECT categoria_id FROM produto_categorias WHERE produto_id = $1 ORDER BY categoria_id"},
+		{&s.inserirEstoque, "INSERT INTO estoques (produto_id) VALUES ($1) ON CONFLICT DO NOTHING"},
+		{&s.estoque, "SELECT quantidade, reservado FROM estoques WHERE produto_id = $1"},
+		{&s.travarEstoque, "SELECT quantidade, reservado FROM estoques WHERE produto_id = $1 FOR UPDATE"},
+		{&s.atualizarEstoque, "UPDATE estoques SET quantidade = $2, reservado = $3 WHERE produto_id = $1"},
+		{&s.vencerReservas, "UPDATE reservas SET status = 'expirada' WHERE produto_id = $1 AND status = 'pendente' AND expira_em <= $2 RETURNING quantidade"},
+		{&s.reservasVencidas, "SELECT DISTINCT produto_id FROM reservas WHERE status = 'pendente' AND expira_em <= $1"},
+		{&s.inserirReserva, "INSERT INTO reservas (" + colunasReserva + ") VALUES ($1, $2, $3, $4, $5, $6, $7)"},
+		{&s.reserva, "SELECT " + colunasReserva + " FROM reservas WHERE id = $1 AND tenant_id = $2"},
+		{&s.travarReserva, "SELECT " + colunasReserva + " FROM reservas WHERE id = $1 FOR UPDATE"},
+		{&s.atualizarReserva, "UPDATE reservas SET status = $2 WHERE id = $1"},
+		{&s.inserirPedido, "INSERT INTO pedidos (id, tenant_id, status, total, criado_em, atualizado_em) VALUES ($1, $2, $3, $4, $5, $6)"},
+		{&s.inserirItem, "INSERT INTO pedido_itens (pedido_id, posicao, produto_id, nome, preco_unitario, quantidade, subtotal) VALUES ($1, $2, $3, $4, $5, $6, $7)"},
+		{&s.pedido, "SELECT " + colunasPedido + " FROM pedidos p JOIN pedido_itens i ON i.pedido_id = p.id WHERE p.id = $1 AND p.tenant_id = $2 ORDER BY i.posicao"},
+		{&s.pedidos, "SELECT " + colunasPedido + " FROM (SELECT * FROM pedidos WHERE tenant_id = $1 AND ($2 = '' OR status = $2) ORDER BY criado_em DESC, id DESC LIMIT $3) p JOIN pedido_itens i ON i.pedido_id = p.id ORDER BY p.criado_em DESC, p.id DESC, i.posicao"},
+		{&s.travarPedido, "SELECT status FROM pedidos WHERE id = $1 AND tenant_id = $2 FOR UPDATE"},
+		{&s.atualizarPedido, "UPDATE pedidos SET status = $2, atualizado_em = $3 WHERE id = $1"},
+		{&s.grade, "SELECT eixos FROM grades WHERE produto_id = $1"},
+		{&s.salvarGrade, "INSERT INTO grades (produto_id, eixos) VALUES ($1, $2) ON CONFLICT (produto_id) DO UPDATE SET eixos = EXCLUDED.eixos"},
+		{&s.papelVariante, "SELECT EXISTS (SELECT 1 FROM variantes WHERE produto_id = $1), EXISTS (SELECT 1 FROM variantes WHERE pai_id = $1)"},
+		{&s.existeVariante, "SELECT EXISTS (SELECT 1 FROM variantes WHERE tenant_id = $1 AND sku = $2), EXISTS (SELECT 1 FROM variantes WHERE pai_id = $3 AND opcoes = $4)"},
+		{&s.inserirVariante, "INSERT INTO variantes (produto_id, pai_id, tenant_id, sku, opcoes) VALUES ($1, $2, $3, $4, $5)"},
+		{&s.variantes, "SELECT " + colunasVariante + " FROM variantes v JOIN produtos p ON p.id = v.produto_id WHERE v.pai_id = $1 AND p.tenant_id = $2 AND p.deleted_at IS NULL"},
+		{&s.varianteSKU, "SELECT " + colunasVariante + " FROM variantes v JOIN produtos p ON p.id = v.produto_id WHERE v.tenant_id = $1 AND v.sku = $2 AND p.deleted_at IS NULL"},
+		{&s.precos, "SELECT " + colunasPreco + " FROM produtos_precos WHERE produto_id = $1 AND tenant_id = $2 ORDER BY vigente_de, id"},
+		{&s.precosAgendados, "SELECT " + colunasPreco + " FROM produtos_precos WHERE agendado AND vigente_de <= $1 ORDER BY vigente_de, id"},
+		{&s.agendamento, "SELECT id FROM produtos_precos WHERE produto_id = $1 AND agendado AND vigente_de = $2"},
+		{&s.pendente, "SELECT EXISTS (SELECT 1 FROM produtos_precos WHERE id = $1 AND agendado)"},
+		{&s.salvarPreco, "INSERT INTO produtos_precos (" + colunasPreco + ") VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO UPDATE SET preco = EXCLUDED.preco, vigente_de = EXCLUDED.vigente_de, vigente_ate = EXCLUDED.vigente_ate, agendado = EXCLUDED.agendado"},
+		{&s.fecharPreco, "UPDATE produtos_precos SET vigente_ate = $2 WHERE produto_id = $1 AND NOT agendado AND vigente_ate IS NULL"},
+		{&s.inserirImagem, "INSERT INTO produtos_imagens (" + colunasImagem + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"},
+		{&s.imagens, "SELECT " + colunasImagem + " FROM produtos_imagens WHERE produto_id IN (SELECT id FROM produtos WHERE id = ANY($1::text[]::uuid[]) AND tenant_id = $2 AND deleted_at IS NULL) ORDER BY criada_em, id"},
+		{&s.removerImagem, "DELETE FROM produtos_imagens WHERE id = $1 AND produto_id = $2 RETURNING " + colunasImagem},
+		{&s.expurgarImagens, "DELETE FROM produtos_imagens WHERE produto_id IN (SELECT id FROM produtos WHERE deleted_at < $1) RETURNING " + colunasImagem},
+		{&s.expurgarProduto, "DELETE FROM produtos_imagens WHERE produto_id = $1 RETURNING " + colunasImagem},
+	} {
+		stmt, err := db.PrepareContext(ctx, p.sql)
+		if err != nil {
+			s.fechar()
+			return nil, fmt.Errorf("preparar %q: %w", p.sql, err)
+		}
+		*p.stmt = stmt
+	}
+
+	return &PgxRepositorio{db: db, stmts: s, logger: logger, escopoNome: opcoes.escopoNome()}, nil
+}
+
+// Fechar libera as instruções preparadas. Não fecha o *sql.DB.
+func (r *PgxRepositorio) Fechar() error {
+	return r.stmts.fechar()
+}
+
+func (s *instrucoesPgx) fechar() error {
+	var erros []error
+	for _, stmt := range []*sql.Stmt{
+		s.inserir, s.idEmUso, s.buscar, s.travar, s.travarRemovido, s.nomeEmUso,
+		s.nomeNaCategoria, s.travarCategorias, s.atualizar,
+		s.remover, s.restaurar, s.purgar, s.inserirHistorico, s.historico,
+		s.inserirEvento, s.inserirCategoria, s.existeCategoria, s.categorias,
+		s.removerVinculos, s.inserirVinculo, s.vinculos, s.inserirEstoque,
+		s.estoque, s.travarEstoque, s.atualizarEstoque, s.vencerReservas,
+		s.reservasVencidas, s.inserirReserva, s.reserva, s.travarReserva,
+		s.atualizarReserva, s.inserirPedido, s.inserirItem, s.pedido,
+		s.pedidos, s.travarPedido, s.atualizarPedido, s.grade, s.salvarGrade,
+		s.papelVariante, s.existeVariante, s.inserirVariante, s.variantes,
+		s.varianteSKU, s.precos, s.precosAgendados, s.agendamento,
+		s.pendente, s.salvarPreco, s.fecharPreco, s.inserirImagem, s.imagens,
+		s.removerImagem, s.expurgarImagens, s.expurgarProduto,
+	} {
+		if stmt != nil {
+			erros = append(erros, stmt.Close())
+		}
+	}
+	return errors.Join(erros...)
+}
+
+// Criar adiciona um novo produto ao banco.
+func (r *PgxRepositorio) Criar(ctx context.Context, nome string, preco models.Dinheiro) (models.Produto, error) {
+	return r.criar(ctx, uuid.New(), nome, preco)
+}
+
+// CriarComID adiciona ao banco um novo produto com o ID informado.
+func (r *PgxRepositorio) CriarComID(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	return r.criar(ctx, id, nome, preco)
+}
+
+func (r *PgxRepositorio) criar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	if err := preco.Validar(); err != nil {
+		r.logger.Error("Falha ao criar produto", zap.Error(err), zap.String("nome", nome))
+		return models.Produto{}, err
+	}
+
+	produto := models.Produto{ID: id, TenantID: tenantDe(ctx), Nome: nome, Preco: preco, Versao: 1}
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		var usado bool
+		if err := tx.StmtContext(ctx, r.stmts.idEmUso).QueryRowContext(ctx, id).Scan(&usado); err != nil {
+			return err
+		}
+		if usado {
+			return ErrIDEmUso
+		}
+		if err := r.nomeLivre(ctx, tx, produto); err != nil {
+			return err
+		}
+		err := r.gravarNome(ctx, tx, produto, func() error {
+			_, err := tx.StmtContext(ctx, r.stmts.inserir).ExecContext(ctx, produto.ID, produto.TenantID, produto.Nome, normalizarNome(produto.Nome), r.escopoNome, produto.Preco)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return r.registrarHistorico(ctx, tx, OperacaoCriar, nil, &produto)
+	})
+	if errors.Is(err, ErrProdutoDuplicado) || errors.Is(err, ErrIDEmUso) {
+		r.logger.Error("Falha ao criar produto", zap.Error(err), zap.String("nome", nome))
+		return models.Produto{}, fmt.Errorf("criar produto: %w", err)
+	}
+	if err != nil {
+		r.logger.Error("Falha ao criar produto no banco", zap.Error(err))
+		return models.Produto{}, fmt.Errorf("criar produto: %w", err)
+	}
+
+	r.logger.Info("Produto criado", zap.String("id", produto.ID.String()), zap.String("nome", nome), zap.Stringer("preco", preco))
+	return produto, nil
+}
+
+// Buscar recupera um produto pelo ID.
+func (r *PgxRepositorio) Buscar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	produto, err := escanearProduto(r.stmt(ctx, r.stmts.buscar).QueryRowContext(ctx, id, tenantDe(ctx)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			r.logger.Error("Falha ao buscar produto", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", id.String()))
+			return models.Produto{}, fmt.Errorf("buscar produto id %s: %w", id, ErrProdutoNaoEncontrado)
+		}
+
+		r.logger.Error("Falha ao buscar produto no banco", zap.Error(err))
+		return models.Produto{}, fmt.Errorf("buscar produto: %w", err)
+	}
+
+	r.logger.Info("Produto encontrado", zap.String("id", id.String()))
+	return produto, nil
+}
+
+// Listar retorna uma página de produtos com a mesma consulta por chave
+// (keyset) de PostgresRepositorio.Listar.
+func (r *PgxRepositorio) Listar(ctx context.Context, filtro FiltroListagem) (Pagina, error) {
+	filtro, c, err := filtro.normalizar()
+	if err != nil {
+		r.logger.Error("Falha ao listar produtos", zap.Error(err))
+		return Pagina{}, fmt.Errorf("listar produtos: %w", err)
+	}
+
+	var condicoes []string
+	var args []any
+	param := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	condicoes = append(condicoes, "tenant_id = "+param(tenantDe(ctx)))
+	if !filtro.IncluirRemovidos {
+		condicoes = append(condicoes, "deleted_at IS NULL")
+	}
+	if filtro.Nome != "" {
+		condicoes = append(condicoes, "nome ILIKE "+param("%"+escaparLike(filtro.Nome)+"%"))
+	}
+	if filtro.PrecoMin != nil {
+		condicoes = append(condicoes, "preco >= "+param(*filtro.PrecoMin))
+	}
+	if filtro.PrecoMax != nil {
+		condicoes = append(condicoes, "preco <= "+param(*filtro.PrecoMax))
+	}
+
+	coluna, direcao, operador := `nome COLLATE "C"`, "ASC", ">"
+	if filtro.Ordenacao == OrdenarPorPreco || filtro.Ordenacao == OrdenarPorPrecoDesc {
+		coluna = "preco"
+	}
+	if filtro.Ordenacao.decrescente() {
+		direcao, operador = "DESC", "<"
+	}
+	if c != nil {
+		var valor any = c.Nome
+		if coluna == "preco" {
+			valor = models.Centavos(c.Centavos)
+		}
+		condicoes = append(condicoes, fmt.Sprintf("(%s, id) %s (%s, %s)", coluna, operador, param(valor), param(c.ID)))
+	}
+
+	consulta := "SELECT " + colunasProduto + " FROM produtos WHERE " + strings.Join(condicoes, " AND ")
+	consulta += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", coluna, direcao, direcao, param(filtro.Limite+1))
+
+	produtos, err := r.consultarProdutos(ctx, consulta, args...)
+	if err != nil {
+		r.logger.Error("Falha ao listar produtos", zap.Error(err))
+		return Pagina{}, fmt.Errorf("listar produtos: %w", err)
+	}
+
+	pagina := paginar(filtro, produtos)
+	r.logger.Info("Listando produtos", zap.Int("total", len(pagina.Produtos)))
+	return pagina, nil
+}
+
+// Pesquisar faz a mesma busca textual de PostgresRepositorio.Pesquisar.
+func (r *PgxRepositorio) Pesquisar(ctx context.Context, termo string, limite int) ([]models.Produto, error) {
+	if strings.TrimSpace(termo) == "" {
+		r.logger.Error("Falha ao pesquisar produtos", zap.Error(ErrBuscaVazia))
+		return nil, fmt.Errorf("pesquisar produtos: %w", ErrBuscaVazia)
+	}
+
+	produtos, err := r.consultarProdutos(ctx, `SELECT `+colunasProduto+` FROM produtos
+		WHERE tenant_id = $3 AND deleted_at IS NULL AND busca @@ websearch_to_tsquery('portugues_sem_acento', $1)
+		ORDER BY ts_rank(busca, websearch_to_tsquery('portugues_sem_acento', $1)) DESC, nome COLLATE "C", id
+		LIMIT $2`, termo, normalizarLimite(limite), tenantDe(ctx))
+	if err != nil {
+		r.logger.Error("Falha ao pesquisar produtos", zap.Error(err))
+		return nil, fmt.Errorf("pesquisar produtos: %w", err)
+	}
+
+	r.logger.Info("Produtos pesquisados", zap.String("termo", termo), zap.Int("total", len(produtos)))
+	return produtos, nil
+}
+
+// Atualizar modifica um produto existente, com a mesma verificação de versão
+// de PostgresRepositorio.Atualizar.
+func (r *PgxRepositorio) Atualizar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro, versao int) (models.Produto, error) {
+	if err := preco.Validar(); err != nil {
+		r.logger.Error("Falha ao atualizar produto", zap.Error(err), zap.String("id", id.String()))
+		return models.Produto{}, err
+	}
+
+	var produto models.Produto
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		antes, err := r.travarProduto(ctx, tx, r.stmts.travar, id, versao)
+		if err != nil {
+			return err
+		}
+
+		produto = antes
+		produto.Nome = nome
+		produto.Preco = preco
+		produto.Versao++
+		if nome != antes.Nome {
+			if err := r.nomeLivre(ctx, tx, produto); err != nil {
+				return err
+			}
+		}
+		err = r.gravarNome(ctx, tx, produto, func() error {
+			_, err := tx.StmtContext(ctx, r.stmts.atualizar).ExecContext(ctx, id, produto.Nome, normalizarNome(produto.Nome), r.escopoNome, produto.Preco, produto.Versao)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return r.registrarHistorico(ctx, tx, OperacaoAtualizar, &antes, &produto)
+	})
+	if err != nil {
+		return models.Produto{}, r.falhaEscrita("atualizar", id, versao, err)
+	}
+
+	r.logger.Info("Produto atualizado", zap.String("id", id.String()), zap.String("nome", nome), zap.Stringer("preco", preco), zap.Int("versao", produto.Versao))
+	return produto, nil
+}
+
+// Deletar remove logicamente um produto pelo ID, respeitando a versão como em
+// Atualizar.
+func (r *PgxRepositorio) Deletar(ctx context.Context, id uuid.UUID, versao int) error {
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		antes, err := r.travarProduto(ctx, tx, r.stmts.travar, id, versao)
+		if err != nil {
+			return err
+		}
+
+		depois := antes
+		depois.RemovidoEm = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		if _, err := tx.StmtContext(ctx, r.stmts.remover).ExecContext(ctx, id, depois.RemovidoEm.Time); err != nil {
+			return err
+		}
+		return r.registrarHistorico(ctx, tx, OperacaoDeletar, &antes, &depois)
+	})
+	if err != nil {
+		return r.falhaEscrita("deletar", id, versao, err)
+	}
+
+	r.logger.Info("Produto deletado", zap.String("id", id.String()))
+	return nil
+}
+
+// Restaurar desfaz a remoção lógica de um produto. Restaurar um produto
+// ativo não tem efeito.
+func (r *PgxRepositorio) Restaurar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	var produto models.Produto
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		var err error
+		produto, err = r.travarProduto(ctx, tx, r.stmts.travarRemovido, id, QualquerVersao)
+		if err != nil || !produto.RemovidoEm.Valid {
+			return err
+		}
+		if err := r.nomeLivre(ctx, tx, produto); err != nil {
+			return err
+		}
+
+		antes := produto
+		produto.RemovidoEm = gorm.DeletedAt{}
+		err = r.gravarNome(ctx, tx, produto, func() error {
+			_, err := tx.StmtContext(ctx, r.stmts.restaurar).ExecContext(ctx, id, normalizarNome(produto.Nome), r.escopoNome)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return r.registrarHistorico(ctx, tx, OperacaoRestaurar, &antes, &produto)
+	})
+	if err != nil {
+		return models.Produto{}, r.falhaEscrita("restaurar", id, QualquerVersao, err)
+	}
+
+	r.logger.Info("Produto restaurado", zap.String("id", id.String()))
+	return produto, nil
+}
+
+// Purgar exclui definitivamente os produtos removidos antes do instante
+// informado, de todos os tenants, e retorna quantos foram excluídos.
+func (r *PgxRepositorio) Purgar(ctx context.Context, removidosAntesDe time.Time) (int64, error) {
+	result, err := r.stmt(ctx, r.stmts.purgar).ExecContext(ctx, removidosAntesDe)
+	if err != nil {
+		r.logger.Error("Falha ao purgar produtos no banco", zap.Error(err))
+		return 0, fmt.Errorf("purgar produtos: %w", err)
+	}
+	total, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Falha ao purgar produtos no banco", zap.Error(err))
+		return 0, fmt.Errorf("purgar produtos: %w", err)
+	}
+
+	r.logger.Info("Produtos purgados", zap.Int64("total", total), zap.Time("removidos_antes_de", removidosAntesDe))
+	return total, nil
+}
+
+// AplicarLote executa as operações em uma única transação, com um savepoint
+// por operação, como PostgresRepositorio.AplicarLote.
+func (r *PgxRepositorio) AplicarLote(ctx context.Context, operacoes []OperacaoLote) ([]ResultadoLote, error) {
+	if len(operacoes) > LoteMaximo {
+		return nil, fmt.Errorf("aplicar lote com %d operações: %w", len(operacoes), ErrLoteMuitoGrande)
+	}
+
+	var resultados []ResultadoLote
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		txRepo := r.emTransacao(tx)
+
+		var falhas int
+		resultados, falhas = executarLote(operacoes, func(op OperacaoLote) (*models.Produto, error) {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT operacao"); err != nil {
+				return nil, err
+			}
+			produto, err := aplicarOperacao(ctx, txRepo, op)
+			if err != nil {
+				if _, errRb := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT operacao"); errRb != nil {
+					return nil, errors.Join(err, errRb)
+				}
+				return nil, err
+			}
+			return produto, nil
+		})
+		if falhas > 0 {
+			return fmt.Errorf("%d de %d operações falharam: %w", falhas, len(operacoes), ErrLoteRejeitado)
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("Falha ao aplicar lote", zap.Error(err), zap.Int("operacoes", len(operacoes)))
+		return resultados, fmt.Errorf("aplicar lote: %w", err)
+	}
+
+	r.logger.Info("Lote aplicado", zap.Int("operacoes", len(operacoes)))
+	return resultados, nil
+}
+
+// Historico retorna as alterações do produto em ordem cronológica. O
+// histórico sobrevive à remoção e ao expurgo do produto.
+func (r *PgxRepositorio) Historico(ctx context.Context, id uuid.UUID) ([]models.HistoricoProduto, error) {
+	historico, err := r.consultarHistorico(ctx, id)
+	if err != nil {
+		r.logger.Error("Falha ao consultar histórico no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar histórico: %w", err)
+	}
+	if len(historico) == 0 {
+		r.logger.Error("Falha ao consultar histórico", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", id.String()))
+		return nil, fmt.Errorf("consultar histórico id %s: %w", id, ErrProdutoNaoEncontrado)
+	}
+
+	r.logger.Info("Histórico consultado", zap.String("id", id.String()), zap.Int("total", len(historico)))
+	return historico, nil
+}
+
+func (r *PgxRepositorio) consultarHistorico(ctx context.Context, id uuid.UUID) ([]models.HistoricoProduto, error) {
+	linhas, err := r.stmt(ctx, r.stmts.historico).QueryContext(ctx, id, tenantDe(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var historico []models.HistoricoProduto
+	for linhas.Next() {
+		var h models.HistoricoProduto
+		var antes, depois []byte
+		if err := linhas.Scan(&h.ID, &h.ProdutoID, &h.TenantID, &h.Operacao, &antes, &depois, &h.Autor, &h.RegistradoEm); err != nil {
+			return nil, err
+		}
+		if h.Antes, err = produtoDeJSON(antes); err != nil {
+			return nil, err
+		}
+		if h.Depois, err = produtoDeJSON(depois); err != nil {
+			return nil, err
+		}
+		historico = append(historico, h)
+	}
+	return historico, linhas.Err()
+}
+
+// CriarCategoria cria uma categoria, conferindo antes que o pai existe.
+func (r *PgxRepositorio) CriarCategoria(ctx context.Context, nome string, paiID *uuid.UUID) (models.Categoria, error) {
+	categoria := models.Categoria{ID: uuid.New(), TenantID: tenantDe(ctx), Nome: nome, PaiID: paiID}
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		if paiID != nil {
+			if err := r.existeCategoria(ctx, tx, *paiID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.StmtContext(ctx, r.stmts.inserirCategoria).ExecContext(ctx, categoria.ID, categoria.TenantID, categoria.Nome, categoria.PaiID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrCategoriaNaoEncontrada) {
+			r.logger.Error("Falha ao criar categoria", zap.Error(err), zap.Stringer("pai_id", paiID))
+			return models.Categoria{}, fmt.Errorf("criar categoria pai %s: %w", paiID, err)
+		}
+
+		r.logger.Error("Falha ao criar categoria no banco", zap.Error(err))
+		return models.Categoria{}, fmt.Errorf("criar categoria: %w", err)
+	}
+
+	r.logger.Info("Categoria criada", zap.String("id", categoria.ID.String()), zap.String("nome", nome))
+	return categoria, nil
+}
+
+// ListarCategorias retorna todas as categorias ordenadas por nome.
+func (r *PgxRepositorio) ListarCategorias(ctx context.Context) ([]models.Categoria, error) {
+	categorias, err := r.consultarCategorias(ctx)
+	if err != nil {
+		r.logger.Error("Falha ao listar categorias no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar categorias: %w", err)
+	}
+	slices.SortFunc(categorias, compararCategorias)
+
+	r.logger.Info("Listando categorias", zap.Int("total", len(categorias)))
+	return categorias, nil
+}
+
+func (r *PgxRepositorio) consultarCategorias(ctx context.Context) ([]models.Categoria, error) {
+	linhas, err := r.stmt(ctx, r.stmts.categorias).QueryContext(ctx, tenantDe(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var categorias []models.Categoria
+	for linhas.Next() {
+		var c models.Categoria
+		if err := linhas.Scan(&c.ID, &c.TenantID, &c.Nome, &c.PaiID); err != nil {
+			return nil, err
+		}
+		categorias = append(categorias, c)
+	}
+	return categorias, linhas.Err()
+}
+
+// ProdutosDaCategoria percorre a árvore com a mesma CTE recursiva de
+// PostgresRepositorio.ProdutosDaCategoria.
+func (r *PgxRepositorio) ProdutosDaCategoria(ctx context.Context, id uuid.UUID, incluirDescendentes bool) ([]models.Produto, error) {
+	var existe bool
+	if err := r.stmt(ctx, r.stmts.existeCategoria).QueryRowContext(ctx, id, tenantDe(ctx)).Scan(&existe); err != nil {
+		r.logger.Error("Falha ao listar produtos da categoria no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar produtos da categoria: %w", err)
+	}
+	if !existe {
+		r.logger.Error("Falha ao listar produtos da categoria", zap.Error(ErrCategoriaNaoEncontrada), zap.String("id", id.String()))
+		return nil, fmt.Errorf("listar produtos da categoria id %s: %w", id, ErrCategoriaNaoEncontrada)
+	}
+
+	produtos, err := r.consultarProdutos(ctx, consultaProdutosDaCategoria(incluirDescendentes, `nome COLLATE "C"`, "$1", "$2"), id, tenantDe(ctx))
+	if err != nil {
+		r.logger.Error("Falha ao listar produtos da categoria no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar produtos da categoria: %w", err)
+	}
+
+	r.logger.Info("Listando produtos da categoria", zap.String("id", id.String()), zap.Int("total", len(produtos)))
+	return produtos, nil
+}
+
+// AtribuirCategorias substitui as categorias do produto, que fica travado
+// durante a troca.
+func (r *PgxRepositorio) AtribuirCategorias(ctx context.Context, produtoID uuid.UUID, categorias []uuid.UUID) error {
+	categorias = normalizarCategorias(categorias)
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		produto, err := r.travarProduto(ctx, tx, r.stmts.travar, produtoID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		for _, id := range categorias {
+			if err := r.existeCategoria(ctx, tx, id); err != nil {
+				return fmt.Errorf("categoria %s: %w", id, err)
+			}
+		}
+		if r.escopoNome == NomeUnicoNaCategoria {
+			if err := r.nomeLivreNasCategorias(ctx, tx, produto, categorias); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.StmtContext(ctx, r.stmts.removerVinculos).ExecContext(ctx, produtoID); err != nil {
+			return err
+		}
+		for _, id := range categorias {
+			if _, err := tx.StmtContext(ctx, r.stmts.inserirVinculo).ExecContext(ctx, produtoID, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrProdutoNaoEncontrado) || errors.Is(err, ErrCategoriaNaoEncontrada) || errors.Is(err, ErrProdutoDuplicado) {
+			r.logger.Error("Falha ao atribuir categorias", zap.Error(err), zap.String("id", produtoID.String()))
+			return fmt.Errorf("atribuir categorias ao produto id %s: %w", produtoID, err)
+		}
+
+		r.logger.Error("Falha ao atribuir categorias no banco", zap.Error(err))
+		return fmt.Errorf("atribuir categorias: %w", err)
+	}
+
+	r.logger.Info("Categorias atribuídas", zap.String("id", produtoID.String()), zap.Int("total", len(categorias)))
+	return nil
+}
+
+// CategoriasDoProduto retorna os IDs das categorias do produto em ordem.
+func (r *PgxRepositorio) CategoriasDoProduto(ctx context.Context, produtoID uuid.UUID) ([]uuid.UUID, error) {
+	if _, err := escanearProduto(r.stmt(ctx, r.stmts.buscar).QueryRowContext(ctx, produtoID, tenantDe(ctx))); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			r.logger.Error("Falha ao consultar categorias", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", produtoID.String()))
+			return nil, fmt.Errorf("consultar categorias do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+		}
+
+		r.logger.Error("Falha ao consultar categorias no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar categorias: %w", err)
+	}
+
+	categorias, err := consultarVinculos(ctx, r.stmt(ctx, r.stmts.vinculos), produtoID)
+	if err != nil {
+		r.logger.Error("Falha ao consultar categorias no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar categorias: %w", err)
+	}
+	return categorias, nil
+}
+
+func consultarVinculos(ctx context.Context, vinculos *sql.Stmt, produtoID uuid.UUID) ([]uuid.UUID, error) {
+	linhas, err := vinculos.QueryContext(ctx, produtoID)
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var categorias []uuid.UUID
+	for linhas.Next() {
+		var id uuid.UUID
+		if err := linhas.Scan(&id); err != nil {
+			return nil, err
+		}
+		categorias = append(categorias, id)
+	}
+	return categorias, linhas.Err()
+}
+
+// existeCategoria retorna ErrCategoriaNaoEncontrada se a categoria não existe
+// no tenant do contexto.
+func (r *PgxRepositorio) existeCategoria(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	var existe bool
+	if err := tx.StmtContext(ctx, r.stmts.existeCategoria).QueryRowContext(ctx, id, tenantDe(ctx)).Scan(&existe); err != nil {
+		return err
+	}
+	if !existe {
+		return ErrCategoriaNaoEncontrada
+	}
+	return nil
+}
+
+// DefinirEstoque fixa a quantidade em mãos com a linha do estoque travada,
+// criando-a na primeira vez.
+func (r *PgxRepositorio) DefinirEstoque(ctx context.Context, produtoID uuid.UUID, quantidade int) (models.Estoque, error) {
+	if quantidade < 0 {
+		return models.Estoque{}, falhaEstoque(r.logger, "definir estoque do produto", produtoID, ErrQuantidadeInvalida)
+	}
+
+	var estoque models.Estoque
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		if _, err := r.travarProduto(ctx, tx, r.stmts.buscar, produtoID, QualquerVersao); err != nil {
+			return err
+		}
+		if _, err := tx.StmtContext(ctx, r.stmts.inserirEstoque).ExecContext(ctx, produtoID); err != nil {
+			return err
+		}
+		var err error
+		if estoque, err = r.travarEstoque(ctx, tx, produtoID, time.Now()); err != nil {
+			return err
+		}
+		if quantidade < estoque.Reservado {
+			return fmt.Errorf("reservado %d: %w", estoque.Reservado, ErrEstoqueInsuficiente)
+		}
+
+		estoque.Quantidade = quantidade
+		_, err = tx.StmtContext(ctx, r.stmts.atualizarEstoque).ExecContext(ctx, produtoID, estoque.Quantidade, estoque.Reservado)
+		return err
+	})
+	if err != nil {
+		return models.Estoque{}, falhaEstoque(r.logger, "definir estoque do produto", produtoID, err)
+	}
+
+	r.logger.Info("Estoque definido", zap.String("id", produtoID.String()), zap.Int("quantidade", quantidade))
+	return estoque, nil
+}
+
+// ConsultarEstoque retorna o estoque do produto ativo.
+func (r *PgxRepositorio) ConsultarEstoque(ctx context.Context, produtoID uuid.UUID) (models.Estoque, error) {
+	if _, err := escanearProduto(r.stmt(ctx, r.stmts.buscar).QueryRowContext(ctx, produtoID, tenantDe(ctx))); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrProdutoNaoEncontrado
+		}
+		return models.Estoque{}, falhaEstoque(r.logger, "consultar estoque do produto", produtoID, err)
+	}
+
+	estoque := models.Estoque{ProdutoID: produtoID}
+	err := r.stmt(ctx, r.stmts.estoque).QueryRowContext(ctx, produtoID).Scan(&estoque.Quantidade, &estoque.Reservado)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.Estoque{}, falhaEstoque(r.logger, "consultar estoque do produto", produtoID, err)
+	}
+	return estoque, nil
+}
+
+// Reservar trava a linha do estoque como PostgresRepositorio.Reservar.
+func (r *PgxRepositorio) Reservar(ctx context.Context, produtoID uuid.UUID, quantidade int, validade time.Duration) (models.Reserva, error) {
+	if quantidade <= 0 {
+		return models.Reserva{}, falhaEstoque(r.logger, "reservar estoque do produto", produtoID, ErrQuantidadeInvalida)
+	}
+
+	reserva := novaReserva(tenantDe(ctx), produtoID, quantidade, validade)
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		if _, err := r.travarProduto(ctx, tx, r.stmts.buscar, produtoID, QualquerVersao); err != nil {
+			return err
+		}
+		estoque, err := r.travarEstoque(ctx, tx, produtoID, reserva.CriadaEm)
+		if err != nil {
+			return err
+		}
+		if estoque.Disponivel() < quantidade {
+			return fmt.Errorf("disponível %d: %w", estoque.Disponivel(), ErrEstoqueInsuficiente)
+		}
+
+		_, err = tx.StmtContext(ctx, r.stmts.inserirReserva).ExecContext(ctx,
+			reserva.ID, reserva.ProdutoID, reserva.TenantID, reserva.Quantidade, reserva.Status, reserva.CriadaEm, reserva.ExpiraEm)
+		if err != nil {
+			return err
+		}
+		_, err = tx.StmtContext(ctx, r.stmts.atualizarEstoque).ExecContext(ctx, produtoID, estoque.Quantidade, estoque.Reservado+quantidade)
+		return err
+	})
+	if err != nil {
+		return models.Reserva{}, falhaEstoque(r.logger, "reservar estoque do produto", produtoID, err)
+	}
+
+	r.logger.Info("Estoque reservado", zap.String("id", reserva.ID.String()), zap.String("produto_id", produtoID.String()), zap.Int("quantidade", quantidade))
+	return reserva, nil
+}
+
+// ConfirmarReserva baixa a reserva do estoque.
+func (r *PgxRepositorio) ConfirmarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error) {
+	return r.encerrarReserva(ctx, id, ReservaConfirmada, "confirmar reserva")
+}
+
+// LiberarReserva devolve a reserva ao disponível.
+func (r *PgxRepositorio) LiberarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error) {
+	return r.encerrarReserva(ctx, id, ReservaLiberada, "liberar reserva")
+}
+
+// encerrarReserva trava o estoque e depois a reserva, na mesma ordem de
+// Reservar, e a leva ao status alvo.
+func (r *PgxRepositorio) encerrarReserva(ctx context.Context, id uuid.UUID, alvo StatusReserva, operacao string) (models.Reserva, error) {
+	var reserva models.Reserva
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		atual, err := escanearReserva(tx.StmtContext(ctx, r.stmts.reserva).QueryRowContext(ctx, id, tenantDe(ctx)))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReservaNaoEncontrada
+		}
+		if err != nil {
+			return err
+		}
+		agora := time.Now()
+		estoque, err := r.travarEstoque(ctx, tx, atual.ProdutoID, agora)
+		if err != nil {
+			return err
+		}
+		if reserva, err = escanearReserva(tx.StmtContext(ctx, r.stmts.travarReserva).QueryRowContext(ctx, id)); err != nil {
+			return err
+		}
+
+		mudar, err := encerrarReserva(reserva, alvo, agora)
+		if err != nil || !mudar {
+			return err
+		}
+		estoque.Reservado -= reserva.Quantidade
+		if alvo == ReservaConfirmada {
+			estoque.Quantidade -= reserva.Quantidade
+		}
+		reserva.Status = string(alvo)
+		if _, err := tx.StmtContext(ctx, r.stmts.atualizarReserva).ExecContext(ctx, id, reserva.Status); err != nil {
+			return err
+		}
+		_, err = tx.StmtContext(ctx, r.stmts.atualizarEstoque).ExecContext(ctx, estoque.ProdutoID, estoque.Quantidade, estoque.Reservado)
+		return err
+	})
+	if err != nil {
+		return models.Reserva{}, falhaEstoque(r.logger, operacao, id, err)
+	}
+
+	r.logger.Info("Reserva encerrada", zap.String("id", id.String()), zap.String("status", reserva.Status))
+	return reserva, nil
+}
+
+// ExpirarReservas expira as reservas vencidas produto a produto, cada um na
+// sua transação.
+func (r *PgxRepositorio) ExpirarReservas(ctx context.Context, agora time.Time) (int64, error) {
+	produtos, err := r.produtosComReservasVencidas(ctx, agora)
+	if err != nil {
+		r.logger.Error("Falha ao expirar reservas no banco", zap.Error(err))
+		return 0, fmt.Errorf("expirar reservas: %w", err)
+	}
+
+	var total int64
+	for _, produtoID := range produtos {
+		err := r.transacao(ctx, func(tx *sql.Tx) error {
+			estoque, err := r.travarEstoque(ctx, tx, produtoID, time.Time{})
+			if err != nil {
+				return err
+			}
+			expiradas, err := r.vencerReservas(ctx, tx, &estoque, agora)
+			total += expiradas
+			return err
+		})
+		if err != nil {
+			r.logger.Error("Falha ao expirar reservas no banco", zap.Error(err), zap.String("produto_id", produtoID.String()))
+			return total, fmt.Errorf("expirar reservas: %w", err)
+		}
+	}
+
+	r.logger.Info("Reservas expiradas", zap.Int64("total", total))
+	return total, nil
+}
+
+func (r *PgxRepositorio) produtosComReservasVencidas(ctx context.Context, agora time.Time) ([]uuid.UUID, error) {
+	linhas, err := r.stmt(ctx, r.stmts.reservasVencidas).QueryContext(ctx, agora)
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var produtos []uuid.UUID
+	for linhas.Next() {
+		var id uuid.UUID
+		if err := linhas.Scan(&id); err != nil {
+			return nil, err
+		}
+		produtos = append(produtos, id)
+	}
+	return produtos, linhas.Err()
+}
+
+// travarEstoque carrega o estoque com SELECT ... FOR UPDATE e, se agora não
+// for zero, expira as reservas vencidas nele. Um produto sem linha de
+// estoque tem estoque zerado, que não é travado.
+func (r *PgxRepositorio) travarEstoque(ctx context.Context, tx *sql.Tx, produtoID uuid.UUID, agora time.Time) (models.Estoque, error) {
+	estoque := models.Estoque{ProdutoID: produtoID}
+	err := tx.StmtContext(ctx, r.stmts.travarEstoque).QueryRowContext(ctx, produtoID).Scan(&estoque.Quantidade, &estoque.Reservado)
+	if errors.Is(err, sql.ErrNoRows) {
+		return estoque, nil
+	}
+	if err != nil {
+		return models.Estoque{}, err
+	}
+	if !agora.IsZero() {
+		if _, err := r.vencerReservas(ctx, tx, &estoque, agora); err != nil {
+			return models.Estoque{}, err
+		}
+	}
+	return estoque, nil
+}
+
+// vencerReservas marca como expiradas as reservas pendentes do estoque,
+// já travado, vencidas em agora e desconta-as do reservado.
+func (r *PgxRepositorio) vencerReservas(ctx context.Context, tx *sql.Tx, estoque *models.Estoque, agora time.Time) (int64, error) {
+	linhas, err := tx.StmtContext(ctx, r.stmts.vencerReservas).QueryContext(ctx, estoque.ProdutoID, agora)
+	if err != nil {
+		return 0, err
+	}
+	defer linhas.Close()
+
+	var expiradas int64
+	for linhas.Next() {
+		var quantidade int
+		if err := linhas.Scan(&quantidade); err != nil {
+			return 0, err
+		}
+		estoque.Reservado -= quantidade
+		expiradas++
+	}
+	if err := linhas.Err(); err != nil || expiradas == 0 {
+		return 0, err
+	}
+
+	_, err = tx.StmtContext(ctx, r.stmts.atualizarEstoque).ExecContext(ctx, estoque.ProdutoID, estoque.Quantidade, estoque.Reservado)
+	return expiradas, err
+}
+
+// CriarPedido lê os produtos e grava o pedido com seus itens na mesma
+// transação.
+func (r *PgxRepositorio) CriarPedido(ctx context.Context, itens []ItemSolicitado) (models.Pedido, error) {
+	var pedido models.Pedido
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		var err error
+		pedido, err = novoPedido(tenantDe(ctx), itens, func(id uuid.UUID) (models.Produto, error) {
+			return r.travarProduto(ctx, tx, r.stmts.buscar, id, QualquerVersao)
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.StmtContext(ctx, r.stmts.inserirPedido).ExecContext(ctx,
+			pedido.ID, pedido.TenantID, pedido.Status, pedido.Total, pedido.CriadoEm, pedido.AtualizadoEm)
+		if err != nil {
+			return err
+		}
+		inserirItem := tx.StmtContext(ctx, r.stmts.inserirItem)
+		for _, item := range pedido.Itens {
+			_, err := inserirItem.ExecContext(ctx,
+				item.PedidoID, item.Posicao, item.ProdutoID, item.Nome, item.PrecoUnitario, item.Quantidade, item.Subtotal)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Pedido{}, falhaCriarPedido(r.logger, err)
+	}
+
+	r.logger.Info("Pedido criado", zap.String("id", pedido.ID.String()), zap.Int("itens", len(pedido.Itens)), zap.Stringer("total", pedido.Total))
+	return pedido, nil
+}
+
+// BuscarPedido recupera o pedido e seus itens numa única consulta.
+func (r *PgxRepositorio) BuscarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	pedidos, err := consultarPedidos(ctx, r.stmt(ctx, r.stmts.pedido), id, tenantDe(ctx))
+	if err != nil {
+		r.logger.Error("Falha ao buscar pedido no banco", zap.Error(err))
+		return models.Pedido{}, fmt.Errorf("buscar pedido: %w", err)
+	}
+	if len(pedidos) == 0 {
+		r.logger.Error("Falha ao buscar pedido", zap.Error(ErrPedidoNaoEncontrado), zap.String("id", id.String()))
+		return models.Pedido{}, fmt.Errorf("buscar pedido id %s: %w", id, ErrPedidoNaoEncontrado)
+	}
+
+	r.logger.Info("Pedido encontrado", zap.String("id", id.String()))
+	return pedidos[0], nil
+}
+
+// ListarPedidos retorna os pedidos mais recentes primeiro, com os itens
+// trazidos na mesma consulta.
+func (r *PgxRepositorio) ListarPedidos(ctx context.Context, status StatusPedido, limite int) ([]models.Pedido, error) {
+	if err := validarStatusPedido(status); err != nil {
+		r.logger.Error("Falha ao listar pedidos", zap.Error(err))
+		return nil, fmt.Errorf("listar pedidos: %w", err)
+	}
+
+	pedidos, err := consultarPedidos(ctx, r.stmt(ctx, r.stmts.pedidos), tenantDe(ctx), string(status), normalizarLimite(limite))
+	if err != nil {
+		r.logger.Error("Falha ao listar pedidos no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar pedidos: %w", err)
+	}
+
+	r.logger.Info("Listando pedidos", zap.Int("total", len(pedidos)))
+	return pedidos, nil
+}
+
+// PagarPedido leva um pedido criado a pago.
+func (r *PgxRepositorio) PagarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoPago, "pagar pedido")
+}
+
+// EnviarPedido leva um pedido pago a enviado.
+func (r *PgxRepositorio) EnviarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoEnviado, "enviar pedido")
+}
+
+// CancelarPedido cancela um pedido ainda não enviado.
+func (r *PgxRepositorio) CancelarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoCancelado, "cancelar pedido")
+}
+
+// mudarStatusPedido trava o pedido como
+// PostgresRepositorio.mudarStatusPedido e o relê com os itens.
+func (r *PgxRepositorio) mudarStatusPedido(ctx context.Context, id uuid.UUID, alvo StatusPedido, operacao string) (models.Pedido, error) {
+	var pedido models.Pedido
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		var status string
+		err := tx.StmtContext(ctx, r.stmts.travarPedido).QueryRowContext(ctx, id, tenantDe(ctx)).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPedidoNaoEncontrado
+		}
+		if err != nil {
+			return err
+		}
+
+		mudar, err := transicaoPedido(StatusPedido(status), alvo)
+		if err != nil {
+			return err
+		}
+		if mudar {
+			if _, err := tx.StmtContext(ctx, r.stmts.atualizarPedido).ExecContext(ctx, id, string(alvo), time.Now().UTC()); err != nil {
+				return err
+			}
+		}
+		pedidos, err := consultarPedidos(ctx, tx.StmtContext(ctx, r.stmts.pedido), id, tenantDe(ctx))
+		if err != nil {
+			return err
+		}
+		pedido = pedidos[0]
+		return nil
+	})
+	if err != nil {
+		return models.Pedido{}, falhaPedido(r.logger, operacao, id, err)
+	}
+
+	r.logger.Info("Status do pedido alterado", zap.String("id", id.String()), zap.String("status", pedido.Status))
+	return pedido, nil
+}
+
+// consultarPedidos executa uma consulta sobre colunasPedido, ordenada por
+// pedido e posição do item, e agrupa as linhas de cada pedido.
+func consultarPedidos(ctx context.Context, s *sql.Stmt, args ...any) ([]models.Pedido, error) {
+	linhas, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var pedidos []models.Pedido
+	for linhas.Next() {
+		var p models.Pedido
+		var item models.ItemPedido
+		err := linhas.Scan(&p.ID, &p.TenantID, &p.Status, &p.Total, &p.CriadoEm, &p.AtualizadoEm,
+			&item.Posicao, &item.ProdutoID, &item.Nome, &item.PrecoUnitario, &item.Quantidade, &item.Subtotal)
+		if err != nil {
+			return nil, err
+		}
+		item.PedidoID = p.ID
+		if len(pedidos) == 0 || pedidos[len(pedidos)-1].ID != p.ID {
+			pedidos = append(pedidos, p)
+		}
+		ultimo := &pedidos[len(pedidos)-1]
+		ultimo.Itens = append(ultimo.Itens, item)
+	}
+	return pedidos, linhas.Err()
+}
+
+func escanearReserva(linha interface{ Scan(dest ...any) error }) (models.Reserva, error) {
+	var reserva models.Reserva
+	err := linha.Scan(&reserva.ID, &reserva.ProdutoID, &reserva.TenantID, &reserva.Quantidade, &reserva.Status, &reserva.CriadaEm, &reserva.ExpiraEm)
+	return reserva, err
+}
+
+// DefinirEixos grava os eixos com o produto travado, o que serializa a troca
+// com a criação de variantes.
+func (r *PgxRepositorio) DefinirEixos(ctx context.Context, produtoID uuid.UUID, eixos []models.EixoVariante) (models.Grade, error) {
+	if err := validarEixos(eixos); err != nil {
+		return models.Grade{}, falhaVariante(r.logger, "definir eixos do produto", "id", produtoID.String(), err)
+	}
+	dados, err := json.Marshal(eixos)
+	if err != nil {
+		return models.Grade{}, falhaVariante(r.logger, "definir eixos do produto", "id", produtoID.String(), err)
+	}
+
+	err = r.transacao(ctx, func(tx *sql.Tx) error {
+		if _, err := r.travarProduto(ctx, tx, r.stmts.travar, produtoID, QualquerVersao); err != nil {
+			return err
+		}
+		var ehVariante, temVariantes bool
+		if err := tx.StmtContext(ctx, r.stmts.papelVariante).QueryRowContext(ctx, produtoID).Scan(&ehVariante, &temVariantes); err != nil {
+			return err
+		}
+		switch {
+		case ehVariante:
+			return fmt.Errorf("produto é uma variante: %w", ErrEixosInvalidos)
+		case temVariantes:
+			return ErrGradeComVariantes
+		}
+		_, err := tx.StmtContext(ctx, r.stmts.salvarGrade).ExecContext(ctx, produtoID, string(dados))
+		return err
+	})
+	if err != nil {
+		return models.Grade{}, falhaVariante(r.logger, "definir eixos do produto", "id", produtoID.String(), err)
+	}
+
+	r.logger.Info("Eixos definidos", zap.String("id", produtoID.String()), zap.Int("eixos", len(eixos)))
+	return models.Grade{ProdutoID: produtoID, Eixos: eixos, Variantes: []models.Variante{}}, nil
+}
+
+// CriarVariante grava o produto filho, seu histórico e a ligação ao pai na
+// mesma transação, com o pai travado como em
+// PostgresRepositorio.CriarVariante.
+func (r *PgxRepositorio) CriarVariante(ctx context.Context, paiID uuid.UUID, nova NovaVariante) (models.Variante, error) {
+	var variante models.Variante
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		pai, err := r.travarProduto(ctx, tx, r.stmts.travar, paiID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		eixos, err := r.consultarEixos(ctx, tx.StmtContext(ctx, r.stmts.grade), paiID)
+		if err != nil {
+			return err
+		}
+		if eixos == nil {
+			return ErrProdutoSemEixos
+		}
+		if err := validarVariante(eixos, nova); err != nil {
+			return err
+		}
+		opcoes, err := combinacao(nova.Opcoes)
+		if err != nil {
+			return err
+		}
+		var skuUsado, combinacaoUsada bool
+		err = tx.StmtContext(ctx, r.stmts.existeVariante).QueryRowContext(ctx, tenantDe(ctx), nova.SKU, paiID, opcoes).Scan(&skuUsado, &combinacaoUsada)
+		switch {
+		case err != nil:
+			return err
+		case skuUsado:
+			return ErrSKUDuplicado
+		case combinacaoUsada:
+			return ErrCombinacaoDuplicada
+		}
+
+		produto := models.Produto{ID: uuid.New(), TenantID: tenantDe(ctx), Nome: nomeVariante(pai, eixos, nova.Opcoes), Preco: nova.Preco, Versao: 1}
+		if err := r.nomeLivre(ctx, tx, produto); err != nil {
+			return err
+		}
+		err = r.gravarNome(ctx, tx, produto, func() error {
+			_, err := tx.StmtContext(ctx, r.stmts.inserir).ExecContext(ctx, produto.ID, produto.TenantID, produto.Nome, normalizarNome(produto.Nome), r.escopoNome, produto.Preco)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := r.registrarHistorico(ctx, tx, OperacaoCriar, nil, &produto); err != nil {
+			return err
+		}
+		variante = models.Variante{ProdutoID: produto.ID, PaiID: paiID, TenantID: produto.TenantID, SKU: nova.SKU, Opcoes: nova.Opcoes, Produto: &produto}
+		_, err = tx.StmtContext(ctx, r.stmts.inserirVariante).ExecContext(ctx, variante.ProdutoID, variante.PaiID, variante.TenantID, variante.SKU, opcoes)
+		return err
+	})
+	if err != nil {
+		return models.Variante{}, falhaVariante(r.logger, "criar variante do produto", "id", paiID.String(), err)
+	}
+
+	r.logger.Info("Variante criada", zap.String("id", variante.ProdutoID.String()), zap.String("pai_id", paiID.String()), zap.String("sku", nova.SKU))
+	return variante, nil
+}
+
+// Grade lê os eixos e as variantes ativas do produto.
+func (r *PgxRepositorio) Grade(ctx context.Context, produtoID uuid.UUID) (models.Grade, error) {
+	grade := models.Grade{ProdutoID: produtoID, Eixos: []models.EixoVariante{}}
+	_, err := escanearProduto(r.stmt(ctx, r.stmts.buscar).QueryRowContext(ctx, produtoID, tenantDe(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrProdutoNaoEncontrado
+	}
+	var eixos []models.EixoVariante
+	if err == nil {
+		eixos, err = r.consultarEixos(ctx, r.stmt(ctx, r.stmts.grade), produtoID)
+	}
+	if err == nil {
+		grade.Variantes, err = r.consultarVariantes(ctx, r.stmts.variantes, produtoID, tenantDe(ctx))
+	}
+	if err != nil {
+		return models.Grade{}, falhaVariante(r.logger, "consultar grade do produto", "id", produtoID.String(), err)
+	}
+	if eixos != nil {
+		grade.Eixos = eixos
+	}
+	ordenarVariantes(grade.Eixos, grade.Variantes)
+
+	r.logger.Info("Grade consultada", zap.String("id", produtoID.String()), zap.Int("variantes", len(grade.Variantes)))
+	return grade, nil
+}
+
+// BuscarSKU retorna a variante ativa com o código SKU.
+func (r *PgxRepositorio) BuscarSKU(ctx context.Context, sku string) (models.Variante, error) {
+	variantes, err := r.consultarVariantes(ctx, r.stmts.varianteSKU, tenantDe(ctx), sku)
+	if err == nil && len(variantes) == 0 {
+		err = ErrVarianteNaoEncontrada
+	}
+	if err != nil {
+		return models.Variante{}, falhaVariante(r.logger, "buscar variante", "sku", sku, err)
+	}
+
+	r.logger.Info("Variante encontrada", zap.String("sku", sku))
+	return variantes[0], nil
+}
+
+// consultarEixos lê os eixos gravados do produto, ou nil se ele não tem
+// grade.
+func (r *PgxRepositorio) consultarEixos(ctx context.Context, s *sql.Stmt, produtoID uuid.UUID) ([]models.EixoVariante, error) {
+	var dados []byte
+	err := s.QueryRowContext(ctx, produtoID).Scan(&dados)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var eixos []models.EixoVariante
+	if err := json.Unmarshal(dados, &eixos); err != nil {
+		return nil, err
+	}
+	return eixos, nil
+}
+
+func (r *PgxRepositorio) consultarVariantes(ctx context.Context, s *sql.Stmt, args ...any) ([]models.Variante, error) {
+	linhas, err := r.stmt(ctx, s).QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	variantes := []models.Variante{}
+	for linhas.Next() {
+		var v models.Variante
+		var opcoes []byte
+		p := &models.Produto{}
+		if err := linhas.Scan(&v.ProdutoID, &v.PaiID, &v.TenantID, &v.SKU, &opcoes, &p.ID, &p.TenantID, &p.Nome, &p.Preco, &p.Versao, &p.RemovidoEm); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(opcoes, &v.Opcoes); err != nil {
+			return nil, err
+		}
+		v.Produto = p
+		variantes = append(variantes, v)
+	}
+	return variantes, linhas.Err()
+}
+
+// AgendarPreco grava o agendamento com o produto travado, como
+// PostgresRepositorio.AgendarPreco.
+func (r *PgxRepositorio) AgendarPreco(ctx context.Context, produtoID uuid.UUID, preco models.Dinheiro, vigenteDe time.Time) (models.PrecoProduto, error) {
+	if err := validarAgendamento(preco, vigenteDe, time.Now()); err != nil {
+		return models.PrecoProduto{}, falhaPreco(r.logger, "agendar preço do produto", produtoID, err)
+	}
+
+	agendado := models.PrecoProduto{ID: uuid.New(), ProdutoID: produtoID, Preco: preco, VigenteDe: vigenteDe.UTC(), Agendado: true}
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		produto, err := r.travarProduto(ctx, tx, r.stmts.travar, produtoID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		agendado.TenantID = produto.TenantID
+
+		err = tx.StmtContext(ctx, r.stmts.agendamento).QueryRowContext(ctx, produtoID, agendado.VigenteDe).Scan(&agendado.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return r.salvarPreco(ctx, tx, agendado)
+	})
+	if err != nil {
+		return models.PrecoProduto{}, falhaPreco(r.logger, "agendar preço do produto", produtoID, err)
+	}
+
+	r.logger.Info("Preço agendado", zap.String("id", produtoID.String()), zap.Stringer("preco", preco), zap.Time("vigente_de", vigenteDe))
+	return agendado, nil
+}
+
+// Precos retorna a linha do tempo do produto em ordem de VigenteDe.
+func (r *PgxRepositorio) Precos(ctx context.Context, produtoID uuid.UUID) ([]models.PrecoProduto, error) {
+	precos, err := r.consultarPrecos(ctx, r.stmts.precos, produtoID, tenantDe(ctx))
+	if err == nil && len(precos) == 0 {
+		err = ErrProdutoNaoEncontrado
+	}
+	if err != nil {
+		return nil, falhaPreco(r.logger, "consultar preços do produto", produtoID, err)
+	}
+
+	r.logger.Info("Preços consultados", zap.String("id", produtoID.String()), zap.Int("total", len(precos)))
+	return precos, nil
+}
+
+// AplicarPrecosAgendados aplica cada preço na sua transação, relendo o
+// agendamento sob a trava do produto como
+// PostgresRepositorio.AplicarPrecosAgendados.
+func (r *PgxRepositorio) AplicarPrecosAgendados(ctx context.Context, agora time.Time) ([]models.PrecoProduto, error) {
+	devidos, err := r.consultarPrecos(ctx, r.stmts.precosAgendados, agora)
+	if err != nil {
+		r.logger.Error("Falha ao aplicar preços agendados no banco", zap.Error(err))
+		return nil, fmt.Errorf("aplicar preços agendados: %w", err)
+	}
+
+	aplicados := []models.PrecoProduto{}
+	for _, p := range devidos {
+		aplicado := false
+		err := r.transacao(ctx, func(tx *sql.Tx) error {
+			antes, err := r.travarProduto(ComTenant(ctx, p.TenantID), tx, r.stmts.travar, p.ProdutoID, QualquerVersao)
+			if errors.Is(err, ErrProdutoNaoEncontrado) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var pendente bool
+			if err := tx.StmtContext(ctx, r.stmts.pendente).QueryRowContext(ctx, p.ID).Scan(&pendente); err != nil || !pendente {
+				return err
+			}
+
+			produto := antes
+			produto.Preco = p.Preco
+			produto.Versao++
+			if _, err := tx.StmtContext(ctx, r.stmts.atualizar).ExecContext(ctx, produto.ID, produto.Nome, normalizarNome(produto.Nome), r.escopoNome, produto.Preco, produto.Versao); err != nil {
+				return err
+			}
+			h := novoHistorico(ctx, OperacaoAtualizar, &antes, &produto)
+			if err := r.gravarHistorico(ctx, tx, h); err != nil {
+				return err
+			}
+			p.Agendado, p.VigenteDe = false, h.RegistradoEm
+			aplicado = true
+			return r.abrirVigencia(ctx, tx, p)
+		})
+		if err != nil {
+			r.logger.Error("Falha ao aplicar preços agendados no banco", zap.Error(err), zap.String("produto_id", p.ProdutoID.String()))
+			return aplicados, fmt.Errorf("aplicar preços agendados: %w", err)
+		}
+		if aplicado {
+			aplicados = append(aplicados, p)
+		}
+	}
+
+	r.logger.Info("Preços agendados aplicados", zap.Int("total", len(aplicados)))
+	return aplicados, nil
+}
+
+func (r *PgxRepositorio) consultarPrecos(ctx context.Context, s *sql.Stmt, args ...any) ([]models.PrecoProduto, error) {
+	linhas, err := r.stmt(ctx, s).QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var precos []models.PrecoProduto
+	for linhas.Next() {
+		var p models.PrecoProduto
+		if err := linhas.Scan(&p.ID, &p.ProdutoID, &p.TenantID, &p.Preco, &p.VigenteDe, &p.VigenteAte, &p.Agendado); err != nil {
+			return nil, err
+		}
+		precos = append(precos, p)
+	}
+	return precos, linhas.Err()
+}
+
+// abrirVigencia fecha o período em vigor do produto no início de v e grava
+// v, que pode ser um agendamento passando a valer.
+func (r *PgxRepositorio) abrirVigencia(ctx context.Context, tx *sql.Tx, v models.PrecoProduto) error {
+	if _, err := tx.StmtContext(ctx, r.stmts.fecharPreco).ExecContext(ctx, v.ProdutoID, v.VigenteDe); err != nil {
+		return fmt.Errorf("registrar preço: %w", err)
+	}
+	if err := r.salvarPreco(ctx, tx, v); err != nil {
+		return fmt.Errorf("registrar preço: %w", err)
+	}
+	return nil
+}
+
+func (r *PgxRepositorio) salvarPreco(ctx context.Context, tx *sql.Tx, p models.PrecoProduto) error {
+	_, err := tx.StmtContext(ctx, r.stmts.salvarPreco).ExecContext(ctx, p.ID, p.ProdutoID, p.TenantID, p.Preco, p.VigenteDe, p.VigenteAte, p.Agendado)
+	return err
+}
+
+// AdicionarImagem grava a imagem com o produto travado, como
+// PostgresRepositorio.AdicionarImagem.
+func (r *PgxRepositorio) AdicionarImagem(ctx context.Context, imagem models.Imagem) (models.Imagem, error) {
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		produto, err := r.travarProduto(ctx, tx, r.stmts.travar, imagem.ProdutoID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		imagem.TenantID, imagem.CriadaEm = produto.TenantID, time.Now().UTC()
+		_, err = tx.StmtContext(ctx, r.stmts.inserirImagem).ExecContext(ctx, imagem.ID, imagem.ProdutoID, imagem.TenantID, imagem.TipoConteudo, imagem.Tamanho, imagem.Largura, imagem.Altura, imagem.CriadaEm)
+		return err
+	})
+	if err != nil {
+		return models.Imagem{}, falhaImagem(r.logger, "adicionar imagem ao produto", imagem.ProdutoID, err)
+	}
+
+	r.logger.Info("Imagem adicionada", zap.String("id", imagem.ProdutoID.String()), zap.String("imagem_id", imagem.ID.String()))
+	return imagem, nil
+}
+
+// Imagens retorna as imagens dos produtos ativos em uma única consulta. Os
+// IDs vão como text[], convertido para uuid[] no próprio SQL.
+func (r *PgxRepositorio) Imagens(ctx context.Context, produtoIDs []uuid.UUID) (map[uuid.UUID][]models.Imagem, error) {
+	imagens := make(map[uuid.UUID][]models.Imagem)
+	if len(produtoIDs) == 0 {
+		return imagens, nil
+	}
+
+	ids := make([]string, len(produtoIDs))
+	for i, id := range produtoIDs {
+		ids[i] = id.String()
+	}
+	lista, err := r.consultarImagens(ctx, r.stmts.imagens, ids, tenantDe(ctx))
+	if err != nil {
+		r.logger.Error("Falha ao consultar imagens no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar imagens: %w", err)
+	}
+	for _, imagem := range lista {
+		imagens[imagem.ProdutoID] = append(imagens[imagem.ProdutoID], imagem)
+	}
+
+	r.logger.Info("Imagens consultadas", zap.Int("produtos", len(produtoIDs)), zap.Int("com_imagens", len(imagens)))
+	return imagens, nil
+}
+
+// RemoverImagem exclui a imagem com o produto travado, lendo-a do próprio
+// DELETE.
+func (r *PgxRepositorio) RemoverImagem(ctx context.Context, produtoID, imagemID uuid.UUID) (models.Imagem, error) {
+	var imagem models.Imagem
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		if _, err := r.travarProduto(ctx, tx, r.stmts.travar, produtoID, QualquerVersao); err != nil {
+			return err
+		}
+		var err error
+		imagem, err = escanearImagem(tx.StmtContext(ctx, r.stmts.removerImagem).QueryRowContext(ctx, imagemID, produtoID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrImagemNaoEncontrada
+		}
+		return err
+	})
+	if err != nil {
+		return models.Imagem{}, falhaImagem(r.logger, "remover imagem do produto", produtoID, err)
+	}
+
+	r.logger.Info("Imagem removida", zap.String("id", produtoID.String()), zap.String("imagem_id", imagemID.String()))
+	return imagem, nil
+}
+
+// ExpurgarImagens exclui as imagens e as lê do próprio DELETE.
+func (r *PgxRepositorio) ExpurgarImagens(ctx context.Context, removidosAntesDe time.Time) ([]models.Imagem, error) {
+	expurgadas, err := r.consultarImagens(ctx, r.stmts.expurgarImagens, removidosAntesDe)
+	if err != nil {
+		r.logger.Error("Falha ao expurgar imagens no banco", zap.Error(err))
+		return nil, fmt.Errorf("expurgar imagens: %w", err)
+	}
+	if expurgadas == nil {
+		expurgadas = []models.Imagem{}
+	}
+
+	r.logger.Info("Imagens expurgadas", zap.Int("total", len(expurgadas)), zap.Time("removidos_antes_de", removidosAntesDe))
+	return expurgadas, nil
+}
+
+// ExpurgarImagensDoProduto trava o produto removido como
+// PostgresRepositorio.ExpurgarImagensDoProduto e lê as imagens do próprio
+// DELETE.
+func (r *PgxRepositorio) ExpurgarImagensDoProduto(ctx context.Context, produtoID uuid.UUID) ([]models.Imagem, error) {
+	expurgadas := []models.Imagem{}
+	err := r.transacao(ctx, func(tx *sql.Tx) error {
+		produto, err := r.travarProduto(ctx, tx, r.stmts.travarRemovido, produtoID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		if !produto.RemovidoEm.Valid {
+			return ErrProdutoNaoEncontrado
+		}
+		linhas, err := tx.StmtContext(ctx, r.stmts.expurgarProduto).QueryContext(ctx, produtoID)
+		if err != nil {
+			return err
+		}
+		defer linhas.Close()
+		for linhas.Next() {
+			imagem, err := escanearImagem(linhas)
+			if err != nil {
+				return err
+			}
+			expurgadas = append(expurgadas, imagem)
+		}
+		return linhas.Err()
+	})
+	if err != nil {
+		return nil, falhaImagem(r.logger, "expurgar imagens do produto", produtoID, err)
+	}
+	ordenarImagens(expurgadas)
+
+	r.logger.Info("Imagens do produto expurgadas", zap.String("id", produtoID.String()), zap.Int("total", len(expurgadas)))
+	return expurgadas, nil
+}
+
+func (r *PgxRepositorio) consultarImagens(ctx context.Context, s *sql.Stmt, args ...any) ([]models.Imagem, error) {
+	linhas, err := r.stmt(ctx, s).QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var imagens []models.Imagem
+	for linhas.Next() {
+		imagem, err := escanearImagem(linhas)
+		if err != nil {
+			return nil, err
+		}
+		imagens = append(imagens, imagem)
+	}
+	return imagens, linhas.Err()
+}
+
+func escanearImagem(linha interface{ Scan(dest ...any) error }) (models.Imagem, error) {
+	var i models.Imagem
+	err := linha.Scan(&i.ID, &i.ProdutoID, &i.TenantID, &i.TipoConteudo, &i.Tamanho, &i.Largura, &i.Altura, &i.CriadaEm)
+	return i, err
+}
+
+// emTransacao devolve uma cópia do repositório ligada a tx, que reaproveita
+// as instruções já preparadas.
+func (r *PgxRepositorio) emTransacao(tx *sql.Tx) *PgxRepositorio {
+	return &PgxRepositorio{db: r.db, tx: tx, stmts: r.stmts, logger: r.logger, escopoNome: r.escopoNome}
+}
+
+// transacao executa fn em uma transação, confirmando-a se fn não falhar. Em
+// um repositório que já pertence a uma transação, fn roda sob um savepoint,
+// como nas transações aninhadas do GORM.
+func (r *PgxRepositorio) transacao(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if r.tx != nil {
+		if _, err := r.tx.ExecContext(ctx, "SAVEPOINT aninhada"); err != nil {
+			return err
+		}
+		if err := fn(r.tx); err != nil {
+			if _, errRb := r.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT aninhada"); errRb != nil {
+				return errors.Join(err, errRb)
+			}
+			return err
+		}
+		_, err := r.tx.ExecContext(ctx, "RELEASE SAVEPOINT aninhada")
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if errRb := tx.Rollback(); errRb != nil {
+			return errors.Join(err, errRb)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// stmt devolve a instrução preparada, ligada à transação do repositório
+// quando houver.
+func (r *PgxRepositorio) stmt(ctx context.Context, s *sql.Stmt) *sql.Stmt {
+	if r.tx != nil {
+		return r.tx.StmtContext(ctx, s)
+	}
+	return s
+}
+
+func (r *PgxRepositorio) consultarProdutos(ctx context.Context, consulta string, args ...any) ([]models.Produto, error) {
+	var linhas *sql.Rows
+	var err error
+	if r.tx != nil {
+		linhas, err = r.tx.QueryContext(ctx, consulta, args...)
+	} else {
+		linhas, err = r.db.QueryContext(ctx, consulta, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer linhas.Close()
+
+	var produtos []models.Produto
+	for linhas.Next() {
+		produto, err := escanearProduto(linhas)
+		if err != nil {
+			return nil, err
+		}
+		produtos = append(produtos, produto)
+	}
+	return produtos, linhas.Err()
+}
+
+// travarProduto carrega o produto do tenant do contexto com a instrução
+// SELECT ... FOR UPDATE informada e confere a versão esperada.
+func (r *PgxRepositorio) travarProduto(ctx context.Context, tx *sql.Tx, s *sql.Stmt, id uuid.UUID, versao int) (models.Produto, error) {
+	produto, err := escanearProduto(tx.StmtContext(ctx, s).QueryRowContext(ctx, id, tenantDe(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Produto{}, ErrProdutoNaoEncontrado
+	}
+	if err != nil {
+		return models.Produto{}, err
+	}
+	if versao != QualquerVersao && produto.Versao != versao {
+		return models.Produto{}, ErrConflitoDeVersao
+	}
+	return produto, nil
+}
+
+// nomeLivre confere, como a função homônima do GORM, que nenhum outro
+// produto ativo do tenant de p usa o nome dele no escopo do repositório.
+func (r *PgxRepositorio) nomeLivre(ctx context.Context, tx *sql.Tx, p models.Produto) error {
+	if r.escopoNome == NomeUnicoNoTenant {
+		return r.nomeEmUso(ctx, tx.StmtContext(ctx, r.stmts.nomeEmUso), p)
+	}
+	categorias, err := consultarVinculos(ctx, tx.StmtContext(ctx, r.stmts.vinculos), p.ID)
+	if err != nil {
+		return err
+	}
+	return r.nomeLivreNasCategorias(ctx, tx, p, categorias)
+}
+
+// nomeLivreNasCategorias confere o nome de p entre os produtos ativos das
+// categorias, travadas até o fim da transação como na função homônima do
+// GORM. Os IDs vão como text[], convertido para uuid[] no próprio SQL.
+func (r *PgxRepositorio) nomeLivreNasCategorias(ctx context.Context, tx *sql.Tx, p models.Produto, categorias []uuid.UUID) error {
+	if len(categorias) == 0 {
+		return nil
+	}
+	ids := make([]string, len(categorias))
+	for i, id := range categorias {
+		ids[i] = id.String()
+	}
+	if _, err := tx.StmtContext(ctx, r.stmts.travarCategorias).ExecContext(ctx, ids); err != nil {
+		return err
+	}
+	return r.nomeEmUso(ctx, tx.StmtContext(ctx, r.stmts.nomeNaCategoria), p, ids)
+}
+
+// nomeEmUso executa a consulta de nome em uso, que recebe o tenant, o nome
+// normalizado e o ID de p seguidos de filtros.
+func (r *PgxRepositorio) nomeEmUso(ctx context.Context, consulta *sql.Stmt, p models.Produto, filtros ...any) error {
+	var existente uuid.UUID
+	args := append([]any{p.TenantID, normalizarNome(p.Nome), p.ID}, filtros...)
+	err := consulta.QueryRowContext(ctx, args...).Scan(&existente)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &ProdutoDuplicadoError{Nome: p.Nome, ExistenteID: existente}
+}
+
+// gravarNome executa gravar num savepoint e, como a função homônima do GORM,
+// repete nomeLivre se uma escrita concorrente tomou o nome de p.
+func (r *PgxRepositorio) gravarNome(ctx context.Context, tx *sql.Tx, p models.Produto, gravar func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT nome_unico"); err != nil {
+		return err
+	}
+	err := gravar()
+	if err == nil {
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT nome_unico")
+		return err
+	}
+	if !violaNomeUnicoPostgres(err) {
+		return err
+	}
+	if _, errRb := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT nome_unico"); errRb != nil {
+		return errors.Join(err, errRb)
+	}
+	if err := r.nomeLivre(ctx, tx, p); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrProdutoDuplicado, err)
+}
+
+// registrarHistorico grava a alteração, o evento que a anuncia na outbox e,
+// se o preço mudou, o período de preço que ela abre, tudo na transação da
+// própria alteração.
+func (r *PgxRepositorio) registrarHistorico(ctx context.Context, tx *sql.Tx, operacao TipoOperacao, antes, depois *models.Produto) error {
+	h := novoHistorico(ctx, operacao, antes, depois)
+	if err := r.gravarHistorico(ctx, tx, h); err != nil {
+		return err
+	}
+	if !mudouPreco(antes, depois) {
+		return nil
+	}
+	return r.abrirVigencia(ctx, tx, novaVigencia(h))
+}
+
+// gravarHistorico grava a entrada de histórico e o evento que a anuncia.
+func (r *PgxRepositorio) gravarHistorico(ctx context.Context, tx *sql.Tx, h models.HistoricoProduto) error {
+	antesJSON, err := produtoParaJSON(h.Antes)
+	if err != nil {
+		return fmt.Errorf("registrar histórico: %w", err)
+	}
+	depoisJSON, err := produtoParaJSON(h.Depois)
+	if err != nil {
+		return fmt.Errorf("registrar histórico: %w", err)
+	}
+
+	_, err = tx.StmtContext(ctx, r.stmts.inserirHistorico).
+		ExecContext(ctx, h.ID, h.ProdutoID, h.TenantID, h.Operacao, antesJSON, depoisJSON, h.Autor, h.RegistradoEm)
+	if err != nil {
+		return fmt.Errorf("registrar histórico: %w", err)
+	}
+
+	e := novoEvento(h)
+	_, err = tx.StmtContext(ctx, r.stmts.inserirEvento).
+		ExecContext(ctx, e.ID, e.Tipo, e.ProdutoID, depoisJSON, e.OcorridoEm)
+	if err != nil {
+		return fmt.Errorf("registrar evento: %w", err)
+	}
+	return nil
+}
+
+// falhaEscrita registra e contextualiza o erro de uma escrita, preservando os
+// sentinelas de produto inexistente e de conflito de versão.
+func (r *PgxRepositorio) falhaEscrita(operacao string, id uuid.UUID, versao int, err error) error {
+	switch {
+	case errors.Is(err, ErrProdutoNaoEncontrado), errors.Is(err, ErrProdutoDuplicado):
+		r.logger.Error("Falha ao "+operacao+" produto", zap.Error(err), zap.String("id", id.String()))
+		return fmt.Errorf("%s produto id %s: %w", operacao, id, err)
+	case errors.Is(err, ErrConflitoDeVersao):
+		r.logger.Error("Falha ao "+operacao+" produto", zap.Error(err), zap.String("id", id.String()), zap.Int("versao", versao))
+		return fmt.Errorf("%s produto id %s versão %d: %w", operacao, id, versao, err)
+	default:
+		r.logger.Error("Falha ao "+operacao+" produto no banco", zap.Error(err))
+		return fmt.Errorf("%s produto: %w", operacao, err)
+	}
+}
+
+func escanearProduto(linha interface{ Scan(dest ...any) error }) (models.Produto, error) {
+	var p models.Produto
+	err := linha.Scan(&p.ID, &p.TenantID, &p.Nome, &p.Preco, &p.Versao, &p.RemovidoEm)
+	return p, err
+}
+
+// produtoParaJSON serializa um estado do histórico para a coluna JSONB,
+// gravando NULL quando ausente.
+func produtoParaJSON(p *models.Produto) (any, error) {
+	if p == nil {
+		return nil, nil
+	}
+	dados, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(dados), nil
+}
+
+func produtoDeJSON(dados []byte) (*models.Produto, error) {
+	if dados == nil {
+		return nil, nil
+	}
+	var p models.Produto
+	if err := json.Unmarshal(dados, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,203 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/internal/repo/repotest"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func abrirPgx(t *testing.T, opcoes repo.OpcoesRepositorio) *repo.PgxRepositorio {
+	db, err := sql.Open("pgx", dsnTeste)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	repositorio, err := repo.NovoPgxRepositorio(context.Background(), db, opcoes, zap.NewNop())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		db.Exec("TRUNCATE produtos, produtos_historico, outbox, produto_categorias, categorias, reservas, estoques, pedido_itens, pedidos, grades, variantes, produtos_precos, produtos_imagens")
+		repositorio.Fechar()
+		db.Close()
+	})
+	return repositorio
+}
+
+func TestPgxRepositorio(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.Run(t, func(t *testing.T) repo.RepositorioProdutos {
+		esvaziar(t)
+		return repositorio
+	})
+}
+
+func TestTenantsPgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.RunTenants(t, func(t *testing.T) repo.RepositorioProdutos {
+		esvaziar(t)
+		return repositorio
+	})
+}
+
+func TestUnidadeDeTrabalhoPgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.RunUnidadeDeTrabalho(t, func(t *testing.T) (repo.UnidadeDeTrabalho, repo.RepositorioProdutos) {
+		esvaziar(t)
+		return repo.NovaUnidadeDeTrabalhoPgx(repositorio, zap.NewNop()), repositorio
+	})
+}
+
+func TestCategoriasPgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+
+	repotest.RunCategorias(t, func(t *testing.T, opcoes repo.OpcoesRepositorio) (repo.RepositorioProdutos, repo.RepositorioCategorias) {
+		esvaziar(t)
+		repositorio := abrirPgx(t, opcoes)
+		return repositorio, repositorio
+	})
+}
+
+func TestEstoquePgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.RunEstoque(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioEstoque) {
+		esvaziar(t)
+		return repositorio, repositorio
+	})
+}
+
+func TestPedidosPgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.RunPedidos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPedidos) {
+		esvaziar(t)
+		return repositorio, repositorio
+	})
+}
+
+func TestVariantesPgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.RunVariantes(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioVariantes) {
+		esvaziar(t)
+		return repositorio, repositorio
+	})
+}
+
+func TestPrecosPgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.RunPrecos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPrecos) {
+		esvaziar(t)
+		return repositorio, repositorio
+	})
+}
+
+func TestImagensPgx(t *testing.T) {
+	_, esvaziar := abrirPostgres(t)
+	repositorio := abrirPgx(t, repo.OpcoesRepositorio{})
+
+	repotest.RunImagens(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioImagens) {
+		esvaziar(t)
+		return repositorio, repositorio
+	})
+}
+
+// BenchmarkRepositoriosPostgres compara PostgresRepositorio (GORM) com
+// PgxRepositorio sobre o mesmo banco:
+//
+//	go test -run '^$' -bench RepositoriosPostgres -benchmem ./internal/repo
+func BenchmarkRepositoriosPostgres(b *testing.B) {
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	gormDB, err := gorm.Open(postgres.Open(dsnTeste), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		b.Skipf("PostgreSQL indisponível: %v", err)
+	}
+	sqlDB, err := sql.Open("pgx", dsnTeste)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sqlDB.Close()
+	defer sqlDB.Exec("TRUNCATE produtos, produtos_historico, outbox, produto_categorias, categorias, reservas, estoques, pedido_itens, pedidos, grades, variantes, produtos_precos, produtos_imagens")
+
+	pgxRepo, err := repo.NovoPgxRepositorio(ctx, sqlDB, repo.OpcoesRepositorio{}, zap.NewNop())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pgxRepo.Fechar()
+
+	implementacoes := []struct {
+		nome        string
+		repositorio repo.RepositorioProdutos
+	}{
+		{"gorm", repo.NovoPostgresRepositorio(gormDB, repo.OpcoesRepositorio{}, zap.NewNop())},
+		{"pgx", pgxRepo},
+	}
+
+	for _, impl := range implementacoes {
+		b.Run("Criar/"+impl.nome, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// Os nomes são únicos, e cada rodada do benchmark recomeça i
+				if _, err := impl.repositorio.Criar(ctx, "Produto "+uuid.NewString(), models.Centavos(1000)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	produto, err := pgxRepo.Criar(ctx, "Laptop", models.Centavos(99999))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, impl := range implementacoes {
+		b.Run("Buscar/"+impl.nome, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := impl.repositorio.Buscar(ctx, produto.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	for _, impl := range implementacoes {
+		b.Run("Atualizar/"+impl.nome, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := impl.repositorio.Atualizar(ctx, produto.ID, "Laptop", models.Centavos(int64(i+1)), repo.QualquerVersao); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	for _, impl := range implementacoes {
+		b.Run("Listar/"+impl.nome, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := impl.repositorio.Listar(ctx, repo.FiltroListagem{Ordenacao: repo.OrdenarPorPreco, Limite: repo.LimiteMaximo}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
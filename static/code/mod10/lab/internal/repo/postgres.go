@@ -1,52 +1,97 @@
 package repo
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/seu-usuario/lab6/models"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
-)
-
-var (
-	ErrPrecoInvalido        = errors.New("preço não pode ser negativo")
-	ErrProdutoNaoEncontrado = errors.New("produto não encontrado")
+	"gorm.io/gorm/clause"
 )
 
 // PostgresRepositorio implementa o repositório com PostgreSQL.
 type PostgresRepositorio struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db         *gorm.DB
+	logger     *zap.Logger
+	escopoNome EscopoNome
+	// violaNomeUnico reconhece, pelo código de erro do banco, a violação de
+	// indiceNomeUnico.
+	violaNomeUnico func(error) bool
 }
 
 // NovoPostgresRepositorio cria um novo repositório.
-func NovoPostgresRepositorio(db *gorm.DB, logger *zap.Logger) *PostgresRepositorio {
-	return &PostgresRepositorio{db: db, logger: logger}
+func NovoPostgresRepositorio(db *gorm.DB, opcoes OpcoesRepositorio, logger *zap.Logger) *PostgresRepositorio {
+	return &PostgresRepositorio{db: db, logger: logger, escopoNome: opcoes.escopoNome(), violaNomeUnico: violaNomeUnicoPostgres}
+}
+
+// emTransacao retorna uma cópia do repositório ligada a tx.
+func (r *PostgresRepositorio) emTransacao(tx *gorm.DB) *PostgresRepositorio {
+	copia := *r
+	copia.db = tx
+	return &copia
 }
 
 // Criar adiciona um novo produto ao banco.
-func (r *PostgresRepositorio) Criar(nome string, preco float64) (models.Produto, error) {
-	if preco < 0 {
-		r.logger.Error("Falha ao criar produto", zap.Error(ErrPrecoInvalido), zap.String("nome", nome))
-		return models.Produto{}, ErrPrecoInvalido
+func (r *PostgresRepositorio) Criar(ctx context.Context, nome string, preco models.Dinheiro) (models.Produto, error) {
+	return r.criar(ctx, uuid.New(), nome, preco)
+}
+
+// CriarComID adiciona ao banco um novo produto com o ID informado.
+func (r *PostgresRepositorio) CriarComID(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	return r.criar(ctx, id, nome, preco)
+}
+
+func (r *PostgresRepositorio) criar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro) (models.Produto, error) {
+	if err := preco.Validar(); err != nil {
+		r.logger.Error("Falha ao criar produto", zap.Error(err), zap.String("nome", nome))
+		return models.Produto{}, err
 	}
 
-	produto := models.Produto{Nome: nome, Preco: preco}
-	if err := r.db.Create(&produto).Error; err != nil {
+	produto := models.Produto{ID: id, TenantID: tenantDe(ctx), Nome: nome, Preco: preco, Versao: 1}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var usados int64
+		if err := tx.Unscoped().Model(&models.Produto{}).Where("id = ?", id).Count(&usados).Error; err != nil {
+			return err
+		}
+		if usados > 0 {
+			return ErrIDEmUso
+		}
+		if err := r.nomeLivre(ctx, tx, nome, uuid.Nil); err != nil {
+			return err
+		}
+		err := r.gravarNome(ctx, tx, nome, uuid.Nil, func(tx *gorm.DB) error {
+			return r.inserirProduto(ctx, tx, &produto)
+		})
+		if err != nil {
+			return err
+		}
+		return registrarHistorico(ctx, tx, OperacaoCriar, nil, &produto)
+	})
+	if errors.Is(err, ErrProdutoDuplicado) || errors.Is(err, ErrIDEmUso) {
+		r.logger.Error("Falha ao criar produto", zap.Error(err), zap.String("nome", nome))
+		return models.Produto{}, fmt.Errorf("criar produto: %w", err)
+	}
+	if err != nil {
 		r.logger.Error("Falha ao criar produto no banco", zap.Error(err))
 		return models.Produto{}, fmt.Errorf("criar produto: %w", err)
 	}
 
-	r.logger.Info("Produto criado", zap.String("id", produto.ID.String()), zap.String("nome", nome), zap.Float64("preco", preco))
+	r.logger.Info("Produto criado", zap.String("id", produto.ID.String()), zap.String("nome", nome), zap.Stringer("preco", preco))
 	return produto, nil
 }
 
 // Buscar recupera um produto pelo ID.
-func (r *PostgresRepositorio) Buscar(id uuid.UUID) (models.Produto, error) {
+func (r *PostgresRepositorio) Buscar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
 	var produto models.Produto
-	if err := r.db.First(&produto, "id = ?", id).Error; err != nil {
+	if err := r.db.WithContext(ctx).First(&produto, "id = ? AND tenant_id = ?", id, tenantDe(ctx)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			r.logger.Error("Falha ao buscar produto", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", id.String()))
 			return models.Produto{}, fmt.Errorf("buscar produto id %s: %w", id, ErrProdutoNaoEncontrado)
@@ -60,58 +105,1499 @@ func (r *PostgresRepositorio) Buscar(id uuid.UUID) (models.Produto, error) {
 	return produto, nil
 }
 
-// Listar retorna todos os produtos.
-func (r *PostgresRepositorio) Listar() ([]models.Produto, error) {
+// Listar retorna uma página de produtos usando paginação por chave (keyset).
+// Os nomes são ordenados com COLLATE "C" para coincidir com a ordenação byte
+// a byte do repositório em memória.
+func (r *PostgresRepositorio) Listar(ctx context.Context, filtro FiltroListagem) (Pagina, error) {
+	return r.listar(ctx, filtro, `nome COLLATE "C"`, "nome ILIKE ?")
+}
+
+// listar monta a consulta de Listar. colunaNome é a expressão usada para
+// ordenar por nome e filtroNome a condição de busca por substring, que
+// recebe o padrão já escapado por escaparLike; ambas variam com o banco.
+func (r *PostgresRepositorio) listar(ctx context.Context, filtro FiltroListagem, colunaNome, filtroNome string) (Pagina, error) {
+	filtro, c, err := filtro.normalizar()
+	if err != nil {
+		r.logger.Error("Falha ao listar produtos", zap.Error(err))
+		return Pagina{}, fmt.Errorf("listar produtos: %w", err)
+	}
+
+	query := r.db.WithContext(ctx).Model(&models.Produto{}).Where("tenant_id = ?", tenantDe(ctx))
+	if filtro.IncluirRemovidos {
+		query = query.Unscoped()
+	}
+	if filtro.Nome != "" {
+		query = query.Where(filtroNome, "%"+escaparLike(filtro.Nome)+"%")
+	}
+	if filtro.PrecoMin != nil {
+		query = query.Where("preco >= ?", *filtro.PrecoMin)
+	}
+	if filtro.PrecoMax != nil {
+		query = query.Where("preco <= ?", *filtro.PrecoMax)
+	}
+
+	coluna, direcao, operador := colunaNome, "ASC", ">"
+	if filtro.Ordenacao == OrdenarPorPreco || filtro.Ordenacao == OrdenarPorPrecoDesc {
+		coluna = "preco"
+	}
+	if filtro.Ordenacao.decrescente() {
+		direcao, operador = "DESC", "<"
+	}
+	if c != nil {
+		var valor any = c.Nome
+		if coluna == "preco" {
+			valor = models.Centavos(c.Centavos)
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", coluna, operador), valor, c.ID)
+	}
+
 	var produtos []models.Produto
-	if err := r.db.Find(&produtos).Error; err != nil {
+	err = query.Order(fmt.Sprintf("%s %s, id %s", coluna, direcao, direcao)).
+		Limit(filtro.Limite + 1).
+		Find(&produtos).Error
+	if err != nil {
 		r.logger.Error("Falha ao listar produtos", zap.Error(err))
-		return nil, fmt.Errorf("listar produtos: %w", err)
+		return Pagina{}, fmt.Errorf("listar produtos: %w", err)
+	}
+
+	pagina := paginar(filtro, produtos)
+	r.logger.Info("Listando produtos", zap.Int("total", len(pagina.Produtos)))
+	return pagina, nil
+}
+
+// Pesquisar faz a busca textual sobre a coluna busca (tsvector com
+// radicalização em português e sem acentos), ordenando por ts_rank.
+func (r *PostgresRepositorio) Pesquisar(ctx context.Context, termo string, limite int) ([]models.Produto, error) {
+	if strings.TrimSpace(termo) == "" {
+		r.logger.Error("Falha ao pesquisar produtos", zap.Error(ErrBuscaVazia))
+		return nil, fmt.Errorf("pesquisar produtos: %w", ErrBuscaVazia)
+	}
+
+	var produtos []models.Produto
+	err := r.db.WithContext(ctx).
+		Where("tenant_id = ? AND busca @@ websearch_to_tsquery('portugues_sem_acento', ?)", tenantDe(ctx), termo).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                `ts_rank(busca, websearch_to_tsquery('portugues_sem_acento', ?)) DESC, nome COLLATE "C", id`,
+			Vars:               []any{termo},
+			WithoutParentheses: true,
+		}}).
+		Limit(normalizarLimite(limite)).
+		Find(&produtos).Error
+	if err != nil {
+		r.logger.Error("Falha ao pesquisar produtos", zap.Error(err))
+		return nil, fmt.Errorf("pesquisar produtos: %w", err)
 	}
 
-	r.logger.Info("Listando produtos", zap.Int("total", len(produtos)))
+	r.logger.Info("Produtos pesquisados", zap.String("termo", termo), zap.Int("total", len(produtos)))
 	return produtos, nil
 }
 
-// Atualizar modifica um produto existente.
-func (r *PostgresRepositorio) Atualizar(id uuid.UUID, nome string, preco float64) (models.Produto, error) {
-	if preco < 0 {
-		r.logger.Error("Falha ao atualizar produto", zap.Error(ErrPrecoInvalido), zap.String("id", id.String()))
-		return models.Produto{}, ErrPrecoInvalido
+// escaparLike protege os curingas do LIKE, usando \ como caractere de escape,
+// para que o filtro por nome seja uma busca literal por substring.
+func escaparLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Atualizar modifica um produto existente. Quando versao é diferente de
+// QualquerVersao, a atualização só ocorre se a versão gravada for a mesma.
+// A alteração e seu registro no histórico são gravados na mesma transação.
+func (r *PostgresRepositorio) Atualizar(ctx context.Context, id uuid.UUID, nome string, preco models.Dinheiro, versao int) (models.Produto, error) {
+	if err := preco.Validar(); err != nil {
+		r.logger.Error("Falha ao atualizar produto", zap.Error(err), zap.String("id", id.String()))
+		return models.Produto{}, err
 	}
+
 	var produto models.Produto
-	if err := r.db.First(&produto, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			r.logger.Error("Falha ao atualizar produto", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", id.String()))
-			return models.Produto{}, fmt.Errorf("atualizar produto id %s: %w", id, ErrProdutoNaoEncontrado)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		antes, err := travarProduto(ctx, tx, id, versao)
+		if err != nil {
+			return err
+		}
+		if nome != antes.Nome {
+			if err := r.nomeLivre(ctx, tx, nome, id); err != nil {
+				return err
+			}
 		}
 
-		r.logger.Error("Falha ao buscar produto no banco", zap.Error(err))
-		return models.Produto{}, fmt.Errorf("atualizar produto: %w", err)
+		produto = antes
+		produto.Nome = nome
+		produto.Preco = preco
+		produto.Versao++
+		valores := map[string]any{
+			"nome":   produto.Nome,
+			"preco":  produto.Preco,
+			"versao": produto.Versao,
+		}
+		if nome != antes.Nome {
+			maps.Copy(valores, r.colunasNome(ctx, nome))
+		}
+		err = r.gravarNome(ctx, tx, nome, id, func(tx *gorm.DB) error {
+			return tx.Model(&produto).Updates(valores).Error
+		})
+		if err != nil {
+			return err
+		}
+		return registrarHistorico(ctx, tx, OperacaoAtualizar, &antes, &produto)
+	})
+	if err != nil {
+		return models.Produto{}, r.falhaEscrita("atualizar", id, versao, err)
 	}
 
-	produto.Nome = nome
-	produto.Preco = preco
-	if err := r.db.Save(&produto).Error; err != nil {
-		r.logger.Error("Falha ao atualizar produto no banco", zap.Error(err))
-		return models.Produto{}, fmt.Errorf("atualizar produto: %w", err)
+	r.logger.Info("Produto atualizado", zap.String("id", id.String()), zap.String("nome", nome), zap.Stringer("preco", preco), zap.Int("versao", produto.Versao))
+	return produto, nil
+}
+
+// Deletar remove logicamente um produto pelo ID, respeitando a versão como em
+// Atualizar.
+func (r *PostgresRepositorio) Deletar(ctx context.Context, id uuid.UUID, versao int) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		antes, err := travarProduto(ctx, tx, id, versao)
+		if err != nil {
+			return err
+		}
+
+		depois := antes
+		depois.RemovidoEm = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		if err := tx.Model(&depois).Update("deleted_at", depois.RemovidoEm).Error; err != nil {
+			return err
+		}
+		return registrarHistorico(ctx, tx, OperacaoDeletar, &antes, &depois)
+	})
+	if err != nil {
+		return r.falhaEscrita("deletar", id, versao, err)
 	}
 
-	r.logger.Info("Produto atualizado", zap.String("id", id.String()), zap.String("nome", nome), zap.Float64("preco", preco))
+	r.logger.Info("Produto deletado", zap.String("id", id.String()))
+	return nil
+}
+
+// Restaurar desfaz a remoção lógica de um produto. Restaurar um produto
+// ativo não tem efeito; um removido só volta se o nome estiver livre.
+func (r *PostgresRepositorio) Restaurar(ctx context.Context, id uuid.UUID) (models.Produto, error) {
+	var produto models.Produto
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&produto, "id = ? AND tenant_id = ?", id, tenantDe(ctx)).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProdutoNaoEncontrado
+		}
+		if err != nil || !produto.RemovidoEm.Valid {
+			return err
+		}
+
+		if err := r.nomeLivre(ctx, tx, produto.Nome, id); err != nil {
+			return err
+		}
+
+		antes := produto
+		produto.RemovidoEm = gorm.DeletedAt{}
+		valores := r.colunasNome(ctx, produto.Nome)
+		valores["deleted_at"] = nil
+		err = r.gravarNome(ctx, tx, produto.Nome, id, func(tx *gorm.DB) error {
+			return tx.Unscoped().Model(&produto).Updates(valores).Error
+		})
+		if err != nil {
+			return err
+		}
+		return registrarHistorico(ctx, tx, OperacaoRestaurar, &antes, &produto)
+	})
+	if err != nil {
+		return models.Produto{}, r.falhaEscrita("restaurar", id, QualquerVersao, err)
+	}
+
+	r.logger.Info("Produto restaurado", zap.String("id", id.String()))
 	return produto, nil
 }
 
-// Deletar remove um produto pelo ID.
-func (r *PostgresRepositorio) Deletar(id uuid.UUID) error {
-	result := r.db.Delete(&models.Produto{}, "id = ?", id)
+// Purgar exclui definitivamente os produtos removidos antes do instante
+// informado, de todos os tenants, e retorna quantos foram excluídos.
+func (r *PostgresRepositorio) Purgar(ctx context.Context, removidosAntesDe time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at < ?", removidosAntesDe).
+		Delete(&models.Produto{})
 	if result.Error != nil {
-		r.logger.Error("Falha ao deletar produto no banco", zap.Error(result.Error))
-		return fmt.Errorf("deletar produto: %w", result.Error)
+		r.logger.Error("Falha ao purgar produtos no banco", zap.Error(result.Error))
+		return 0, fmt.Errorf("purgar produtos: %w", result.Error)
 	}
-	if result.RowsAffected == 0 {
-		r.logger.Error("Falha ao deletar produto", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", id.String()))
-		return fmt.Errorf("deletar produto id %s: %w", id, ErrProdutoNaoEncontrado)
+
+	r.logger.Info("Produtos purgados", zap.Int64("total", result.RowsAffected), zap.Time("removidos_antes_de", removidosAntesDe))
+	return result.RowsAffected, nil
+}
+
+// AplicarLote executa as operações em uma única transação. Cada operação
+// roda sob um savepoint, de modo que uma falha não interrompe as demais e o
+// relatório traz o erro de cada item; se houver qualquer falha, a transação
+// inteira é desfeita.
+func (r *PostgresRepositorio) AplicarLote(ctx context.Context, operacoes []OperacaoLote) ([]ResultadoLote, error) {
+	if len(operacoes) > LoteMaximo {
+		return nil, fmt.Errorf("aplicar lote com %d operações: %w", len(operacoes), ErrLoteMuitoGrande)
 	}
 
-	r.logger.Info("Produto deletado", zap.String("id", id.String()))
+	var resultados []ResultadoLote
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := r.emTransacao(tx)
+
+		var falhas int
+		resultados, falhas = executarLote(operacoes, func(op OperacaoLote) (*models.Produto, error) {
+			if err := tx.SavePoint("operacao").Error; err != nil {
+				return nil, err
+			}
+			produto, err := aplicarOperacao(ctx, txRepo, op)
+			if err != nil {
+				if errRb := tx.RollbackTo("operacao").Error; errRb != nil {
+					return nil, errors.Join(err, errRb)
+				}
+				return nil, err
+			}
+			return produto, nil
+		})
+		if falhas > 0 {
+			return fmt.Errorf("%d de %d operações falharam: %w", falhas, len(operacoes), ErrLoteRejeitado)
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("Falha ao aplicar lote", zap.Error(err), zap.Int("operacoes", len(operacoes)))
+		return resultados, fmt.Errorf("aplicar lote: %w", err)
+	}
+
+	r.logger.Info("Lote aplicado", zap.Int("operacoes", len(operacoes)))
+	return resultados, nil
+}
+
+// Historico retorna as alterações do produto em ordem cronológica. O
+// histórico sobrevive à remoção e ao expurgo do produto.
+func (r *PostgresRepositorio) Historico(ctx context.Context, id uuid.UUID) ([]models.HistoricoProduto, error) {
+	var historico []models.HistoricoProduto
+	err := r.db.WithContext(ctx).
+		Where("produto_id = ? AND tenant_id = ?", id, tenantDe(ctx)).
+		Order("registrado_em, id").
+		Find(&historico).Error
+	if err != nil {
+		r.logger.Error("Falha ao consultar histórico no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar histórico: %w", err)
+	}
+	if len(historico) == 0 {
+		r.logger.Error("Falha ao consultar histórico", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", id.String()))
+		return nil, fmt.Errorf("consultar histórico id %s: %w", id, ErrProdutoNaoEncontrado)
+	}
+
+	r.logger.Info("Histórico consultado", zap.String("id", id.String()), zap.Int("total", len(historico)))
+	return historico, nil
+}
+
+// CriarCategoria cria uma categoria, conferindo antes que o pai existe.
+func (r *PostgresRepositorio) CriarCategoria(ctx context.Context, nome string, paiID *uuid.UUID) (models.Categoria, error) {
+	categoria := models.Categoria{ID: uuid.New(), TenantID: tenantDe(ctx), Nome: nome, PaiID: paiID}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if paiID != nil {
+			if err := existeCategoria(ctx, tx, *paiID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&categoria).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrCategoriaNaoEncontrada) {
+			r.logger.Error("Falha ao criar categoria", zap.Error(err), zap.Stringer("pai_id", paiID))
+			return models.Categoria{}, fmt.Errorf("criar categoria pai %s: %w", paiID, err)
+		}
+
+		r.logger.Error("Falha ao criar categoria no banco", zap.Error(err))
+		return models.Categoria{}, fmt.Errorf("criar categoria: %w", err)
+	}
+
+	r.logger.Info("Categoria criada", zap.String("id", categoria.ID.String()), zap.String("nome", nome))
+	return categoria, nil
+}
+
+// ListarCategorias retorna todas as categorias ordenadas por nome.
+func (r *PostgresRepositorio) ListarCategorias(ctx context.Context) ([]models.Categoria, error) {
+	var categorias []models.Categoria
+	if err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantDe(ctx)).Find(&categorias).Error; err != nil {
+		r.logger.Error("Falha ao listar categorias no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar categorias: %w", err)
+	}
+	slices.SortFunc(categorias, compararCategorias)
+
+	r.logger.Info("Listando categorias", zap.Int("total", len(categorias)))
+	return categorias, nil
+}
+
+// ProdutosDaCategoria percorre a árvore com uma CTE recursiva. Os nomes são
+// ordenados com COLLATE "C", como em Listar.
+func (r *PostgresRepositorio) ProdutosDaCategoria(ctx context.Context, id uuid.UUID, incluirDescendentes bool) ([]models.Produto, error) {
+	return r.produtosDaCategoria(ctx, id, incluirDescendentes, `nome COLLATE "C"`)
+}
+
+func (r *PostgresRepositorio) produtosDaCategoria(ctx context.Context, id uuid.UUID, incluirDescendentes bool, colunaNome string) ([]models.Produto, error) {
+	db := r.db.WithContext(ctx)
+	if err := existeCategoria(ctx, db, id); err != nil {
+		if errors.Is(err, ErrCategoriaNaoEncontrada) {
+			r.logger.Error("Falha ao listar produtos da categoria", zap.Error(err), zap.String("id", id.String()))
+			return nil, fmt.Errorf("listar produtos da categoria id %s: %w", id, err)
+		}
+
+		r.logger.Error("Falha ao listar produtos da categoria no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar produtos da categoria: %w", err)
+	}
+
+	var produtos []models.Produto
+	if err := db.Raw(consultaProdutosDaCategoria(incluirDescendentes, colunaNome, "?", "?"), id, tenantDe(ctx)).Scan(&produtos).Error; err != nil {
+		r.logger.Error("Falha ao listar produtos da categoria no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar produtos da categoria: %w", err)
+	}
+
+	r.logger.Info("Listando produtos da categoria", zap.String("id", id.String()), zap.Int("total", len(produtos)))
+	return produtos, nil
+}
+
+// AtribuirCategorias substitui as categorias do produto, que fica travado
+// durante a troca.
+func (r *PostgresRepositorio) AtribuirCategorias(ctx context.Context, produtoID uuid.UUID, categorias []uuid.UUID) error {
+	categorias = normalizarCategorias(categorias)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		produto, err := travarProduto(ctx, tx, produtoID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		for _, id := range categorias {
+			if err := existeCategoria(ctx, tx, id); err != nil {
+				return fmt.Errorf("categoria %s: %w", id, err)
+			}
+		}
+		if r.escopoNome == NomeUnicoNaCategoria {
+			if err := nomeLivreNasCategorias(ctx, tx, produto.Nome, produtoID, categorias); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("DELETE FROM produto_categorias WHERE produto_id = ?", produtoID).Error; err != nil {
+			return err
+		}
+		for _, id := range categorias {
+			if err := tx.Exec("INSERT INTO produto_categorias (produto_id, categoria_id) VALUES (?, ?)", produtoID, id).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return r.falhaAtribuir(produtoID, err)
+	}
+
+	r.logger.Info("Categorias atribuídas", zap.String("id", produtoID.String()), zap.Int("total", len(categorias)))
+	return nil
+}
+
+// CategoriasDoProduto retorna os IDs das categorias do produto em ordem.
+func (r *PostgresRepositorio) CategoriasDoProduto(ctx context.Context, produtoID uuid.UUID) ([]uuid.UUID, error) {
+	db := r.db.WithContext(ctx)
+
+	var total int64
+	if err := db.Model(&models.Produto{}).Where("id = ? AND tenant_id = ?", produtoID, tenantDe(ctx)).Count(&total).Error; err != nil {
+		r.logger.Error("Falha ao consultar categorias no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar categorias: %w", err)
+	}
+	if total == 0 {
+		r.logger.Error("Falha ao consultar categorias", zap.Error(ErrProdutoNaoEncontrado), zap.String("id", produtoID.String()))
+		return nil, fmt.Errorf("consultar categorias do produto id %s: %w", produtoID, ErrProdutoNaoEncontrado)
+	}
+
+	var categorias []uuid.UUID
+	err := db.Table("produto_categorias").
+		Where("produto_id = ?", produtoID).
+		Order("categoria_id").
+		Pluck("categoria_id", &categorias).Error
+	if err != nil {
+		r.logger.Error("Falha ao consultar categorias no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar categorias: %w", err)
+	}
+	return categorias, nil
+}
+
+// existeCategoria retorna ErrCategoriaNaoEncontrada se a categoria não existe
+// no tenant do contexto.
+func existeCategoria(ctx context.Context, tx *gorm.DB, id uuid.UUID) error {
+	var total int64
+	if err := tx.Model(&models.Categoria{}).Where("id = ? AND tenant_id = ?", id, tenantDe(ctx)).Count(&total).Error; err != nil {
+		return err
+	}
+	if total == 0 {
+		return ErrCategoriaNaoEncontrada
+	}
+	return nil
+}
+
+// falhaAtribuir registra e contextualiza o erro de AtribuirCategorias.
+func (r *PostgresRepositorio) falhaAtribuir(produtoID uuid.UUID, err error) error {
+	if errors.Is(err, ErrProdutoNaoEncontrado) || errors.Is(err, ErrCategoriaNaoEncontrada) || errors.Is(err, ErrProdutoDuplicado) {
+		r.logger.Error("Falha ao atribuir categorias", zap.Error(err), zap.String("id", produtoID.String()))
+		return fmt.Errorf("atribuir categorias ao produto id %s: %w", produtoID, err)
+	}
+
+	r.logger.Error("Falha ao atribuir categorias no banco", zap.Error(err))
+	return fmt.Errorf("atribuir categorias: %w", err)
+}
+
+// DefinirEstoque fixa a quantidade em mãos com a linha do estoque travada,
+// criando-a na primeira vez.
+func (r *PostgresRepositorio) DefinirEstoque(ctx context.Context, produtoID uuid.UUID, quantidade int) (models.Estoque, error) {
+	if quantidade < 0 {
+		return models.Estoque{}, falhaEstoque(r.logger, "definir estoque do produto", produtoID, ErrQuantidadeInvalida)
+	}
+
+	var estoque models.Estoque
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := produtoAtivo(ctx, tx, produtoID); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Estoque{ProdutoID: produtoID}).Error; err != nil {
+			return err
+		}
+		var err error
+		if estoque, err = travarEstoque(tx, produtoID, time.Now()); err != nil {
+			return err
+		}
+		if quantidade < estoque.Reservado {
+			return fmt.Errorf("reservado %d: %w", estoque.Reservado, ErrEstoqueInsuficiente)
+		}
+
+		estoque.Quantidade = quantidade
+		return tx.Model(&estoque).Update("quantidade", quantidade).Error
+	})
+	if err != nil {
+		return models.Estoque{}, falhaEstoque(r.logger, "definir estoque do produto", produtoID, err)
+	}
+
+	r.logger.Info("Estoque definido", zap.String("id", produtoID.String()), zap.Int("quantidade", quantidade))
+	return estoque, nil
+}
+
+// ConsultarEstoque retorna o estoque do produto ativo.
+func (r *PostgresRepositorio) ConsultarEstoque(ctx context.Context, produtoID uuid.UUID) (models.Estoque, error) {
+	db := r.db.WithContext(ctx)
+	if err := produtoAtivo(ctx, db, produtoID); err != nil {
+		return models.Estoque{}, falhaEstoque(r.logger, "consultar estoque do produto", produtoID, err)
+	}
+
+	estoque := models.Estoque{ProdutoID: produtoID}
+	err := db.First(&estoque, "produto_id = ?", produtoID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Estoque{}, falhaEstoque(r.logger, "consultar estoque do produto", produtoID, err)
+	}
+	return estoque, nil
+}
+
+// Reservar trava a linha do estoque com SELECT ... FOR UPDATE, de modo que
+// reservas concorrentes do mesmo produto conferem o disponível uma de cada
+// vez.
+func (r *PostgresRepositorio) Reservar(ctx context.Context, produtoID uuid.UUID, quantidade int, validade time.Duration) (models.Reserva, error) {
+	if quantidade <= 0 {
+		return models.Reserva{}, falhaEstoque(r.logger, "reservar estoque do produto", produtoID, ErrQuantidadeInvalida)
+	}
+
+	reserva := novaReserva(tenantDe(ctx), produtoID, quantidade, validade)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := produtoAtivo(ctx, tx, produtoID); err != nil {
+			return err
+		}
+		estoque, err := travarEstoque(tx, produtoID, reserva.CriadaEm)
+		if err != nil {
+			return err
+		}
+		if estoque.Disponivel() < quantidade {
+			return fmt.Errorf("disponível %d: %w", estoque.Disponivel(), ErrEstoqueInsuficiente)
+		}
+
+		if err := tx.Create(&reserva).Error; err != nil {
+			return err
+		}
+		return tx.Model(&estoque).Update("reservado", estoque.Reservado+quantidade).Error
+	})
+	if err != nil {
+		return models.Reserva{}, falhaEstoque(r.logger, "reservar estoque do produto", produtoID, err)
+	}
+
+	r.logger.Info("Estoque reservado", zap.String("id", reserva.ID.String()), zap.String("produto_id", produtoID.String()), zap.Int("quantidade", quantidade))
+	return reserva, nil
+}
+
+// ConfirmarReserva baixa a reserva do estoque.
+func (r *PostgresRepositorio) ConfirmarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error) {
+	return r.encerrarReserva(ctx, id, ReservaConfirmada, "confirmar reserva")
+}
+
+// LiberarReserva devolve a reserva ao disponível.
+func (r *PostgresRepositorio) LiberarReserva(ctx context.Context, id uuid.UUID) (models.Reserva, error) {
+	return r.encerrarReserva(ctx, id, ReservaLiberada, "liberar reserva")
+}
+
+// encerrarReserva trava o estoque e depois a reserva, na mesma ordem de
+// Reservar, e a leva ao status alvo.
+func (r *PostgresRepositorio) encerrarReserva(ctx context.Context, id uuid.UUID, alvo StatusReserva, operacao string) (models.Reserva, error) {
+	var reserva models.Reserva
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&reserva, "id = ? AND tenant_id = ?", id, tenantDe(ctx)).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReservaNaoEncontrada
+		}
+		if err != nil {
+			return err
+		}
+		agora := time.Now()
+		estoque, err := travarEstoque(tx, reserva.ProdutoID, agora)
+		if err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reserva, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		mudar, err := encerrarReserva(reserva, alvo, agora)
+		if err != nil || !mudar {
+			return err
+		}
+		estoque.Reservado -= reserva.Quantidade
+		if alvo == ReservaConfirmada {
+			estoque.Quantidade -= reserva.Quantidade
+		}
+		reserva.Status = string(alvo)
+		if err := tx.Model(&reserva).Update("status", reserva.Status).Error; err != nil {
+			return err
+		}
+		return tx.Model(&estoque).Updates(map[string]any{
+			"quantidade": estoque.Quantidade,
+			"reservado":  estoque.Reservado,
+		}).Error
+	})
+	if err != nil {
+		return models.Reserva{}, falhaEstoque(r.logger, operacao, id, err)
+	}
+
+	r.logger.Info("Reserva encerrada", zap.String("id", id.String()), zap.String("status", reserva.Status))
+	return reserva, nil
+}
+
+// ExpirarReservas expira as reservas vencidas produto a produto, cada um na
+// sua transação.
+func (r *PostgresRepositorio) ExpirarReservas(ctx context.Context, agora time.Time) (int64, error) {
+	db := r.db.WithContext(ctx)
+
+	var produtos []uuid.UUID
+	err := db.Model(&models.Reserva{}).
+		Where("status = ? AND expira_em <= ?", string(ReservaPendente), agora.UTC()).
+		Distinct().
+		Pluck("produto_id", &produtos).Error
+	if err != nil {
+		r.logger.Error("Falha ao expirar reservas no banco", zap.Error(err))
+		return 0, fmt.Errorf("expirar reservas: %w", err)
+	}
+
+	var total int64
+	for _, produtoID := range produtos {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			estoque, err := travarEstoque(tx, produtoID, time.Time{})
+			if err != nil {
+				return err
+			}
+			expiradas, err := vencerReservas(tx, &estoque, agora)
+			total += expiradas
+			return err
+		})
+		if err != nil {
+			r.logger.Error("Falha ao expirar reservas no banco", zap.Error(err), zap.String("produto_id", produtoID.String()))
+			return total, fmt.Errorf("expirar reservas: %w", err)
+		}
+	}
+
+	r.logger.Info("Reservas expiradas", zap.Int64("total", total))
+	return total, nil
+}
+
+// produtoAtivo retorna ErrProdutoNaoEncontrado se o produto não existe, foi
+// removido ou pertence a outro tenant.
+func produtoAtivo(ctx context.Context, tx *gorm.DB, id uuid.UUID) error {
+	var total int64
+	if err := tx.Model(&models.Produto{}).Where("id = ? AND tenant_id = ?", id, tenantDe(ctx)).Count(&total).Error; err != nil {
+		return err
+	}
+	if total == 0 {
+		return ErrProdutoNaoEncontrado
+	}
 	return nil
 }
+
+// travarEstoque carrega o estoque do produto com SELECT ... FOR UPDATE e,
+// se agora não for zero, expira as reservas vencidas nele. Um produto sem
+// linha de estoque tem estoque zerado, que não é travado.
+func travarEstoque(tx *gorm.DB, produtoID uuid.UUID, agora time.Time) (models.Estoque, error) {
+	estoque := models.Estoque{ProdutoID: produtoID}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&estoque, "produto_id = ?", produtoID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return estoque, nil
+	}
+	if err != nil {
+		return models.Estoque{}, err
+	}
+	if !agora.IsZero() {
+		if _, err := vencerReservas(tx, &estoque, agora); err != nil {
+			return models.Estoque{}, err
+		}
+	}
+	return estoque, nil
+}
+
+// vencerReservas marca como expiradas as reservas pendentes do estoque,
+// já travado, vencidas em agora e desconta-as do reservado.
+func vencerReservas(tx *gorm.DB, estoque *models.Estoque, agora time.Time) (int64, error) {
+	var vencidas []models.Reserva
+	err := tx.Where("produto_id = ? AND status = ? AND expira_em <= ?", estoque.ProdutoID, string(ReservaPendente), agora.UTC()).
+		Find(&vencidas).Error
+	if err != nil || len(vencidas) == 0 {
+		return 0, err
+	}
+
+	ids := make([]uuid.UUID, len(vencidas))
+	for i, reserva := range vencidas {
+		ids[i] = reserva.ID
+		estoque.Reservado -= reserva.Quantidade
+	}
+	if err := tx.Model(&models.Reserva{}).Where("id IN ?", ids).Update("status", string(ReservaExpirada)).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(estoque).Update("reservado", estoque.Reservado).Error; err != nil {
+		return 0, err
+	}
+	return int64(len(vencidas)), nil
+}
+
+// falhaEstoque registra e contextualiza o erro de uma operação de estoque,
+// preservando os sentinelas. Também serve PgxRepositorio.
+func falhaEstoque(logger *zap.Logger, operacao string, id uuid.UUID, err error) error {
+	for _, sentinela := range []error{ErrProdutoNaoEncontrado, ErrQuantidadeInvalida, ErrEstoqueInsuficiente, ErrReservaNaoEncontrada, ErrReservaExpirada, ErrReservaEncerrada} {
+		if errors.Is(err, sentinela) {
+			logger.Error("Falha ao "+operacao, zap.Error(err), zap.String("id", id.String()))
+			return fmt.Errorf("%s id %s: %w", operacao, id, err)
+		}
+	}
+
+	logger.Error("Falha ao "+operacao+" no banco", zap.Error(err))
+	return fmt.Errorf("%s: %w", operacao, err)
+}
+
+// CriarPedido lê os produtos e grava o pedido com seus itens na mesma
+// transação.
+func (r *PostgresRepositorio) CriarPedido(ctx context.Context, itens []ItemSolicitado) (models.Pedido, error) {
+	var pedido models.Pedido
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		pedido, err = novoPedido(tenantDe(ctx), itens, func(id uuid.UUID) (models.Produto, error) {
+			var produto models.Produto
+			err := tx.First(&produto, "id = ? AND tenant_id = ?", id, tenantDe(ctx)).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.Produto{}, ErrProdutoNaoEncontrado
+			}
+			return produto, err
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Create(&pedido).Error
+	})
+	if err != nil {
+		return models.Pedido{}, falhaCriarPedido(r.logger, err)
+	}
+
+	r.logger.Info("Pedido criado", zap.String("id", pedido.ID.String()), zap.Int("itens", len(pedido.Itens)), zap.Stringer("total", pedido.Total))
+	return pedido, nil
+}
+
+// BuscarPedido recupera o pedido com seus itens.
+func (r *PostgresRepositorio) BuscarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	var pedido models.Pedido
+	if err := r.db.WithContext(ctx).Preload("Itens", ordenarItens).First(&pedido, "id = ? AND tenant_id = ?", id, tenantDe(ctx)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			r.logger.Error("Falha ao buscar pedido", zap.Error(ErrPedidoNaoEncontrado), zap.String("id", id.String()))
+			return models.Pedido{}, fmt.Errorf("buscar pedido id %s: %w", id, ErrPedidoNaoEncontrado)
+		}
+
+		r.logger.Error("Falha ao buscar pedido no banco", zap.Error(err))
+		return models.Pedido{}, fmt.Errorf("buscar pedido: %w", err)
+	}
+
+	r.logger.Info("Pedido encontrado", zap.String("id", id.String()))
+	return pedido, nil
+}
+
+// ListarPedidos retorna os pedidos mais recentes primeiro, carregando os
+// itens de todos numa segunda consulta.
+func (r *PostgresRepositorio) ListarPedidos(ctx context.Context, status StatusPedido, limite int) ([]models.Pedido, error) {
+	if err := validarStatusPedido(status); err != nil {
+		r.logger.Error("Falha ao listar pedidos", zap.Error(err))
+		return nil, fmt.Errorf("listar pedidos: %w", err)
+	}
+
+	query := r.db.WithContext(ctx).Preload("Itens", ordenarItens).Where("tenant_id = ?", tenantDe(ctx))
+	if status != "" {
+		query = query.Where("status = ?", string(status))
+	}
+
+	var pedidos []models.Pedido
+	err := query.Order("criado_em DESC, id DESC").Limit(normalizarLimite(limite)).Find(&pedidos).Error
+	if err != nil {
+		r.logger.Error("Falha ao listar pedidos no banco", zap.Error(err))
+		return nil, fmt.Errorf("listar pedidos: %w", err)
+	}
+
+	r.logger.Info("Listando pedidos", zap.Int("total", len(pedidos)))
+	return pedidos, nil
+}
+
+// PagarPedido leva um pedido criado a pago.
+func (r *PostgresRepositorio) PagarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoPago, "pagar pedido")
+}
+
+// EnviarPedido leva um pedido pago a enviado.
+func (r *PostgresRepositorio) EnviarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoEnviado, "enviar pedido")
+}
+
+// CancelarPedido cancela um pedido ainda não enviado.
+func (r *PostgresRepositorio) CancelarPedido(ctx context.Context, id uuid.UUID) (models.Pedido, error) {
+	return r.mudarStatusPedido(ctx, id, PedidoCancelado, "cancelar pedido")
+}
+
+// mudarStatusPedido trava o pedido com SELECT ... FOR UPDATE, de modo que
+// transições concorrentes são decididas uma de cada vez.
+func (r *PostgresRepositorio) mudarStatusPedido(ctx context.Context, id uuid.UUID, alvo StatusPedido, operacao string) (models.Pedido, error) {
+	var pedido models.Pedido
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pedido, "id = ? AND tenant_id = ?", id, tenantDe(ctx)).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPedidoNaoEncontrado
+		}
+		if err != nil {
+			return err
+		}
+
+		mudar, err := transicaoPedido(StatusPedido(pedido.Status), alvo)
+		if err != nil {
+			return err
+		}
+		if mudar {
+			pedido.Status = string(alvo)
+			pedido.AtualizadoEm = time.Now().UTC()
+			err := tx.Model(&pedido).Updates(map[string]any{
+				"status":        pedido.Status,
+				"atualizado_em": pedido.AtualizadoEm,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return ordenarItens(tx.Where("pedido_id = ?", id)).Find(&pedido.Itens).Error
+	})
+	if err != nil {
+		return models.Pedido{}, falhaPedido(r.logger, operacao, id, err)
+	}
+
+	r.logger.Info("Status do pedido alterado", zap.String("id", id.String()), zap.String("status", pedido.Status))
+	return pedido, nil
+}
+
+// ordenarItens mantém os itens na ordem em que foram pedidos.
+func ordenarItens(db *gorm.DB) *gorm.DB {
+	return db.Order("posicao")
+}
+
+// falhaCriarPedido registra e contextualiza o erro de CriarPedido,
+// preservando os sentinelas. Também serve PgxRepositorio.
+func falhaCriarPedido(logger *zap.Logger, err error) error {
+	for _, sentinela := range []error{ErrPedidoVazio, ErrQuantidadeInvalida, ErrProdutoNaoEncontrado, models.ErrValorMonetarioInvalido} {
+		if errors.Is(err, sentinela) {
+			logger.Error("Falha ao criar pedido", zap.Error(err))
+			return fmt.Errorf("criar pedido: %w", err)
+		}
+	}
+
+	logger.Error("Falha ao criar pedido no banco", zap.Error(err))
+	return fmt.Errorf("criar pedido: %w", err)
+}
+
+// falhaPedido registra e contextualiza o erro de uma mudança de status do
+// pedido, preservando os sentinelas. Também serve PgxRepositorio.
+func falhaPedido(logger *zap.Logger, operacao string, id uuid.UUID, err error) error {
+	if errors.Is(err, ErrPedidoNaoEncontrado) || errors.Is(err, ErrTransicaoInvalida) {
+		logger.Error("Falha ao "+operacao, zap.Error(err), zap.String("id", id.String()))
+		return fmt.Errorf("%s id %s: %w", operacao, id, err)
+	}
+
+	logger.Error("Falha ao "+operacao+" no banco", zap.Error(err))
+	return fmt.Errorf("%s: %w", operacao, err)
+}
+
+// DefinirEixos grava os eixos com o produto travado, o que serializa a troca
+// com a criação de variantes.
+func (r *PostgresRepositorio) DefinirEixos(ctx context.Context, produtoID uuid.UUID, eixos []models.EixoVariante) (models.Grade, error) {
+	if err := validarEixos(eixos); err != nil {
+		return models.Grade{}, falhaVariante(r.logger, "definir eixos do produto", "id", produtoID.String(), err)
+	}
+
+	grade := models.Grade{ProdutoID: produtoID, Eixos: eixos}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := travarProduto(ctx, tx, produtoID, QualquerVersao); err != nil {
+			return err
+		}
+		var variante, filhos int64
+		if err := tx.Model(&models.Variante{}).Where("produto_id = ?", produtoID).Count(&variante).Error; err != nil {
+			return err
+		}
+		if variante > 0 {
+			return fmt.Errorf("produto é uma variante: %w", ErrEixosInvalidos)
+		}
+		if err := tx.Model(&models.Variante{}).Where("pai_id = ?", produtoID).Count(&filhos).Error; err != nil {
+			return err
+		}
+		if filhos > 0 {
+			return ErrGradeComVariantes
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "produto_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"eixos"}),
+		}).Create(&grade).Error
+	})
+	if err != nil {
+		return models.Grade{}, falhaVariante(r.logger, "definir eixos do produto", "id", produtoID.String(), err)
+	}
+
+	r.logger.Info("Eixos definidos", zap.String("id", produtoID.String()), zap.Int("eixos", len(eixos)))
+	grade.Variantes = []models.Variante{}
+	return grade, nil
+}
+
+// CriarVariante grava o produto filho, seu histórico e a ligação ao pai na
+// mesma transação. O pai fica travado, então duas variantes dele não
+// disputam a mesma combinação; as restrições únicas da tabela variantes
+// barram o que escapar às verificações.
+func (r *PostgresRepositorio) CriarVariante(ctx context.Context, paiID uuid.UUID, nova NovaVariante) (models.Variante, error) {
+	var variante models.Variante
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		pai, err := travarProduto(ctx, tx, paiID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		var grade models.Grade
+		if err := tx.First(&grade, "produto_id = ?", paiID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProdutoSemEixos
+			}
+			return err
+		}
+		if err := validarVariante(grade.Eixos, nova); err != nil {
+			return err
+		}
+		opcoes, err := combinacao(nova.Opcoes)
+		if err != nil {
+			return err
+		}
+		var total int64
+		if err := tx.Model(&models.Variante{}).Where("tenant_id = ? AND sku = ?", tenantDe(ctx), nova.SKU).Count(&total).Error; err != nil {
+			return err
+		}
+		if total > 0 {
+			return ErrSKUDuplicado
+		}
+		if err := tx.Model(&models.Variante{}).Where("pai_id = ? AND opcoes = ?", paiID, opcoes).Count(&total).Error; err != nil {
+			return err
+		}
+		if total > 0 {
+			return ErrCombinacaoDuplicada
+		}
+
+		produto := models.Produto{TenantID: tenantDe(ctx), Nome: nomeVariante(pai, grade.Eixos, nova.Opcoes), Preco: nova.Preco, Versao: 1}
+		if err := r.nomeLivre(ctx, tx, produto.Nome, uuid.Nil); err != nil {
+			return err
+		}
+		err = r.gravarNome(ctx, tx, produto.Nome, uuid.Nil, func(tx *gorm.DB) error {
+			return r.inserirProduto(ctx, tx, &produto)
+		})
+		if err != nil {
+			return err
+		}
+		if err := registrarHistorico(ctx, tx, OperacaoCriar, nil, &produto); err != nil {
+			return err
+		}
+		variante = models.Variante{ProdutoID: produto.ID, PaiID: paiID, TenantID: produto.TenantID, SKU: nova.SKU, Opcoes: nova.Opcoes}
+		if err := tx.Create(&variante).Error; err != nil {
+			return err
+		}
+		variante.Produto = &produto
+		return nil
+	})
+	if err != nil {
+		return models.Variante{}, falhaVariante(r.logger, "criar variante do produto", "id", paiID.String(), err)
+	}
+
+	r.logger.Info("Variante criada", zap.String("id", variante.ProdutoID.String()), zap.String("pai_id", paiID.String()), zap.String("sku", nova.SKU))
+	return variante, nil
+}
+
+// Grade lê os eixos e as variantes do produto e completa cada variante com
+// seu produto ativo.
+func (r *PostgresRepositorio) Grade(ctx context.Context, produtoID uuid.UUID) (models.Grade, error) {
+	db := r.db.WithContext(ctx)
+	grade := models.Grade{ProdutoID: produtoID, Eixos: []models.EixoVariante{}, Variantes: []models.Variante{}}
+	err := produtoAtivo(ctx, db, produtoID)
+	if err == nil {
+		err = db.Where("produto_id = ?", produtoID).Limit(1).Find(&grade).Error
+	}
+	var variantes []models.Variante
+	if err == nil {
+		err = db.Where("pai_id = ?", produtoID).Find(&variantes).Error
+	}
+	if err == nil {
+		grade.Variantes, err = completarVariantes(ctx, db, variantes)
+	}
+	if err != nil {
+		return models.Grade{}, falhaVariante(r.logger, "consultar grade do produto", "id", produtoID.String(), err)
+	}
+	ordenarVariantes(grade.Eixos, grade.Variantes)
+
+	r.logger.Info("Grade consultada", zap.String("id", produtoID.String()), zap.Int("variantes", len(grade.Variantes)))
+	return grade, nil
+}
+
+// BuscarSKU retorna a variante ativa com o código SKU.
+func (r *PostgresRepositorio) BuscarSKU(ctx context.Context, sku string) (models.Variante, error) {
+	db := r.db.WithContext(ctx)
+	var variantes []models.Variante
+	err := db.Where("tenant_id = ? AND sku = ?", tenantDe(ctx), sku).Find(&variantes).Error
+	if err == nil {
+		variantes, err = completarVariantes(ctx, db, variantes)
+	}
+	if err == nil && len(variantes) == 0 {
+		err = ErrVarianteNaoEncontrada
+	}
+	if err != nil {
+		return models.Variante{}, falhaVariante(r.logger, "buscar variante", "sku", sku, err)
+	}
+
+	r.logger.Info("Variante encontrada", zap.String("sku", sku))
+	return variantes[0], nil
+}
+
+// completarVariantes preenche o produto de cada variante, descartando as de
+// produto removido.
+func completarVariantes(ctx context.Context, db *gorm.DB, variantes []models.Variante) ([]models.Variante, error) {
+	completas := []models.Variante{}
+	if len(variantes) == 0 {
+		return completas, nil
+	}
+	ids := make([]uuid.UUID, len(variantes))
+	for i, v := range variantes {
+		ids[i] = v.ProdutoID
+	}
+	var produtos []models.Produto
+	if err := db.Where("id IN ? AND tenant_id = ?", ids, tenantDe(ctx)).Find(&produtos).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range variantes {
+		if i := slices.IndexFunc(produtos, func(p models.Produto) bool { return p.ID == v.ProdutoID }); i >= 0 {
+			v.Produto = &produtos[i]
+			completas = append(completas, v)
+		}
+	}
+	return completas, nil
+}
+
+// falhaVariante registra e contextualiza o erro de uma operação de
+// variantes, preservando os sentinelas. Também serve PgxRepositorio.
+func falhaVariante(logger *zap.Logger, operacao, campo, valor string, err error) error {
+	for _, sentinela := range []error{
+		ErrProdutoNaoEncontrado, ErrEixosInvalidos, ErrOpcoesInvalidas, ErrSKUInvalido, ErrSKUDuplicado,
+		ErrCombinacaoDuplicada, ErrProdutoSemEixos, ErrGradeComVariantes, ErrVarianteNaoEncontrada, ErrPrecoInvalido,
+		ErrProdutoDuplicado,
+	} {
+		if errors.Is(err, sentinela) {
+			logger.Error("Falha ao "+operacao, zap.Error(err), zap.String(campo, valor))
+			return fmt.Errorf("%s %s %s: %w", operacao, campo, valor, err)
+		}
+	}
+
+	logger.Error("Falha ao "+operacao+" no banco", zap.Error(err))
+	return fmt.Errorf("%s: %w", operacao, err)
+}
+
+// AgendarPreco grava o agendamento com o produto travado, reaproveitando o
+// ID de um agendamento pendente para o mesmo instante.
+func (r *PostgresRepositorio) AgendarPreco(ctx context.Context, produtoID uuid.UUID, preco models.Dinheiro, vigenteDe time.Time) (models.PrecoProduto, error) {
+	if err := validarAgendamento(preco, vigenteDe, time.Now()); err != nil {
+		return models.PrecoProduto{}, falhaPreco(r.logger, "agendar preço do produto", produtoID, err)
+	}
+
+	agendado := models.PrecoProduto{ID: uuid.New(), ProdutoID: produtoID, Preco: preco, VigenteDe: vigenteDe.UTC(), Agendado: true}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		produto, err := travarProduto(ctx, tx, produtoID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		agendado.TenantID = produto.TenantID
+
+		var pendentes []models.PrecoProduto
+		if err := tx.Where("produto_id = ? AND agendado = ? AND vigente_de = ?", produtoID, true, agendado.VigenteDe).Find(&pendentes).Error; err != nil {
+			return err
+		}
+		if len(pendentes) > 0 {
+			agendado.ID = pendentes[0].ID
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&agendado).Error
+	})
+	if err != nil {
+		return models.PrecoProduto{}, falhaPreco(r.logger, "agendar preço do produto", produtoID, err)
+	}
+
+	r.logger.Info("Preço agendado", zap.String("id", produtoID.String()), zap.Stringer("preco", preco), zap.Time("vigente_de", vigenteDe))
+	return agendado, nil
+}
+
+// Precos retorna a linha do tempo do produto em ordem de VigenteDe.
+func (r *PostgresRepositorio) Precos(ctx context.Context, produtoID uuid.UUID) ([]models.PrecoProduto, error) {
+	var precos []models.PrecoProduto
+	err := r.db.WithContext(ctx).
+		Where("produto_id = ? AND tenant_id = ?", produtoID, tenantDe(ctx)).
+		Order("vigente_de, id").
+		Find(&precos).Error
+	if err == nil && len(precos) == 0 {
+		err = ErrProdutoNaoEncontrado
+	}
+	if err != nil {
+		return nil, falhaPreco(r.logger, "consultar preços do produto", produtoID, err)
+	}
+
+	r.logger.Info("Preços consultados", zap.String("id", produtoID.String()), zap.Int("total", len(precos)))
+	return precos, nil
+}
+
+// AplicarPrecosAgendados aplica cada preço na sua transação, com o produto
+// travado. O agendamento é relido sob a trava, então instâncias que rodem o
+// agendador ao mesmo tempo não aplicam o mesmo preço duas vezes.
+func (r *PostgresRepositorio) AplicarPrecosAgendados(ctx context.Context, agora time.Time) ([]models.PrecoProduto, error) {
+	db := r.db.WithContext(ctx)
+
+	var devidos []models.PrecoProduto
+	err := db.Where("agendado = ? AND vigente_de <= ?", true, agora.UTC()).Order("vigente_de, id").Find(&devidos).Error
+	if err != nil {
+		r.logger.Error("Falha ao aplicar preços agendados no banco", zap.Error(err))
+		return nil, fmt.Errorf("aplicar preços agendados: %w", err)
+	}
+
+	aplicados := []models.PrecoProduto{}
+	for _, p := range devidos {
+		aplicado := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			antes, err := travarProduto(ComTenant(ctx, p.TenantID), tx, p.ProdutoID, QualquerVersao)
+			if errors.Is(err, ErrProdutoNaoEncontrado) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var pendentes int64
+			if err := tx.Model(&models.PrecoProduto{}).Where("id = ? AND agendado = ?", p.ID, true).Count(&pendentes).Error; err != nil || pendentes == 0 {
+				return err
+			}
+
+			produto := antes
+			produto.Preco = p.Preco
+			produto.Versao++
+			if err := tx.Model(&produto).Updates(map[string]any{"preco": produto.Preco, "versao": produto.Versao}).Error; err != nil {
+				return err
+			}
+			h := novoHistorico(ctx, OperacaoAtualizar, &antes, &produto)
+			if err := gravarHistorico(tx, h); err != nil {
+				return err
+			}
+			p.Agendado, p.VigenteDe = false, h.RegistradoEm
+			aplicado = true
+			return abrirVigencia(tx, p)
+		})
+		if err != nil {
+			r.logger.Error("Falha ao aplicar preços agendados no banco", zap.Error(err), zap.String("produto_id", p.ProdutoID.String()))
+			return aplicados, fmt.Errorf("aplicar preços agendados: %w", err)
+		}
+		if aplicado {
+			aplicados = append(aplicados, p)
+		}
+	}
+
+	r.logger.Info("Preços agendados aplicados", zap.Int("total", len(aplicados)))
+	return aplicados, nil
+}
+
+// falhaPreco registra e contextualiza o erro de uma operação de preços,
+// preservando os sentinelas. Também serve PgxRepositorio.
+func falhaPreco(logger *zap.Logger, operacao string, id uuid.UUID, err error) error {
+	for _, sentinela := range []error{ErrProdutoNaoEncontrado, ErrPrecoInvalido, ErrAgendamentoInvalido} {
+		if errors.Is(err, sentinela) {
+			logger.Error("Falha ao "+operacao, zap.Error(err), zap.String("id", id.String()))
+			return fmt.Errorf("%s id %s: %w", operacao, id, err)
+		}
+	}
+
+	logger.Error("Falha ao "+operacao+" no banco", zap.Error(err))
+	return fmt.Errorf("%s: %w", operacao, err)
+}
+
+// AdicionarImagem grava a imagem com o produto travado, para que ela não
+// seja registrada num produto que está sendo removido.
+func (r *PostgresRepositorio) AdicionarImagem(ctx context.Context, imagem models.Imagem) (models.Imagem, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		produto, err := travarProduto(ctx, tx, imagem.ProdutoID, QualquerVersao)
+		if err != nil {
+			return err
+		}
+		imagem.TenantID, imagem.CriadaEm = produto.TenantID, time.Now().UTC()
+		return tx.Create(&imagem).Error
+	})
+	if err != nil {
+		return models.Imagem{}, falhaImagem(r.logger, "adicionar imagem ao produto", imagem.ProdutoID, err)
+	}
+
+	r.logger.Info("Imagem adicionada", zap.String("id", imagem.ProdutoID.String()), zap.String("imagem_id", imagem.ID.String()))
+	return imagem, nil
+}
+
+// Imagens retorna as imagens dos produtos ativos em uma única consulta.
+func (r *PostgresRepositorio) Imagens(ctx context.Context, produtoIDs []uuid.UUID) (map[uuid.UUID][]models.Imagem, error) {
+	imagens := make(map[uuid.UUID][]models.Imagem)
+	if len(produtoIDs) == 0 {
+		return imagens, nil
+	}
+
+	var lista []models.Imagem
+	err := r.db.WithContext(ctx).
+		Where("produto_id IN (SELECT id FROM produtos WHERE id IN ? AND tenant_id = ? AND deleted_at IS NULL)", produtoIDs, tenantDe(ctx)).
+		Order("criada_em, id").
+		Find(&lista).Error
+	if err != nil {
+		r.logger.Error("Falha ao consultar imagens no banco", zap.Error(err))
+		return nil, fmt.Errorf("consultar imagens: %w", err)
+	}
+	for _, imagem := range lista {
+		imagens[imagem.ProdutoID] = append(imagens[imagem.ProdutoID], imagem)
+	}
+
+	r.logger.Info("Imagens consultadas", zap.Int("produtos", len(produtoIDs)), zap.Int("com_imagens", len(imagens)))
+	return imagens, nil
+}
+
+// RemoverImagem exclui a imagem com o produto travado.
+func (r *PostgresRepositorio) RemoverImagem(ctx context.Context, produtoID, imagemID uuid.UUID) (models.Imagem, error) {
+	var imagem models.Imagem
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := travarProduto(ctx, tx, produtoID, QualquerVersao); err != nil {
+			return err
+		}
+		err := tx.First(&imagem, "id = ? AND produto_id = ?", imagemID, produtoID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrImagemNaoEncontrada
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&imagem).Error
+	})
+	if err != nil {
+		return models.Imagem{}, falhaImagem(r.logger, "remover imagem do produto", produtoID, err)
+	}
+
+	r.logger.Info("Imagem removida", zap.String("id", produtoID.String()), zap.String("imagem_id", imagemID.String()))
+	return imagem, nil
+}
+
+// ExpurgarImagens lê e exclui as imagens numa mesma transação.
+func (r *PostgresRepositorio) ExpurgarImagens(ctx context.Context, removidosAntesDe time.Time) ([]models.Imagem, error) {
+	expurgadas := []models.Imagem{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("produto_id IN (SELECT id FROM produtos WHERE deleted_at < ?)", removidosAntesDe).
+			Find(&expurgadas).Error
+		if err != nil || len(expurgadas) == 0 {
+			return err
+		}
+		ids := make([]uuid.UUID, len(expurgadas))
+		for i, imagem := range expurgadas {
+			ids[i] = imagem.ID
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.Imagem{}).Error
+	})
+	if err != nil {
+		r.logger.Error("Falha ao expurgar imagens no banco", zap.Error(err))
+		return nil, fmt.Errorf("expurgar imagens: %w", err)
+	}
+
+	r.logger.Info("Imagens expurgadas", zap.Int("total", len(expurgadas)), zap.Time("removidos_antes_de", removidosAntesDe))
+	return expurgadas, nil
+}
+
+// ExpurgarImagensDoProduto lê e exclui as imagens com o produto removido
+// travado, o que impede uma restauração concorrente de vê-las pela metade.
+func (r *PostgresRepositorio) ExpurgarImagensDoProduto(ctx context.Context, produtoID uuid.UUID) ([]models.Imagem, error) {
+	expurgadas := []models.Imagem{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var produto models.Produto
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&produto, "id = ? AND tenant_id = ?", produtoID, tenantDe(ctx)).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !produto.RemovidoEm.Valid) {
+			return ErrProdutoNaoEncontrado
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("produto_id = ?", produtoID).Order("criada_em, id").Find(&expurgadas).Error; err != nil {
+			return err
+		}
+		return tx.Where("produto_id = ?", produtoID).Delete(&models.Imagem{}).Error
+	})
+	if err != nil {
+		return nil, falhaImagem(r.logger, "expurgar imagens do produto", produtoID, err)
+	}
+
+	r.logger.Info("Imagens do produto expurgadas", zap.String("id", produtoID.String()), zap.Int("total", len(expurgadas)))
+	return expurgadas, nil
+}
+
+// falhaImagem registra e contextualiza o erro de uma operação de imagens,
+// preservando os sentinelas. Também serve PgxRepositorio.
+func falhaImagem(logger *zap.Logger, operacao string, id uuid.UUID, err error) error {
+	for _, sentinela := range []error{ErrProdutoNaoEncontrado, ErrImagemNaoEncontrada} {
+		if errors.Is(err, sentinela) {
+			logger.Error("Falha ao "+operacao, zap.Error(err), zap.String("id", id.String()))
+			return fmt.Errorf("%s id %s: %w", operacao, id, err)
+		}
+	}
+
+	logger.Error("Falha ao "+operacao+" no banco", zap.Error(err))
+	return fmt.Errorf("%s: %w", operacao, err)
+}
+
+// travarProduto carrega o produto ativo do tenant do contexto com SELECT ...
+// FOR UPDATE e confere a versão esperada, serializando escritas concorrentes
+// sobre a mesma linha.
+func travarProduto(ctx context.Context, tx *gorm.DB, id uuid.UUID, versao int) (models.Produto, error) {
+	var produto models.Produto
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&produto, "id = ? AND tenant_id = ?", id, tenantDe(ctx)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Produto{}, ErrProdutoNaoEncontrado
+	}
+	if err != nil {
+		return models.Produto{}, err
+	}
+	if versao != QualquerVersao && produto.Versao != versao {
+		return models.Produto{}, ErrConflitoDeVersao
+	}
+	return produto, nil
+}
+
+// indiceNomeUnico garante os nomes únicos dos produtos ativos gravados com
+// NomeUnicoNoTenant.
+const indiceNomeUnico = "produtos_tenant_nome_unico_idx"
+
+// violacaoUnica é o SQLSTATE unique_violation do PostgreSQL.
+const violacaoUnica = "23505"
+
+// linhaProduto grava o produto junto das colunas da unicidade do nome, que
+// ficam fora do modelo.
+type linhaProduto struct {
+	models.Produto
+	NomeNormalizado string
+	EscopoNome      EscopoNome
+}
+
+func (linhaProduto) TableName() string {
+	return "produtos"
+}
+
+// inserirProduto cria o produto com o nome normalizado e o escopo do
+// repositório.
+func (r *PostgresRepositorio) inserirProduto(ctx context.Context, tx *gorm.DB, produto *models.Produto) error {
+	linha := linhaProduto{Produto: *produto, NomeNormalizado: normalizarNome(produto.Nome), EscopoNome: r.escopoNome}
+	if err := tx.Create(&linha).Error; err != nil {
+		return err
+	}
+	*produto = linha.Produto
+	return nil
+}
+
+// colunasNome são as colunas a gravar quando o produto passa a ocupar o
+// nome, por ser renomeado ou restaurado.
+func (r *PostgresRepositorio) colunasNome(ctx context.Context, nome string) map[string]any {
+	return map[string]any{
+		"nome_normalizado": normalizarNome(nome),
+		"escopo_nome":      r.escopoNome,
+	}
+}
+
+// nomeLivre confere que nenhum outro produto ativo do tenant do contexto usa
+// o nome no escopo do repositório, para que a recusa traga o produto existente.
+// No escopo por categoria, valem as categorias atuais do produto id.
+func (r *PostgresRepositorio) nomeLivre(ctx context.Context, tx *gorm.DB, nome string, id uuid.UUID) error {
+	if r.escopoNome == NomeUnicoNoTenant {
+		return nomeEmUso(ctx, tx, nome, id)
+	}
+	var categorias []uuid.UUID
+	if err := tx.Table("produto_categorias").Where("produto_id = ?", id).Pluck("categoria_id", &categorias).Error; err != nil {
+		return err
+	}
+	return nomeLivreNasCategorias(ctx, tx, nome, id, categorias)
+}
+
+// nomeLivreNasCategorias confere o nome entre os produtos ativos das
+// categorias, que ficam travadas até o fim da transação: sem um índice que
+// cubra o escopo por categoria, é o lock que serializa as escritas
+// concorrentes nelas.
+func nomeLivreNasCategorias(ctx context.Context, tx *gorm.DB, nome string, id uuid.UUID, categorias []uuid.UUID) error {
+	if len(categorias) == 0 {
+		return nil
+	}
+	var travadas []uuid.UUID
+	err := tx.Model(&models.Categoria{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", categorias).Order("id").Pluck("id", &travadas).Error
+	if err != nil {
+		return err
+	}
+	return nomeEmUso(ctx, tx.Where("id IN (SELECT produto_id FROM produto_categorias WHERE categoria_id IN ?)", categorias), nome, id)
+}
+
+// nomeEmUso procura, entre os produtos ativos do tenant do contexto
+// selecionados por consulta, outro com o mesmo nome normalizado.
+func nomeEmUso(ctx context.Context, consulta *gorm.DB, nome string, id uuid.UUID) error {
+	var existentes []uuid.UUID
+	err := consulta.Model(&models.Produto{}).
+		Where("tenant_id = ? AND nome_normalizado = ? AND id <> ?", tenantDe(ctx), normalizarNome(nome), id).
+		Limit(1).Pluck("id", &existentes).Error
+	if err != nil {
+		return err
+	}
+	if len(existentes) > 0 {
+		return &ProdutoDuplicadoError{Nome: nome, ExistenteID: existentes[0]}
+	}
+	return nil
+}
+
+// gravarNome executa gravar num savepoint. Se uma escrita concorrente tomou o
+// nome depois de nomeLivre, só o savepoint é desfeito e nomeLivre é repetida
+// para que a recusa traga o produto que ficou com o nome.
+func (r *PostgresRepositorio) gravarNome(ctx context.Context, tx *gorm.DB, nome string, id uuid.UUID, gravar func(tx *gorm.DB) error) error {
+	err := tx.Transaction(gravar)
+	if !r.violaNomeUnico(err) {
+		return err
+	}
+	if err := r.nomeLivre(ctx, tx, nome, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrProdutoDuplicado, err)
+}
+
+// violaNomeUnicoPostgres informa se err é a violação de indiceNomeUnico,
+// pelo SQLSTATE e pelo nome da restrição que o PostgreSQL informa.
+func violaNomeUnicoPostgres(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == violacaoUnica && pgErr.ConstraintName == indiceNomeUnico
+}
+
+// PreencherNomesNormalizados grava nome_normalizado nos produtos que as
+// migrações deixaram sem ele, com a mesma normalizarNome das escritas, para
+// que só o Go normalize nomes. Se a normalização iguala o nome de produtos
+// ativos que o lower() do banco distinguia, o de menor ID fica com o nome e
+// os demais ganham o próprio ID como sufixo e uma nova versão, como na
+// migração do índice único. Deve rodar depois das migrações e antes de o
+// banco receber escritas.
+func PreencherNomesNormalizados(ctx context.Context, db *gorm.DB) error {
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pendentes []models.Produto
+		if err := tx.Unscoped().Where("nome_normalizado IS NULL").Order("id").Find(&pendentes).Error; err != nil {
+			return err
+		}
+		for _, p := range pendentes {
+			valores := map[string]any{"nome_normalizado": normalizarNome(p.Nome)}
+			if !p.RemovidoEm.Valid {
+				var repetidos int64
+				err := tx.Model(&models.Produto{}).
+					Where("tenant_id = ? AND nome_normalizado = ? AND escopo_nome = ?", p.TenantID, normalizarNome(p.Nome), NomeUnicoNoTenant).
+					Count(&repetidos).Error
+				if err != nil {
+					return err
+				}
+				if repetidos > 0 {
+					nome := fmt.Sprintf("%s (%s)", truncarNome(p.Nome, 216), p.ID)
+					valores = map[string]any{"nome": nome, "nome_normalizado": normalizarNome(nome), "versao": p.Versao + 1}
+				}
+			}
+			if err := tx.Unscoped().Model(&models.Produto{}).Where("id = ?", p.ID).UpdateColumns(valores).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("preencher nomes normalizados: %w", err)
+	}
+	return nil
+}
+
+// registrarHistorico grava a alteração, o evento que a anuncia na outbox e,
+// se o preço mudou, o período de preço que ela abre, tudo na transação da
+// própria alteração.
+func registrarHistorico(ctx context.Context, tx *gorm.DB, operacao TipoOperacao, antes, depois *models.Produto) error {
+	h := novoHistorico(ctx, operacao, antes, depois)
+	if err := gravarHistorico(tx, h); err != nil {
+		return err
+	}
+	if !mudouPreco(antes, depois) {
+		return nil
+	}
+	return abrirVigencia(tx, novaVigencia(h))
+}
+
+// gravarHistorico grava a entrada de histórico e o evento que a anuncia.
+func gravarHistorico(tx *gorm.DB, h models.HistoricoProduto) error {
+	if err := tx.Create(&h).Error; err != nil {
+		return fmt.Errorf("registrar histórico: %w", err)
+	}
+	evento := novoEvento(h)
+	if err := tx.Create(&evento).Error; err != nil {
+		return fmt.Errorf("registrar evento: %w", err)
+	}
+	return nil
+}
+
+// abrirVigencia fecha o período em vigor do produto no início de v e grava
+// v, que pode ser um agendamento passando a valer.
+func abrirVigencia(tx *gorm.DB, v models.PrecoProduto) error {
+	err := tx.Model(&models.PrecoProduto{}).
+		Where("produto_id = ? AND agendado = ? AND vigente_ate IS NULL", v.ProdutoID, false).
+		Update("vigente_ate", v.VigenteDe).Error
+	if err != nil {
+		return fmt.Errorf("registrar preço: %w", err)
+	}
+	if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&v).Error; err != nil {
+		return fmt.Errorf("registrar preço: %w", err)
+	}
+	return nil
+}
+
+// falhaEscrita registra e contextualiza o erro de uma escrita, preservando os
+// sentinelas de produto inexistente e de conflito de versão.
+func (r *PostgresRepositorio) falhaEscrita(operacao string, id uuid.UUID, versao int, err error) error {
+	switch {
+	case errors.Is(err, ErrProdutoNaoEncontrado), errors.Is(err, ErrProdutoDuplicado):
+		r.logger.Error("Falha ao "+operacao+" produto", zap.Error(err), zap.String("id", id.String()))
+		return fmt.Errorf("%s produto id %s: %w", operacao, id, err)
+	case errors.Is(err, ErrConflitoDeVersao):
+		r.logger.Error("Falha ao "+operacao+" produto", zap.Error(err), zap.String("id", id.String()), zap.Int("versao", versao))
+		return fmt.Errorf("%s produto id %s versão %d: %w", operacao, id, versao, err)
+	default:
+		r.logger.Error("Falha ao "+operacao+" produto no banco", zap.Error(err))
+		return fmt.Errorf("%s produto: %w", operacao, err)
+	}
+}
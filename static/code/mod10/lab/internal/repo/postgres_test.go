@@ -1,82 +1,124 @@
-package repo
+package repo_test
 
 import (
-	"log/slog"
-	"os"
 	"testing"
 
-	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/internal/repo/repotest"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+const dsnTeste = "host=localhost user=postgres password=secret dbname=mydb port=5432 sslmode=disable"
+
+// abrirPostgres conecta ao banco de teste e devolve uma função que o esvazia,
+// usada pelas fábricas para que cada caso comece sem produtos.
+func abrirPostgres(t *testing.T) (*gorm.DB, func(t *testing.T)) {
+	db, err := gorm.Open(postgres.Open(dsnTeste), &gorm.Config{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	esvaziar := func(t *testing.T) {
+		assert.NoError(t, db.Exec("TRUNCATE produtos, produtos_historico, outbox, produto_categorias, categorias, reservas, estoques, pedido_itens, pedidos, grades, variantes, produtos_precos, produtos_imagens").Error)
+	}
+	t.Cleanup(func() { esvaziar(t) })
+	return db, esvaziar
+}
+
 func TestPostgresRepositorio(t *testing.T) {
-	// Configurar banco de teste
-	dsn := "host=localhost user=postgres password=secret dbname=mydb port=5432 sslmode=disable"
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	assert.NoError(t, err)
-	defer db.Exec("TRUNCATE produtos RESTART IDENTITY CASCADE")
-
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	repo := NovoPostgresRepositorio(db, logger)
-
-	t.Run("Criar produto com sucesso", func(t *testing.T) {
-		produto, err := repo.Criar("Laptop", 999.99)
-		assert.NoError(t, err)
-		assert.NotEqual(t, uuid.Nil, produto.ID)
-		assert.Equal(t, "Laptop", produto.Nome)
-		assert.Equal(t, 999.99, produto.Preco)
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
+
+	repotest.Run(t, func(t *testing.T) repo.RepositorioProdutos {
+		esvaziar(t)
+		return repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
 	})
+}
+
+func TestTenantsPostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
+
+	repotest.RunTenants(t, func(t *testing.T) repo.RepositorioProdutos {
+		esvaziar(t)
+		return repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
+	})
+}
+
+func TestUnidadeDeTrabalhoPostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
 
-	t.Run("Criar produto com preço inválido", func(t *testing.T) {
-		_, err := repo.Criar("Laptop", -1)
-		assert.ErrorIs(t, err, ErrPrecoInvalido)
+	repotest.RunUnidadeDeTrabalho(t, func(t *testing.T) (repo.UnidadeDeTrabalho, repo.RepositorioProdutos) {
+		esvaziar(t)
+		return repo.NovaUnidadeDeTrabalhoPostgres(db, repo.OpcoesRepositorio{}, logger), repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
 	})
+}
 
-	t.Run("Buscar produto existente", func(t *testing.T) {
-		produto, err := repo.Criar("Mouse", 29.99)
-		assert.NoError(t, err)
+func TestCategoriasPostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
 
-		encontrado, err := repo.Buscar(produto.ID)
-		assert.NoError(t, err)
-		assert.Equal(t, produto, encontrado)
+	repotest.RunCategorias(t, func(t *testing.T, opcoes repo.OpcoesRepositorio) (repo.RepositorioProdutos, repo.RepositorioCategorias) {
+		esvaziar(t)
+		r := repo.NovoPostgresRepositorio(db, opcoes, logger)
+		return r, r
 	})
+}
+
+func TestEstoquePostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
 
-	t.Run("Buscar produto inexistente", func(t *testing.T) {
-		_, err := repo.Buscar(uuid.New())
-		assert.ErrorIs(t, err, ErrProdutoNaoEncontrado)
+	repotest.RunEstoque(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioEstoque) {
+		esvaziar(t)
+		r := repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
+}
 
-	t.Run("Listar produtos", func(t *testing.T) {
-		db.Exec("TRUNCATE produtos RESTART IDENTITY CASCADE")
-		repo.Criar("Laptop", 999.99)
-		repo.Criar("Mouse", 29.99)
+func TestPedidosPostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
 
-		produtos, err := repo.Listar()
-		assert.NoError(t, err)
-		assert.Len(t, produtos, 2)
+	repotest.RunPedidos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPedidos) {
+		esvaziar(t)
+		r := repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
+}
 
-	t.Run("Atualizar produto existente", func(t *testing.T) {
-		produto, err := repo.Criar("Laptop", 999.99)
-		assert.NoError(t, err)
+func TestVariantesPostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
 
-		atualizado, err := repo.Atualizar(produto.ID, "Laptop Pro", 1299.99)
-		assert.NoError(t, err)
-		assert.Equal(t, "Laptop Pro", atualizado.Nome)
-		assert.Equal(t, 1299.99, atualizado.Preco)
+	repotest.RunVariantes(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioVariantes) {
+		esvaziar(t)
+		r := repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
+}
+
+func TestPrecosPostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
 
-	t.Run("Deletar produto existente", func(t *testing.T) {
-		produto, err := repo.Criar("Laptop", 999.99)
-		assert.NoError(t, err)
+	repotest.RunPrecos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPrecos) {
+		esvaziar(t)
+		r := repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
+		return r, r
+	})
+}
 
-		err = repo.Deletar(produto.ID)
-		assert.NoError(t, err)
+func TestImagensPostgres(t *testing.T) {
+	db, esvaziar := abrirPostgres(t)
+	logger := zap.NewNop()
 
-		_, err = repo.Buscar(produto.ID)
-		assert.ErrorIs(t, err, ErrProdutoNaoEncontrado)
+	repotest.RunImagens(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioImagens) {
+		esvaziar(t)
+		r := repo.NovoPostgresRepositorio(db, repo.OpcoesRepositorio{}, logger)
+		return r, r
 	})
 }
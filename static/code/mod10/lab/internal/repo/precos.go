@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+// ErrAgendamentoInvalido indica um preço agendado para agora ou para o
+// passado.
+var ErrAgendamentoInvalido = errors.New("preço agendado precisa entrar em vigor no futuro")
+
+// RepositorioPrecos guarda a linha do tempo de preços dos produtos. Toda
+// escrita que muda o preço de um produto, inclusive a criação, fecha o
+// período em vigor e abre outro no instante registrado no histórico. Os
+// repositórios de produtos também o implementam.
+type RepositorioPrecos interface {
+	// AgendarPreco agenda um novo preço para o produto ativo a partir de
+	// vigenteDe, que precisa estar no futuro. Agendar de novo para o mesmo
+	// instante substitui o preço agendado.
+	AgendarPreco(ctx context.Context, produtoID uuid.UUID, preco models.Dinheiro, vigenteDe time.Time) (models.PrecoProduto, error)
+	// Precos retorna a linha do tempo do produto, com os agendamentos
+	// pendentes, em ordem de VigenteDe. Como o histórico, sobrevive à
+	// remoção do produto, mas não ao expurgo.
+	Precos(ctx context.Context, produtoID uuid.UUID) ([]models.PrecoProduto, error)
+	// AplicarPrecosAgendados aplica, de todos os tenants, os preços
+	// agendados até agora, em ordem de VigenteDe, e os retorna. Cada um
+	// atualiza o produto como uma alteração do AutorPadrao e passa a valer a
+	// partir dela. Preços de produtos removidos ficam pendentes até que o
+	// produto seja restaurado.
+	AplicarPrecosAgendados(ctx context.Context, agora time.Time) ([]models.PrecoProduto, error)
+}
+
+// mudouPreco informa se a alteração de antes para depois abre um período
+// de preço: a criação sempre abre, e as demais só quando o preço muda.
+func mudouPreco(antes, depois *models.Produto) bool {
+	return depois != nil && (antes == nil || antes.Preco != depois.Preco)
+}
+
+// novaVigencia monta o período aberto pela entrada de histórico h, de quem
+// herda o ID e o instante.
+func novaVigencia(h models.HistoricoProduto) models.PrecoProduto {
+	return models.PrecoProduto{
+		ID:        h.ID,
+		ProdutoID: h.ProdutoID,
+		TenantID:  h.TenantID,
+		Preco:     h.Depois.Preco,
+		VigenteDe: h.RegistradoEm,
+	}
+}
+
+// validarAgendamento confere o preço e que vigenteDe está depois de agora.
+func validarAgendamento(preco models.Dinheiro, vigenteDe, agora time.Time) error {
+	if err := preco.Validar(); err != nil {
+		return err
+	}
+	if !vigenteDe.After(agora) {
+		return ErrAgendamentoInvalido
+	}
+	return nil
+}
+
+// ordenarPrecos ordena a linha do tempo por VigenteDe, desempatando pelo ID.
+func ordenarPrecos(precos []models.PrecoProduto) {
+	slices.SortFunc(precos, func(a, b models.PrecoProduto) int {
+		if c := a.VigenteDe.Compare(b.VigenteDe); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+}
@@ -0,0 +1,2144 @@
+// Package repotest reúne os testes de contrato de repo.RepositorioProdutos.
+// Toda implementação roda a mesma suíte, de modo que um backend novo é
+// verificado exatamente como os existentes:
+//
+//	func TestMeuRepositorio(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) repo.RepositorioProdutos {
+//			return novoRepositorioVazio(t)
+//		})
+//	}
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fabrica devolve um repositório vazio e independente dos criados antes.
+// É chamada uma vez por caso da suíte.
+type Fabrica func(t *testing.T) repo.RepositorioProdutos
+
+// FabricaUnidadeDeTrabalho devolve uma unidade de trabalho vazia e o
+// repositório de produtos que enxerga o que ela confirma.
+type FabricaUnidadeDeTrabalho func(t *testing.T) (repo.UnidadeDeTrabalho, repo.RepositorioProdutos)
+
+// FabricaCategorias devolve repositórios vazios de produtos e de categorias,
+// criados com opcoes, que compartilham o mesmo armazenamento.
+type FabricaCategorias func(t *testing.T, opcoes repo.OpcoesRepositorio) (repo.RepositorioProdutos, repo.RepositorioCategorias)
+
+// FabricaEstoque devolve repositórios vazios de produtos e de estoque que
+// compartilham o mesmo armazenamento.
+type FabricaEstoque func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioEstoque)
+
+// FabricaPedidos devolve repositórios vazios de produtos e de pedidos que
+// compartilham o mesmo armazenamento.
+type FabricaPedidos func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPedidos)
+
+// FabricaVariantes devolve repositórios vazios de produtos e de variantes
+// que compartilham o mesmo armazenamento.
+type FabricaVariantes func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioVariantes)
+
+// FabricaPrecos devolve repositórios vazios de produtos e de preços que
+// compartilham os mesmos dados.
+type FabricaPrecos func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPrecos)
+
+// FabricaImagens devolve repositórios vazios de produtos e de imagens que
+// compartilham os mesmos dados.
+type FabricaImagens func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioImagens)
+
+// Run executa a suíte de contrato sobre os repositórios criados por novo.
+func Run(t *testing.T, novo Fabrica) {
+	ctx := contexto()
+
+	t.Run("Criar produto com sucesso", func(t *testing.T) {
+		r := novo(t)
+
+		produto, err := r.Criar(ctx, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+		assert.NotEqual(t, uuid.Nil, produto.ID)
+		assert.Equal(t, "Laptop", produto.Nome)
+		assert.Equal(t, models.Centavos(99999), produto.Preco)
+		assert.Equal(t, 1, produto.Versao)
+		assert.False(t, produto.RemovidoEm.Valid)
+	})
+
+	t.Run("Criar produto com preço inválido", func(t *testing.T) {
+		r := novo(t)
+
+		_, err := r.Criar(ctx, "Laptop", models.Centavos(-100))
+		assertEnvolve(t, err, repo.ErrPrecoInvalido)
+
+		pagina, err := r.Listar(ctx, repo.FiltroListagem{})
+		assert.NoError(t, err)
+		assert.Empty(t, pagina.Produtos)
+	})
+
+	t.Run("Buscar produto existente", func(t *testing.T) {
+		r := novo(t)
+		produto, err := r.Criar(ctx, "Mouse", models.Centavos(2999))
+		assert.NoError(t, err)
+
+		encontrado, err := r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, produto, encontrado)
+	})
+
+	t.Run("Buscar produto inexistente", func(t *testing.T) {
+		r := novo(t)
+
+		_, err := r.Buscar(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Listar produtos", func(t *testing.T) {
+		r := novo(t)
+		criar(t, r, "Laptop", 99999)
+		criar(t, r, "Mouse", 2999)
+
+		pagina, err := r.Listar(ctx, repo.FiltroListagem{})
+		assert.NoError(t, err)
+		assert.Len(t, pagina.Produtos, 2)
+		assert.Empty(t, pagina.ProximoCursor)
+	})
+
+	t.Run("Listar produtos paginados", func(t *testing.T) {
+		r := novo(t)
+		for _, nome := range []string{"Teclado", "Mouse", "Laptop", "Monitor", "Headset"} {
+			criar(t, r, nome, 10000)
+		}
+
+		var nomes []string
+		for _, p := range listarTudo(t, r, repo.FiltroListagem{Limite: 2}) {
+			nomes = append(nomes, p.Nome)
+		}
+		assert.Equal(t, []string{"Headset", "Laptop", "Monitor", "Mouse", "Teclado"}, nomes)
+	})
+
+	t.Run("Listar produtos em todas as ordenações", func(t *testing.T) {
+		r := novo(t)
+		// Preços repetidos exercitam o desempate pelo ID, e "a" e "Z"
+		// conferem a ordenação byte a byte (maiúsculas antes). Os nomes não
+		// se repetem por serem únicos no tenant.
+		for i, nome := range []string{"b", "a", "Z", "b2", "a2", "Z2", "c"} {
+			criar(t, r, nome, int64(100*(i%3+1)))
+		}
+
+		for _, o := range []repo.Ordenacao{repo.OrdenarPorNome, repo.OrdenarPorNomeDesc, repo.OrdenarPorPreco, repo.OrdenarPorPrecoDesc} {
+			t.Run(string(o), func(t *testing.T) {
+				produtos := listarTudo(t, r, repo.FiltroListagem{Ordenacao: o, Limite: 2})
+				assert.Len(t, produtos, 7)
+				assert.Len(t, uniq(ids(produtos)), 7)
+				for i := 1; i < len(produtos); i++ {
+					assert.Negative(t, comparar(o, produtos[i-1], produtos[i]),
+						"%s antes de %s na ordenação %s", produtos[i-1].Nome, produtos[i].Nome, o)
+				}
+			})
+		}
+	})
+
+	t.Run("Listar produtos filtrados e ordenados", func(t *testing.T) {
+		r := novo(t)
+		criar(t, r, "Laptop", 99999)
+		criar(t, r, "Laptop Pro", 129999)
+		criar(t, r, "Mouse", 2999)
+		criar(t, r, "Laptop Max", 199999)
+
+		precoMin, precoMax := models.Centavos(10000), models.Centavos(150000)
+		pagina, err := r.Listar(ctx, repo.FiltroListagem{
+			Nome:      "laptop",
+			PrecoMin:  &precoMin,
+			PrecoMax:  &precoMax,
+			Ordenacao: repo.OrdenarPorPrecoDesc,
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, pagina.Produtos, 2) {
+			assert.Equal(t, "Laptop Pro", pagina.Produtos[0].Nome)
+			assert.Equal(t, "Laptop", pagina.Produtos[1].Nome)
+		}
+		assert.Empty(t, pagina.ProximoCursor)
+	})
+
+	t.Run("Listar filtrando nome com curingas", func(t *testing.T) {
+		r := novo(t)
+		criar(t, r, "Desconto 10%", 1000)
+		criar(t, r, "Desconto 100", 1000)
+		criar(t, r, "Cabo_USB", 1000)
+		criar(t, r, "Cabo USB", 1000)
+
+		pagina, err := r.Listar(ctx, repo.FiltroListagem{Nome: "10%"})
+		assert.NoError(t, err)
+		assert.Len(t, pagina.Produtos, 1)
+
+		pagina, err = r.Listar(ctx, repo.FiltroListagem{Nome: "o_u"})
+		assert.NoError(t, err)
+		assert.Len(t, pagina.Produtos, 1)
+	})
+
+	t.Run("Listar com cursor ou ordenação inválidos", func(t *testing.T) {
+		r := novo(t)
+		criar(t, r, "Laptop", 99999)
+		criar(t, r, "Mouse", 2999)
+
+		_, err := r.Listar(ctx, repo.FiltroListagem{Cursor: "invalido"})
+		assertEnvolve(t, err, repo.ErrCursorInvalido)
+
+		pagina, err := r.Listar(ctx, repo.FiltroListagem{Limite: 1})
+		assert.NoError(t, err)
+		_, err = r.Listar(ctx, repo.FiltroListagem{Ordenacao: repo.OrdenarPorPreco, Cursor: pagina.ProximoCursor})
+		assertEnvolve(t, err, repo.ErrCursorInvalido)
+
+		_, err = r.Listar(ctx, repo.FiltroListagem{Ordenacao: "estoque"})
+		assertEnvolve(t, err, repo.ErrOrdenacaoInvalida)
+	})
+
+	t.Run("Pesquisar produtos por texto", func(t *testing.T) {
+		r := novo(t)
+		criar(t, r, "Café torrado", 2590)
+		criar(t, r, "Cafés especiais e café gourmet", 5990)
+		criar(t, r, "Chá verde", 1250)
+		removido := criar(t, r, "Café solúvel", 990)
+		assert.NoError(t, r.Deletar(ctx, removido.ID, repo.QualquerVersao))
+
+		produtos, err := r.Pesquisar(ctx, "cafe", 0)
+		assert.NoError(t, err)
+		if assert.Len(t, produtos, 2) {
+			assert.Equal(t, "Cafés especiais e café gourmet", produtos[0].Nome)
+		}
+
+		produtos, err = r.Pesquisar(ctx, "CAFÉ torrado", 0)
+		assert.NoError(t, err)
+		if assert.Len(t, produtos, 1) {
+			assert.Equal(t, "Café torrado", produtos[0].Nome)
+		}
+
+		produtos, err = r.Pesquisar(ctx, "cafe", 1)
+		assert.NoError(t, err)
+		assert.Len(t, produtos, 1)
+
+		_, err = r.Pesquisar(ctx, "  ", 0)
+		assertEnvolve(t, err, repo.ErrBuscaVazia)
+	})
+
+	t.Run("Atualizar produto existente", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+
+		atualizado, err := r.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), repo.QualquerVersao)
+		assert.NoError(t, err)
+		assert.Equal(t, "Laptop Pro", atualizado.Nome)
+		assert.Equal(t, models.Centavos(129999), atualizado.Preco)
+
+		encontrado, err := r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, atualizado, encontrado)
+	})
+
+	t.Run("Atualizar produto com preço inválido", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+
+		_, err := r.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(-100), repo.QualquerVersao)
+		assertEnvolve(t, err, repo.ErrPrecoInvalido)
+
+		inalterado, err := r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, produto, inalterado)
+	})
+
+	t.Run("Atualizar produto inexistente", func(t *testing.T) {
+		r := novo(t)
+
+		_, err := r.Atualizar(ctx, uuid.New(), "Laptop", models.Centavos(99999), repo.QualquerVersao)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Atualizar produto com versão desatualizada", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+
+		atualizado, err := r.Atualizar(ctx, produto.ID, "Laptop Pro", models.Centavos(129999), produto.Versao)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, atualizado.Versao)
+
+		_, err = r.Atualizar(ctx, produto.ID, "Laptop Max", models.Centavos(149999), produto.Versao)
+		assertEnvolve(t, err, repo.ErrConflitoDeVersao)
+
+		err = r.Deletar(ctx, produto.ID, produto.Versao)
+		assertEnvolve(t, err, repo.ErrConflitoDeVersao)
+
+		err = r.Deletar(ctx, produto.ID, atualizado.Versao)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Deletar produto existente", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+
+		err := r.Deletar(ctx, produto.ID, repo.QualquerVersao)
+		assert.NoError(t, err)
+
+		_, err = r.Buscar(ctx, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		err = r.Deletar(ctx, produto.ID, repo.QualquerVersao)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Deletar produto inexistente", func(t *testing.T) {
+		r := novo(t)
+
+		err := r.Deletar(ctx, uuid.New(), repo.QualquerVersao)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Aplicar lote com sucesso", func(t *testing.T) {
+		r := novo(t)
+		existente := criar(t, r, "Laptop", 99999)
+
+		resultados, err := r.AplicarLote(ctx, []repo.OperacaoLote{
+			{Tipo: repo.OperacaoCriar, Nome: "Mouse", Preco: models.Centavos(2999)},
+			{Tipo: repo.OperacaoAtualizar, ID: existente.ID, Nome: "Laptop Pro", Preco: models.Centavos(129999), Versao: existente.Versao},
+		})
+		assert.NoError(t, err)
+		if !assert.Len(t, resultados, 2) {
+			return
+		}
+		assert.Empty(t, resultados[0].Erro)
+		assert.Equal(t, 1, resultados[1].Indice)
+
+		criado, err := r.Buscar(ctx, resultados[0].Produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Mouse", criado.Nome)
+
+		atualizado, err := r.Buscar(ctx, existente.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Laptop Pro", atualizado.Nome)
+	})
+
+	t.Run("Aplicar lote com falha desfaz todas as operações", func(t *testing.T) {
+		r := novo(t)
+		existente := criar(t, r, "Laptop", 99999)
+
+		resultados, err := r.AplicarLote(ctx, []repo.OperacaoLote{
+			{Tipo: repo.OperacaoCriar, Nome: "Mouse", Preco: models.Centavos(2999)},
+			{Tipo: repo.OperacaoAtualizar, ID: existente.ID, Nome: "Laptop Pro", Preco: models.Centavos(129999)},
+			{Tipo: repo.OperacaoDeletar, ID: uuid.New()},
+			{Tipo: repo.OperacaoCriar, Nome: "Teclado", Preco: models.Centavos(-100)},
+		})
+		assertEnvolve(t, err, repo.ErrLoteRejeitado)
+		if !assert.Len(t, resultados, 4) {
+			return
+		}
+		assert.Empty(t, resultados[0].Erro)
+		assert.Empty(t, resultados[1].Erro)
+		assert.NotEmpty(t, resultados[2].Erro)
+		assert.NotEmpty(t, resultados[3].Erro)
+
+		_, err = r.Buscar(ctx, resultados[0].Produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		inalterado, err := r.Buscar(ctx, existente.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, existente, inalterado)
+
+		historico, err := r.Historico(ctx, existente.ID)
+		assert.NoError(t, err)
+		assert.Len(t, historico, 1)
+	})
+
+	t.Run("Aplicar lote com item inválido", func(t *testing.T) {
+		r := novo(t)
+		existente := criar(t, r, "Laptop", 99999)
+
+		resultados, err := r.AplicarLote(ctx, []repo.OperacaoLote{
+			{Tipo: repo.OperacaoCriar, Nome: "Mouse", Preco: models.Centavos(2999)},
+			{Tipo: repo.OperacaoCriar, Nome: "", Preco: models.Centavos(1000)},
+			{Tipo: repo.OperacaoCriar, Nome: "TV", Preco: models.Centavos(1000)},
+			{Tipo: repo.OperacaoAtualizar, ID: existente.ID, Nome: "Laptop Pro", Preco: models.Centavos(0), Versao: existente.Versao},
+		})
+		assertEnvolve(t, err, repo.ErrLoteRejeitado)
+		if !assert.Len(t, resultados, 4) {
+			return
+		}
+		assert.Empty(t, resultados[0].Erro)
+		assert.Contains(t, resultados[1].Erro, repo.ErrOperacaoInvalida.Error())
+		assert.Contains(t, resultados[2].Erro, repo.ErrOperacaoInvalida.Error())
+		assert.Contains(t, resultados[3].Erro, repo.ErrOperacaoInvalida.Error())
+
+		_, err = r.Buscar(ctx, resultados[0].Produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		inalterado, err := r.Buscar(ctx, existente.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, existente, inalterado)
+	})
+
+	t.Run("Aplicar lote grande demais", func(t *testing.T) {
+		r := novo(t)
+
+		_, err := r.AplicarLote(ctx, make([]repo.OperacaoLote, repo.LoteMaximo+1))
+		assertEnvolve(t, err, repo.ErrLoteMuitoGrande)
+	})
+
+	t.Run("Consultar histórico de alterações", func(t *testing.T) {
+		r := novo(t)
+		ctxAutor := repo.ComAutor(ctx, "maria")
+		produto, err := r.Criar(ctxAutor, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+		_, err = r.Atualizar(ctxAutor, produto.ID, "Laptop Pro", models.Centavos(129999), repo.QualquerVersao)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+
+		historico, err := r.Historico(ctx, produto.ID)
+		assert.NoError(t, err)
+		if !assert.Len(t, historico, 3) {
+			return
+		}
+
+		assert.Equal(t, "criar", historico[0].Operacao)
+		assert.Nil(t, historico[0].Antes)
+		assert.Equal(t, "Laptop", historico[0].Depois.Nome)
+		assert.Equal(t, "maria", historico[0].Autor)
+
+		assert.Equal(t, "atualizar", historico[1].Operacao)
+		assert.Equal(t, "Laptop", historico[1].Antes.Nome)
+		assert.Equal(t, "Laptop Pro", historico[1].Depois.Nome)
+
+		assert.Equal(t, "deletar", historico[2].Operacao)
+		assert.Equal(t, repo.AutorPadrao, historico[2].Autor)
+		assert.True(t, historico[2].Depois.RemovidoEm.Valid)
+
+		_, err = r.Historico(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Restaurar produto removido", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+
+		_, err := r.Buscar(ctx, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		pagina, err := r.Listar(ctx, repo.FiltroListagem{Nome: "Laptop", IncluirRemovidos: true})
+		assert.NoError(t, err)
+		assert.Contains(t, ids(pagina.Produtos), produto.ID)
+
+		restaurado, err := r.Restaurar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.False(t, restaurado.RemovidoEm.Valid)
+
+		_, err = r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+
+		_, err = r.Restaurar(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Nomes de produtos ativos são únicos no tenant", func(t *testing.T) {
+		r := novo(t)
+		laptop := criar(t, r, "Laptop", 99999)
+		mouse := criar(t, r, "Mouse", 2999)
+
+		_, err := r.Criar(ctx, "LAPTOP", models.Centavos(1000))
+		assertDuplicado(t, err, laptop.ID)
+		_, err = r.Atualizar(ctx, mouse.ID, "laptop", mouse.Preco, repo.QualquerVersao)
+		assertDuplicado(t, err, laptop.ID)
+		resultados, err := r.AplicarLote(ctx, []repo.OperacaoLote{
+			{Tipo: repo.OperacaoCriar, Nome: "Teclado", Preco: models.Centavos(14990)},
+			{Tipo: repo.OperacaoCriar, Nome: "teclado", Preco: models.Centavos(14990)},
+		})
+		assertEnvolve(t, err, repo.ErrLoteRejeitado)
+		if assert.Len(t, resultados, 2) {
+			assert.Empty(t, resultados[0].Erro)
+			assert.Contains(t, resultados[1].Erro, repo.ErrProdutoDuplicado.Error())
+		}
+
+		// O próprio produto pode trocar as maiúsculas, e outro tenant usa o
+		// nome livremente
+		_, err = r.Atualizar(ctx, laptop.ID, "LAPTOP", laptop.Preco, repo.QualquerVersao)
+		assert.NoError(t, err)
+		_, err = r.Criar(repo.ComTenant(ctx, "loja-b"), "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+
+		// O removido libera o nome e não volta enquanto ele estiver em uso
+		assert.NoError(t, r.Deletar(ctx, laptop.ID, repo.QualquerVersao))
+		substituto := criar(t, r, "Laptop", 89999)
+		_, err = r.Restaurar(ctx, laptop.ID)
+		assertDuplicado(t, err, substituto.ID)
+		_, err = r.Buscar(ctx, laptop.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		assert.NoError(t, r.Deletar(ctx, substituto.ID, repo.QualquerVersao))
+		_, err = r.Restaurar(ctx, laptop.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Criar com ID", func(t *testing.T) {
+		r := novo(t)
+		id := uuid.New()
+
+		produto, err := r.CriarComID(ctx, id, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+		assert.Equal(t, id, produto.ID)
+		assert.Equal(t, 1, produto.Versao)
+		encontrado, err := r.Buscar(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, produto, encontrado)
+
+		// O ID não pode ser reaproveitado, nem depois da remoção nem por
+		// outro tenant
+		_, err = r.CriarComID(ctx, id, "Mouse", models.Centavos(2999))
+		assertEnvolve(t, err, repo.ErrIDEmUso)
+		_, err = r.CriarComID(repo.ComTenant(ctx, "loja-b"), id, "Mouse", models.Centavos(2999))
+		assertEnvolve(t, err, repo.ErrIDEmUso)
+		assert.NoError(t, r.Deletar(ctx, id, repo.QualquerVersao))
+		_, err = r.CriarComID(ctx, id, "Mouse", models.Centavos(2999))
+		assertEnvolve(t, err, repo.ErrIDEmUso)
+	})
+
+	t.Run("Nomes únicos ignoram maiúsculas fora do ASCII", func(t *testing.T) {
+		r := novo(t)
+		agua := criar(t, r, "Água Tônica", 599)
+
+		_, err := r.Criar(ctx, "ÁGUA TÔNICA", models.Centavos(699))
+		assertDuplicado(t, err, agua.ID)
+	})
+
+	t.Run("Purgar produtos removidos", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		ativo := criar(t, r, "Mouse", 2999)
+		assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+
+		total, err := r.Purgar(ctx, time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.Zero(t, total)
+
+		total, err = r.Purgar(ctx, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+
+		_, err = r.Restaurar(ctx, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		_, err = r.Buscar(ctx, ativo.ID)
+		assert.NoError(t, err)
+
+		historico, err := r.Historico(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Len(t, historico, 2)
+	})
+
+	t.Run("Operação com contexto cancelado", func(t *testing.T) {
+		r := novo(t)
+		cancelado, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := r.Criar(cancelado, "Laptop", models.Centavos(99999))
+		assert.ErrorIs(t, err, context.Canceled)
+
+		_, err = r.Listar(cancelado, repo.FiltroListagem{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Operações concorrentes", func(t *testing.T) {
+		r := novo(t)
+		const goroutines, operacoes = 16, 100
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < operacoes; i++ {
+					nome := fmt.Sprintf("Produto %d-%d", g, i)
+					produto, err := r.Criar(ctx, nome, models.Centavos(1000))
+					if !assert.NoError(t, err) {
+						return
+					}
+
+					_, err = r.Atualizar(ctx, produto.ID, nome+" atualizado", models.Centavos(2000), repo.QualquerVersao)
+					assert.NoError(t, err)
+
+					_, err = r.Buscar(ctx, produto.ID)
+					assert.NoError(t, err)
+
+					pagina, err := r.Listar(ctx, repo.FiltroListagem{Limite: repo.LimiteMaximo})
+					assert.NoError(t, err)
+					for j := 1; j < len(pagina.Produtos); j++ {
+						assert.Negative(t, comparar(repo.OrdenarPorNome, pagina.Produtos[j-1], pagina.Produtos[j]))
+					}
+
+					if i%2 == 0 {
+						assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		produtos := listarTudo(t, r, repo.FiltroListagem{Limite: repo.LimiteMaximo})
+		assert.Len(t, produtos, goroutines*operacoes/2)
+	})
+
+	t.Run("Atualizações concorrentes da mesma versão", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		const concorrentes = 8
+
+		var wg sync.WaitGroup
+		erros := make([]error, concorrentes)
+		for i := range erros {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, erros[i] = r.Atualizar(ctx, produto.ID, fmt.Sprintf("Laptop %d", i), models.Centavos(100000), produto.Versao)
+			}(i)
+		}
+		wg.Wait()
+
+		sucessos := 0
+		for _, err := range erros {
+			if err == nil {
+				sucessos++
+				continue
+			}
+			assert.ErrorIs(t, err, repo.ErrConflitoDeVersao)
+		}
+		assert.Equal(t, 1, sucessos)
+
+		atual, err := r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, atual.Versao)
+	})
+}
+
+// RunTenants verifica que cada tenant só enxerga e altera os próprios
+// produtos.
+func RunTenants(t *testing.T, novo Fabrica) {
+	ctx := contexto()
+	lojaA := repo.ComTenant(ctx, "loja-a")
+	lojaB := repo.ComTenant(ctx, "loja-b")
+
+	t.Run("Produto de outro tenant é inexistente", func(t *testing.T) {
+		r := novo(t)
+		produto, err := r.Criar(lojaA, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+		assert.Equal(t, "loja-a", produto.TenantID)
+
+		_, err = r.Buscar(lojaB, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = r.Atualizar(lojaB, produto.ID, "Invadido", models.Centavos(1), repo.QualquerVersao)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		assertEnvolve(t, r.Deletar(lojaB, produto.ID, repo.QualquerVersao), repo.ErrProdutoNaoEncontrado)
+		_, err = r.Restaurar(lojaB, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = r.Historico(lojaB, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = r.Buscar(ctx, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		encontrado, err := r.Buscar(lojaA, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, produto, encontrado)
+		historico, err := r.Historico(lojaA, produto.ID)
+		assert.NoError(t, err)
+		assert.Len(t, historico, 1)
+		assert.Equal(t, "loja-a", historico[0].TenantID)
+	})
+
+	t.Run("Produto removido de outro tenant não é restaurado", func(t *testing.T) {
+		r := novo(t)
+		produto, err := r.Criar(lojaA, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+		assert.NoError(t, r.Deletar(lojaA, produto.ID, produto.Versao))
+
+		_, err = r.Restaurar(lojaB, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		removidos, err := r.Listar(lojaB, repo.FiltroListagem{IncluirRemovidos: true})
+		assert.NoError(t, err)
+		assert.Empty(t, removidos.Produtos)
+
+		restaurado, err := r.Restaurar(lojaA, produto.ID)
+		assert.NoError(t, err)
+		assert.False(t, restaurado.RemovidoEm.Valid)
+	})
+
+	t.Run("Listagem e busca restritas ao tenant", func(t *testing.T) {
+		r := novo(t)
+		deA, err := r.Criar(lojaA, "Teclado mecânico", models.Centavos(29990))
+		assert.NoError(t, err)
+		deB, err := r.Criar(lojaB, "Teclado sem fio", models.Centavos(19990))
+		assert.NoError(t, err)
+
+		for tenant, esperado := range map[context.Context]models.Produto{lojaA: deA, lojaB: deB} {
+			pagina, err := r.Listar(tenant, repo.FiltroListagem{})
+			assert.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{esperado.ID}, ids(pagina.Produtos))
+
+			encontrados, err := r.Pesquisar(tenant, "teclado", 0)
+			assert.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{esperado.ID}, ids(encontrados))
+		}
+
+		pagina, err := r.Listar(ctx, repo.FiltroListagem{})
+		assert.NoError(t, err)
+		assert.Empty(t, pagina.Produtos)
+	})
+
+	t.Run("Lote não alcança outro tenant", func(t *testing.T) {
+		r := novo(t)
+		produto, err := r.Criar(lojaA, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+
+		resultados, err := r.AplicarLote(lojaB, []repo.OperacaoLote{
+			{Tipo: repo.OperacaoCriar, Nome: "Mouse", Preco: models.Centavos(4990)},
+			{Tipo: repo.OperacaoAtualizar, ID: produto.ID, Nome: "Invadido", Preco: models.Centavos(1)},
+		})
+		assert.ErrorIs(t, err, repo.ErrLoteRejeitado)
+		if assert.Len(t, resultados, 2) {
+			assert.Contains(t, resultados[1].Erro, repo.ErrProdutoNaoEncontrado.Error())
+		}
+
+		encontrado, err := r.Buscar(lojaA, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, produto, encontrado)
+	})
+
+	t.Run("Contexto sem tenant é recusado", func(t *testing.T) {
+		r := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		assert.Equal(t, repo.TenantPadrao, produto.TenantID)
+
+		assert.PanicsWithError(t, repo.ErrSemTenant.Error(), func() {
+			r.Criar(context.Background(), "Mouse", models.Centavos(4990))
+		})
+		assert.PanicsWithError(t, repo.ErrSemTenant.Error(), func() {
+			r.Buscar(context.Background(), produto.ID)
+		})
+	})
+}
+
+// RunUnidadeDeTrabalho executa a suíte de contrato de repo.UnidadeDeTrabalho.
+func RunUnidadeDeTrabalho(t *testing.T, novo FabricaUnidadeDeTrabalho) {
+	ctx := contexto()
+
+	t.Run("Unidade de trabalho confirma as escritas", func(t *testing.T) {
+		uow, r := novo(t)
+
+		var criado models.Produto
+		err := uow.Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+			var err error
+			criado, err = repos.Produtos.Criar(ctx, "Teclado", models.Centavos(19999))
+			if err != nil {
+				return err
+			}
+			_, err = repos.Produtos.Atualizar(ctx, criado.ID, "Teclado mecânico", models.Centavos(29999), criado.Versao)
+			return err
+		})
+		assert.NoError(t, err)
+
+		encontrado, err := r.Buscar(ctx, criado.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Teclado mecânico", encontrado.Nome)
+		assert.Equal(t, 2, encontrado.Versao)
+	})
+
+	t.Run("Unidade de trabalho com erro desfaz as escritas", func(t *testing.T) {
+		uow, r := novo(t)
+		existente := criar(t, r, "Monitor", 89999)
+
+		var criado models.Produto
+		err := uow.Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+			if _, err := repos.Produtos.Atualizar(ctx, existente.ID, "Monitor 4K", models.Centavos(149999), existente.Versao); err != nil {
+				return err
+			}
+			var err error
+			criado, err = repos.Produtos.Criar(ctx, "Webcam", models.Centavos(39999))
+			if err != nil {
+				return err
+			}
+			return repos.Produtos.Deletar(ctx, uuid.New(), repo.QualquerVersao)
+		})
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		_, err = r.Buscar(ctx, criado.ID)
+		assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+
+		encontrado, err := r.Buscar(ctx, existente.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, existente, encontrado)
+
+		historico, err := r.Historico(ctx, existente.ID)
+		assert.NoError(t, err)
+		assert.Len(t, historico, 1)
+	})
+
+	t.Run("Unidade de trabalho desfaz as escritas em pânico", func(t *testing.T) {
+		uow, r := novo(t)
+
+		var criado models.Produto
+		assert.Panics(t, func() {
+			uow.Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+				var err error
+				criado, err = repos.Produtos.Criar(ctx, "Webcam", models.Centavos(39999))
+				assert.NoError(t, err)
+				panic("falha inesperada")
+			})
+		})
+
+		_, err := r.Buscar(ctx, criado.ID)
+		assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Unidade de trabalho desfaz o produto se a categoria não existe", func(t *testing.T) {
+		uow, r := novo(t)
+
+		var criado models.Produto
+		err := uow.Executar(ctx, func(ctx context.Context, repos repo.Repositorios) error {
+			categoria, err := repos.Categorias.CriarCategoria(ctx, "Periféricos", nil)
+			if err != nil {
+				return err
+			}
+			criado, err = repos.Produtos.Criar(ctx, "Webcam", models.Centavos(39999))
+			if err != nil {
+				return err
+			}
+			return repos.Categorias.AtribuirCategorias(ctx, criado.ID, []uuid.UUID{categoria.ID, uuid.New()})
+		})
+		assertEnvolve(t, err, repo.ErrCategoriaNaoEncontrada)
+
+		_, err = r.Buscar(ctx, criado.ID)
+		assert.ErrorIs(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+}
+
+// RunCategorias executa a suíte de contrato de repo.RepositorioCategorias.
+func RunCategorias(t *testing.T, novo FabricaCategorias) {
+	ctx := contexto()
+
+	t.Run("Criar e listar categorias", func(t *testing.T) {
+		_, c := novo(t, repo.OpcoesRepositorio{})
+
+		eletronicos, err := c.CriarCategoria(ctx, "Eletrônicos", nil)
+		assert.NoError(t, err)
+		assert.NotEqual(t, uuid.Nil, eletronicos.ID)
+		assert.Nil(t, eletronicos.PaiID)
+		informatica, err := c.CriarCategoria(ctx, "Informática", &eletronicos.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &eletronicos.ID, informatica.PaiID)
+		alimentos, err := c.CriarCategoria(ctx, "Alimentos", nil)
+		assert.NoError(t, err)
+
+		categorias, err := c.ListarCategorias(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []models.Categoria{alimentos, eletronicos, informatica}, categorias)
+	})
+
+	t.Run("Nomes únicos por categoria", func(t *testing.T) {
+		r, c := novo(t, repo.OpcoesRepositorio{EscopoNome: repo.NomeUnicoNaCategoria})
+		bebidas, err := c.CriarCategoria(ctx, "Bebidas", nil)
+		assert.NoError(t, err)
+		limpeza, err := c.CriarCategoria(ctx, "Limpeza", nil)
+		assert.NoError(t, err)
+
+		// Sem categoria em comum, o nome se repete
+		tonica, err := r.Criar(ctx, "Água", models.Centavos(399))
+		assert.NoError(t, err)
+		sanitaria, err := r.Criar(ctx, "ÁGUA", models.Centavos(899))
+		assert.NoError(t, err)
+		assert.NoError(t, c.AtribuirCategorias(ctx, tonica.ID, []uuid.UUID{bebidas.ID}))
+		assert.NoError(t, c.AtribuirCategorias(ctx, sanitaria.ID, []uuid.UUID{limpeza.ID}))
+
+		// Mas não dentro da mesma categoria
+		err = c.AtribuirCategorias(ctx, sanitaria.ID, []uuid.UUID{limpeza.ID, bebidas.ID})
+		assertDuplicado(t, err, tonica.ID)
+		categorias, err := c.CategoriasDoProduto(ctx, sanitaria.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{limpeza.ID}, categorias)
+
+		suco, err := r.Criar(ctx, "Suco", models.Centavos(599))
+		assert.NoError(t, err)
+		assert.NoError(t, c.AtribuirCategorias(ctx, suco.ID, []uuid.UUID{bebidas.ID}))
+		_, err = r.Atualizar(ctx, suco.ID, "água", suco.Preco, repo.QualquerVersao)
+		assertDuplicado(t, err, tonica.ID)
+
+		assert.NoError(t, r.Deletar(ctx, tonica.ID, repo.QualquerVersao))
+		_, err = r.Atualizar(ctx, suco.ID, "água", suco.Preco, repo.QualquerVersao)
+		assert.NoError(t, err)
+		_, err = r.Restaurar(ctx, tonica.ID)
+		assertDuplicado(t, err, suco.ID)
+	})
+
+	t.Run("Criar categoria com pai inexistente", func(t *testing.T) {
+		_, c := novo(t, repo.OpcoesRepositorio{})
+
+		pai := uuid.New()
+		_, err := c.CriarCategoria(ctx, "Informática", &pai)
+		assertEnvolve(t, err, repo.ErrCategoriaNaoEncontrada)
+
+		categorias, err := c.ListarCategorias(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, categorias)
+	})
+
+	t.Run("Atribuir categorias substitui as anteriores", func(t *testing.T) {
+		r, c := novo(t, repo.OpcoesRepositorio{})
+		produto := criar(t, r, "Laptop", 99999)
+		a := criarCategoria(t, c, "Informática", nil)
+		b := criarCategoria(t, c, "Promoções", nil)
+
+		// Os IDs voltam sem repetições, na ordem dos bytes
+		esperadas := []uuid.UUID{a.ID, b.ID}
+		slices.SortFunc(esperadas, func(x, y uuid.UUID) int { return bytes.Compare(x[:], y[:]) })
+		assert.NoError(t, c.AtribuirCategorias(ctx, produto.ID, []uuid.UUID{b.ID, a.ID, b.ID}))
+		categorias, err := c.CategoriasDoProduto(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, esperadas, categorias)
+
+		assert.NoError(t, c.AtribuirCategorias(ctx, produto.ID, []uuid.UUID{a.ID}))
+		categorias, err = c.CategoriasDoProduto(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{a.ID}, categorias)
+
+		assert.NoError(t, c.AtribuirCategorias(ctx, produto.ID, nil))
+		categorias, err = c.CategoriasDoProduto(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, categorias)
+	})
+
+	t.Run("Atribuir categoria inexistente mantém as anteriores", func(t *testing.T) {
+		r, c := novo(t, repo.OpcoesRepositorio{})
+		produto := criar(t, r, "Laptop", 99999)
+		a := criarCategoria(t, c, "Informática", nil)
+		assert.NoError(t, c.AtribuirCategorias(ctx, produto.ID, []uuid.UUID{a.ID}))
+
+		err := c.AtribuirCategorias(ctx, produto.ID, []uuid.UUID{uuid.New()})
+		assertEnvolve(t, err, repo.ErrCategoriaNaoEncontrada)
+
+		categorias, err := c.CategoriasDoProduto(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{a.ID}, categorias)
+	})
+
+	t.Run("Categorias de produto inexistente ou removido", func(t *testing.T) {
+		r, c := novo(t, repo.OpcoesRepositorio{})
+		a := criarCategoria(t, c, "Informática", nil)
+		removido := criar(t, r, "Laptop", 99999)
+		assert.NoError(t, r.Deletar(ctx, removido.ID, removido.Versao))
+
+		for _, id := range []uuid.UUID{uuid.New(), removido.ID} {
+			err := c.AtribuirCategorias(ctx, id, []uuid.UUID{a.ID})
+			assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+			_, err = c.CategoriasDoProduto(ctx, id)
+			assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		}
+	})
+
+	t.Run("Produtos da categoria e das subcategorias", func(t *testing.T) {
+		r, c := novo(t, repo.OpcoesRepositorio{})
+		raiz := criarCategoria(t, c, "Alimentos", nil)
+		filha := criarCategoria(t, c, "Frutas", &raiz.ID)
+		neta := criarCategoria(t, c, "Frutas secas", &filha.ID)
+		outra := criarCategoria(t, c, "Bebidas", nil)
+
+		atribuir := func(nome string, categorias ...uuid.UUID) models.Produto {
+			p := criar(t, r, nome, 1000)
+			assert.NoError(t, c.AtribuirCategorias(ctx, p.ID, categorias))
+			return p
+		}
+		arroz := atribuir("Arroz", raiz.ID)
+		banana := atribuir("Banana", filha.ID)
+		damasco := atribuir("Damasco", neta.ID)
+		castanha := atribuir("Castanha", raiz.ID, neta.ID)
+		atribuir("Suco", outra.ID)
+		removido := atribuir("Açúcar", raiz.ID)
+		assert.NoError(t, r.Deletar(ctx, removido.ID, removido.Versao))
+
+		produtos, err := c.ProdutosDaCategoria(ctx, raiz.ID, false)
+		assert.NoError(t, err)
+		assert.Equal(t, ids([]models.Produto{arroz, castanha}), ids(produtos))
+
+		produtos, err = c.ProdutosDaCategoria(ctx, raiz.ID, true)
+		assert.NoError(t, err)
+		assert.Equal(t, ids([]models.Produto{arroz, banana, castanha, damasco}), ids(produtos))
+
+		produtos, err = c.ProdutosDaCategoria(ctx, filha.ID, true)
+		assert.NoError(t, err)
+		assert.Equal(t, ids([]models.Produto{banana, castanha, damasco}), ids(produtos))
+
+		produtos, err = c.ProdutosDaCategoria(ctx, filha.ID, false)
+		assert.NoError(t, err)
+		assert.Equal(t, ids([]models.Produto{banana}), ids(produtos))
+
+		_, err = c.ProdutosDaCategoria(ctx, uuid.New(), true)
+		assertEnvolve(t, err, repo.ErrCategoriaNaoEncontrada)
+	})
+
+	t.Run("Categoria de outro tenant é inexistente", func(t *testing.T) {
+		r, c := novo(t, repo.OpcoesRepositorio{})
+		lojaA := repo.ComTenant(ctx, "loja-a")
+		lojaB := repo.ComTenant(ctx, "loja-b")
+		categoria, err := c.CriarCategoria(lojaA, "Informática", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "loja-a", categoria.TenantID)
+		produto, err := r.Criar(lojaB, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+
+		_, err = c.CriarCategoria(lojaB, "Notebooks", &categoria.ID)
+		assertEnvolve(t, err, repo.ErrCategoriaNaoEncontrada)
+		err = c.AtribuirCategorias(lojaB, produto.ID, []uuid.UUID{categoria.ID})
+		assertEnvolve(t, err, repo.ErrCategoriaNaoEncontrada)
+		_, err = c.ProdutosDaCategoria(lojaB, categoria.ID, true)
+		assertEnvolve(t, err, repo.ErrCategoriaNaoEncontrada)
+		_, err = c.CategoriasDoProduto(lojaA, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		categorias, err := c.ListarCategorias(lojaB)
+		assert.NoError(t, err)
+		assert.Empty(t, categorias)
+		categorias, err = c.ListarCategorias(lojaA)
+		assert.NoError(t, err)
+		assert.Equal(t, []models.Categoria{categoria}, categorias)
+	})
+}
+
+// RunEstoque executa a suíte de contrato de repo.RepositorioEstoque.
+func RunEstoque(t *testing.T, novo FabricaEstoque) {
+	ctx := contexto()
+
+	t.Run("Definir e consultar estoque", func(t *testing.T) {
+		r, e := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+
+		estoque, err := e.ConsultarEstoque(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Estoque{ProdutoID: produto.ID}, estoque)
+
+		estoque, err = e.DefinirEstoque(ctx, produto.ID, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Estoque{ProdutoID: produto.ID, Quantidade: 10}, estoque)
+
+		consultado, err := e.ConsultarEstoque(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, estoque, consultado)
+		assert.Equal(t, 10, consultado.Disponivel())
+	})
+
+	t.Run("Estoque de produto de outro tenant", func(t *testing.T) {
+		r, e := novo(t)
+		produto, err := r.Criar(repo.ComTenant(ctx, "loja-a"), "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+
+		lojaB := repo.ComTenant(ctx, "loja-b")
+		_, err = e.DefinirEstoque(lojaB, produto.ID, 10)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = e.ConsultarEstoque(lojaB, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = e.Reservar(lojaB, produto.ID, 1, time.Minute)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Reserva de outro tenant é inexistente", func(t *testing.T) {
+		r, e := novo(t)
+		lojaA := repo.ComTenant(ctx, "loja-a")
+		produto, err := r.Criar(lojaA, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+		_, err = e.DefinirEstoque(lojaA, produto.ID, 10)
+		assert.NoError(t, err)
+		reserva, err := e.Reservar(lojaA, produto.ID, 3, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, "loja-a", reserva.TenantID)
+
+		lojaB := repo.ComTenant(ctx, "loja-b")
+		_, err = e.ConfirmarReserva(lojaB, reserva.ID)
+		assertEnvolve(t, err, repo.ErrReservaNaoEncontrada)
+		_, err = e.LiberarReserva(lojaB, reserva.ID)
+		assertEnvolve(t, err, repo.ErrReservaNaoEncontrada)
+
+		estoque, err := e.ConsultarEstoque(lojaA, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Estoque{ProdutoID: produto.ID, Quantidade: 10, Reservado: 3}, estoque)
+		liberada, err := e.LiberarReserva(lojaA, reserva.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.ReservaLiberada), liberada.Status)
+	})
+
+	t.Run("Estoque com quantidade inválida ou produto inexistente", func(t *testing.T) {
+		r, e := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		removido := criar(t, r, "Mouse", 4990)
+		assert.NoError(t, r.Deletar(ctx, removido.ID, removido.Versao))
+
+		_, err := e.DefinirEstoque(ctx, produto.ID, -1)
+		assertEnvolve(t, err, repo.ErrQuantidadeInvalida)
+		_, err = e.Reservar(ctx, produto.ID, 0, time.Minute)
+		assertEnvolve(t, err, repo.ErrQuantidadeInvalida)
+
+		for _, id := range []uuid.UUID{uuid.New(), removido.ID} {
+			_, err = e.DefinirEstoque(ctx, id, 10)
+			assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+			_, err = e.ConsultarEstoque(ctx, id)
+			assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+			_, err = e.Reservar(ctx, id, 1, time.Minute)
+			assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		}
+
+		_, err = e.ConfirmarReserva(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrReservaNaoEncontrada)
+		_, err = e.LiberarReserva(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrReservaNaoEncontrada)
+	})
+
+	t.Run("Reservar e confirmar", func(t *testing.T) {
+		r, e := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		_, err := e.DefinirEstoque(ctx, produto.ID, 10)
+		assert.NoError(t, err)
+
+		reserva, err := e.Reservar(ctx, produto.ID, 3, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.ReservaPendente), reserva.Status)
+		assert.Equal(t, 3, reserva.Quantidade)
+		assert.True(t, reserva.ExpiraEm.After(reserva.CriadaEm))
+		assertEstoque(t, e, produto.ID, 10, 3)
+
+		_, err = e.Reservar(ctx, produto.ID, 8, time.Minute)
+		assertEnvolve(t, err, repo.ErrEstoqueInsuficiente)
+		_, err = e.DefinirEstoque(ctx, produto.ID, 2)
+		assertEnvolve(t, err, repo.ErrEstoqueInsuficiente)
+
+		confirmada, err := e.ConfirmarReserva(ctx, reserva.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.ReservaConfirmada), confirmada.Status)
+		assertEstoque(t, e, produto.ID, 7, 0)
+
+		// Confirmar de novo não baixa o estoque outra vez
+		_, err = e.ConfirmarReserva(ctx, reserva.ID)
+		assert.NoError(t, err)
+		assertEstoque(t, e, produto.ID, 7, 0)
+
+		_, err = e.LiberarReserva(ctx, reserva.ID)
+		assertEnvolve(t, err, repo.ErrReservaEncerrada)
+	})
+
+	t.Run("Liberar reserva", func(t *testing.T) {
+		r, e := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		_, err := e.DefinirEstoque(ctx, produto.ID, 10)
+		assert.NoError(t, err)
+		reserva, err := e.Reservar(ctx, produto.ID, 4, time.Minute)
+		assert.NoError(t, err)
+
+		liberada, err := e.LiberarReserva(ctx, reserva.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.ReservaLiberada), liberada.Status)
+		assertEstoque(t, e, produto.ID, 10, 0)
+
+		_, err = e.LiberarReserva(ctx, reserva.ID)
+		assert.NoError(t, err)
+		assertEstoque(t, e, produto.ID, 10, 0)
+
+		_, err = e.ConfirmarReserva(ctx, reserva.ID)
+		assertEnvolve(t, err, repo.ErrReservaEncerrada)
+	})
+
+	t.Run("Expirar reservas vencidas", func(t *testing.T) {
+		r, e := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		outro := criar(t, r, "Mouse", 4990)
+		for _, id := range []uuid.UUID{produto.ID, outro.ID} {
+			_, err := e.DefinirEstoque(ctx, id, 5)
+			assert.NoError(t, err)
+		}
+		primeira, err := e.Reservar(ctx, produto.ID, 2, time.Hour)
+		assert.NoError(t, err)
+		_, err = e.Reservar(ctx, produto.ID, 3, time.Hour)
+		assert.NoError(t, err)
+		_, err = e.Reservar(ctx, outro.ID, 1, 3*time.Hour)
+		assert.NoError(t, err)
+
+		expiradas, err := e.ExpirarReservas(ctx, time.Now())
+		assert.NoError(t, err)
+		assert.Zero(t, expiradas)
+
+		expiradas, err = e.ExpirarReservas(ctx, time.Now().Add(2*time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), expiradas)
+		assertEstoque(t, e, produto.ID, 5, 0)
+		assertEstoque(t, e, outro.ID, 5, 1)
+
+		_, err = e.ConfirmarReserva(ctx, primeira.ID)
+		assertEnvolve(t, err, repo.ErrReservaExpirada)
+		liberada, err := e.LiberarReserva(ctx, primeira.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.ReservaExpirada), liberada.Status)
+		assertEstoque(t, e, produto.ID, 5, 0)
+	})
+
+	t.Run("Reserva vencida não bloqueia novas reservas", func(t *testing.T) {
+		r, e := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		_, err := e.DefinirEstoque(ctx, produto.ID, 1)
+		assert.NoError(t, err)
+		vencida, err := e.Reservar(ctx, produto.ID, 1, time.Millisecond)
+		assert.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+
+		// A reserva vencida é expirada por Reservar mesmo sem ExpirarReservas
+		_, err = e.Reservar(ctx, produto.ID, 1, time.Minute)
+		assert.NoError(t, err)
+		assertEstoque(t, e, produto.ID, 1, 1)
+
+		_, err = e.ConfirmarReserva(ctx, vencida.ID)
+		assertEnvolve(t, err, repo.ErrReservaExpirada)
+	})
+
+	t.Run("Reservas concorrentes não vendem além do estoque", func(t *testing.T) {
+		r, e := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		_, err := e.DefinirEstoque(ctx, produto.ID, 10)
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var sucessos, insuficientes int
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := e.Reservar(ctx, produto.ID, 1, time.Minute)
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					sucessos++
+				case errors.Is(err, repo.ErrEstoqueInsuficiente):
+					insuficientes++
+				default:
+					t.Errorf("erro inesperado: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 10, sucessos)
+		assert.Equal(t, 20, insuficientes)
+		assertEstoque(t, e, produto.ID, 10, 10)
+	})
+}
+
+// RunPedidos executa a suíte de contrato de repo.RepositorioPedidos.
+func RunPedidos(t *testing.T, novo FabricaPedidos) {
+	ctx := contexto()
+
+	t.Run("Criar pedido copia nome e preço dos produtos", func(t *testing.T) {
+		r, p := novo(t)
+		laptop := criar(t, r, "Laptop", 99999)
+		mouse := criar(t, r, "Mouse", 4990)
+
+		pedido, err := p.CriarPedido(ctx, []repo.ItemSolicitado{
+			{ProdutoID: laptop.ID, Quantidade: 1},
+			{ProdutoID: mouse.ID, Quantidade: 3},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.PedidoCriado), pedido.Status)
+		assert.Equal(t, models.Centavos(114969), pedido.Total)
+		if assert.Len(t, pedido.Itens, 2) {
+			assert.Equal(t, "Laptop", pedido.Itens[0].Nome)
+			assert.Equal(t, models.Centavos(99999), pedido.Itens[0].Subtotal)
+			assert.Equal(t, mouse.ID, pedido.Itens[1].ProdutoID)
+			assert.Equal(t, models.Centavos(4990), pedido.Itens[1].PrecoUnitario)
+			assert.Equal(t, 3, pedido.Itens[1].Quantidade)
+			assert.Equal(t, models.Centavos(14970), pedido.Itens[1].Subtotal)
+		}
+
+		// Alterar o produto depois não muda o pedido
+		_, err = r.Atualizar(ctx, mouse.ID, "Mouse Gamer", models.Centavos(19990), repo.QualquerVersao)
+		assert.NoError(t, err)
+
+		encontrado, err := p.BuscarPedido(ctx, pedido.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, pedido.ID, encontrado.ID)
+		assert.Equal(t, pedido.Total, encontrado.Total)
+		assert.Equal(t, pedido.Itens, encontrado.Itens)
+	})
+
+	t.Run("Pedido inválido não é criado", func(t *testing.T) {
+		r, p := novo(t)
+		produto := criar(t, r, "Laptop", 99999)
+		removido := criar(t, r, "Mouse", 4990)
+		assert.NoError(t, r.Deletar(ctx, removido.ID, removido.Versao))
+		deOutroTenant, err := r.Criar(repo.ComTenant(ctx, "loja-b"), "Teclado", models.Centavos(29990))
+		assert.NoError(t, err)
+
+		_, err = p.CriarPedido(ctx, nil)
+		assertEnvolve(t, err, repo.ErrPedidoVazio)
+		_, err = p.CriarPedido(ctx, []repo.ItemSolicitado{{ProdutoID: produto.ID, Quantidade: 0}})
+		assertEnvolve(t, err, repo.ErrQuantidadeInvalida)
+		for _, id := range []uuid.UUID{uuid.New(), removido.ID, deOutroTenant.ID} {
+			_, err = p.CriarPedido(ctx, []repo.ItemSolicitado{{ProdutoID: produto.ID, Quantidade: 1}, {ProdutoID: id, Quantidade: 1}})
+			assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		}
+
+		pedidos, err := p.ListarPedidos(ctx, "", 0)
+		assert.NoError(t, err)
+		assert.Empty(t, pedidos)
+
+		_, err = p.BuscarPedido(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrPedidoNaoEncontrado)
+		_, err = p.PagarPedido(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrPedidoNaoEncontrado)
+		_, err = p.CancelarPedido(ctx, uuid.New())
+		assertEnvolve(t, err, repo.ErrPedidoNaoEncontrado)
+	})
+
+	t.Run("Pedido de outro tenant é inexistente", func(t *testing.T) {
+		r, p := novo(t)
+		lojaA := repo.ComTenant(ctx, "loja-a")
+		produto, err := r.Criar(lojaA, "Laptop", models.Centavos(99999))
+		assert.NoError(t, err)
+		pedido, err := p.CriarPedido(lojaA, []repo.ItemSolicitado{{ProdutoID: produto.ID, Quantidade: 1}})
+		assert.NoError(t, err)
+		assert.Equal(t, "loja-a", pedido.TenantID)
+
+		lojaB := repo.ComTenant(ctx, "loja-b")
+		_, err = p.BuscarPedido(lojaB, pedido.ID)
+		assertEnvolve(t, err, repo.ErrPedidoNaoEncontrado)
+		_, err = p.PagarPedido(lojaB, pedido.ID)
+		assertEnvolve(t, err, repo.ErrPedidoNaoEncontrado)
+		_, err = p.CancelarPedido(lojaB, pedido.ID)
+		assertEnvolve(t, err, repo.ErrPedidoNaoEncontrado)
+		pedidos, err := p.ListarPedidos(lojaB, "", 0)
+		assert.NoError(t, err)
+		assert.Empty(t, pedidos)
+
+		encontrado, err := p.BuscarPedido(lojaA, pedido.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.PedidoCriado), encontrado.Status)
+		pedidos, err = p.ListarPedidos(lojaA, "", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{pedido.ID}, idsDosPedidos(pedidos))
+	})
+
+	t.Run("Pedido passa por pago e enviado", func(t *testing.T) {
+		r, p := novo(t)
+		pedido := criarPedido(t, r, p)
+
+		_, err := p.EnviarPedido(ctx, pedido.ID)
+		assertEnvolve(t, err, repo.ErrTransicaoInvalida)
+
+		pago, err := p.PagarPedido(ctx, pedido.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.PedidoPago), pago.Status)
+		assert.Equal(t, pedido.Itens, pago.Itens)
+		_, err = p.PagarPedido(ctx, pedido.ID)
+		assertEnvolve(t, err, repo.ErrTransicaoInvalida)
+
+		enviado, err := p.EnviarPedido(ctx, pedido.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.PedidoEnviado), enviado.Status)
+
+		// Um pedido enviado não pode mais ser cancelado
+		_, err = p.CancelarPedido(ctx, pedido.ID)
+		assertEnvolve(t, err, repo.ErrTransicaoInvalida)
+
+		encontrado, err := p.BuscarPedido(ctx, pedido.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, string(repo.PedidoEnviado), encontrado.Status)
+	})
+
+	t.Run("Cancelar pedido é idempotente", func(t *testing.T) {
+		r, p := novo(t)
+		pedido := criarPedido(t, r, p)
+		pago := criarPedido(t, r, p)
+		_, err := p.PagarPedido(ctx, pago.ID)
+		assert.NoError(t, err)
+
+		for _, id := range []uuid.UUID{pedido.ID, pago.ID} {
+			cancelado, err := p.CancelarPedido(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, string(repo.PedidoCancelado), cancelado.Status)
+
+			deNovo, err := p.CancelarPedido(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, string(repo.PedidoCancelado), deNovo.Status)
+			assert.True(t, cancelado.AtualizadoEm.Equal(deNovo.AtualizadoEm), "cancelar de novo não deve alterar o pedido")
+		}
+
+		_, err = p.PagarPedido(ctx, pedido.ID)
+		assertEnvolve(t, err, repo.ErrTransicaoInvalida)
+	})
+
+	t.Run("Cancelamentos concorrentes", func(t *testing.T) {
+		r, p := novo(t)
+		pedido := criarPedido(t, r, p)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cancelado, err := p.CancelarPedido(ctx, pedido.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, string(repo.PedidoCancelado), cancelado.Status)
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("Listar pedidos por status", func(t *testing.T) {
+		r, p := novo(t)
+		var ids []uuid.UUID
+		for i := 0; i < 3; i++ {
+			ids = append(ids, criarPedido(t, r, p).ID)
+			time.Sleep(2 * time.Millisecond)
+		}
+		_, err := p.PagarPedido(ctx, ids[1])
+		assert.NoError(t, err)
+
+		pedidos, err := p.ListarPedidos(ctx, "", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{ids[2], ids[1], ids[0]}, idsDosPedidos(pedidos))
+		for _, pedido := range pedidos {
+			assert.Len(t, pedido.Itens, 1)
+		}
+
+		pedidos, err = p.ListarPedidos(ctx, repo.PedidoPago, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{ids[1]}, idsDosPedidos(pedidos))
+
+		pedidos, err = p.ListarPedidos(ctx, repo.PedidoCriado, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{ids[2]}, idsDosPedidos(pedidos))
+
+		_, err = p.ListarPedidos(ctx, "devolvido", 0)
+		assertEnvolve(t, err, repo.ErrStatusPedidoInvalido)
+	})
+}
+
+// RunVariantes executa a suíte de contrato das grades de variantes.
+func RunVariantes(t *testing.T, novo FabricaVariantes) {
+	ctx := contexto()
+
+	t.Run("Variantes são produtos com preço próprio", func(t *testing.T) {
+		r, v := novo(t)
+		pai := criarGrade(t, r, v)
+
+		var criadas []models.Variante
+		for _, nova := range []repo.NovaVariante{
+			{SKU: "CAM-G-PRE", Opcoes: map[string]string{"Tamanho": "G", "Cor": "Preto"}, Preco: models.Centavos(5990)},
+			{SKU: "CAM-P-AZU", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Azul"}, Preco: models.Centavos(4990)},
+			{SKU: "CAM-P-PRE", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Preto"}, Preco: models.Centavos(4990)},
+		} {
+			variante, err := v.CriarVariante(ctx, pai.ID, nova)
+			assert.NoError(t, err)
+			criadas = append(criadas, variante)
+		}
+		if !assert.NotNil(t, criadas[0].Produto) {
+			return
+		}
+		assert.Equal(t, pai.ID, criadas[0].PaiID)
+		assert.Equal(t, "Camiseta (G, Preto)", criadas[0].Produto.Nome)
+		assert.Equal(t, models.Centavos(5990), criadas[0].Produto.Preco)
+		assert.Equal(t, criadas[0].ProdutoID, criadas[0].Produto.ID)
+
+		// O SKU é um produto comum, com histórico próprio
+		produto, err := r.Buscar(ctx, criadas[0].ProdutoID)
+		assert.NoError(t, err)
+		assert.Equal(t, *criadas[0].Produto, produto)
+		_, err = r.Atualizar(ctx, produto.ID, produto.Nome, models.Centavos(6490), produto.Versao)
+		assert.NoError(t, err)
+		historico, err := r.Historico(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Len(t, historico, 2)
+
+		grade, err := v.Grade(ctx, pai.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, pai.ID, grade.ProdutoID)
+		assert.Len(t, grade.Eixos, 2)
+		var skus []string
+		for _, variante := range grade.Variantes {
+			skus = append(skus, variante.SKU)
+		}
+		assert.Equal(t, []string{"CAM-P-AZU", "CAM-P-PRE", "CAM-G-PRE"}, skus)
+		if assert.Len(t, grade.Variantes, 3) && assert.NotNil(t, grade.Variantes[2].Produto) {
+			assert.Equal(t, models.Centavos(6490), grade.Variantes[2].Produto.Preco)
+			assert.Equal(t, map[string]string{"Tamanho": "G", "Cor": "Preto"}, grade.Variantes[2].Opcoes)
+		}
+
+		encontrada, err := v.BuscarSKU(ctx, "CAM-P-AZU")
+		assert.NoError(t, err)
+		assert.Equal(t, criadas[1].ProdutoID, encontrada.ProdutoID)
+		assert.Equal(t, criadas[1].Opcoes, encontrada.Opcoes)
+	})
+
+	t.Run("Combinação e SKU são únicos", func(t *testing.T) {
+		r, v := novo(t)
+		pai := criarGrade(t, r, v)
+		outro := criarGradeComNome(t, r, v, "Camiseta Polo")
+		opcoes := map[string]string{"Tamanho": "P", "Cor": "Azul"}
+
+		_, err := v.CriarVariante(ctx, pai.ID, repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: opcoes, Preco: models.Centavos(4990)})
+		assert.NoError(t, err)
+		_, err = v.CriarVariante(ctx, pai.ID, repo.NovaVariante{SKU: "CAM-P-AZU-2", Opcoes: map[string]string{"Cor": "Azul", "Tamanho": "P"}, Preco: models.Centavos(4990)})
+		assertEnvolve(t, err, repo.ErrCombinacaoDuplicada)
+		_, err = v.CriarVariante(ctx, outro.ID, repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: opcoes, Preco: models.Centavos(4990)})
+		assertEnvolve(t, err, repo.ErrSKUDuplicado)
+
+		// A mesma combinação em outro pai e o mesmo SKU em outro tenant são
+		// permitidos
+		_, err = v.CriarVariante(ctx, outro.ID, repo.NovaVariante{SKU: "CAM2-P-AZU", Opcoes: opcoes, Preco: models.Centavos(4990)})
+		assert.NoError(t, err)
+		deOutroTenant := repo.ComTenant(ctx, "loja-b")
+		paiB, err := r.Criar(deOutroTenant, "Camiseta", models.Centavos(4990))
+		assert.NoError(t, err)
+		_, err = v.DefinirEixos(deOutroTenant, paiB.ID, []models.EixoVariante{{Nome: "Tamanho", Valores: []string{"P"}}})
+		assert.NoError(t, err)
+		_, err = v.CriarVariante(deOutroTenant, paiB.ID, repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: map[string]string{"Tamanho": "P"}, Preco: models.Centavos(4990)})
+		assert.NoError(t, err)
+
+		grade, err := v.Grade(ctx, pai.ID)
+		assert.NoError(t, err)
+		assert.Len(t, grade.Variantes, 1)
+		_, err = v.BuscarSKU(deOutroTenant, "CAM2-P-AZU")
+		assertEnvolve(t, err, repo.ErrVarianteNaoEncontrada)
+	})
+
+	t.Run("Variante inválida não é criada", func(t *testing.T) {
+		r, v := novo(t)
+		pai := criarGrade(t, r, v)
+		semEixos := criar(t, r, "Caneca", 2990)
+
+		for _, caso := range []struct {
+			nova      repo.NovaVariante
+			sentinela error
+		}{
+			{repo.NovaVariante{SKU: "CAM-P", Opcoes: map[string]string{"Tamanho": "P"}}, repo.ErrOpcoesInvalidas},
+			{repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Azul", "Gola": "V"}}, repo.ErrOpcoesInvalidas},
+			{repo.NovaVariante{SKU: "CAM-XG-AZU", Opcoes: map[string]string{"Tamanho": "XG", "Cor": "Azul"}}, repo.ErrOpcoesInvalidas},
+			{repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: map[string]string{"Tamanho": "P", "Gola": "Azul"}}, repo.ErrOpcoesInvalidas},
+			{repo.NovaVariante{SKU: "CAM P AZU", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Azul"}}, repo.ErrSKUInvalido},
+			{repo.NovaVariante{SKU: "", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Azul"}}, repo.ErrSKUInvalido},
+			{repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Azul"}, Preco: models.Centavos(-1)}, repo.ErrPrecoInvalido},
+		} {
+			_, err := v.CriarVariante(ctx, pai.ID, caso.nova)
+			assertEnvolve(t, err, caso.sentinela)
+		}
+
+		valida := repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Azul"}, Preco: models.Centavos(4990)}
+		_, err := v.CriarVariante(ctx, semEixos.ID, valida)
+		assertEnvolve(t, err, repo.ErrProdutoSemEixos)
+		_, err = v.CriarVariante(ctx, uuid.New(), valida)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = v.CriarVariante(repo.ComTenant(ctx, "loja-b"), pai.ID, valida)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = v.Grade(repo.ComTenant(ctx, "loja-b"), pai.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		grade, err := v.Grade(ctx, pai.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, grade.Variantes)
+		grade, err = v.Grade(ctx, semEixos.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, grade.Eixos)
+		_, err = v.BuscarSKU(ctx, "CAM-P-AZU")
+		assertEnvolve(t, err, repo.ErrVarianteNaoEncontrada)
+	})
+
+	t.Run("Eixos inválidos ou em uso não são gravados", func(t *testing.T) {
+		r, v := novo(t)
+		produto := criar(t, r, "Camiseta", 4990)
+
+		for _, eixos := range [][]models.EixoVariante{
+			nil,
+			{{Nome: "Tamanho", Valores: []string{"P"}}, {Nome: "Tamanho", Valores: []string{"M"}}},
+			{{Nome: " ", Valores: []string{"P"}}},
+			{{Nome: "Tamanho"}},
+			{{Nome: "Tamanho", Valores: []string{"P", "P"}}},
+			{{Nome: "Tamanho", Valores: []string{"P", ""}}},
+		} {
+			_, err := v.DefinirEixos(ctx, produto.ID, eixos)
+			assertEnvolve(t, err, repo.ErrEixosInvalidos)
+		}
+		_, err := v.DefinirEixos(ctx, uuid.New(), []models.EixoVariante{{Nome: "Tamanho", Valores: []string{"P"}}})
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		// Os eixos podem ser trocados até a primeira variante
+		_, err = v.DefinirEixos(ctx, produto.ID, []models.EixoVariante{{Nome: "Tamanho", Valores: []string{"P"}}})
+		assert.NoError(t, err)
+		grade, err := v.DefinirEixos(ctx, produto.ID, []models.EixoVariante{{Nome: "Tamanho", Valores: []string{"P", "M"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, []models.EixoVariante{{Nome: "Tamanho", Valores: []string{"P", "M"}}}, grade.Eixos)
+
+		variante, err := v.CriarVariante(ctx, produto.ID, repo.NovaVariante{SKU: "CAM-M", Opcoes: map[string]string{"Tamanho": "M"}, Preco: models.Centavos(4990)})
+		assert.NoError(t, err)
+		_, err = v.DefinirEixos(ctx, produto.ID, []models.EixoVariante{{Nome: "Cor", Valores: []string{"Azul"}}})
+		assertEnvolve(t, err, repo.ErrGradeComVariantes)
+		_, err = v.DefinirEixos(ctx, variante.ProdutoID, []models.EixoVariante{{Nome: "Cor", Valores: []string{"Azul"}}})
+		assertEnvolve(t, err, repo.ErrEixosInvalidos)
+
+		grade, err = v.Grade(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []models.EixoVariante{{Nome: "Tamanho", Valores: []string{"P", "M"}}}, grade.Eixos)
+	})
+
+	t.Run("Variante removida sai da grade e mantém o SKU", func(t *testing.T) {
+		r, v := novo(t)
+		pai := criarGrade(t, r, v)
+		nova := repo.NovaVariante{SKU: "CAM-P-AZU", Opcoes: map[string]string{"Tamanho": "P", "Cor": "Azul"}, Preco: models.Centavos(4990)}
+		variante, err := v.CriarVariante(ctx, pai.ID, nova)
+		assert.NoError(t, err)
+
+		assert.NoError(t, r.Deletar(ctx, variante.ProdutoID, repo.QualquerVersao))
+		grade, err := v.Grade(ctx, pai.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, grade.Variantes)
+		_, err = v.BuscarSKU(ctx, nova.SKU)
+		assertEnvolve(t, err, repo.ErrVarianteNaoEncontrada)
+		_, err = v.CriarVariante(ctx, pai.ID, nova)
+		assertEnvolve(t, err, repo.ErrSKUDuplicado)
+
+		_, err = r.Restaurar(ctx, variante.ProdutoID)
+		assert.NoError(t, err)
+		encontrada, err := v.BuscarSKU(ctx, nova.SKU)
+		assert.NoError(t, err)
+		assert.Equal(t, variante.ProdutoID, encontrada.ProdutoID)
+
+		// Expurgar o filho libera o SKU e a combinação
+		assert.NoError(t, r.Deletar(ctx, variante.ProdutoID, repo.QualquerVersao))
+		_, err = r.Purgar(ctx, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		_, err = v.CriarVariante(ctx, pai.ID, nova)
+		assert.NoError(t, err)
+	})
+}
+
+// RunPrecos verifica a linha do tempo de preços e os preços agendados.
+func RunPrecos(t *testing.T, novo FabricaPrecos) {
+	ctx := contexto()
+
+	t.Run("Cada mudança de preço abre um período", func(t *testing.T) {
+		r, p := novo(t)
+		produto := criar(t, r, "Teclado", 10000)
+
+		// Mudar só o nome não afeta a linha do tempo
+		produto, err := r.Atualizar(ctx, produto.ID, "Teclado mecânico", produto.Preco, produto.Versao)
+		assert.NoError(t, err)
+		produto, err = r.Atualizar(ctx, produto.ID, produto.Nome, models.Centavos(12000), produto.Versao)
+		assert.NoError(t, err)
+		_, err = r.AplicarLote(ctx, []repo.OperacaoLote{
+			{Tipo: repo.OperacaoAtualizar, ID: produto.ID, Nome: produto.Nome, Preco: models.Centavos(9000), Versao: produto.Versao},
+		})
+		assert.NoError(t, err)
+
+		precos, err := p.Precos(ctx, produto.ID)
+		assert.NoError(t, err)
+		if !assert.Len(t, precos, 3) {
+			return
+		}
+		for i, centavos := range []int64{10000, 12000, 9000} {
+			assert.Equal(t, models.Centavos(centavos), precos[i].Preco)
+			assert.Equal(t, produto.ID, precos[i].ProdutoID)
+			assert.False(t, precos[i].Agendado)
+		}
+		for i := 0; i < 2; i++ {
+			if assert.NotNil(t, precos[i].VigenteAte) {
+				assert.True(t, precos[i].VigenteAte.Equal(precos[i+1].VigenteDe))
+			}
+		}
+		assert.Nil(t, precos[2].VigenteAte)
+
+		// A linha do tempo sobrevive à remoção
+		assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+		precos, err = p.Precos(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Len(t, precos, 3)
+	})
+
+	t.Run("Agendar exige o futuro e um produto ativo", func(t *testing.T) {
+		r, p := novo(t)
+		produto := criar(t, r, "Mouse", 5000)
+		amanha := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+		_, err := p.AgendarPreco(ctx, produto.ID, models.Centavos(4000), time.Now().Add(-time.Minute))
+		assertEnvolve(t, err, repo.ErrAgendamentoInvalido)
+		_, err = p.AgendarPreco(ctx, produto.ID, models.Centavos(-1), amanha)
+		assertEnvolve(t, err, repo.ErrPrecoInvalido)
+		_, err = p.AgendarPreco(ctx, uuid.New(), models.Centavos(4000), amanha)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = p.AgendarPreco(repo.ComTenant(ctx, "loja-b"), produto.ID, models.Centavos(4000), amanha)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = p.Precos(repo.ComTenant(ctx, "loja-b"), produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		// Agendar de novo para o mesmo instante substitui o preço
+		agendado, err := p.AgendarPreco(ctx, produto.ID, models.Centavos(4000), amanha)
+		assert.NoError(t, err)
+		assert.True(t, agendado.Agendado)
+		assert.True(t, amanha.Equal(agendado.VigenteDe))
+		substituto, err := p.AgendarPreco(ctx, produto.ID, models.Centavos(3500), amanha)
+		assert.NoError(t, err)
+		assert.Equal(t, agendado.ID, substituto.ID)
+
+		precos, err := p.Precos(ctx, produto.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, precos, 2) {
+			assert.Equal(t, models.Centavos(5000), precos[0].Preco)
+			assert.Nil(t, precos[0].VigenteAte)
+			assert.Equal(t, substituto.ID, precos[1].ID)
+			assert.Equal(t, models.Centavos(3500), precos[1].Preco)
+			assert.True(t, precos[1].Agendado)
+		}
+
+		// O preço atual não muda até o agendamento ser aplicado
+		atual, err := r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Centavos(5000), atual.Preco)
+
+		assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+		_, err = p.AgendarPreco(ctx, produto.ID, models.Centavos(4000), amanha)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Preços agendados entram em vigor na ordem", func(t *testing.T) {
+		r, p := novo(t)
+		produto := criar(t, r, "Monitor", 100000)
+		agora := time.Now()
+		promocao, err := p.AgendarPreco(ctx, produto.ID, models.Centavos(80000), agora.Add(time.Hour))
+		assert.NoError(t, err)
+		_, err = p.AgendarPreco(ctx, produto.ID, models.Centavos(95000), agora.Add(2*time.Hour))
+		assert.NoError(t, err)
+
+		aplicados, err := p.AplicarPrecosAgendados(ctx, agora)
+		assert.NoError(t, err)
+		assert.Empty(t, aplicados)
+
+		aplicados, err = p.AplicarPrecosAgendados(ctx, agora.Add(90*time.Minute))
+		assert.NoError(t, err)
+		if assert.Len(t, aplicados, 1) {
+			assert.Equal(t, promocao.ID, aplicados[0].ID)
+			assert.False(t, aplicados[0].Agendado)
+		}
+		atual, err := r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Centavos(80000), atual.Preco)
+		assert.Equal(t, 2, atual.Versao)
+
+		// A aplicação é uma alteração do AutorPadrao
+		historico, err := r.Historico(ctx, produto.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, historico, 2) {
+			assert.Equal(t, string(repo.OperacaoAtualizar), historico[1].Operacao)
+			assert.Equal(t, repo.AutorPadrao, historico[1].Autor)
+		}
+
+		precos, err := p.Precos(ctx, produto.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, precos, 3) {
+			assert.Equal(t, models.Centavos(100000), precos[0].Preco)
+			if assert.NotNil(t, precos[0].VigenteAte) {
+				assert.True(t, precos[0].VigenteAte.Equal(precos[1].VigenteDe))
+			}
+			assert.Equal(t, promocao.ID, precos[1].ID)
+			assert.False(t, precos[1].Agendado)
+			assert.Nil(t, precos[1].VigenteAte)
+			assert.True(t, precos[2].Agendado)
+		}
+
+		aplicados, err = p.AplicarPrecosAgendados(ctx, agora.Add(3*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, aplicados, 1)
+		aplicados, err = p.AplicarPrecosAgendados(ctx, agora.Add(3*time.Hour))
+		assert.NoError(t, err)
+		assert.Empty(t, aplicados)
+		atual, err = r.Buscar(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Centavos(95000), atual.Preco)
+	})
+
+	t.Run("Agendamentos atravessam tenants e esperam a restauração", func(t *testing.T) {
+		r, p := novo(t)
+		deOutroTenant := repo.ComTenant(ctx, "loja-b")
+		produto, err := r.Criar(deOutroTenant, "Cadeira", models.Centavos(70000))
+		assert.NoError(t, err)
+		removido := criar(t, r, "Mesa", 90000)
+		agora := time.Now()
+		_, err = p.AgendarPreco(deOutroTenant, produto.ID, models.Centavos(60000), agora.Add(time.Hour))
+		assert.NoError(t, err)
+		_, err = p.AgendarPreco(ctx, removido.ID, models.Centavos(85000), agora.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.NoError(t, r.Deletar(ctx, removido.ID, repo.QualquerVersao))
+
+		aplicados, err := p.AplicarPrecosAgendados(ctx, agora.Add(2*time.Hour))
+		assert.NoError(t, err)
+		if assert.Len(t, aplicados, 1) {
+			assert.Equal(t, produto.ID, aplicados[0].ProdutoID)
+			assert.Equal(t, "loja-b", aplicados[0].TenantID)
+		}
+		atual, err := r.Buscar(deOutroTenant, produto.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Centavos(60000), atual.Preco)
+
+		_, err = r.Restaurar(ctx, removido.ID)
+		assert.NoError(t, err)
+		aplicados, err = p.AplicarPrecosAgendados(ctx, agora.Add(2*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, aplicados, 1)
+		atual, err = r.Buscar(ctx, removido.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.Centavos(85000), atual.Preco)
+	})
+}
+
+// RunImagens verifica os metadados das imagens de produtos.
+func RunImagens(t *testing.T, novo FabricaImagens) {
+	ctx := contexto()
+
+	t.Run("Adicionar e consultar imagens", func(t *testing.T) {
+		r, i := novo(t)
+		produto := criar(t, r, "Cadeira", 70000)
+		semImagens := criar(t, r, "Mesa", 90000)
+
+		frente, err := i.AdicionarImagem(ctx, novaImagem(produto.ID))
+		assert.NoError(t, err)
+		assert.Equal(t, repo.TenantPadrao, frente.TenantID)
+		assert.False(t, frente.CriadaEm.IsZero())
+		verso, err := i.AdicionarImagem(ctx, novaImagem(produto.ID))
+		assert.NoError(t, err)
+
+		imagens, err := i.Imagens(ctx, []uuid.UUID{produto.ID, semImagens.ID, uuid.New()})
+		assert.NoError(t, err)
+		assert.Len(t, imagens, 1)
+		if assert.Len(t, imagens[produto.ID], 2) {
+			assert.Equal(t, frente.ID, imagens[produto.ID][0].ID)
+			assert.Equal(t, verso.ID, imagens[produto.ID][1].ID)
+			assert.Equal(t, "image/png", imagens[produto.ID][0].TipoConteudo)
+			assert.Equal(t, int64(2048), imagens[produto.ID][0].Tamanho)
+			assert.Equal(t, 640, imagens[produto.ID][0].Largura)
+			assert.Equal(t, 480, imagens[produto.ID][0].Altura)
+		}
+
+		vazio, err := i.Imagens(ctx, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, vazio)
+
+		// Outros tenants não enxergam nem alteram as imagens
+		deOutroTenant := repo.ComTenant(ctx, "loja-b")
+		imagens, err = i.Imagens(deOutroTenant, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+		assert.Empty(t, imagens)
+		_, err = i.AdicionarImagem(deOutroTenant, novaImagem(produto.ID))
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = i.AdicionarImagem(ctx, novaImagem(uuid.New()))
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+	})
+
+	t.Run("Imagens de produto removido ficam ocultas até a restauração", func(t *testing.T) {
+		r, i := novo(t)
+		produto := criar(t, r, "Sofá", 250000)
+		imagem, err := i.AdicionarImagem(ctx, novaImagem(produto.ID))
+		assert.NoError(t, err)
+
+		assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+		imagens, err := i.Imagens(ctx, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+		assert.Empty(t, imagens)
+		_, err = i.AdicionarImagem(ctx, novaImagem(produto.ID))
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		_, err = i.RemoverImagem(ctx, produto.ID, imagem.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		_, err = r.Restaurar(ctx, produto.ID)
+		assert.NoError(t, err)
+		imagens, err = i.Imagens(ctx, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+		if assert.Len(t, imagens[produto.ID], 1) {
+			assert.Equal(t, imagem.ID, imagens[produto.ID][0].ID)
+		}
+	})
+
+	t.Run("Remover imagem", func(t *testing.T) {
+		r, i := novo(t)
+		produto := criar(t, r, "Poltrona", 120000)
+		primeira, err := i.AdicionarImagem(ctx, novaImagem(produto.ID))
+		assert.NoError(t, err)
+		segunda, err := i.AdicionarImagem(ctx, novaImagem(produto.ID))
+		assert.NoError(t, err)
+
+		_, err = i.RemoverImagem(repo.ComTenant(ctx, "loja-b"), produto.ID, primeira.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		removida, err := i.RemoverImagem(ctx, produto.ID, primeira.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, primeira.ID, removida.ID)
+		assert.Equal(t, primeira.TipoConteudo, removida.TipoConteudo)
+		_, err = i.RemoverImagem(ctx, produto.ID, primeira.ID)
+		assertEnvolve(t, err, repo.ErrImagemNaoEncontrada)
+
+		imagens, err := i.Imagens(ctx, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+		if assert.Len(t, imagens[produto.ID], 1) {
+			assert.Equal(t, segunda.ID, imagens[produto.ID][0].ID)
+		}
+
+		_, err = i.RemoverImagem(ctx, produto.ID, segunda.ID)
+		assert.NoError(t, err)
+		imagens, err = i.Imagens(ctx, []uuid.UUID{produto.ID})
+		assert.NoError(t, err)
+		assert.Empty(t, imagens)
+	})
+
+	t.Run("Expurgar imagens do produto removido", func(t *testing.T) {
+		r, i := novo(t)
+		produto := criar(t, r, "Sofá", 250000)
+		vizinho := criar(t, r, "Poltrona", 120000)
+		var esperadas []uuid.UUID
+		for j := 0; j < 2; j++ {
+			imagem, err := i.AdicionarImagem(ctx, novaImagem(produto.ID))
+			assert.NoError(t, err)
+			esperadas = append(esperadas, imagem.ID)
+		}
+		mantida, err := i.AdicionarImagem(ctx, novaImagem(vizinho.ID))
+		assert.NoError(t, err)
+
+		// Só o produto já removido, e do próprio tenant, perde as imagens
+		_, err = i.ExpurgarImagensDoProduto(ctx, produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+		assert.NoError(t, r.Deletar(ctx, produto.ID, repo.QualquerVersao))
+		_, err = i.ExpurgarImagensDoProduto(repo.ComTenant(ctx, "loja-b"), produto.ID)
+		assertEnvolve(t, err, repo.ErrProdutoNaoEncontrado)
+
+		expurgadas, err := i.ExpurgarImagensDoProduto(ctx, produto.ID)
+		assert.NoError(t, err)
+		ids := make([]uuid.UUID, len(expurgadas))
+		for j, imagem := range expurgadas {
+			ids[j] = imagem.ID
+		}
+		assert.ElementsMatch(t, esperadas, ids)
+		expurgadas, err = i.ExpurgarImagensDoProduto(ctx, produto.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, expurgadas)
+
+		_, err = r.Restaurar(ctx, produto.ID)
+		assert.NoError(t, err)
+		imagens, err := i.Imagens(ctx, []uuid.UUID{produto.ID, vizinho.ID})
+		assert.NoError(t, err)
+		assert.Len(t, imagens, 1)
+		if assert.Len(t, imagens[vizinho.ID], 1) {
+			assert.Equal(t, mantida.ID, imagens[vizinho.ID][0].ID)
+		}
+	})
+
+	t.Run("Expurgar imagens dos removidos de todos os tenants", func(t *testing.T) {
+		r, i := novo(t)
+		deOutroTenant := repo.ComTenant(ctx, "loja-b")
+		ativo := criar(t, r, "Luminária", 15000)
+		removido := criar(t, r, "Abajur", 9000)
+		doOutro, err := r.Criar(deOutroTenant, "Tapete", models.Centavos(30000))
+		assert.NoError(t, err)
+
+		mantida, err := i.AdicionarImagem(ctx, novaImagem(ativo.ID))
+		assert.NoError(t, err)
+		var esperadas []uuid.UUID
+		for _, p := range []struct {
+			ctx context.Context
+			id  uuid.UUID
+		}{{ctx, removido.ID}, {ctx, removido.ID}, {deOutroTenant, doOutro.ID}} {
+			imagem, err := i.AdicionarImagem(p.ctx, novaImagem(p.id))
+			assert.NoError(t, err)
+			esperadas = append(esperadas, imagem.ID)
+		}
+		assert.NoError(t, r.Deletar(ctx, removido.ID, repo.QualquerVersao))
+		assert.NoError(t, r.Deletar(deOutroTenant, doOutro.ID, repo.QualquerVersao))
+
+		expurgadas, err := i.ExpurgarImagens(ctx, time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.Empty(t, expurgadas)
+
+		expurgadas, err = i.ExpurgarImagens(ctx, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		ids := make([]uuid.UUID, len(expurgadas))
+		for j, imagem := range expurgadas {
+			ids[j] = imagem.ID
+		}
+		assert.ElementsMatch(t, esperadas, ids)
+
+		// Restaurar depois do expurgo não traz as imagens de volta
+		_, err = r.Restaurar(ctx, removido.ID)
+		assert.NoError(t, err)
+		imagens, err := i.Imagens(ctx, []uuid.UUID{ativo.ID, removido.ID})
+		assert.NoError(t, err)
+		assert.Len(t, imagens, 1)
+		if assert.Len(t, imagens[ativo.ID], 1) {
+			assert.Equal(t, mantida.ID, imagens[ativo.ID][0].ID)
+		}
+	})
+}
+
+// novaImagem descreve uma imagem PNG de 640x480 para o produto.
+func novaImagem(produtoID uuid.UUID) models.Imagem {
+	return models.Imagem{ID: uuid.New(), ProdutoID: produtoID, TipoConteudo: "image/png", Tamanho: 2048, Largura: 640, Altura: 480}
+}
+
+// criarGrade cria uma camiseta com os eixos Tamanho (P, M, G) e Cor (Azul,
+// Preto).
+func criarGrade(t *testing.T, r repo.RepositorioProdutos, v repo.RepositorioVariantes) models.Produto {
+	t.Helper()
+
+	return criarGradeComNome(t, r, v, "Camiseta")
+}
+
+// criarGradeComNome cria a grade de criarGrade num produto de outro nome,
+// já que os nomes são únicos no tenant.
+func criarGradeComNome(t *testing.T, r repo.RepositorioProdutos, v repo.RepositorioVariantes, nome string) models.Produto {
+	t.Helper()
+
+	pai := criar(t, r, nome, 4990)
+	_, err := v.DefinirEixos(contexto(), pai.ID, []models.EixoVariante{
+		{Nome: "Tamanho", Valores: []string{"P", "M", "G"}},
+		{Nome: "Cor", Valores: []string{"Azul", "Preto"}},
+	})
+	assert.NoError(t, err)
+	return pai
+}
+
+// criarPedido cria um pedido de uma unidade de um produto novo, cujo nome
+// leva um sufixo aleatório para não repetir o de outro pedido.
+func criarPedido(t *testing.T, r repo.RepositorioProdutos, p repo.RepositorioPedidos) models.Pedido {
+	t.Helper()
+
+	produto := criar(t, r, "Laptop "+uuid.NewString()[:8], 99999)
+	pedido, err := p.CriarPedido(contexto(), []repo.ItemSolicitado{{ProdutoID: produto.ID, Quantidade: 1}})
+	assert.NoError(t, err)
+	return pedido
+}
+
+func idsDosPedidos(pedidos []models.Pedido) []uuid.UUID {
+	ids := make([]uuid.UUID, len(pedidos))
+	for i, p := range pedidos {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func assertEstoque(t *testing.T, e repo.RepositorioEstoque, produtoID uuid.UUID, quantidade, reservado int) {
+	t.Helper()
+
+	estoque, err := e.ConsultarEstoque(contexto(), produtoID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Estoque{ProdutoID: produtoID, Quantidade: quantidade, Reservado: reservado}, estoque)
+}
+
+func criarCategoria(t *testing.T, c repo.RepositorioCategorias, nome string, paiID *uuid.UUID) models.Categoria {
+	t.Helper()
+
+	categoria, err := c.CriarCategoria(contexto(), nome, paiID)
+	assert.NoError(t, err)
+	return categoria
+}
+
+// assertEnvolve confere que err é o sentinela esperado envolvido com %w, e
+// não o próprio sentinela sem contexto.
+func assertEnvolve(t *testing.T, err, sentinela error) bool {
+	t.Helper()
+	if !assert.ErrorIs(t, err, sentinela) {
+		return false
+	}
+	return assert.NotEqual(t, sentinela.Error(), err.Error(), "o sentinela deveria ser envolvido com contexto")
+}
+
+// assertDuplicado confere que err recusa um nome já usado pelo produto
+// existente.
+func assertDuplicado(t *testing.T, err error, existente uuid.UUID) {
+	t.Helper()
+	var duplicado *repo.ProdutoDuplicadoError
+	if assertEnvolve(t, err, repo.ErrProdutoDuplicado) && assert.ErrorAs(t, err, &duplicado) {
+		assert.Equal(t, existente, duplicado.ExistenteID)
+	}
+}
+
+// contexto é o contexto das operações feitas no tenant padrão.
+func contexto() context.Context {
+	return repo.ComTenant(context.Background(), repo.TenantPadrao)
+}
+
+func criar(t *testing.T, r repo.RepositorioProdutos, nome string, centavos int64) models.Produto {
+	t.Helper()
+	produto, err := r.Criar(contexto(), nome, models.Centavos(centavos))
+	assert.NoError(t, err)
+	return produto
+}
+
+// listarTudo percorre todas as páginas de Listar a partir do filtro.
+func listarTudo(t *testing.T, r repo.RepositorioProdutos, filtro repo.FiltroListagem) []models.Produto {
+	t.Helper()
+	var produtos []models.Produto
+	for {
+		pagina, err := r.Listar(contexto(), filtro)
+		if !assert.NoError(t, err) {
+			return produtos
+		}
+		produtos = append(produtos, pagina.Produtos...)
+		if pagina.ProximoCursor == "" {
+			return produtos
+		}
+		filtro.Cursor = pagina.ProximoCursor
+	}
+}
+
+// comparar reproduz o contrato de ordenação: nome byte a byte ou preço,
+// desempatando pelo ID, invertido nas ordenações decrescentes.
+func comparar(o repo.Ordenacao, a, b models.Produto) int {
+	var c int
+	switch o {
+	case repo.OrdenarPorPreco, repo.OrdenarPorPrecoDesc:
+		switch {
+		case a.Preco.Centavos < b.Preco.Centavos:
+			c = -1
+		case a.Preco.Centavos > b.Preco.Centavos:
+			c = 1
+		}
+	default:
+		c = strings.Compare(a.Nome, b.Nome)
+	}
+	if c == 0 {
+		c = bytes.Compare(a.ID[:], b.ID[:])
+	}
+	if strings.HasPrefix(string(o), "-") {
+		c = -c
+	}
+	return c
+}
+
+func ids(produtos []models.Produto) []uuid.UUID {
+	resultado := make([]uuid.UUID, len(produtos))
+	for i, p := range produtos {
+		resultado[i] = p.ID
+	}
+	return resultado
+}
+
+func uniq(ids []uuid.UUID) []uuid.UUID {
+	vistos := make(map[uuid.UUID]bool, len(ids))
+	var resultado []uuid.UUID
+	for _, id := range ids {
+		if !vistos[id] {
+			vistos[id] = true
+			resultado = append(resultado, id)
+		}
+	}
+	return resultado
+}
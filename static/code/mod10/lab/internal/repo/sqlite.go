@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteRepositorio implementa o repositório sobre um arquivo SQLite
+// embarcado, para rodar a API e os testes sem o PostgreSQL. As escritas, o
+// lote, o expurgo e o histórico usam o mesmo SQL de PostgresRepositorio;
+// apenas a listagem e a busca textual dependem do banco.
+//
+// O SQLite serializa as escritas no arquivo inteiro, então o *gorm.DB deve
+// usar uma única conexão (SetMaxOpenConns(1)) para evitar SQLITE_BUSY.
+type SQLiteRepositorio struct {
+	*PostgresRepositorio
+}
+
+// NovoSQLiteRepositorio cria um novo repositório sobre um banco SQLite já
+// migrado por MigrarSQLite.
+func NovoSQLiteRepositorio(db *gorm.DB, opcoes OpcoesRepositorio, logger *zap.Logger) *SQLiteRepositorio {
+	r := NovoPostgresRepositorio(db, opcoes, logger)
+	r.violaNomeUnico = violaNomeUnicoSQLite
+	return &SQLiteRepositorio{PostgresRepositorio: r}
+}
+
+// Listar retorna uma página de produtos como PostgresRepositorio.Listar. O
+// SQLite já compara texto byte a byte, mas seu LIKE só ignora a diferença
+// entre maiúsculas e minúsculas em letras ASCII.
+func (r *SQLiteRepositorio) Listar(ctx context.Context, filtro FiltroListagem) (Pagina, error) {
+	return r.listar(ctx, filtro, "nome", `nome LIKE ? ESCAPE '\'`)
+}
+
+// ProdutosDaCategoria retorna os produtos como
+// PostgresRepositorio.ProdutosDaCategoria, ordenando os nomes byte a byte.
+func (r *SQLiteRepositorio) ProdutosDaCategoria(ctx context.Context, id uuid.UUID, incluirDescendentes bool) ([]models.Produto, error) {
+	return r.produtosDaCategoria(ctx, id, incluirDescendentes, "nome")
+}
+
+// Pesquisar faz a busca textual com o tokenizador do repositório em memória,
+// já que o SQLite não tem unaccent nem o dicionário portuguese. Os produtos
+// ativos são carregados e classificados em Go, o que atende ao volume de um
+// ambiente de desenvolvimento.
+func (r *SQLiteRepositorio) Pesquisar(ctx context.Context, termo string, limite int) ([]models.Produto, error) {
+	if strings.TrimSpace(termo) == "" {
+		r.logger.Error("Falha ao pesquisar produtos", zap.Error(ErrBuscaVazia))
+		return nil, fmt.Errorf("pesquisar produtos: %w", ErrBuscaVazia)
+	}
+
+	var produtos []models.Produto
+	if err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantDe(ctx)).Find(&produtos).Error; err != nil {
+		r.logger.Error("Falha ao pesquisar produtos", zap.Error(err))
+		return nil, fmt.Errorf("pesquisar produtos: %w", err)
+	}
+	produtos = classificar(tokenizar(termo), produtos, normalizarLimite(limite))
+
+	r.logger.Info("Produtos pesquisados", zap.String("termo", termo), zap.Int("total", len(produtos)))
+	return produtos, nil
+}
+
+// violaNomeUnicoSQLite informa se err é a violação de indiceNomeUnico. O
+// SQLite não informa o nome do índice, só cita na mensagem as colunas dele.
+func violaNomeUnicoSQLite(err error) bool {
+	var sqliteErr *gosqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE &&
+		strings.Contains(sqliteErr.Error(), "produtos.nome_normalizado")
+}
+
+// MigrarSQLite aplica em ordem os arquivos <versão>_<descrição>.up.sql de
+// migracoes que ainda não constam em schema_migrations, cada um em sua própria
+// transação. O golang-migrate não é usado aqui porque seu driver sqlite
+// registra no database/sql o mesmo nome de driver que o usado pelo GORM.
+func MigrarSQLite(ctx context.Context, db *gorm.DB, migracoes fs.FS) error {
+	db = db.WithContext(ctx)
+	if err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)").Error; err != nil {
+		return fmt.Errorf("migrar sqlite: %w", err)
+	}
+
+	arquivos, err := fs.Glob(migracoes, "*.up.sql")
+	if err != nil {
+		return fmt.Errorf("migrar sqlite: %w", err)
+	}
+	for _, arquivo := range arquivos {
+		prefixo, _, _ := strings.Cut(arquivo, "_")
+		versao, err := strconv.ParseInt(prefixo, 10, 64)
+		if err != nil {
+			return fmt.Errorf("migração %s sem versão: %w", arquivo, err)
+		}
+		script, err := fs.ReadFile(migracoes, arquivo)
+		if err != nil {
+			return fmt.Errorf("ler migração %s: %w", arquivo, err)
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var aplicadas int64
+			if err := tx.Table("schema_migrations").Where("version = ?", versao).Count(&aplicadas).Error; err != nil {
+				return err
+			}
+			if aplicadas > 0 {
+				return nil
+			}
+			if err := tx.Exec(string(script)).Error; err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", versao).Error
+		})
+		if err != nil {
+			return fmt.Errorf("aplicar migração %s: %w", arquivo, err)
+		}
+	}
+	return nil
+}
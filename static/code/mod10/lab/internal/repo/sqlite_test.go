@@ -0,0 +1,256 @@
+package repo_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/internal/repo"
+	"github.com/seu-usuario/lab6/internal/repo/repotest"
+	"github.com/seu-usuario/lab6/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func abrirSQLite(t *testing.T, arquivo string) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(arquivo+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"), &gorm.Config{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	assert.NoError(t, repo.MigrarSQLite(context.Background(), db, os.DirFS("../../migrations/sqlite")))
+	return db
+}
+
+func TestSQLiteRepositorio(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.Run(t, func(t *testing.T) repo.RepositorioProdutos {
+		return repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), repo.OpcoesRepositorio{}, logger)
+	})
+}
+
+func TestTenantsSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunTenants(t, func(t *testing.T) repo.RepositorioProdutos {
+		return repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), repo.OpcoesRepositorio{}, logger)
+	})
+}
+
+func TestUnidadeDeTrabalhoSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunUnidadeDeTrabalho(t, func(t *testing.T) (repo.UnidadeDeTrabalho, repo.RepositorioProdutos) {
+		db := abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db"))
+		return repo.NovaUnidadeDeTrabalhoSQLite(db, repo.OpcoesRepositorio{}, logger), repo.NovoSQLiteRepositorio(db, repo.OpcoesRepositorio{}, logger)
+	})
+}
+
+func TestCategoriasSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunCategorias(t, func(t *testing.T, opcoes repo.OpcoesRepositorio) (repo.RepositorioProdutos, repo.RepositorioCategorias) {
+		r := repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), opcoes, logger)
+		return r, r
+	})
+}
+
+func TestEstoqueSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunEstoque(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioEstoque) {
+		r := repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), repo.OpcoesRepositorio{}, logger)
+		return r, r
+	})
+}
+
+func TestPedidosSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunPedidos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPedidos) {
+		r := repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), repo.OpcoesRepositorio{}, logger)
+		return r, r
+	})
+}
+
+func TestVariantesSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunVariantes(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioVariantes) {
+		r := repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), repo.OpcoesRepositorio{}, logger)
+		return r, r
+	})
+}
+
+func TestPrecosSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunPrecos(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioPrecos) {
+		r := repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), repo.OpcoesRepositorio{}, logger)
+		return r, r
+	})
+}
+
+func TestImagensSQLite(t *testing.T) {
+	logger := zap.NewNop()
+
+	repotest.RunImagens(t, func(t *testing.T) (repo.RepositorioProdutos, repo.RepositorioImagens) {
+		r := repo.NovoSQLiteRepositorio(abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db")), repo.OpcoesRepositorio{}, logger)
+		return r, r
+	})
+}
+
+func TestSQLiteRepositorioPersistencia(t *testing.T) {
+	arquivo := filepath.Join(t.TempDir(), "produtos.db")
+	logger := zap.NewNop()
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	produto, err := repo.NovoSQLiteRepositorio(abrirSQLite(t, arquivo), repo.OpcoesRepositorio{}, logger).Criar(ctx, "Headset", models.Centavos(19990))
+	assert.NoError(t, err)
+
+	// Reabrir o arquivo aplica as migrações de novo sem efeito
+	reaberto := repo.NovoSQLiteRepositorio(abrirSQLite(t, arquivo), repo.OpcoesRepositorio{}, logger)
+	encontrado, err := reaberto.Buscar(ctx, produto.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, produto, encontrado)
+}
+
+func TestCorridaDeNomeSQLite(t *testing.T) {
+	db := abrirSQLite(t, filepath.Join(t.TempDir(), "produtos.db"))
+	r := repo.NovoSQLiteRepositorio(db, repo.OpcoesRepositorio{}, zap.NewNop())
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	// Um produto rival com o mesmo nome é gravado logo depois da
+	// verificação de nome livre, como faria uma escrita concorrente
+	rival := uuid.New()
+	gravado := false
+	err := db.Callback().Query().After("gorm:query").Register("corrida", func(tx *gorm.DB) {
+		if gravado || tx.Statement.Table != "produtos" {
+			return
+		}
+		gravado = true
+		tx.AddError(tx.Session(&gorm.Session{NewDB: true}).
+			Exec("INSERT INTO produtos (id, tenant_id, nome, nome_normalizado, preco, versao) VALUES (?, ?, ?, ?, ?, 1)", rival, repo.TenantPadrao, "CANETA", "caneta", 150).Error)
+	})
+	assert.NoError(t, err)
+
+	_, err = r.Criar(ctx, "Caneta", models.Centavos(250))
+	assert.ErrorIs(t, err, repo.ErrProdutoDuplicado)
+	var duplicado *repo.ProdutoDuplicadoError
+	if assert.ErrorAs(t, err, &duplicado) {
+		assert.Equal(t, rival, duplicado.ExistenteID)
+	}
+}
+
+// migracoesAte copia as migrações de subida anteriores à versão informada,
+// para testar a migração dela sobre dados antigos.
+func migracoesAte(t *testing.T, migracoes fs.FS, versao string) fstest.MapFS {
+	anteriores := fstest.MapFS{}
+	arquivos, err := fs.Glob(migracoes, "*.up.sql")
+	assert.NoError(t, err)
+	for _, arquivo := range arquivos {
+		if arquivo < versao {
+			conteudo, err := fs.ReadFile(migracoes, arquivo)
+			assert.NoError(t, err)
+			anteriores[arquivo] = &fstest.MapFile{Data: conteudo}
+		}
+	}
+	return anteriores
+}
+
+func abrirSQLiteSemMigrar(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "produtos.db")), &gorm.Config{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestMigracaoNomeUnicoSQLite(t *testing.T) {
+	db := abrirSQLiteSemMigrar(t)
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	// Nomes repetidos antes do índice único: o de menor ID fica com o nome e
+	// os demais ganham o ID como sufixo
+	migracoes := os.DirFS("../../migrations/sqlite")
+	assert.NoError(t, repo.MigrarSQLite(ctx, db, migracoesAte(t, migracoes, "202506120016")))
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+	for i, nome := range []string{"Caneta", "caneta", "CANETA"} {
+		assert.NoError(t, db.Exec("INSERT INTO produtos (id, tenant_id, nome, preco, versao) VALUES (?, ?, ?, ?, 1)", ids[i], repo.TenantPadrao, nome, 199).Error)
+	}
+	assert.NoError(t, repo.MigrarSQLite(ctx, db, migracoes))
+
+	var produtos []models.Produto
+	assert.NoError(t, db.Order("id").Find(&produtos).Error)
+	if !assert.Len(t, produtos, 3) {
+		return
+	}
+	assert.Equal(t, "Caneta", produtos[0].Nome)
+	assert.Equal(t, 1, produtos[0].Versao)
+	assert.Equal(t, "caneta ("+ids[1].String()+")", produtos[1].Nome)
+	assert.Equal(t, 2, produtos[1].Versao)
+	assert.Equal(t, "CANETA ("+ids[2].String()+")", produtos[2].Nome)
+}
+
+func TestMigracaoNomeNormalizadoSQLite(t *testing.T) {
+	db := abrirSQLiteSemMigrar(t)
+	ctx := repo.ComTenant(context.Background(), repo.TenantPadrao)
+
+	// Produtos gravados antes da coluna nome_normalizado são preenchidos com
+	// a normalização do Go, que também converte letras fora do ASCII. O
+	// lower() do SQLite distinguia "ÁGUA" de "água"; o de maior ID ganha o
+	// ID como sufixo
+	migracoes := os.DirFS("../../migrations/sqlite")
+	assert.NoError(t, repo.MigrarSQLite(ctx, db, migracoesAte(t, migracoes, "202506120018")))
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+	for i, nome := range []string{"ÁGUA Tônica", "água tônica"} {
+		assert.NoError(t, db.Exec("INSERT INTO produtos (id, tenant_id, nome, preco, versao) VALUES (?, ?, ?, ?, 1)", ids[i], repo.TenantPadrao, nome, 599).Error)
+	}
+	assert.NoError(t, repo.MigrarSQLite(ctx, db, migracoes))
+	assert.NoError(t, repo.PreencherNomesNormalizados(ctx, db))
+
+	var linhas []struct {
+		Nome            string
+		NomeNormalizado string
+		Versao          int
+	}
+	assert.NoError(t, db.Table("produtos").Order("id").Find(&linhas).Error)
+	if !assert.Len(t, linhas, 2) {
+		return
+	}
+	assert.Equal(t, "ÁGUA Tônica", linhas[0].Nome)
+	assert.Equal(t, "água tônica", linhas[0].NomeNormalizado)
+	assert.Equal(t, 1, linhas[0].Versao)
+	assert.Equal(t, "água tônica ("+ids[1].String()+")", linhas[1].Nome)
+	assert.Equal(t, "água tônica ("+ids[1].String()+")", linhas[1].NomeNormalizado)
+	assert.Equal(t, 2, linhas[1].Versao)
+
+	// Sem pendentes, preencher de novo não muda nada
+	assert.NoError(t, repo.PreencherNomesNormalizados(ctx, db))
+	r := repo.NovoSQLiteRepositorio(db, repo.OpcoesRepositorio{}, zap.NewNop())
+	_, err := r.Criar(ctx, "ÁGUA TÔNICA", models.Centavos(599))
+	var duplicado *repo.ProdutoDuplicadoError
+	if assert.ErrorAs(t, err, &duplicado) {
+		assert.Equal(t, ids[0], duplicado.ExistenteID)
+	}
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// TenantPadrao é o tenant dos produtos gravados antes do isolamento por
+// tenant e das requisições que não informam um.
+const TenantPadrao = "padrao"
+
+var (
+	ErrTenantInvalido = errors.New("tenant inválido")
+	// ErrSemTenant é o valor do panic das operações chamadas com um contexto
+	// sem tenant: elas não escolhem um tenant por conta própria.
+	ErrSemTenant = errors.New("contexto sem tenant; use ComTenant")
+)
+
+// formatoTenant cabe na coluna tenant_id, VARCHAR(64).
+var formatoTenant = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type chaveTenant struct{}
+
+// ComTenant associa ao contexto o tenant ao qual as operações sobre produtos
+// ficam restritas: produtos de outros tenants se comportam como inexistentes.
+// Toda operação de um tenant exige um; sem ele, a operação entra em panic
+// com ErrSemTenant.
+func ComTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, chaveTenant{}, tenant)
+}
+
+func tenantDe(ctx context.Context) string {
+	if tenant, ok := ctx.Value(chaveTenant{}).(string); ok && tenant != "" {
+		return tenant
+	}
+	panic(ErrSemTenant)
+}
+
+// ValidarTenant aceita identificadores de até 64 letras minúsculas, dígitos,
+// hífens e sublinhados, começando por letra ou dígito.
+func ValidarTenant(tenant string) error {
+	if !formatoTenant.MatchString(tenant) {
+		return fmt.Errorf("%q: %w", tenant, ErrTenantInvalido)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Repositorios reúne os repositórios que participam de uma mesma transação.
+// Todos enxergam as escritas uns dos outros e são confirmados ou desfeitos
+// em conjunto.
+type Repositorios struct {
+	Produtos   RepositorioProdutos
+	Categorias RepositorioCategorias
+}
+
+// UnidadeDeTrabalho executa fn dentro de uma transação. Se fn retornar nil a
+// transação é confirmada; qualquer erro (ou pânico) desfaz todas as escritas
+// feitas pelos repositórios recebidos. Os repositórios só são válidos durante
+// a chamada de fn.
+type UnidadeDeTrabalho interface {
+	Executar(ctx context.Context, fn func(ctx context.Context, repos Repositorios) error) error
+}
+
+// UnidadeDeTrabalhoPostgres abre uma transação do banco e entrega a fn
+// repositórios ligados a ela.
+type UnidadeDeTrabalhoPostgres struct {
+	db     *gorm.DB
+	opcoes OpcoesRepositorio
+	logger *zap.Logger
+}
+
+func NovaUnidadeDeTrabalhoPostgres(db *gorm.DB, opcoes OpcoesRepositorio, logger *zap.Logger) *UnidadeDeTrabalhoPostgres {
+	return &UnidadeDeTrabalhoPostgres{db: db, opcoes: opcoes, logger: logger}
+}
+
+// Executar implementa UnidadeDeTrabalho. As transações abertas pelos
+// repositórios dentro de fn viram savepoints da transação externa.
+func (u *UnidadeDeTrabalhoPostgres) Executar(ctx context.Context, fn func(ctx context.Context, repos Repositorios) error) error {
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := NovoPostgresRepositorio(tx, u.opcoes, u.logger)
+		return fn(ctx, Repositorios{Produtos: repo, Categorias: repo})
+	})
+	if err != nil {
+		u.logger.Error("Falha ao executar transação", zap.Error(err))
+		return fmt.Errorf("executar transação: %w", err)
+	}
+	return nil
+}
+
+// UnidadeDeTrabalhoSQLite é a UnidadeDeTrabalhoPostgres para o banco
+// SQLite embarcado, entregando a fn repositórios SQLite.
+type UnidadeDeTrabalhoSQLite struct {
+	db     *gorm.DB
+	opcoes OpcoesRepositorio
+	logger *zap.Logger
+}
+
+func NovaUnidadeDeTrabalhoSQLite(db *gorm.DB, opcoes OpcoesRepositorio, logger *zap.Logger) *UnidadeDeTrabalhoSQLite {
+	return &UnidadeDeTrabalhoSQLite{db: db, opcoes: opcoes, logger: logger}
+}
+
+// Executar implementa UnidadeDeTrabalho.
+func (u *UnidadeDeTrabalhoSQLite) Executar(ctx context.Context, fn func(ctx context.Context, repos Repositorios) error) error {
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := NovoSQLiteRepositorio(tx, u.opcoes, u.logger)
+		return fn(ctx, Repositorios{Produtos: repo, Categorias: repo})
+	})
+	if err != nil {
+		u.logger.Error("Falha ao executar transação", zap.Error(err))
+		return fmt.Errorf("executar transação: %w", err)
+	}
+	return nil
+}
+
+// UnidadeDeTrabalhoPgx abre uma transação database/sql e entrega a fn
+// repositórios pgx ligados a ela, com as instruções já preparadas.
+type UnidadeDeTrabalhoPgx struct {
+	produtos *PgxRepositorio
+	logger   *zap.Logger
+}
+
+func NovaUnidadeDeTrabalhoPgx(produtos *PgxRepositorio, logger *zap.Logger) *UnidadeDeTrabalhoPgx {
+	return &UnidadeDeTrabalhoPgx{produtos: produtos, logger: logger}
+}
+
+// Executar implementa UnidadeDeTrabalho.
+func (u *UnidadeDeTrabalhoPgx) Executar(ctx context.Context, fn func(ctx context.Context, repos Repositorios) error) error {
+	err := u.produtos.transacao(ctx, func(tx *sql.Tx) error {
+		repo := u.produtos.emTransacao(tx)
+		return fn(ctx, Repositorios{Produtos: repo, Categorias: repo})
+	})
+	if err != nil {
+		u.logger.Error("Falha ao executar transação", zap.Error(err))
+		return fmt.Errorf("executar transação: %w", err)
+	}
+	return nil
+}
+
+// UnidadeDeTrabalhoEmMemoria dá a fn cópias dos repositórios em memória e só
+// as publica se fn terminar sem erro. Enquanto fn executa, os repositórios
+// originais ficam bloqueados para escrita e leitura, então fn não deve
+// chamá-los diretamente, apenas os recebidos em Repositorios.
+type UnidadeDeTrabalhoEmMemoria struct {
+	produtos *RepositorioEmMemoria
+	logger   *slog.Logger
+}
+
+func NovaUnidadeDeTrabalhoEmMemoria(produtos *RepositorioEmMemoria, logger *slog.Logger) *UnidadeDeTrabalhoEmMemoria {
+	return &UnidadeDeTrabalhoEmMemoria{produtos: produtos, logger: logger}
+}
+
+// Executar implementa UnidadeDeTrabalho.
+func (u *UnidadeDeTrabalhoEmMemoria) Executar(ctx context.Context, fn func(ctx context.Context, repos Repositorios) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	u.produtos.mu.Lock()
+	defer u.produtos.mu.Unlock()
+
+	produtos := u.produtos.rascunho()
+	if err := fn(ctx, Repositorios{Produtos: produtos, Categorias: produtos}); err != nil {
+		u.logger.Error("Falha ao executar transação", "error", err)
+
+		return fmt.Errorf("executar transação: %w", err)
+	}
+
+	if err := u.produtos.publicar(produtos); err != nil {
+		u.logger.Error("Falha ao executar transação", "error", err)
+
+		return fmt.Errorf("executar transação: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package repo
+
+import (
+	"reflect"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/seu-usuario/lab6/models"
+)
+
+// init faz o validador do binding comparar Dinheiro pelos centavos, para que
+// as regras de binding do modelo valham tanto na API quanto nos lotes.
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterCustomTypeFunc(func(campo reflect.Value) any {
+			return campo.Interface().(models.Dinheiro).Centavos
+		}, models.Dinheiro{})
+	}
+}
+
+// validarProduto aplica a nome e preço as regras de binding de
+// models.Produto, as mesmas de POST /produtos.
+func validarProduto(nome string, preco models.Dinheiro) error {
+	return binding.Validator.ValidateStruct(models.Produto{Nome: nome, Preco: preco})
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/seu-usuario/lab6/models"
+)
+
+var (
+	ErrEixosInvalidos        = errors.New("eixos de variante inválidos")
+	ErrOpcoesInvalidas       = errors.New("opções de variante inválidas")
+	ErrSKUInvalido           = errors.New("SKU inválido")
+	ErrSKUDuplicado          = errors.New("SKU já usado por outra variante")
+	ErrCombinacaoDuplicada   = errors.New("combinação de opções já usada por outra variante")
+	ErrProdutoSemEixos       = errors.New("produto sem eixos de variante")
+	ErrGradeComVariantes     = errors.New("produto já tem variantes")
+	ErrVarianteNaoEncontrada = errors.New("variante não encontrada")
+)
+
+// formatoSKU cabe na coluna sku, VARCHAR(64).
+var formatoSKU = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// NovaVariante descreve uma variante a criar: o código SKU, o valor de cada
+// eixo do pai e o preço do SKU.
+type NovaVariante struct {
+	SKU    string            `json:"sku" binding:"required"`
+	Opcoes map[string]string `json:"opcoes" binding:"required"`
+	Preco  models.Dinheiro   `json:"preco" binding:"required,gt=0"`
+}
+
+// RepositorioVariantes organiza produtos em grades: um produto pai define
+// eixos de opções e cada variante é um produto filho com uma combinação
+// desses eixos. Os filhos são produtos comuns, alterados, removidos e
+// restaurados pelo RepositorioProdutos; um filho removido continua ocupando
+// o SKU e a combinação até ser expurgado. Os repositórios de produtos também
+// o implementam.
+type RepositorioVariantes interface {
+	// DefinirEixos substitui os eixos do produto, o que só é permitido
+	// enquanto ele não tiver variantes.
+	DefinirEixos(ctx context.Context, produtoID uuid.UUID, eixos []models.EixoVariante) (models.Grade, error)
+	// CriarVariante cria o produto filho, nomeado pelo pai e pelas opções, e
+	// o liga ao pai.
+	CriarVariante(ctx context.Context, paiID uuid.UUID, nova NovaVariante) (models.Variante, error)
+	// Grade retorna os eixos do produto e suas variantes ativas, ordenadas
+	// pelos valores na ordem dos eixos. Um produto sem eixos tem a grade
+	// vazia.
+	Grade(ctx context.Context, produtoID uuid.UUID) (models.Grade, error)
+	// BuscarSKU retorna a variante ativa com o código SKU.
+	BuscarSKU(ctx context.Context, sku string) (models.Variante, error)
+}
+
+// validarEixos exige ao menos um eixo, com nomes distintos e ao menos um
+// valor, sem valores vazios ou repetidos.
+func validarEixos(eixos []models.EixoVariante) error {
+	if len(eixos) == 0 {
+		return fmt.Errorf("nenhum eixo: %w", ErrEixosInvalidos)
+	}
+	nomes := make(map[string]bool, len(eixos))
+	for _, eixo := range eixos {
+		if strings.TrimSpace(eixo.Nome) == "" || nomes[eixo.Nome] {
+			return fmt.Errorf("eixo %q vazio ou repetido: %w", eixo.Nome, ErrEixosInvalidos)
+		}
+		nomes[eixo.Nome] = true
+
+		if len(eixo.Valores) == 0 {
+			return fmt.Errorf("eixo %q sem valores: %w", eixo.Nome, ErrEixosInvalidos)
+		}
+		valores := make(map[string]bool, len(eixo.Valores))
+		for _, valor := range eixo.Valores {
+			if strings.TrimSpace(valor) == "" || valores[valor] {
+				return fmt.Errorf("eixo %q: valor %q vazio ou repetido: %w", eixo.Nome, valor, ErrEixosInvalidos)
+			}
+			valores[valor] = true
+		}
+	}
+	return nil
+}
+
+// validarVariante confere o SKU, o preço e que as opções trazem exatamente
+// um valor admitido para cada eixo.
+func validarVariante(eixos []models.EixoVariante, nova NovaVariante) error {
+	if !formatoSKU.MatchString(nova.SKU) {
+		return fmt.Errorf("%q: %w", nova.SKU, ErrSKUInvalido)
+	}
+	if err := nova.Preco.Validar(); err != nil {
+		return err
+	}
+	if len(nova.Opcoes) != len(eixos) {
+		return fmt.Errorf("%d opções para %d eixos: %w", len(nova.Opcoes), len(eixos), ErrOpcoesInvalidas)
+	}
+	for _, eixo := range eixos {
+		valor, ok := nova.Opcoes[eixo.Nome]
+		if !ok || !slices.Contains(eixo.Valores, valor) {
+			return fmt.Errorf("eixo %q: valor %q: %w", eixo.Nome, valor, ErrOpcoesInvalidas)
+		}
+	}
+	return nil
+}
+
+// nomeVariante nomeia o produto filho pelo pai e pelos valores na ordem dos
+// eixos, como "Camiseta (M, Azul)".
+func nomeVariante(pai models.Produto, eixos []models.EixoVariante, opcoes map[string]string) string {
+	valores := make([]string, len(eixos))
+	for i, eixo := range eixos {
+		valores[i] = opcoes[eixo.Nome]
+	}
+	return pai.Nome + " (" + strings.Join(valores, ", ") + ")"
+}
+
+// combinacao é o texto gravado na coluna opcoes: o JSON do mapa, que
+// encoding/json escreve com as chaves ordenadas.
+func combinacao(opcoes map[string]string) (string, error) {
+	dados, err := json.Marshal(opcoes)
+	return string(dados), err
+}
+
+// ordenarVariantes ordena as variantes pela posição de cada valor no seu
+// eixo, do primeiro eixo ao último.
+func ordenarVariantes(eixos []models.EixoVariante, variantes []models.Variante) {
+	slices.SortFunc(variantes, func(a, b models.Variante) int {
+		for _, eixo := range eixos {
+			if c := slices.Index(eixo.Valores, a.Opcoes[eixo.Nome]) - slices.Index(eixo.Valores, b.Opcoes[eixo.Nome]); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.SKU, b.SKU)
+	})
+}
@@ -0,0 +1,2 @@
+DROP INDEX produtos_preco_id_idx;
+DROP INDEX produtos_nome_id_idx;
\ No newline at end of file
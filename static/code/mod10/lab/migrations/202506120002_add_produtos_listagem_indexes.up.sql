@@ -0,0 +1,2 @@
+CREATE INDEX produtos_nome_id_idx ON produtos (nome COLLATE "C", id);
+CREATE INDEX produtos_preco_id_idx ON produtos (preco, id);
\ No newline at end of file
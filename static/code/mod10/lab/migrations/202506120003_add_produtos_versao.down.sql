@@ -0,0 +1 @@
+ALTER TABLE produtos DROP COLUMN versao;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE produtos ADD COLUMN versao INTEGER NOT NULL DEFAULT 1;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX produtos_deleted_at_idx;
+ALTER TABLE produtos DROP COLUMN deleted_at;
\ No newline at end of file
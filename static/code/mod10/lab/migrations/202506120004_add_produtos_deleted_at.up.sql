@@ -0,0 +1,2 @@
+ALTER TABLE produtos ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX produtos_deleted_at_idx ON produtos (deleted_at);
\ No newline at end of file
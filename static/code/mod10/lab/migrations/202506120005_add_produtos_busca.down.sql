@@ -0,0 +1,3 @@
+DROP INDEX produtos_busca_idx;
+ALTER TABLE produtos DROP COLUMN busca;
+DROP TEXT SEARCH CONFIGURATION portugues_sem_acento;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+CREATE TEXT SEARCH CONFIGURATION portugues_sem_acento (COPY = portuguese);
+ALTER TEXT SEARCH CONFIGURATION portugues_sem_acento
+    ALTER MAPPING FOR hword, hword_part, word WITH unaccent, portuguese_stem;
+
+ALTER TABLE produtos ADD COLUMN busca TSVECTOR
+    GENERATED ALWAYS AS (setweight(to_tsvector('portugues_sem_acento', nome), 'A')) STORED;
+CREATE INDEX produtos_busca_idx ON produtos USING GIN (busca);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE produtos_historico;
\ No newline at end of file
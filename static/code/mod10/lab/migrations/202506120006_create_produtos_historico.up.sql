@@ -0,0 +1,11 @@
+CREATE TABLE produtos_historico (
+    id UUID PRIMARY KEY,
+    produto_id UUID NOT NULL,
+    operacao VARCHAR(20) NOT NULL,
+    antes JSONB,
+    depois JSONB,
+    autor VARCHAR(255) NOT NULL,
+    registrado_em TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX produtos_historico_produto_idx ON produtos_historico (produto_id, registrado_em);
\ No newline at end of file
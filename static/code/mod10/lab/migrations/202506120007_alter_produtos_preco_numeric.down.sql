@@ -0,0 +1 @@
+ALTER TABLE produtos ALTER COLUMN preco TYPE DOUBLE PRECISION;
\ No newline at end of file
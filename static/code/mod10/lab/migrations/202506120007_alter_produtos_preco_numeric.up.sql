@@ -0,0 +1 @@
+ALTER TABLE produtos ALTER COLUMN preco TYPE NUMERIC(12,2) USING round(preco::numeric, 2);
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE outbox (
+    seq BIGSERIAL PRIMARY KEY,
+    id UUID NOT NULL UNIQUE,
+    tipo VARCHAR(40) NOT NULL,
+    produto_id UUID NOT NULL,
+    produto JSONB,
+    ocorrido_em TIMESTAMPTZ NOT NULL,
+    publicado_em TIMESTAMPTZ,
+    tentativas INTEGER NOT NULL DEFAULT 0,
+    ultimo_erro TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX outbox_pendentes_idx ON outbox (seq) WHERE publicado_em IS NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE produto_categorias;
+DROP TABLE categorias;
\ No newline at end of file
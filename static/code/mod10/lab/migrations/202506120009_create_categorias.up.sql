@@ -0,0 +1,15 @@
+CREATE TABLE categorias (
+    id UUID PRIMARY KEY,
+    nome VARCHAR(255) NOT NULL,
+    pai_id UUID REFERENCES categorias (id)
+);
+
+CREATE INDEX categorias_pai_idx ON categorias (pai_id);
+
+CREATE TABLE produto_categorias (
+    produto_id UUID NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    categoria_id UUID NOT NULL REFERENCES categorias (id),
+    PRIMARY KEY (produto_id, categoria_id)
+);
+
+CREATE INDEX produto_categorias_categoria_idx ON produto_categorias (categoria_id);
\ No newline at end of file
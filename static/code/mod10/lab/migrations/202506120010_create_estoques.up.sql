@@ -0,0 +1,16 @@
+CREATE TABLE estoques (
+    produto_id UUID PRIMARY KEY REFERENCES produtos (id) ON DELETE CASCADE,
+    quantidade INTEGER NOT NULL DEFAULT 0 CHECK (quantidade >= 0),
+    reservado INTEGER NOT NULL DEFAULT 0 CHECK (reservado >= 0 AND reservado <= quantidade)
+);
+
+CREATE TABLE reservas (
+    id UUID PRIMARY KEY,
+    produto_id UUID NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    quantidade INTEGER NOT NULL CHECK (quantidade > 0),
+    status VARCHAR(20) NOT NULL,
+    criada_em TIMESTAMPTZ NOT NULL,
+    expira_em TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX reservas_pendentes_idx ON reservas (expira_em) WHERE status = 'pendente';
\ No newline at end of file
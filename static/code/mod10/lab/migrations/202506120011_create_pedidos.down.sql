@@ -0,0 +1,2 @@
+DROP TABLE pedido_itens;
+DROP TABLE pedidos;
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE TABLE pedidos (
+    id UUID PRIMARY KEY,
+    status VARCHAR(20) NOT NULL,
+    total NUMERIC(12,2) NOT NULL,
+    criado_em TIMESTAMPTZ NOT NULL,
+    atualizado_em TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX pedidos_criado_em_idx ON pedidos (criado_em DESC, id DESC);
+
+-- Os itens guardam nome e preço do produto no momento do pedido; produto_id
+-- não referencia produtos para que o expurgo não apague pedidos.
+CREATE TABLE pedido_itens (
+    pedido_id UUID NOT NULL REFERENCES pedidos (id) ON DELETE CASCADE,
+    posicao INTEGER NOT NULL,
+    produto_id UUID NOT NULL,
+    nome VARCHAR(255) NOT NULL,
+    preco_unitario NUMERIC(12,2) NOT NULL,
+    quantidade INTEGER NOT NULL CHECK (quantidade > 0),
+    subtotal NUMERIC(12,2) NOT NULL,
+    PRIMARY KEY (pedido_id, posicao)
+);
\ No newline at end of file
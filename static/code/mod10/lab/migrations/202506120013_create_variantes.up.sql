@@ -0,0 +1,18 @@
+-- Uma grade guarda os eixos de opções do produto pai, em JSON.
+CREATE TABLE grades (
+    produto_id UUID PRIMARY KEY REFERENCES produtos (id) ON DELETE CASCADE,
+    eixos TEXT NOT NULL
+);
+
+-- Cada variante é um produto próprio ligado ao pai. opcoes é o JSON do mapa
+-- eixo → valor com as chaves ordenadas, de modo que combinações iguais têm o
+-- mesmo texto.
+CREATE TABLE variantes (
+    produto_id UUID PRIMARY KEY REFERENCES produtos (id) ON DELETE CASCADE,
+    pai_id UUID NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    tenant_id VARCHAR(64) NOT NULL,
+    sku VARCHAR(64) NOT NULL,
+    opcoes TEXT NOT NULL,
+    UNIQUE (tenant_id, sku),
+    UNIQUE (pai_id, opcoes)
+);
\ No newline at end of file
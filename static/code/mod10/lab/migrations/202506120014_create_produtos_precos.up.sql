@@ -0,0 +1,31 @@
+CREATE TABLE produtos_precos (
+    id UUID PRIMARY KEY,
+    produto_id UUID NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    tenant_id VARCHAR(64) NOT NULL,
+    preco NUMERIC(12,2) NOT NULL CHECK (preco >= 0),
+    vigente_de TIMESTAMPTZ NOT NULL,
+    vigente_ate TIMESTAMPTZ,
+    agendado BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX produtos_precos_produto_idx ON produtos_precos (produto_id, tenant_id, vigente_de);
+CREATE INDEX produtos_precos_agendados_idx ON produtos_precos (vigente_de) WHERE agendado;
+
+-- A linha do tempo dos produtos existentes sai do histórico: cada entrada que
+-- mudou o preço abre um período, com o ID da entrada, fechado pela seguinte.
+-- Produtos sem mudança de preço registrada começam um período agora, com o
+-- ID do próprio produto.
+INSERT INTO produtos_precos (id, produto_id, tenant_id, preco, vigente_de, vigente_ate)
+    SELECT id, produto_id, tenant_id, preco, registrado_em,
+           LEAD(registrado_em) OVER (PARTITION BY produto_id ORDER BY registrado_em, id)
+    FROM (
+        SELECT h.id, h.produto_id, h.tenant_id, (h.depois->>'preco')::numeric AS preco, h.registrado_em
+        FROM produtos_historico h
+        JOIN produtos p ON p.id = h.produto_id
+        WHERE h.depois IS NOT NULL
+          AND (h.antes IS NULL OR (h.antes->>'preco')::numeric <> (h.depois->>'preco')::numeric)
+    ) mudancas;
+INSERT INTO produtos_precos (id, produto_id, tenant_id, preco, vigente_de)
+    SELECT id, id, tenant_id, preco, now()
+    FROM produtos p
+    WHERE NOT EXISTS (SELECT 1 FROM produtos_precos pp WHERE pp.produto_id = p.id);
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- Os produtos ativos de um tenant têm nomes únicos, sem distinção entre
+-- maiúsculas e minúsculas; os removidos não ocupam o nome. Numa base que já
+-- tem nomes repetidos, o produto de menor ID de cada grupo fica com o nome e
+-- os demais ganham o próprio ID como sufixo e uma nova versão, para que o
+-- índice possa ser criado.
+WITH repetidos AS (
+    SELECT id, row_number() OVER (PARTITION BY tenant_id, lower(nome) ORDER BY id) AS posicao
+    FROM produtos
+    WHERE deleted_at IS NULL
+)
+UPDATE produtos p
+SET nome = left(p.nome, 216) || ' (' || p.id || ')', versao = p.versao + 1
+FROM repetidos r
+WHERE p.id = r.id AND r.posicao > 1;
+
+CREATE UNIQUE INDEX produtos_tenant_nome_unico_idx ON produtos (tenant_id, lower(nome)) WHERE deleted_at IS NULL;
\ No newline at end of file
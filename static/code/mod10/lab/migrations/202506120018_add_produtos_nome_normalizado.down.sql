@@ -0,0 +1,5 @@
+DROP INDEX produtos_tenant_nome_unico_idx;
+CREATE UNIQUE INDEX produtos_tenant_nome_unico_idx ON produtos (tenant_id, lower(nome)) WHERE deleted_at IS NULL;
+
+ALTER TABLE produtos DROP COLUMN escopo_nome;
+ALTER TABLE produtos DROP COLUMN nome_normalizado;
\ No newline at end of file
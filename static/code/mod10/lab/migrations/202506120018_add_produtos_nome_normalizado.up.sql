@@ -0,0 +1,13 @@
+-- nome_normalizado guarda o nome na forma comparada pela unicidade, que só o
+-- Go calcula (normalizarNome), para que todos os bancos comparem do mesmo
+-- jeito: os repositórios a gravam nas escritas e os produtos anteriores a
+-- esta migração, que ficam com NULL, são preenchidos por
+-- repo.PreencherNomesNormalizados ao abrir o banco. O índice não trata os NULL
+-- como repetidos. escopo_nome registra a regra sob a qual o produto foi
+-- gravado: o índice só cobre os produtos com nome único no tenant; no escopo
+-- por categoria, quem verifica é o repositório, com as categorias travadas.
+ALTER TABLE produtos ADD COLUMN nome_normalizado VARCHAR(255);
+ALTER TABLE produtos ADD COLUMN escopo_nome VARCHAR(16) NOT NULL DEFAULT 'tenant';
+
+DROP INDEX produtos_tenant_nome_unico_idx;
+CREATE UNIQUE INDEX produtos_tenant_nome_unico_idx ON produtos (tenant_id, nome_normalizado) WHERE deleted_at IS NULL AND escopo_nome = 'tenant';
\ No newline at end of file
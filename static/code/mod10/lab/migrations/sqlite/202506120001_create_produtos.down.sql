@@ -0,0 +1 @@
+DROP TABLE produtos;
\ No newline at end of file
@@ -0,0 +1,5 @@
+CREATE TABLE produtos (
+    id TEXT PRIMARY KEY,
+    nome TEXT NOT NULL,
+    preco REAL NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- O SQLite compara texto byte a byte (BINARY) por padrão, como COLLATE "C".
+CREATE INDEX produtos_nome_id_idx ON produtos (nome, id);
+CREATE INDEX produtos_preco_id_idx ON produtos (preco, id);
\ No newline at end of file
@@ -0,0 +1 @@
+-- Nada a desfazer: a migração de busca não altera o esquema no SQLite.
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- O SQLite não tem unaccent nem o dicionário portuguese; a busca textual é
+-- feita pelo SQLiteRepositorio com o mesmo tokenizador do repositório em memória.
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE produtos_historico (
+    id TEXT PRIMARY KEY,
+    produto_id TEXT NOT NULL,
+    operacao TEXT NOT NULL,
+    antes TEXT,
+    depois TEXT,
+    autor TEXT NOT NULL,
+    registrado_em DATETIME NOT NULL
+);
+
+CREATE INDEX produtos_historico_produto_idx ON produtos_historico (produto_id, registrado_em);
\ No newline at end of file
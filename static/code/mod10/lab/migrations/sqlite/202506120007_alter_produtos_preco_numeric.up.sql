@@ -0,0 +1,16 @@
+-- O SQLite não altera o tipo de uma coluna: a tabela é recriada.
+CREATE TABLE produtos_novo (
+    id TEXT PRIMARY KEY,
+    nome TEXT NOT NULL,
+    preco NUMERIC NOT NULL,
+    versao INTEGER NOT NULL DEFAULT 1,
+    deleted_at DATETIME
+);
+INSERT INTO produtos_novo (id, nome, preco, versao, deleted_at)
+    SELECT id, nome, round(preco, 2), versao, deleted_at FROM produtos;
+DROP TABLE produtos;
+ALTER TABLE produtos_novo RENAME TO produtos;
+
+CREATE INDEX produtos_nome_id_idx ON produtos (nome, id);
+CREATE INDEX produtos_preco_id_idx ON produtos (preco, id);
+CREATE INDEX produtos_deleted_at_idx ON produtos (deleted_at);
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE outbox (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    id TEXT NOT NULL UNIQUE,
+    tipo TEXT NOT NULL,
+    produto_id TEXT NOT NULL,
+    produto TEXT,
+    ocorrido_em DATETIME NOT NULL,
+    publicado_em DATETIME,
+    tentativas INTEGER NOT NULL DEFAULT 0,
+    ultimo_erro TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX outbox_pendentes_idx ON outbox (seq) WHERE publicado_em IS NULL;
\ No newline at end of file
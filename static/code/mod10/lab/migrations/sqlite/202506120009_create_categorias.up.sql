@@ -0,0 +1,15 @@
+CREATE TABLE categorias (
+    id TEXT PRIMARY KEY,
+    nome TEXT NOT NULL,
+    pai_id TEXT REFERENCES categorias (id)
+);
+
+CREATE INDEX categorias_pai_idx ON categorias (pai_id);
+
+CREATE TABLE produto_categorias (
+    produto_id TEXT NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    categoria_id TEXT NOT NULL REFERENCES categorias (id),
+    PRIMARY KEY (produto_id, categoria_id)
+);
+
+CREATE INDEX produto_categorias_categoria_idx ON produto_categorias (categoria_id);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE reservas;
+DROP TABLE estoques;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE estoques (
+    produto_id TEXT PRIMARY KEY REFERENCES produtos (id) ON DELETE CASCADE,
+    quantidade INTEGER NOT NULL DEFAULT 0 CHECK (quantidade >= 0),
+    reservado INTEGER NOT NULL DEFAULT 0 CHECK (reservado >= 0 AND reservado <= quantidade)
+);
+
+CREATE TABLE reservas (
+    id TEXT PRIMARY KEY,
+    produto_id TEXT NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    quantidade INTEGER NOT NULL CHECK (quantidade > 0),
+    status TEXT NOT NULL,
+    criada_em DATETIME NOT NULL,
+    expira_em DATETIME NOT NULL
+);
+
+CREATE INDEX reservas_pendentes_idx ON reservas (expira_em) WHERE status = 'pendente';
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE TABLE pedidos (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL,
+    total NUMERIC NOT NULL,
+    criado_em DATETIME NOT NULL,
+    atualizado_em DATETIME NOT NULL
+);
+
+CREATE INDEX pedidos_criado_em_idx ON pedidos (criado_em DESC, id DESC);
+
+-- Os itens guardam nome e preço do produto no momento do pedido; produto_id
+-- não referencia produtos para que o expurgo não apague pedidos.
+CREATE TABLE pedido_itens (
+    pedido_id TEXT NOT NULL REFERENCES pedidos (id) ON DELETE CASCADE,
+    posicao INTEGER NOT NULL,
+    produto_id TEXT NOT NULL,
+    nome TEXT NOT NULL,
+    preco_unitario NUMERIC NOT NULL,
+    quantidade INTEGER NOT NULL CHECK (quantidade > 0),
+    subtotal NUMERIC NOT NULL,
+    PRIMARY KEY (pedido_id, posicao)
+);
\ No newline at end of file
@@ -0,0 +1,9 @@
+DROP INDEX produtos_historico_produto_idx;
+CREATE INDEX produtos_historico_produto_idx ON produtos_historico (produto_id, registrado_em);
+DROP INDEX produtos_tenant_preco_id_idx;
+DROP INDEX produtos_tenant_nome_id_idx;
+CREATE INDEX produtos_nome_id_idx ON produtos (nome, id);
+CREATE INDEX produtos_preco_id_idx ON produtos (preco, id);
+
+ALTER TABLE produtos_historico DROP COLUMN tenant_id;
+ALTER TABLE produtos DROP COLUMN tenant_id;
\ No newline at end of file
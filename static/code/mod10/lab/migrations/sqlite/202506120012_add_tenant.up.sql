@@ -0,0 +1,11 @@
+ALTER TABLE produtos ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'padrao';
+ALTER TABLE produtos_historico ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'padrao';
+
+-- Toda consulta de produtos filtra pelo tenant, então ele abre os índices
+-- da listagem e do histórico.
+DROP INDEX produtos_nome_id_idx;
+DROP INDEX produtos_preco_id_idx;
+CREATE INDEX produtos_tenant_nome_id_idx ON produtos (tenant_id, nome, id);
+CREATE INDEX produtos_tenant_preco_id_idx ON produtos (tenant_id, preco, id);
+DROP INDEX produtos_historico_produto_idx;
+CREATE INDEX produtos_historico_produto_idx ON produtos_historico (produto_id, tenant_id, registrado_em);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE variantes;
+DROP TABLE grades;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE produtos_precos;
\ No newline at end of file
@@ -0,0 +1,31 @@
+CREATE TABLE produtos_precos (
+    id TEXT PRIMARY KEY,
+    produto_id TEXT NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    tenant_id TEXT NOT NULL,
+    preco NUMERIC NOT NULL CHECK (preco >= 0),
+    vigente_de DATETIME NOT NULL,
+    vigente_ate DATETIME,
+    agendado BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX produtos_precos_produto_idx ON produtos_precos (produto_id, tenant_id, vigente_de);
+CREATE INDEX produtos_precos_agendados_idx ON produtos_precos (vigente_de) WHERE agendado;
+
+-- A linha do tempo dos produtos existentes sai do histórico: cada entrada que
+-- mudou o preço abre um período, com o ID da entrada, fechado pela seguinte.
+-- Produtos sem mudança de preço registrada começam um período agora, com o
+-- ID do próprio produto.
+INSERT INTO produtos_precos (id, produto_id, tenant_id, preco, vigente_de, vigente_ate)
+    SELECT id, produto_id, tenant_id, preco, registrado_em,
+           LEAD(registrado_em) OVER (PARTITION BY produto_id ORDER BY registrado_em, id)
+    FROM (
+        SELECT h.id, h.produto_id, h.tenant_id, CAST(json_extract(h.depois, '$.preco') AS NUMERIC) AS preco, h.registrado_em
+        FROM produtos_historico h
+        JOIN produtos p ON p.id = h.produto_id
+        WHERE h.depois IS NOT NULL
+          AND (h.antes IS NULL OR CAST(json_extract(h.antes, '$.preco') AS NUMERIC) <> CAST(json_extract(h.depois, '$.preco') AS NUMERIC))
+    ) mudancas;
+INSERT INTO produtos_precos (id, produto_id, tenant_id, preco, vigente_de)
+    SELECT id, id, tenant_id, preco, CURRENT_TIMESTAMP
+    FROM produtos p
+    WHERE NOT EXISTS (SELECT 1 FROM produtos_precos pp WHERE pp.produto_id = p.id);
\ No newline at end of file
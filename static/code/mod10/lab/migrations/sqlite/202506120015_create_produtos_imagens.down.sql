@@ -0,0 +1 @@
+DROP TABLE produtos_imagens;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Os arquivos das imagens ficam no armazenamento de blobs; a tabela guarda
+-- os metadados, e o expurgo do produto leva as linhas junto.
+CREATE TABLE produtos_imagens (
+    id TEXT PRIMARY KEY,
+    produto_id TEXT NOT NULL REFERENCES produtos (id) ON DELETE CASCADE,
+    tenant_id TEXT NOT NULL,
+    tipo_conteudo TEXT NOT NULL,
+    tamanho INTEGER NOT NULL CHECK (tamanho > 0),
+    largura INTEGER NOT NULL CHECK (largura > 0),
+    altura INTEGER NOT NULL CHECK (altura > 0),
+    criada_em DATETIME NOT NULL
+);
+
+CREATE INDEX produtos_imagens_produto_idx ON produtos_imagens (produto_id, tenant_id, criada_em);
\ No newline at end of file
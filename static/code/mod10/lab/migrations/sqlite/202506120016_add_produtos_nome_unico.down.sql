@@ -0,0 +1 @@
+DROP INDEX produtos_tenant_nome_unico_idx;
\ No newline at end of file
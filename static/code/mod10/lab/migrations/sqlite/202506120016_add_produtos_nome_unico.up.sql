@@ -0,0 +1,17 @@
+-- Os produtos ativos de um tenant têm nomes únicos, sem distinção entre
+-- maiúsculas e minúsculas; os removidos não ocupam o nome. O lower() do
+-- SQLite só converte letras ASCII. Numa base que já tem nomes repetidos, o
+-- produto de menor ID de cada grupo fica com o nome e os demais ganham o
+-- próprio ID como sufixo e uma nova versão, para que o índice possa ser
+-- criado.
+WITH repetidos AS (
+    SELECT id, row_number() OVER (PARTITION BY tenant_id, lower(nome) ORDER BY id) AS posicao
+    FROM produtos
+    WHERE deleted_at IS NULL
+)
+UPDATE produtos
+SET nome = substr(produtos.nome, 1, 216) || ' (' || produtos.id || ')', versao = produtos.versao + 1
+FROM repetidos
+WHERE produtos.id = repetidos.id AND repetidos.posicao > 1;
+
+CREATE UNIQUE INDEX produtos_tenant_nome_unico_idx ON produtos (tenant_id, lower(nome)) WHERE deleted_at IS NULL;
\ No newline at end of file
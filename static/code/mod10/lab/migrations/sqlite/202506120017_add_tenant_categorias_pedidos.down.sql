@@ -0,0 +1,7 @@
+DROP INDEX pedidos_tenant_criado_em_idx;
+CREATE INDEX pedidos_criado_em_idx ON pedidos (criado_em DESC, id DESC);
+DROP INDEX categorias_tenant_idx;
+
+ALTER TABLE pedidos DROP COLUMN tenant_id;
+ALTER TABLE reservas DROP COLUMN tenant_id;
+ALTER TABLE categorias DROP COLUMN tenant_id;
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE categorias ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'padrao';
+ALTER TABLE reservas ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'padrao';
+ALTER TABLE pedidos ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'padrao';
+
+-- Categorias e pedidos são listados por tenant, então ele abre os índices
+-- das listagens.
+CREATE INDEX categorias_tenant_idx ON categorias (tenant_id);
+DROP INDEX pedidos_criado_em_idx;
+CREATE INDEX pedidos_tenant_criado_em_idx ON pedidos (tenant_id, criado_em DESC, id DESC);
\ No newline at end of file
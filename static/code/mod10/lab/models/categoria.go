@@ -0,0 +1,19 @@
+package models
+
+import "github.com/google/uuid"
+
+// Categoria agrupa produtos numa árvore: PaiID é nulo nas categorias raiz.
+// Um produto pode pertencer a várias categorias. A árvore inteira pertence
+// ao mesmo tenant.
+type Categoria struct {
+	ID       uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	TenantID string     `json:"tenant_id" gorm:"not null"`
+	Nome     string     `json:"nome" gorm:"not null" binding:"required,min=2"`
+	PaiID    *uuid.UUID `json:"pai_id" gorm:"type:uuid"`
+}
+
+// TableName define o nome da tabela de categorias, que o GORM deixaria no
+// singular.
+func (Categoria) TableName() string {
+	return "categorias"
+}
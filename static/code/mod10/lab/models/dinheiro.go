@@ -0,0 +1,190 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MoedaPadrao é a moeda (ISO 4217) do catálogo, que tem uma só: a coluna
+// NUMERIC(12,2) e o JSON guardam apenas o valor, e todo Dinheiro, inclusive
+// o zerado, está nessa moeda.
+const MoedaPadrao = "BRL"
+
+// digitosInteiros é a quantidade máxima de dígitos antes da vírgula em
+// NUMERIC(12,2).
+const digitosInteiros = 10
+
+// centavosMaximos é o maior valor absoluto, em centavos, que cabe em
+// NUMERIC(12,2).
+const centavosMaximos = 999_999_999_999
+
+var (
+	ErrPrecoInvalido          = errors.New("preço não pode ser negativo")
+	ErrValorMonetarioInvalido = errors.New("valor monetário inválido")
+)
+
+// Dinheiro representa um valor monetário exato em centavos (unidades menores
+// de MoedaPadrao), evitando os erros de arredondamento de float64. Em JSON é
+// uma string decimal como "999.99"; no banco é um NUMERIC(12,2).
+type Dinheiro struct {
+	Centavos int64
+}
+
+// Centavos cria um valor a partir de unidades menores.
+func Centavos(centavos int64) Dinheiro {
+	return Dinheiro{Centavos: centavos}
+}
+
+// Moeda retorna a moeda do valor, sempre MoedaPadrao.
+func (d Dinheiro) Moeda() string {
+	return MoedaPadrao
+}
+
+// ParseDinheiro interpreta uma string decimal com até duas casas, como
+// "999.99", "-1" ou "10.5".
+func ParseDinheiro(s string) (Dinheiro, error) {
+	texto := strings.TrimSpace(s)
+
+	negativo := strings.HasPrefix(texto, "-")
+	if negativo || strings.HasPrefix(texto, "+") {
+		texto = texto[1:]
+	}
+
+	inteiro, fracao, _ := strings.Cut(texto, ".")
+	if inteiro == "" || len(fracao) > 2 || !apenasDigitos(inteiro) || !apenasDigitos(fracao) {
+		return Dinheiro{}, fmt.Errorf("%q: %w", s, ErrValorMonetarioInvalido)
+	}
+
+	inteiro = strings.TrimLeft(inteiro, "0")
+	if len(inteiro) > digitosInteiros {
+		return Dinheiro{}, fmt.Errorf("%q excede NUMERIC(12,2): %w", s, ErrValorMonetarioInvalido)
+	}
+
+	centavos, _ := strconv.ParseInt(inteiro+(fracao + "00")[:2], 10, 64)
+	if negativo {
+		centavos = -centavos
+	}
+	return Centavos(centavos), nil
+}
+
+func apenasDigitos(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formata o valor com duas casas decimais, sem a moeda.
+func (d Dinheiro) String() string {
+	sinal, centavos := "", d.Centavos
+	if centavos < 0 {
+		sinal, centavos = "-", -centavos
+	}
+	return fmt.Sprintf("%s%d.%02d", sinal, centavos/100, centavos%100)
+}
+
+// Validar rejeita preços negativos com ErrPrecoInvalido.
+func (d Dinheiro) Validar() error {
+	if d.Centavos < 0 {
+		return fmt.Errorf("preço %s: %w", d, ErrPrecoInvalido)
+	}
+	return nil
+}
+
+// Somar adiciona dois valores, recusando com ErrValorMonetarioInvalido um
+// resultado que não caiba em NUMERIC(12,2).
+func (d Dinheiro) Somar(outro Dinheiro) (Dinheiro, error) {
+	soma := d.Centavos + outro.Centavos
+	if soma > centavosMaximos || soma < -centavosMaximos {
+		return Dinheiro{}, fmt.Errorf("somar %s com %s excede NUMERIC(12,2): %w", d, outro, ErrValorMonetarioInvalido)
+	}
+	return Centavos(soma), nil
+}
+
+// Multiplicar multiplica o valor por uma quantidade, como no subtotal de um
+// item, recusando como Somar um resultado que não caiba em NUMERIC(12,2).
+func (d Dinheiro) Multiplicar(quantidade int) (Dinheiro, error) {
+	if quantidade != 0 && abs(d.Centavos) > centavosMaximos/abs(int64(quantidade)) {
+		return Dinheiro{}, fmt.Errorf("multiplicar %s por %d excede NUMERIC(12,2): %w", d, quantidade, ErrValorMonetarioInvalido)
+	}
+	return Centavos(d.Centavos * int64(quantidade)), nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// MarshalJSON escreve o valor como string decimal.
+func (d Dinheiro) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON aceita uma string decimal ou um número JSON, lido a partir do
+// texto original para não passar por float64.
+func (d *Dinheiro) UnmarshalJSON(dados []byte) error {
+	texto := string(dados)
+	if texto == "null" {
+		return nil
+	}
+	if strings.HasPrefix(texto, `"`) {
+		if err := json.Unmarshal(dados, &texto); err != nil {
+			return fmt.Errorf("%s: %w", dados, ErrValorMonetarioInvalido)
+		}
+	}
+
+	valor, err := ParseDinheiro(texto)
+	if err != nil {
+		return err
+	}
+	*d = valor
+	return nil
+}
+
+// UnmarshalParam permite usar Dinheiro em parâmetros de query do Gin.
+func (d *Dinheiro) UnmarshalParam(param string) error {
+	valor, err := ParseDinheiro(param)
+	if err != nil {
+		return err
+	}
+	*d = valor
+	return nil
+}
+
+// Value grava o valor como decimal exato para a coluna NUMERIC(12,2).
+func (d Dinheiro) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan lê um NUMERIC do banco.
+func (d *Dinheiro) Scan(origem any) error {
+	var texto string
+	switch v := origem.(type) {
+	case string:
+		texto = v
+	case []byte:
+		texto = string(v)
+	case int64:
+		*d = Centavos(v * 100)
+		return nil
+	case float64:
+		texto = strconv.FormatFloat(v, 'f', 2, 64)
+	default:
+		return fmt.Errorf("ler %T como dinheiro: %w", origem, ErrValorMonetarioInvalido)
+	}
+
+	valor, err := ParseDinheiro(texto)
+	if err != nil {
+		return err
+	}
+	*d = valor
+	return nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDinheiro(t *testing.T) {
+	t.Run("Interpretar strings decimais", func(t *testing.T) {
+		casos := map[string]int64{
+			"999.99": 99999,
+			"10.5":   1050,
+			"10":     1000,
+			"-1":     -100,
+			"0.01":   1,
+		}
+		for texto, centavos := range casos {
+			d, err := ParseDinheiro(texto)
+			assert.NoError(t, err, texto)
+			assert.Equal(t, Centavos(centavos), d, texto)
+		}
+	})
+
+	t.Run("Rejeitar valores inválidos", func(t *testing.T) {
+		for _, texto := range []string{"", "abc", "1.999", "1e3", ".5", "12345678901.00"} {
+			_, err := ParseDinheiro(texto)
+			assert.ErrorIs(t, err, ErrValorMonetarioInvalido, texto)
+		}
+	})
+
+	t.Run("Formatar com duas casas", func(t *testing.T) {
+		assert.Equal(t, "999.99", Centavos(99999).String())
+		assert.Equal(t, "-0.05", Centavos(-5).String())
+	})
+
+	t.Run("Somar sem perder precisão", func(t *testing.T) {
+		total := Centavos(0)
+		for i := 0; i < 1000; i++ {
+			var err error
+			total, err = total.Somar(Centavos(99999))
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, "999990.00", total.String())
+
+		_, err := Centavos(999999999999).Somar(Centavos(1))
+		assert.ErrorIs(t, err, ErrValorMonetarioInvalido)
+	})
+
+	t.Run("Valor zerado está na moeda padrão", func(t *testing.T) {
+		var zero Dinheiro
+		assert.Equal(t, MoedaPadrao, zero.Moeda())
+
+		soma, err := zero.Somar(Centavos(99999))
+		assert.NoError(t, err)
+		assert.Equal(t, Centavos(99999), soma)
+	})
+
+	t.Run("Multiplicar por quantidade", func(t *testing.T) {
+		subtotal, err := Centavos(1999).Multiplicar(3)
+		assert.NoError(t, err)
+		assert.Equal(t, Centavos(5997), subtotal)
+
+		_, err = Centavos(100000000000).Multiplicar(10)
+		assert.ErrorIs(t, err, ErrValorMonetarioInvalido)
+	})
+
+	t.Run("Validar preço negativo", func(t *testing.T) {
+		assert.NoError(t, Centavos(0).Validar())
+		assert.ErrorIs(t, Centavos(-1).Validar(), ErrPrecoInvalido)
+	})
+
+	t.Run("Serializar em JSON como string", func(t *testing.T) {
+		dados, err := json.Marshal(Produto{Nome: "Laptop", Preco: Centavos(99999)})
+		assert.NoError(t, err)
+		assert.Contains(t, string(dados), `"preco":"999.99"`)
+
+		var p Produto
+		assert.NoError(t, json.Unmarshal([]byte(`{"nome":"Laptop","preco":"1299.99"}`), &p))
+		assert.Equal(t, Centavos(129999), p.Preco)
+
+		assert.NoError(t, json.Unmarshal([]byte(`{"nome":"Laptop","preco":999.99}`), &p))
+		assert.Equal(t, Centavos(99999), p.Preco)
+	})
+
+	t.Run("Ler NUMERIC do banco", func(t *testing.T) {
+		var d Dinheiro
+		assert.NoError(t, d.Scan([]byte("999.99")))
+		assert.Equal(t, Centavos(99999), d)
+
+		valor, err := Centavos(99999).Value()
+		assert.NoError(t, err)
+		assert.Equal(t, "999.99", valor)
+	})
+}
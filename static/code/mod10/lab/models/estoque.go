@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Estoque é a posição de estoque de um produto. Quantidade é o que há em
+// mãos e Reservado a parte dela comprometida com reservas pendentes; só a
+// diferença pode ser reservada.
+type Estoque struct {
+	ProdutoID  uuid.UUID `json:"produto_id" gorm:"type:uuid;primaryKey"`
+	Quantidade int       `json:"quantidade" gorm:"not null"`
+	Reservado  int       `json:"reservado" gorm:"not null"`
+}
+
+// Disponivel retorna quanto do estoque ainda pode ser reservado.
+func (e Estoque) Disponivel() int {
+	return e.Quantidade - e.Reservado
+}
+
+// Reserva separa uma quantidade do estoque de um produto até ser confirmada,
+// liberada ou expirar. Status é um dos repo.StatusReserva.
+type Reserva struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ProdutoID  uuid.UUID `json:"produto_id" gorm:"type:uuid;not null"`
+	TenantID   string    `json:"tenant_id" gorm:"not null"`
+	Quantidade int       `json:"quantidade" gorm:"not null"`
+	Status     string    `json:"status" gorm:"not null"`
+	CriadaEm   time.Time `json:"criada_em" gorm:"not null"`
+	ExpiraEm   time.Time `json:"expira_em" gorm:"not null"`
+}
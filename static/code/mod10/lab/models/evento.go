@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventoProduto é um evento de domínio gravado na tabela outbox na mesma
+// transação da alteração que o gerou. ID é a chave de deduplicação: o relay
+// entrega cada evento pelo menos uma vez, então consumidores devem ignorar
+// IDs já vistos. Seq define a ordem de publicação; os demais campos sem JSON
+// controlam as tentativas do relay.
+type EventoProduto struct {
+	Seq         int64      `json:"seq" gorm:"primaryKey;autoIncrement"`
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;not null;uniqueIndex"`
+	Tipo        string     `json:"tipo" gorm:"not null"`
+	ProdutoID   uuid.UUID  `json:"produto_id" gorm:"type:uuid;not null"`
+	Produto     *Produto   `json:"produto" gorm:"serializer:json"`
+	OcorridoEm  time.Time  `json:"ocorrido_em" gorm:"not null"`
+	PublicadoEm *time.Time `json:"-"`
+	Tentativas  int        `json:"-" gorm:"not null;default:0"`
+	UltimoErro  string     `json:"-" gorm:"not null;default:''"`
+}
+
+// TableName define o nome da tabela de eventos.
+func (EventoProduto) TableName() string {
+	return "outbox"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HistoricoProduto registra uma alteração de produto com o estado antes e
+// depois dela. Antes é nulo na criação. TenantID repete o do produto para
+// que o histórico continue restrito ao tenant depois do expurgo.
+type HistoricoProduto struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ProdutoID    uuid.UUID `json:"produto_id" gorm:"type:uuid;not null"`
+	TenantID     string    `json:"tenant_id" gorm:"not null"`
+	Operacao     string    `json:"operacao" gorm:"not null"`
+	Antes        *Produto  `json:"antes" gorm:"serializer:json"`
+	Depois       *Produto  `json:"depois" gorm:"serializer:json"`
+	Autor        string    `json:"autor" gorm:"not null"`
+	RegistradoEm time.Time `json:"registrado_em" gorm:"not null"`
+}
+
+// TableName define o nome da tabela do histórico.
+func (HistoricoProduto) TableName() string {
+	return "produtos_historico"
+}
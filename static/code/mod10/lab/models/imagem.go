@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Imagem descreve uma imagem de um produto. Os arquivos, o original e a
+// miniatura, ficam no armazenamento de blobs; o banco guarda só os
+// metadados. Largura e Altura são as do original. URL e MiniaturaURL são
+// preenchidas pela API na leitura.
+type Imagem struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ProdutoID    uuid.UUID `json:"produto_id" gorm:"type:uuid;not null"`
+	TenantID     string    `json:"tenant_id" gorm:"not null"`
+	TipoConteudo string    `json:"tipo_conteudo" gorm:"not null"`
+	Tamanho      int64     `json:"tamanho" gorm:"not null"`
+	Largura      int       `json:"largura" gorm:"not null"`
+	Altura       int       `json:"altura" gorm:"not null"`
+	CriadaEm     time.Time `json:"criada_em" gorm:"not null"`
+	URL          string    `json:"url" gorm:"-"`
+	MiniaturaURL string    `json:"miniatura_url" gorm:"-"`
+}
+
+// TableName define o nome da tabela de imagens.
+func (Imagem) TableName() string {
+	return "produtos_imagens"
+}
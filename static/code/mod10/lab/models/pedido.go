@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Pedido é um pedido de compra. Total é calculado pelo repositório a partir
+// dos itens, e Status é um dos repo.StatusPedido.
+type Pedido struct {
+	ID           uuid.UUID    `json:"id" gorm:"type:uuid;primaryKey"`
+	TenantID     string       `json:"tenant_id" gorm:"not null"`
+	Status       string       `json:"status" gorm:"not null"`
+	Itens        []ItemPedido `json:"itens" gorm:"foreignKey:PedidoID"`
+	Total        Dinheiro     `json:"total" gorm:"type:numeric(12,2);not null"`
+	CriadoEm     time.Time    `json:"criado_em" gorm:"not null"`
+	AtualizadoEm time.Time    `json:"atualizado_em" gorm:"not null"`
+}
+
+// ItemPedido é uma linha do pedido. Nome e PrecoUnitario são copiados do
+// produto na criação do pedido e não acompanham alterações posteriores.
+type ItemPedido struct {
+	PedidoID      uuid.UUID `json:"-" gorm:"type:uuid;primaryKey"`
+	Posicao       int       `json:"-" gorm:"primaryKey"`
+	ProdutoID     uuid.UUID `json:"produto_id" gorm:"type:uuid;not null"`
+	Nome          string    `json:"nome" gorm:"not null"`
+	PrecoUnitario Dinheiro  `json:"preco_unitario" gorm:"type:numeric(12,2);not null"`
+	Quantidade    int       `json:"quantidade" gorm:"not null"`
+	Subtotal      Dinheiro  `json:"subtotal" gorm:"type:numeric(12,2);not null"`
+}
+
+// TableName define o nome da tabela dos itens.
+func (ItemPedido) TableName() string {
+	return "pedido_itens"
+}
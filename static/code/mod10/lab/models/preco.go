@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PrecoProduto é um período da linha do tempo de preços de um produto.
+// VigenteAte é nulo no período em vigor, que é o único aberto. Agendado
+// marca um preço futuro, que entra em vigor quando o agendador o aplica;
+// até lá VigenteDe é o instante pedido e VigenteAte fica nulo. TenantID
+// repete o do produto, como no histórico.
+type PrecoProduto struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	ProdutoID  uuid.UUID  `json:"produto_id" gorm:"type:uuid;not null"`
+	TenantID   string     `json:"tenant_id" gorm:"not null"`
+	Preco      Dinheiro   `json:"preco" gorm:"type:numeric(12,2);not null"`
+	VigenteDe  time.Time  `json:"vigente_de" gorm:"not null"`
+	VigenteAte *time.Time `json:"vigente_ate"`
+	Agendado   bool       `json:"agendado" gorm:"not null"`
+}
+
+// TableName define o nome da tabela de preços.
+func (PrecoProduto) TableName() string {
+	return "produtos_precos"
+}
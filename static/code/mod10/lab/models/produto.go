@@ -5,15 +5,27 @@ import (
 	"gorm.io/gorm"
 )
 
-// Produto representa um produto no sistema.
+// Produto representa um produto no sistema. TenantID é o cliente dono do
+// produto; os repositórios só o expõem às operações desse tenant. Versao é
+// incrementada a cada atualização e usada no controle de concorrência
+// otimista. RemovidoEm marca a exclusão lógica: produtos removidos ficam
+// ocultos até serem restaurados ou expurgados. Imagens não é gravada com o
+// produto; a API a preenche na leitura.
 type Produto struct {
-	ID    uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
-	Nome  string    `json:"nome" gorm:"not null" binding:"required,min=3"`
-	Preco float64   `json:"preco" gorm:"not null" binding:"required,gt=0"`
+	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey"`
+	TenantID   string         `json:"tenant_id" gorm:"not null"`
+	Nome       string         `json:"nome" gorm:"not null" binding:"required,min=3"`
+	Preco      Dinheiro       `json:"preco" gorm:"type:numeric(12,2);not null" binding:"required,gt=0"`
+	Versao     int            `json:"versao" gorm:"not null;default:1"`
+	RemovidoEm gorm.DeletedAt `json:"removido_em" gorm:"column:deleted_at;index"`
+	Imagens    []Imagem       `json:"imagens,omitempty" gorm:"-"`
 }
 
-// BeforeCreate gera um UUID antes de salvar no banco.
+// BeforeCreate gera um UUID antes de salvar no banco, se o produto ainda
+// não tiver um.
 func (p *Produto) BeforeCreate(tx *gorm.DB) error {
-	p.ID = uuid.New()
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
 	return nil
 }
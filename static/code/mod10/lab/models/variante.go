@@ -0,0 +1,32 @@
+package models
+
+import "github.com/google/uuid"
+
+// EixoVariante é um eixo de opções de um produto com variantes, como
+// Tamanho ou Cor, com os valores que ele admite na ordem de exibição.
+type EixoVariante struct {
+	Nome    string   `json:"nome" binding:"required"`
+	Valores []string `json:"valores" binding:"required,min=1"`
+}
+
+// Grade reúne os eixos de opções de um produto pai e as variantes criadas
+// sobre eles. Só os eixos são gravados; Variantes é preenchida na leitura.
+type Grade struct {
+	ProdutoID uuid.UUID      `json:"produto_id" gorm:"type:uuid;primaryKey"`
+	Eixos     []EixoVariante `json:"eixos" gorm:"serializer:json;not null"`
+	Variantes []Variante     `json:"variantes" gorm:"-"`
+}
+
+// Variante liga um SKU ao produto pai. O SKU é um produto como os outros,
+// com preço, estoque e pedidos próprios, todos pelo ProdutoID. Opcoes traz
+// um valor para cada eixo do pai, e nenhuma outra variante do mesmo pai tem
+// a mesma combinação; SKU é único entre as variantes do tenant. Produto é
+// preenchido na leitura.
+type Variante struct {
+	ProdutoID uuid.UUID         `json:"produto_id" gorm:"type:uuid;primaryKey"`
+	PaiID     uuid.UUID         `json:"pai_id" gorm:"type:uuid;not null"`
+	TenantID  string            `json:"tenant_id" gorm:"not null"`
+	SKU       string            `json:"sku" gorm:"column:sku;not null"`
+	Opcoes    map[string]string `json:"opcoes" gorm:"serializer:json;not null"`
+	Produto   *Produto          `json:"produto,omitempty" gorm:"-"`
+}